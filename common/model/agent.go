@@ -10,6 +10,8 @@ type Agent struct {
 	ModelID      uint   `json:"modelId"`
 	Model        AIModel `json:"-"`
 	Tools        []Tool  `json:"tools" gorm:"many2many:agent_tools;"`
+	ToolPolicy   string  `json:"toolPolicy" gorm:"type:text"` // JSON AgentToolPolicy
+	RepoMapTokens int    `json:"repoMapTokens"`               // budget of the repository map injected into the system prompt, 0 = off
 	MCPServers   []MCPServer `json:"mcpServers" gorm:"many2many:agent_mcp_servers;"`
 	ExternalURL  string `json:"externalUrl"`
 	ExternalType string `json:"externalType"`
@@ -19,4 +21,6 @@ type Agent struct {
 	ConfigSchema   string `json:"configSchema" gorm:"type:text"`   // JSON Schema for agent-specific config
 	MemoryPolicy   string `json:"memoryPolicy" gorm:"type:text"`   // JSON for memory retention/sharing policy
 	LastHeartbeat  int64  `json:"lastHeartbeat"`
+
+	EffectiveTools []EffectiveTool `json:"effectiveTools,omitempty" gorm:"-"` // computed, see ToolService.EffectiveTools
 }
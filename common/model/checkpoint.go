@@ -0,0 +1,16 @@
+package model
+
+// FileCheckpoint is the content of a file right before a tool modified it.
+// A turn is identified by the user message that started it (MessageID).
+type FileCheckpoint struct {
+	Base
+	SessionID  uint   `json:"sessionId" gorm:"index"`
+	MessageID  uint   `json:"messageId" gorm:"index"`
+	ToolCallID string `json:"toolCallId" gorm:"index"`
+	ToolName   string `json:"toolName"`
+	Path       string `json:"path" gorm:"index"` // absolute path
+	RelPath    string `json:"relPath"`           // path relative to the project root, for display
+	Existed    bool   `json:"existed"`           // false if the tool created the file
+	Content    string `json:"-" gorm:"type:longtext"`
+	Reverted   bool   `json:"reverted"`
+}
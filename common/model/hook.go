@@ -1,13 +1,106 @@
 package model
 
+// Hook events.
+const (
+	HookPreChat              = "pre_chat"
+	HookPostChat             = "post_chat"
+	HookPreTool              = "pre_tool"
+	HookPostTool             = "post_tool"
+	HookSessionCreated       = "session_created"
+	HookSessionDeleted       = "session_deleted"
+	HookMessageSaved         = "message_saved"
+	HookError                = "error"
+	HookSubAgentStart        = "subagent_start"
+	HookSubAgentFinish       = "subagent_finish"
+	HookWorkflowStart        = "workflow_start"
+	HookWorkflowTaskComplete = "workflow_task_complete"
+	HookWorkflowFinish       = "workflow_finish"
+	HookModelFallback        = "model_fallback"
+	HookIndexComplete        = "index_complete"
+)
+
+// HookEvent describes an event hooks can run on and the fields of its data.
+type HookEvent struct {
+	Type     string   `json:"type"`
+	Desc     string   `json:"desc"`
+	Blocking bool     `json:"blocking,omitempty"` // hooks run before the event and may deny it
+	Fields   []string `json:"fields"`
+}
+
+// HookEvents is the catalog of hook events.
+var HookEvents = []HookEvent{
+	{Type: HookPreChat, Desc: "对话开始前，可拒绝或改写用户消息", Blocking: true, Fields: []string{"sessionId", "projectId", "agentName", "mode", "userMessage"}},
+	{Type: HookPostChat, Desc: "对话结束后", Fields: []string{"sessionId", "projectId", "agentName", "mode", "userMessage", "response", "durationMs"}},
+	{Type: HookPreTool, Desc: "工具调用前，可拒绝或改写参数", Blocking: true, Fields: []string{"sessionId", "projectId", "agentName", "mode", "toolName", "arguments"}},
+	{Type: HookPostTool, Desc: "工具调用后，可改写结果", Fields: []string{"sessionId", "projectId", "agentName", "mode", "toolName", "arguments", "result", "error", "durationMs"}},
+	{Type: HookSessionCreated, Desc: "会话创建", Fields: []string{"sessionId", "projectId", "agentId", "mode", "name"}},
+	{Type: HookSessionDeleted, Desc: "会话删除", Fields: []string{"sessionId", "projectId", "name"}},
+	{Type: HookMessageSaved, Desc: "消息保存", Fields: []string{"sessionId", "projectId", "messageId", "role", "content"}},
+	{Type: HookError, Desc: "对话出错", Fields: []string{"sessionId", "projectId", "agentName", "mode", "error"}},
+	{Type: HookSubAgentStart, Desc: "子智能体开始", Fields: []string{"sessionId", "projectId", "agentName", "mode", "query", "depth"}},
+	{Type: HookSubAgentFinish, Desc: "子智能体结束", Fields: []string{"sessionId", "projectId", "agentName", "mode", "query", "depth", "result", "error", "durationMs"}},
+	{Type: HookWorkflowStart, Desc: "工作流开始", Fields: []string{"sessionId", "projectId", "goal", "tasks"}},
+	{Type: HookWorkflowTaskComplete, Desc: "工作流任务完成或失败", Fields: []string{"sessionId", "projectId", "workflowId", "taskId", "title", "status", "output", "error", "durationMs"}},
+	{Type: HookWorkflowFinish, Desc: "工作流结束", Fields: []string{"sessionId", "projectId", "workflowId", "goal", "status", "result", "error", "durationMs"}},
+	{Type: HookModelFallback, Desc: "智能体的模型不可用，改用默认模型", Fields: []string{"sessionId", "projectId", "agentName", "modelId", "fallbackModel", "error"}},
+	{Type: HookIndexComplete, Desc: "项目代码索引完成", Fields: []string{"projectId", "files", "full", "added", "updated", "removed", "durationMs"}},
+}
+
+// IsHookEvent reports whether t is an event of the catalog.
+func IsHookEvent(t string) bool {
+	for _, e := range HookEvents {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlockingHookEvent reports whether hooks of event t run before it and may
+// deny it.
+func IsBlockingHookEvent(t string) bool {
+	for _, e := range HookEvents {
+		if e.Type == t {
+			return e.Blocking
+		}
+	}
+	return false
+}
+
+// Actions of a HookDecision.
+const (
+	HookAllow  = "allow"
+	HookDeny   = "deny"
+	HookModify = "modify"
+)
+
 type Hook struct {
 	Base
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Type        string `json:"type"`       // e.g., "pre_run", "post_run", "pre_tool", "post_tool"
-	TargetType  string `json:"targetType"` // e.g., "agent", "global"
-	TargetID    uint   `json:"targetId"`   // Agent ID if targetType is agent
-	Action      string `json:"action"`     // e.g., "script", "http"
-	Content     string `json:"content"`    // Script content or URL
-	Enabled     bool   `json:"enabled" gorm:"default:true"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Type         string `json:"type"`       // event, see HookEvents
+	TargetType   string `json:"targetType"` // e.g., "agent", "global"
+	TargetID     uint   `json:"targetId"`   // Agent ID if targetType is agent
+	Action       string `json:"action"`     // e.g., "script", "http"
+	Content      string `json:"content"`    // Script content or URL
+	Enabled      bool   `json:"enabled" gorm:"default:true"`
+	Capabilities string `json:"capabilities" gorm:"type:text"` // JSON ScriptCapabilities for script hooks
+	// FailClosed makes a failing pre hook deny the event instead of being
+	// skipped, for policy hooks that mustn't be bypassed by an error.
+	FailClosed bool `json:"failClosed"`
+
+	// Filters: the hook only runs on events that match all of them
+	ToolPattern   string `json:"toolPattern"`   // regexp the toolName must match
+	ProjectID     uint   `json:"projectId"`     // event's projectId
+	Mode          string `json:"mode"`          // event's mode
+	MinDurationMs int64  `json:"minDurationMs"` // event's durationMs at least
+}
+
+// HookDecision is what a script hook returns or an http hook responds with.
+// Pre hooks may deny the event; pre_chat, pre_tool and post_tool hooks may
+// rewrite the userMessage, arguments and result fields through Payload.
+type HookDecision struct {
+	Action  string         `json:"action"`            // allow (default), deny or modify
+	Reason  string         `json:"reason,omitempty"`  // why it was denied, shown to the user or model
+	Payload map[string]any `json:"payload,omitempty"` // event fields to replace
 }
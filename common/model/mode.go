@@ -1,9 +1,152 @@
 package model
 
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Mode is a named set of behaviors an agent runs under. A mode may inherit
+// from another mode through ParentKey; see ResolveMode for how settings are
+// combined.
 type Mode struct {
 	Base
 	Key          string `json:"key" gorm:"uniqueIndex"` // chat, plan, build
 	Name         string `json:"name"`
 	Description  string `json:"description"`
 	SystemPrompt string `json:"systemPrompt"`
+	ParentKey    string `json:"parentKey"`                     // mode to inherit settings from
+	Instructions string `json:"instructions" gorm:"type:text"` // appended to the agent's system prompt
+	PathPolicy   string `json:"pathPolicy" gorm:"type:text"`   // JSON PathPolicy
+	ToolPolicy   string `json:"toolPolicy" gorm:"type:text"`   // JSON ModeToolPolicy
+	MaxTurns     int    `json:"maxTurns"`                      // tool loop limit, 0 = inherit / default
+	Orchestrate  *bool  `json:"orchestrate"`                   // run the task planner first, nil = inherit
+	RepoMap      *bool  `json:"repoMap"`                       // inject the repository map into the system prompt, nil = inherit / agent setting
+
+	AllowGitRewrite *bool `json:"allowGitRewrite"` // force-push, amend, reset --hard, rebase ..., nil = inherit (no)
+
+	SeedVersion int `json:"-"` // built-in settings seeded into the row; see seeder.seedModes
+}
+
+// ModeToolPolicy controls the tools offered in a mode. Entries are tool names
+// or globs.
+type ModeToolPolicy struct {
+	Builtins   []string `json:"builtins,omitempty"`   // builtin tools offered; empty = inherit / built-in default
+	Deny       []string `json:"deny,omitempty"`       // never offered, whatever the source
+	Approve    []string `json:"approve,omitempty"`    // need user approval (per session) before running
+	AgentTools *bool    `json:"agentTools,omitempty"` // offer the agent's custom, script and api tools, nil = inherit (yes)
+	MCPTools   *bool    `json:"mcpTools,omitempty"`   // offer the tools of the agent's MCP servers, nil = inherit (yes)
+}
+
+func (p ModeToolPolicy) IsEmpty() bool {
+	return len(p.Builtins) == 0 && len(p.Deny) == 0 && len(p.Approve) == 0 && p.AgentTools == nil && p.MCPTools == nil
+}
+
+// AllowsAgentTools reports whether the agent's own custom/script/api tools
+// are offered.
+func (p ModeToolPolicy) AllowsAgentTools() bool {
+	return p.AgentTools == nil || *p.AgentTools
+}
+
+// AllowsMCPTools reports whether the tools of the agent's MCP servers are
+// offered.
+func (p ModeToolPolicy) AllowsMCPTools() bool {
+	return p.MCPTools == nil || *p.MCPTools
+}
+
+func (m *Mode) GetPathPolicy() (PathPolicy, error) {
+	return parsePathPolicy(m.PathPolicy)
+}
+
+func (m *Mode) SetPathPolicy(policy PathPolicy) error {
+	raw, err := encodePathPolicy(policy)
+	if err != nil {
+		return err
+	}
+	m.PathPolicy = raw
+	return nil
+}
+
+func (m *Mode) GetToolPolicy() (ModeToolPolicy, error) {
+	var p ModeToolPolicy
+	if strings.TrimSpace(m.ToolPolicy) == "" {
+		return p, nil
+	}
+	err := json.Unmarshal([]byte(m.ToolPolicy), &p)
+	return p, err
+}
+
+func (m *Mode) SetToolPolicy(p ModeToolPolicy) error {
+	if p.IsEmpty() {
+		m.ToolPolicy = ""
+		return nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	m.ToolPolicy = string(data)
+	return nil
+}
+
+// OrchestrationEnabled reports whether the task planner runs before chatting.
+func (m *Mode) OrchestrationEnabled() bool {
+	return m != nil && m.Orchestrate != nil && *m.Orchestrate
+}
+
+// ResolveMode combines a mode with its ancestors. chain is ordered from the
+// root ancestor to the mode itself. Identity fields come from the mode
+// itself; Instructions are concatenated; path policy, builtins, MaxTurns,
+// Orchestrate, RepoMap, AllowGitRewrite, AgentTools and MCPTools are taken
+// from the nearest mode that sets them; denied and approval-required tools
+// accumulate.
+func ResolveMode(chain []Mode) *Mode {
+	if len(chain) == 0 {
+		return nil
+	}
+	resolved := chain[len(chain)-1]
+	resolved.Instructions = ""
+	resolved.PathPolicy = ""
+	resolved.MaxTurns = 0
+	resolved.Orchestrate = nil
+	resolved.RepoMap = nil
+	resolved.AllowGitRewrite = nil
+
+	var instructions []string
+	var tools ModeToolPolicy
+	for _, m := range chain {
+		if s := strings.TrimSpace(m.Instructions); s != "" {
+			instructions = append(instructions, s)
+		}
+		if strings.TrimSpace(m.PathPolicy) != "" {
+			resolved.PathPolicy = m.PathPolicy
+		}
+		if m.MaxTurns > 0 {
+			resolved.MaxTurns = m.MaxTurns
+		}
+		if m.Orchestrate != nil {
+			resolved.Orchestrate = m.Orchestrate
+		}
+		if m.RepoMap != nil {
+			resolved.RepoMap = m.RepoMap
+		}
+		if m.AllowGitRewrite != nil {
+			resolved.AllowGitRewrite = m.AllowGitRewrite
+		}
+
+		p, _ := m.GetToolPolicy()
+		if len(p.Builtins) > 0 {
+			tools.Builtins = p.Builtins
+		}
+		if p.AgentTools != nil {
+			tools.AgentTools = p.AgentTools
+		}
+		if p.MCPTools != nil {
+			tools.MCPTools = p.MCPTools
+		}
+		tools.Deny = append(tools.Deny, p.Deny...)
+		tools.Approve = append(tools.Approve, p.Approve...)
+	}
+	resolved.Instructions = strings.Join(instructions, "\n\n")
+	_ = resolved.SetToolPolicy(tools)
+	return &resolved
 }
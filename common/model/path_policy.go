@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PathPolicy restricts which workspace paths tools may touch. Patterns are
+// slash-separated globs relative to the project root; "**" matches any number
+// of directories and a pattern without "/" matches a file or directory name at
+// any depth (e.g. ".env", "*.pem").
+type PathPolicy struct {
+	Readable []string `json:"readable,omitempty"` // if set, reads are only allowed here
+	Writable []string `json:"writable,omitempty"` // if set, writes are only allowed here
+	ReadOnly []string `json:"readOnly,omitempty"` // readable but never writable
+	Denied   []string `json:"denied,omitempty"`   // neither readable nor writable
+}
+
+func (p PathPolicy) IsEmpty() bool {
+	return len(p.Readable) == 0 && len(p.Writable) == 0 && len(p.ReadOnly) == 0 && len(p.Denied) == 0
+}
+
+func parsePathPolicy(raw string) (PathPolicy, error) {
+	var p PathPolicy
+	if strings.TrimSpace(raw) == "" {
+		return p, nil
+	}
+	err := json.Unmarshal([]byte(raw), &p)
+	return p, err
+}
+
+func encodePathPolicy(p PathPolicy) (string, error) {
+	if p.IsEmpty() {
+		return "", nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
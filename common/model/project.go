@@ -5,4 +5,22 @@ type Project struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Path        string `json:"path"`
+	// HttpAllowlist is a JSON array of hosts agents may reach through
+	// http_request/fetch_url, e.g. ["api.github.com", "*.internal.example"].
+	HttpAllowlist string `json:"httpAllowlist" gorm:"type:text"`
+	PathPolicy    string `json:"pathPolicy" gorm:"type:text"` // JSON PathPolicy
+	Settings      string `json:"settings" gorm:"type:text"`   // JSON ProjectSettings
+}
+
+func (p *Project) GetPathPolicy() (PathPolicy, error) {
+	return parsePathPolicy(p.PathPolicy)
+}
+
+func (p *Project) SetPathPolicy(policy PathPolicy) error {
+	raw, err := encodePathPolicy(policy)
+	if err != nil {
+		return err
+	}
+	p.PathPolicy = raw
+	return nil
 }
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ProjectSettings are project-level defaults and restrictions applied to new
+// sessions, the chat loops and the code index.
+type ProjectSettings struct {
+	DefaultAgentID uint              `json:"defaultAgentId,omitempty"` // agent of new sessions
+	DefaultMode    string            `json:"defaultMode,omitempty"`    // mode key of new sessions
+	ModelID        uint              `json:"modelId,omitempty"`        // overrides the agent's model
+	MCPServerIDs   []uint            `json:"mcpServerIds,omitempty"`   // if set, only these of the agent's MCP servers are used
+	CommandPolicy  CommandPolicy     `json:"commandPolicy"`
+	Env            map[string]string `json:"env,omitempty"` // extra environment of run_command
+	IndexInclude   []string          `json:"indexInclude,omitempty"`
+	IndexExclude   []string          `json:"indexExclude,omitempty"`
+}
+
+// CommandPolicy restricts run_command and run_script. Patterns match the
+// program name or its whole argument line, "*" matching any text (e.g. "go",
+// "npm run *", "rm -rf *"). run_command lines run in a shell and are checked
+// command by command ("go test ./... | tail" needs go and tail), wrappers
+// like env or timeout being looked through; the split is best effort and
+// doesn't see into quoted text or expansions. Deny wins over Allow; an empty Allow
+// list allows everything not denied. A script runs whatever it contains, so
+// with an Allow list run_script needs its interpreter allowed (e.g. "python").
+type CommandPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+func (p CommandPolicy) IsEmpty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+func (s ProjectSettings) IsEmpty() bool {
+	return s.DefaultAgentID == 0 && s.DefaultMode == "" && s.ModelID == 0 && s.MCPServerIDs == nil &&
+		s.CommandPolicy.IsEmpty() && len(s.Env) == 0 && len(s.IndexInclude) == 0 && len(s.IndexExclude) == 0
+}
+
+func (p *Project) GetSettings() (ProjectSettings, error) {
+	var s ProjectSettings
+	if strings.TrimSpace(p.Settings) == "" {
+		return s, nil
+	}
+	err := json.Unmarshal([]byte(p.Settings), &s)
+	return s, err
+}
+
+func (p *Project) SetSettings(s ProjectSettings) error {
+	if s.IsEmpty() {
+		p.Settings = ""
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	p.Settings = string(data)
+	return nil
+}
@@ -1,8 +1,16 @@
 package model
 
+// Languages of script content; empty means JavaScript.
+const (
+	ScriptLangJavaScript = "javascript"
+	ScriptLangTypeScript = "typescript"
+)
+
 type Script struct {
 	Base
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Content     string `json:"content"` // JS code
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Content      string `json:"content"`                       // JS or TS code
+	Language     string `json:"language"`                      // javascript (default) or typescript
+	Capabilities string `json:"capabilities" gorm:"type:text"` // JSON ScriptCapabilities
 }
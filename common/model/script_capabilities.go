@@ -0,0 +1,73 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	ScriptFSRead  = "read"
+	ScriptFSWrite = "write"
+)
+
+// ScriptCapabilities declares what a script, a script tool or a hook script
+// may do. The script engine only registers the granted functions; everything
+// else (fs, http, os.exec, os.getenv) is absent from the runtime.
+type ScriptCapabilities struct {
+	FS     string   `json:"fs,omitempty"`     // "read" or "write"; paths are confined to FSBase
+	FSBase string   `json:"fsBase,omitempty"` // absolute, or relative to the project root; default the project root
+	HTTP   []string `json:"http,omitempty"`   // allowed hosts, e.g. "api.github.com", "*.example.com"
+	Exec   []string `json:"exec,omitempty"`   // allowed commands, CommandPolicy patterns
+	Env    []string `json:"env,omitempty"`    // environment variables os.getenv may read
+}
+
+func (c ScriptCapabilities) IsEmpty() bool {
+	return c.FS == "" && c.FSBase == "" && len(c.HTTP) == 0 && len(c.Exec) == 0 && len(c.Env) == 0
+}
+
+func parseScriptCapabilities(raw string) (ScriptCapabilities, error) {
+	var c ScriptCapabilities
+	if strings.TrimSpace(raw) == "" {
+		return c, nil
+	}
+	err := json.Unmarshal([]byte(raw), &c)
+	return c, err
+}
+
+func encodeScriptCapabilities(c ScriptCapabilities) (string, error) {
+	if c.IsEmpty() {
+		return "", nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *Script) GetCapabilities() (ScriptCapabilities, error) {
+	return parseScriptCapabilities(s.Capabilities)
+}
+
+func (s *Script) SetCapabilities(c ScriptCapabilities) (err error) {
+	s.Capabilities, err = encodeScriptCapabilities(c)
+	return err
+}
+
+func (t *Tool) GetCapabilities() (ScriptCapabilities, error) {
+	return parseScriptCapabilities(t.Capabilities)
+}
+
+func (t *Tool) SetCapabilities(c ScriptCapabilities) (err error) {
+	t.Capabilities, err = encodeScriptCapabilities(c)
+	return err
+}
+
+func (h *Hook) GetCapabilities() (ScriptCapabilities, error) {
+	return parseScriptCapabilities(h.Capabilities)
+}
+
+func (h *Hook) SetCapabilities(c ScriptCapabilities) (err error) {
+	h.Capabilities, err = encodeScriptCapabilities(c)
+	return err
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Sources of a script run.
+const (
+	ScriptRunManual = "script" // a stored script run by the user
+	ScriptRunTool   = "tool"   // a script tool called by an agent
+	ScriptRunHook   = "hook"   // a hook script
+)
+
+// Outcomes of a script run.
+const (
+	ScriptRunOK      = "ok"
+	ScriptRunError   = "error"
+	ScriptRunTimeout = "timeout"
+	// ScriptRunCancelled: the session or request that ran it was aborted
+	ScriptRunCancelled = "cancelled"
+)
+
+// ScriptRun records one execution of a script, script tool or hook script.
+type ScriptRun struct {
+	Base
+	Source     string    `json:"source" gorm:"index:idx_script_run_source"`   // script, tool or hook
+	SourceID   uint      `json:"sourceId" gorm:"index:idx_script_run_source"` // script, tool or hook ID
+	Name       string    `json:"name"`
+	SessionID  uint      `json:"sessionId,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	EndedAt    time.Time `json:"endedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Status     string    `json:"status"`
+	Args       string    `json:"args" gorm:"type:text"`    // JSON input (args or hook context)
+	Result     string    `json:"result" gorm:"type:text"`  // JSON return value
+	Error      string    `json:"error" gorm:"type:text"`   // error message
+	Stack      string    `json:"stack" gorm:"type:text"`   // JS stack trace of the error
+	Console    string    `json:"console" gorm:"type:text"` // JSON []ScriptConsoleLine
+}
+
+// ScriptConsoleLine is one console.log/info/warn/error call of a script.
+type ScriptConsoleLine struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"` // log, info, debug, warn or error
+	Text  string    `json:"text"`
+}
+
+func (r *ScriptRun) GetConsole() ([]ScriptConsoleLine, error) {
+	var lines []ScriptConsoleLine
+	if strings.TrimSpace(r.Console) == "" {
+		return lines, nil
+	}
+	err := json.Unmarshal([]byte(r.Console), &lines)
+	return lines, err
+}
+
+func (r *ScriptRun) SetConsole(lines []ScriptConsoleLine) error {
+	if len(lines) == 0 {
+		r.Console = ""
+		return nil
+	}
+	b, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	r.Console = string(b)
+	return nil
+}
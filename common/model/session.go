@@ -7,6 +7,7 @@ type Session struct {
 	Name        string  `json:"name"`
 	AgentID     uint    `json:"agentId"`
 	Agent       Agent   `json:"-"`
+	Mode        string  `json:"mode"` // default mode key, from the project settings
 	Compressed  bool    `json:"compressed"`
 	Summary     string  `json:"summary"`
 }
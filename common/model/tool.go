@@ -7,4 +7,6 @@ type Tool struct {
 	Type        string `json:"type"` // e.g., "script", "api", "function"
 	Content     string `json:"content"` // Script content or API config
 	Parameters  string `json:"parameters"` // JSON schema for parameters
+	Language    string `json:"language"`   // script language of script/custom tools: javascript (default) or typescript
+	Capabilities string `json:"capabilities" gorm:"type:text"` // JSON ScriptCapabilities for script/custom tools
 }
@@ -0,0 +1,9 @@
+package model
+
+// ToolApproval lets a tool (a name or glob) run in a session even though the
+// session's mode requires user approval for it.
+type ToolApproval struct {
+	Base
+	SessionID uint   `json:"sessionId" gorm:"index"`
+	Tool      string `json:"tool"`
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// AgentToolPolicy lets an agent opt in to or out of individual tools. Entries
+// are tool names or globs ("git_*", "mcp__3__*"). Builtins default to what the
+// active mode offers; Enabled adds builtins beyond that. MCP and custom tools
+// are available when their server/tool is attached to the agent. Disabled
+// always wins.
+type AgentToolPolicy struct {
+	Enabled  []string `json:"enabled,omitempty"`
+	Disabled []string `json:"disabled,omitempty"`
+}
+
+// EffectiveTool describes one tool an agent can call.
+type EffectiveTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Source      string `json:"source"` // builtin, mcp, custom, script, api
+}
+
+func (p AgentToolPolicy) IsEmpty() bool {
+	return len(p.Enabled) == 0 && len(p.Disabled) == 0
+}
+
+// Allows reports whether a tool is available given whether it would be
+// available without the policy.
+func (p AgentToolPolicy) Allows(name string, byDefault bool) bool {
+	if MatchToolName(p.Disabled, name) {
+		return false
+	}
+	return byDefault || MatchToolName(p.Enabled, name)
+}
+
+// MatchToolName reports whether name matches any of the patterns (exact
+// names or path.Match globs).
+func MatchToolName(patterns []string, name string) bool {
+	for _, pat := range patterns {
+		pat = strings.TrimSpace(pat)
+		if pat == name {
+			return true
+		}
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Agent) GetToolPolicy() (AgentToolPolicy, error) {
+	var p AgentToolPolicy
+	if strings.TrimSpace(a.ToolPolicy) == "" {
+		return p, nil
+	}
+	err := json.Unmarshal([]byte(a.ToolPolicy), &p)
+	return p, err
+}
+
+func (a *Agent) SetToolPolicy(p AgentToolPolicy) error {
+	if p.IsEmpty() {
+		a.ToolPolicy = ""
+		return nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	a.ToolPolicy = string(data)
+	return nil
+}
@@ -30,6 +30,7 @@ const (
 	ToolTypeBuiltin = "builtin"
 	ToolTypeCustom  = "custom"
 	ToolTypeScript  = "script"
+	ToolTypeAPI     = "api" // declarative HTTP request, see tools.APIToolSpec
 
 	// Message Roles
 	RoleSystem    = "system"
@@ -63,16 +64,29 @@ type IATTool struct {
 }
 
 var (
-	ToolReadFile      IATTool = IATTool{Name: "read_file", Content: "ReadFile", Description: "Read a file", Type: ToolTypeBuiltin}
-	ToolWriteFile     IATTool = IATTool{Name: "write_file", Content: "WriteFile", Description: "Write to a file", Type: ToolTypeBuiltin}
-	ToolListFiles     IATTool = IATTool{Name: "list_files", Content: "ListFiles", Description: "List files in a directory", Type: ToolTypeBuiltin}
-	ToolReadFileRange IATTool = IATTool{Name: "read_file_range", Content: "ReadFileRange", Description: "Read a range of lines from a file", Type: ToolTypeBuiltin}
-	ToolDiffFile      IATTool = IATTool{Name: "diff_file", Content: "DiffFile", Description: "Compare two files", Type: ToolTypeBuiltin}
-	ToolRunCommand    IATTool = IATTool{Name: "run_command", Content: "RunCommand", Description: "Run a shell command", Type: ToolTypeBuiltin}
-	ToolRunScript     IATTool = IATTool{Name: "run_script", Content: "RunScript", Description: "Run a script", Type: ToolTypeBuiltin}
-	ToolHttpGet       IATTool = IATTool{Name: "http_get", Content: "HttpGet", Description: "Perform an HTTP GET request", Type: ToolTypeBuiltin}
-	ToolHttpPost      IATTool = IATTool{Name: "http_post", Content: "HttpPost", Description: "Perform an HTTP POST request", Type: ToolTypeBuiltin}
-	ToolIndexProject  IATTool = IATTool{Name: "index_project", Content: "IndexProject", Description: "Index projects for searching sessions by project name", Type: ToolTypeBuiltin}
+	ToolReadFile       IATTool = IATTool{Name: "read_file", Content: "ReadFile", Description: "Read a file", Type: ToolTypeBuiltin}
+	ToolWriteFile      IATTool = IATTool{Name: "write_file", Content: "WriteFile", Description: "Write to a file", Type: ToolTypeBuiltin}
+	ToolListFiles      IATTool = IATTool{Name: "list_files", Content: "ListFiles", Description: "List files in a directory", Type: ToolTypeBuiltin}
+	ToolReadFileRange  IATTool = IATTool{Name: "read_file_range", Content: "ReadFileRange", Description: "Read a range of lines from a file", Type: ToolTypeBuiltin}
+	ToolDiffFile       IATTool = IATTool{Name: "diff_file", Content: "DiffFile", Description: "Compare two files", Type: ToolTypeBuiltin}
+	ToolRunCommand     IATTool = IATTool{Name: "run_command", Content: "RunCommand", Description: "Run a shell command", Type: ToolTypeBuiltin}
+	ToolRunScript      IATTool = IATTool{Name: "run_script", Content: "RunScript", Description: "Run a script", Type: ToolTypeBuiltin}
+	ToolHttpGet        IATTool = IATTool{Name: "http_get", Content: "HttpGet", Description: "Perform an HTTP GET request", Type: ToolTypeBuiltin}
+	ToolHttpPost       IATTool = IATTool{Name: "http_post", Content: "HttpPost", Description: "Perform an HTTP POST request", Type: ToolTypeBuiltin}
+	ToolHttpRequest    IATTool = IATTool{Name: "http_request", Content: "HttpRequest", Description: "Perform an HTTP request to an allowlisted host", Type: ToolTypeBuiltin}
+	ToolFetchURL       IATTool = IATTool{Name: "fetch_url", Content: "FetchURL", Description: "Fetch a web page as markdown", Type: ToolTypeBuiltin}
+	ToolGitStatus      IATTool = IATTool{Name: "git_status", Content: "GitStatus", Description: "Show the working tree status", Type: ToolTypeBuiltin}
+	ToolGitDiff        IATTool = IATTool{Name: "git_diff", Content: "GitDiff", Description: "Show staged, unstaged or revision range changes", Type: ToolTypeBuiltin}
+	ToolGitLog         IATTool = IATTool{Name: "git_log", Content: "GitLog", Description: "Show commit history", Type: ToolTypeBuiltin}
+	ToolGitCommit      IATTool = IATTool{Name: "git_commit", Content: "GitCommit", Description: "Record changes to the repository", Type: ToolTypeBuiltin}
+	ToolGitBranch      IATTool = IATTool{Name: "git_branch", Content: "GitBranch", Description: "List, create, switch or delete branches", Type: ToolTypeBuiltin}
+	ToolGitWorktree    IATTool = IATTool{Name: "git_worktree", Content: "GitWorktree", Description: "List, add or remove worktrees", Type: ToolTypeBuiltin}
+	ToolFindDefinition IATTool = IATTool{Name: "find_definition", Content: "GoFindDefinition", Description: "Find where a Go identifier is declared", Type: ToolTypeBuiltin}
+	ToolFindReferences IATTool = IATTool{Name: "find_references", Content: "GoFindReferences", Description: "Find all uses of a Go identifier", Type: ToolTypeBuiltin}
+	ToolListSymbols    IATTool = IATTool{Name: "list_symbols", Content: "GoListSymbols", Description: "List the declarations of a Go file or package", Type: ToolTypeBuiltin}
+	ToolPackageOutline IATTool = IATTool{Name: "package_outline", Content: "GoPackageOutline", Description: "Show the exported API of a Go package", Type: ToolTypeBuiltin}
+	ToolSearchCode     IATTool = IATTool{Name: "search_code", Content: "SearchCode", Description: "Search the project code index", Type: ToolTypeBuiltin}
+	ToolIndexProject   IATTool = IATTool{Name: "index_project", Content: "IndexProject", Description: "Index projects for searching sessions by project name", Type: ToolTypeBuiltin}
 )
 
 func (t IATTool) ToString() string {
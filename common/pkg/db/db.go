@@ -46,6 +46,9 @@ func InitDB() error {
 		&model.Workflow{},
 		&model.WorkflowTask{},
 		&model.Hook{},
+		&model.FileCheckpoint{},
+		&model.ScriptRun{},
+		&model.ToolApproval{},
 	)
 	if err != nil {
 		return err
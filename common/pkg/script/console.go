@@ -0,0 +1,84 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"iat/common/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Limits of the console output kept for one run.
+const (
+	MaxConsoleLines     = 500
+	MaxConsoleLineBytes = 4096
+)
+
+// consoleCapture collects what a script logs instead of printing it.
+// maxBytes, if positive, caps the total text kept.
+type consoleCapture struct {
+	mu       sync.Mutex
+	lines    []model.ScriptConsoleLine
+	bytes    int
+	maxBytes int
+	dropped  int
+}
+
+func (c *consoleCapture) register(vm *goja.Runtime) {
+	console := vm.NewObject()
+	for _, level := range []string{"log", "info", "debug", "warn", "error"} {
+		level := level
+		_ = console.Set(level, func(call goja.FunctionCall) goja.Value {
+			c.add(level, formatConsoleArgs(call.Arguments))
+			return goja.Undefined()
+		})
+	}
+	vm.Set("console", console)
+}
+
+func (c *consoleCapture) add(level, text string) {
+	if len(text) > MaxConsoleLineBytes {
+		text = text[:MaxConsoleLineBytes] + "…"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.lines) >= MaxConsoleLines || (c.maxBytes > 0 && c.bytes+len(text) > c.maxBytes) {
+		c.dropped++
+		return
+	}
+	c.bytes += len(text)
+	c.lines = append(c.lines, model.ScriptConsoleLine{Time: time.Now(), Level: level, Text: text})
+}
+
+// snapshot returns the captured lines, noting how many were dropped.
+func (c *consoleCapture) snapshot() []model.ScriptConsoleLine {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines := append([]model.ScriptConsoleLine{}, c.lines...)
+	if c.dropped > 0 {
+		lines = append(lines, model.ScriptConsoleLine{Time: time.Now(), Level: "warn", Text: fmt.Sprintf("… %d more lines dropped", c.dropped)})
+	}
+	return lines
+}
+
+// formatConsoleArgs joins the arguments like console.log: strings as is,
+// objects as JSON.
+func formatConsoleArgs(args []goja.Value) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		obj, isObj := arg.(*goja.Object)
+		if !isObj || obj.ClassName() == "Function" || obj.ClassName() == "Error" {
+			parts[i] = arg.String()
+			continue
+		}
+		if b, err := json.Marshal(arg.Export()); err == nil {
+			parts[i] = string(b)
+		} else {
+			parts[i] = arg.String()
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -1,54 +1,248 @@
 package script
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"iat/common/model"
 	"iat/common/pkg/script/modules"
+	"iat/common/pkg/tools"
+	"math"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/dop251/goja"
 )
 
 type ScriptEngine struct {
-	vm *goja.Runtime
+	vm      *goja.Runtime
+	grants  modules.Grants
+	modules ModuleSource
+	host    Host
 }
 
+// NewScriptEngine returns a sandboxed engine without any grants: only the
+// side-effect free modules (console, json, path, utils, ...) are available.
 func NewScriptEngine() *ScriptEngine {
+	return NewSandboxedEngine(modules.Grants{})
+}
+
+// NewSandboxedEngine returns an engine with only the granted fs, http and os
+// functions registered.
+func NewSandboxedEngine(g modules.Grants) *ScriptEngine {
 	vm := goja.New()
-	modules.RegisterAll(vm)
-	return &ScriptEngine{vm: vm}
+	g.Run = &modules.RunContext{}
+	modules.RegisterGranted(vm, g)
+	return &ScriptEngine{vm: vm, grants: g}
+}
+
+// GrantsFor turns declared capabilities into engine grants. A relative FSBase
+// is resolved inside root and may not leave it; without a base directory fs
+// calls fail.
+func GrantsFor(caps model.ScriptCapabilities, root string) (modules.Grants, error) {
+	if caps.FS != "" && caps.FS != model.ScriptFSRead && caps.FS != model.ScriptFSWrite {
+		return modules.Grants{}, fmt.Errorf("invalid fs capability %q (expected %q or %q)", caps.FS, model.ScriptFSRead, model.ScriptFSWrite)
+	}
+	g := modules.Grants{
+		FS:        caps.FS,
+		BaseDir:   root,
+		HTTPHosts: caps.HTTP,
+		Exec:      caps.Exec,
+		Env:       caps.Env,
+	}
+	switch {
+	case caps.FSBase == "":
+	case filepath.IsAbs(caps.FSBase):
+		g.BaseDir = filepath.Clean(caps.FSBase)
+	case root == "":
+		g.BaseDir = ""
+	default:
+		base, err := tools.ResolvePathInBase(root, caps.FSBase)
+		if err != nil {
+			return g, err
+		}
+		g.BaseDir = base
+	}
+	return g, nil
 }
 
 func (e *ScriptEngine) Run(script string) (interface{}, error) {
 	return e.RunWithTimeout(script, 30*time.Second)
 }
 
-// Run executes a JS script and returns the exported value with a timeout
+// RunWithTimeout executes a JS script and returns its exported value. See
+// RunContext for the details; console output is discarded.
 func (e *ScriptEngine) RunWithTimeout(script string, timeout time.Duration) (interface{}, error) {
+	res := e.Execute(script, timeout)
+	return res.Value, res.Err
+}
+
+// RunResult is the outcome of one run.
+type RunResult struct {
+	Value     interface{}
+	Err       error
+	Stack     string // JS stack trace of Err, if the script threw or rejected
+	TimedOut  bool
+	Cancelled bool // the caller's context was cancelled
+	Console   []model.ScriptConsoleLine
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// Execute runs a script with the default limits and the given timeout. See
+// RunContext.
+func (e *ScriptEngine) Execute(script string, timeout time.Duration) *RunResult {
+	return e.RunContext(context.Background(), script, Limits{Timeout: timeout})
+}
+
+// RunContext runs a JS script on an event loop: setTimeout/setInterval,
+// promises and fetch (with an http grant) work, and top-level await is
+// allowed, in which case the result is what the script returns. A script
+// whose value is a promise yields the settled value. The run ends when no
+// timer or async call is pending. require() loads modules, cached per run.
+// With a host the iat module is available; its calls get a context that
+// ends with the run. console output is captured in the result.
+//
+// The script is interrupted when ctx is cancelled, the timeout passes or the
+// process heap grows past MaxProcessHeapGrowth (if set), and when calls nest
+// too deeply; blocking os.exec, sqlite and http calls are cancelled with it;
+// results and console output over their limits are rejected or dropped.
+func (e *ScriptEngine) RunContext(ctx context.Context, script string, limits Limits) *RunResult {
 	type result struct {
-		val interface{}
-		err error
+		val   interface{}
+		err   error
+		stack string
+	}
+	limits = limits.withDefaults()
+	out := &RunResult{StartedAt: time.Now()}
+	console := &consoleCapture{maxBytes: limits.MaxConsoleBytes}
+	finish := func(val interface{}, err error, stack string) *RunResult {
+		out.Value, out.Err, out.Stack = val, err, stack
+		out.Console = console.snapshot()
+		out.EndedAt = time.Now()
+		return out
+	}
+	if err := ctx.Err(); err != nil {
+		out.Cancelled = true
+		return finish(nil, fmt.Errorf("script cancelled: %w", err), "")
 	}
 
-	resCh := make(chan result, 1)
-
-	timer := time.AfterFunc(timeout, func() {
-		e.vm.Interrupt("timeout")
-	})
-	defer timer.Stop()
+	prog, err := compileScript(script)
+	if err != nil {
+		return finish(nil, errors.New(err.Error()), "")
+	}
+	if limits.MaxCallStack > 0 {
+		e.vm.SetMaxCallStackSize(limits.MaxCallStack)
+	} else {
+		e.vm.SetMaxCallStackSize(math.MaxInt32)
+	}
+	console.register(e.vm)
+	loop := newEventLoop(e.vm)
+	// 超时或取消时 runCtx 随之结束，正在执行的 os.exec、sqlite 和 http 调用也会停止
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.grants.Run.Set(runCtx)
+	if len(e.grants.HTTPHosts) > 0 {
+		loop.registerFetch(runCtx, e.grants.HTTPHosts)
+	}
+	if e.host != nil {
+		loop.registerHost(runCtx, e.host)
+	}
+	newModuleRegistry(e.vm, e.modules)
+	e.vm.ClearInterrupt()
 
+	resCh := make(chan result, 1)
 	go func() {
-		val, err := e.vm.RunString(script)
-		if err != nil {
-			resCh <- result{err: errors.New(err.Error())}
-		} else {
-			resCh <- result{val: val.Export()}
+		val, err := e.vm.RunProgram(prog)
+		if err == nil {
+			val, err = loop.wait(val)
+		}
+		var overflow *goja.StackOverflowError
+		switch {
+		case errors.As(err, &overflow):
+			resCh <- result{err: fmt.Errorf("maximum call stack size of %d exceeded", limits.MaxCallStack)}
+		case err != nil:
+			resCh <- result{err: errors.New(err.Error()), stack: errorStack(err)}
+		case val == nil:
+			resCh <- result{}
+		default:
+			v := val.Export()
+			if err := checkResultSize(v, limits.MaxResultBytes); err != nil {
+				resCh <- result{err: err}
+				return
+			}
+			resCh <- result{val: v}
 		}
 	}()
 
+	var timeout <-chan time.Time
+	if limits.Timeout > 0 {
+		timer := time.NewTimer(limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	heapExceeded := make(chan struct{})
+	if limits.MaxProcessHeapGrowth > 0 {
+		go watchHeapGrowth(runCtx, limits.MaxProcessHeapGrowth, heapExceeded)
+	}
+	stop := func(reason string) {
+		e.vm.Interrupt(reason)
+		loop.interrupt()
+	}
 	select {
 	case res := <-resCh:
-		return res.val, res.err
+		return finish(res.val, res.err, res.stack)
+	case <-timeout:
+		stop("timeout")
+		out.TimedOut = true
+		return finish(nil, fmt.Errorf("script timeout after %s", limits.Timeout), "")
+	case <-ctx.Done():
+		stop("cancelled")
+		out.Cancelled = true
+		return finish(nil, fmt.Errorf("script cancelled: %w", ctx.Err()), "")
+	case <-heapExceeded:
+		stop("heap growth limit")
+		return finish(nil, fmt.Errorf("script stopped: the process heap grew by more than %d MB while it ran", limits.MaxProcessHeapGrowth>>20), "")
+	}
+}
+
+// errorStack returns the JS stack trace of a thrown exception or a rejected
+// promise.
+func errorStack(err error) string {
+	var ex *goja.Exception
+	if errors.As(err, &ex) {
+		return strings.TrimSpace(ex.String())
+	}
+	var rej *rejectionError
+	if errors.As(err, &rej) {
+		return rej.stack
+	}
+	return ""
+}
+
+// compileScript compiles src as a script. Sources using top-level await are
+// wrapped in an async function, so their result is the returned value.
+func compileScript(src string) (*goja.Program, error) {
+	prog, err := goja.Compile("script", src, false)
+	if err == nil || !strings.Contains(src, "await") {
+		return prog, err
+	}
+	// 不换行包装，保持行号不变；source map 注释必须留在最后一行
+	body, sourceMap := src, ""
+	if i := strings.LastIndex(src, "\n//# sourceMappingURL="); i >= 0 {
+		body, sourceMap = src[:i], src[i:]
+	}
+	if wrapped, werr := goja.Compile("script", "(async () => {"+body+"\n})()"+sourceMap, false); werr == nil {
+		return wrapped, nil
 	}
+	return nil, err
+}
+
+// SetModuleSource sets where require() finds stored and project scripts;
+// builtin modules are always available.
+func (e *ScriptEngine) SetModuleSource(src ModuleSource) {
+	e.modules = src
 }
 
 // RegisterGlobal registers a Go value or function in the JS global scope
@@ -0,0 +1,337 @@
+package script
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iat/common/model"
+	"iat/common/pkg/script/modules"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSandboxedEngine_Grants(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "data.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认没有任何权限
+	val, err := NewScriptEngine().Run(`typeof fs + "," + typeof os + "," + typeof http + "," + typeof path`)
+	if err != nil || val != "undefined,undefined,undefined,object" {
+		t.Fatalf("unexpected globals: %v, %v", val, err)
+	}
+
+	g, err := GrantsFor(model.ScriptCapabilities{FS: model.ScriptFSRead, Exec: []string{"echo *"}}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSandboxedEngine(g)
+	if val, err := e.Run(`fs.readFile("data.txt")`); err != nil || !strings.Contains(val.(string), "hello") {
+		t.Fatalf("read within base: %v, %v", val, err)
+	}
+	if _, err := e.Run(`fs.readFile("../outside.txt")`); err == nil || !strings.Contains(err.Error(), "escapes") {
+		t.Fatalf("expected escape to fail, got %v", err)
+	}
+	if val, _ := e.Run(`typeof fs.writeFile + "," + typeof os.setenv + "," + typeof os.getenv`); val != "undefined,undefined,undefined" {
+		t.Fatalf("ungranted functions registered: %v", val)
+	}
+	if val, err := e.Run(`os.exec("echo", ["ok"])`); err != nil || strings.TrimSpace(val.(string)) != "ok" {
+		t.Fatalf("granted exec: %v, %v", val, err)
+	}
+	if _, err := e.Run(`os.exec("rm", ["-rf", "data.txt"])`); err == nil {
+		t.Fatal("expected exec outside the grant to fail")
+	}
+	// 参数不经过 shell，元字符原样传给程序
+	if val, err := e.Run(`os.exec("echo", ["hi;", "id", "-un"])`); err != nil || strings.TrimSpace(val.(string)) != "hi; id -un" {
+		t.Fatalf("expected arguments to be passed without a shell: %v, %v", val, err)
+	}
+	for _, cmd := range []string{`os.exec("echo hi; id", [])`, `os.exec("sh", ["-c", "echo hi"])`} {
+		if _, err := e.Run(cmd); err == nil {
+			t.Fatalf("expected %s to fail", cmd)
+		}
+	}
+
+	if _, err := GrantsFor(model.ScriptCapabilities{FSBase: "../.."}, root); err == nil {
+		t.Fatal("expected fsBase outside the root to be rejected")
+	}
+}
+
+func TestScriptEngine_Async(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"path":%q}`, r.URL.Path)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	e := NewSandboxedEngine(modules.Grants{HTTPHosts: []string{u.Host}})
+	val, err := e.Run(`
+const sleep = (ms) => new Promise(resolve => setTimeout(resolve, ms));
+let ticks = 0;
+const id = setInterval(() => { if (++ticks === 3) clearInterval(id); }, 1);
+await sleep(5);
+const [a, b] = await Promise.all([
+	fetch("` + srv.URL + `/a").then(r => r.json()),
+	fetch("` + srv.URL + `/b").then(r => r.json()),
+]);
+return a.path + b.path;
+`)
+	if err != nil || val != "/a/b" {
+		t.Fatalf("top-level await: %v, %v", val, err)
+	}
+
+	// 返回 Promise 的脚本取其结果；被拒绝时返回错误
+	if val, err := NewScriptEngine().Run(`new Promise(r => setTimeout(() => r(42), 1))`); err != nil || val != int64(42) {
+		t.Fatalf("promise result: %v (%T), %v", val, val, err)
+	}
+	if _, err := NewScriptEngine().Run(`Promise.reject(new Error("boom"))`); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if _, err := e.Run(`fetch("http://example.invalid/")`); err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("expected fetch outside the grant to fail, got %v", err)
+	}
+
+	// 超时覆盖未结束的定时器
+	start := time.Now()
+	if _, err := NewScriptEngine().RunWithTimeout(`setInterval(() => {}, 5)`, 50*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("timeout not enforced")
+	}
+}
+
+func TestScriptEngine_Require(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, ".iat", "scripts")
+	files := map[string]string{
+		"counter.js":   "globalThis.loads = (globalThis.loads || 0) + 1; exports.n = 41;",
+		"lib/index.js": "const c = require('../counter'); module.exports = { next: () => c.n + 1 };",
+		"a.js":         "require('./b');",
+		"b.js":         "require('./a');",
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 指向脚本目录之外的符号链接
+	outside := filepath.Join(t.TempDir(), "evil.js")
+	os.WriteFile(outside, []byte("module.exports = 'outside';"), 0644)
+	os.WriteFile(filepath.Join(root, "config.js"), []byte("module.exports = 'config';"), 0644)
+	if err := os.Symlink(outside, filepath.Join(dir, "evil.js")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	os.Symlink(filepath.Join(root, "config.js"), filepath.Join(dir, "config.js"))
+	stored := func(name string) (string, bool, error) {
+		if name == "greet" {
+			return "module.exports = n => 'hi ' + n;", true, nil
+		}
+		return "", false, nil
+	}
+
+	e := NewScriptEngine()
+	e.SetModuleSource(ModuleSource{ProjectRoot: root, Stored: stored})
+	got, err := e.Run(`require('counter'); require('greet')(require('json').stringify(require('lib').next())) + ' ' + loads`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hi 42 1" {
+		t.Fatalf("got %v", got)
+	}
+
+	for src, want := range map[string]string{
+		`require('a')`:            "cyclic dependency file:.iat/scripts/a.js -> file:.iat/scripts/b.js -> file:.iat/scripts/a.js",
+		`require('fs')`:           "capability not granted",
+		`require('missing')`:      "cannot find module",
+		`require('../../secret')`: "escapes",
+		`require('evil')`:         "escapes",
+		`require('config')`:       "escapes",
+	} {
+		if _, err := e.Run(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestScriptEngine_ExecuteCapturesConsole(t *testing.T) {
+	e := NewScriptEngine()
+	res := e.Execute(`console.log("n", 1, {a: 2}); console.warn("careful"); 42`, time.Second)
+	if res.Err != nil || res.Value != int64(42) {
+		t.Fatalf("got %v, %v", res.Value, res.Err)
+	}
+	if len(res.Console) != 2 || res.Console[0].Text != `n 1 {"a":2}` || res.Console[1].Level != "warn" {
+		t.Fatalf("console: %+v", res.Console)
+	}
+
+	res = e.Execute("function fail() { throw new Error('boom') }\nfail()", time.Second)
+	if res.Err == nil || !strings.Contains(res.Stack, "at fail") {
+		t.Fatalf("expected stack trace, got %v / %q", res.Err, res.Stack)
+	}
+	res = e.Execute(`await Promise.reject(new Error("async boom"))`, time.Second)
+	if res.Err == nil || !strings.Contains(res.Stack, "async boom") {
+		t.Fatalf("expected rejection stack, got %v / %q", res.Err, res.Stack)
+	}
+	res = e.Execute(`while (true) {}`, 50*time.Millisecond)
+	if !res.TimedOut {
+		t.Fatalf("expected timeout, got %v", res.Err)
+	}
+}
+
+func TestScriptEngine_TypeScript(t *testing.T) {
+	src := "interface Greeting { name: string }\n\nfunction greet(g: Greeting): string {\n  return `hi ${g.name}`\n}\nconst out: string = greet({ name: args.name as string })\nout\n"
+	code, err := Compile(model.ScriptLangTypeScript, src, "greet.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewScriptEngine()
+	e.RegisterGlobal("args", map[string]any{"name": "ts"})
+	if got, err := e.Run(code); err != nil || got != "hi ts" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	// 诊断和堆栈都应指向 TS 源码的行号
+	if _, err := Compile("ts", "const a: number = 1\nconst b: = 2\n", "bad.ts"); err == nil || !strings.Contains(err.Error(), "bad.ts:2:") {
+		t.Fatalf("expected diagnostic at bad.ts:2, got %v", err)
+	}
+	code, err = Transpile("type N = number\n\nfunction fail(n: N): never {\n  throw new Error('n=' + n)\n}\nawait Promise.resolve()\nfail(1)\n", "fail.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := e.Execute(code, time.Second)
+	if res.Err == nil || !strings.Contains(res.Stack, "fail.ts:4:") {
+		t.Fatalf("expected stack at fail.ts:4, got %v / %q", res.Err, res.Stack)
+	}
+
+	// 声明文件本身必须是合法的 TypeScript
+	if _, err := Transpile(modules.TypeDeclarations(), "iat.d.ts"); err != nil {
+		t.Fatalf("invalid declarations: %v", err)
+	}
+}
+
+func TestScriptEngine_StdlibModules(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE items (id INTEGER, name TEXT); INSERT INTO items VALUES (1, 'a'), (2, 'b')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	e := NewSandboxedEngine(modules.Grants{FS: "read", BaseDir: dir})
+	val, err := e.Run(`JSON.stringify({
+		sha: crypto.hash("sha256", "abc").slice(0, 8),
+		hmac: crypto.hmac("sha1", "k", "v").length,
+		date: time.format(time.add(time.parse("2024-01-31", "date"), "24h"), "date"),
+		dur: time.formatDuration(time.duration("1h30m")),
+		yaml: yaml.parse(yaml.stringify({a: [1, 2]})).a[1],
+		csv: csv.parse("x;y\n1;2", {header: true, delimiter: ";"})[0].y,
+		csvOut: csv.stringify([{b: 1, a: "q,r"}]),
+		re: regexp.match("(?P<key>\\w+)=(\\d+)", "n: x=42").groups.key,
+		replaced: regexp.replace("(?P<w>\\w+)@", "bob@host", "${w} at "),
+		tpl: template.render("{{.name | upper}}: {{join \", \" .tags}}", {name: "go", tags: ["a", "b"]}),
+		rows: sqlite.query("data.db", "SELECT name FROM items WHERE id > ?", 1),
+	})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"sha":"ba7816bf","hmac":40,"date":"2024-02-01","dur":"1h30m0s","yaml":2,"csv":"2","csvOut":"b,a\n1,\"q,r\"\n","re":"x","replaced":"bob at host","tpl":"GO: a, b","rows":[{"name":"b"}]}`
+	if val != want {
+		t.Fatalf("got  %s\nwant %s", val, want)
+	}
+
+	if _, err := e.Run(`sqlite.query("data.db", "DELETE FROM items")`); err == nil {
+		t.Fatal("expected write to be rejected")
+	}
+	if _, err := e.Run(`sqlite.query("../x.db", "SELECT 1")`); err == nil {
+		t.Fatal("expected path outside the base directory to be rejected")
+	}
+
+	// ATTACH 和多条语句不能绕过目录限制
+	secretDir := t.TempDir()
+	secret, err := sql.Open("sqlite", filepath.Join(secretDir, "secret.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secret.Exec(`CREATE TABLE t (v TEXT); INSERT INTO t VALUES ('secret')`); err != nil {
+		t.Fatal(err)
+	}
+	secret.Close()
+	for _, q := range []string{
+		fmt.Sprintf("SELECT 1; ATTACH '%s' AS s; SELECT v FROM s.t", filepath.Join(secretDir, "secret.db")),
+		fmt.Sprintf("ATTACH '%s' AS s", filepath.Join(secretDir, "secret.db")),
+		"SELECT name FROM items; -- trailing comment\nDELETE FROM items",
+	} {
+		if val, err := e.Run(fmt.Sprintf("sqlite.query(%q, %q)", "data.db", q)); err == nil {
+			t.Fatalf("expected %q to be rejected, got %v", q, val)
+		}
+	}
+	if val, err := e.Run(`JSON.stringify(sqlite.query("data.db", "/* ok */ SELECT ';' AS s FROM items WHERE name = 'a'; -- done"))`); err != nil || val != `[{"s":";"}]` {
+		t.Fatalf("single statement with ';' in a string: %v, %v", val, err)
+	}
+}
+
+func TestScriptEngine_RunContextLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	res := NewScriptEngine().RunContext(ctx, `await new Promise(() => setInterval(() => {}, 10))`, Limits{})
+	if !res.Cancelled || !errors.Is(res.Err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", res.Err)
+	}
+	res = NewScriptEngine().RunContext(ctx, `1`, Limits{})
+	if !res.Cancelled {
+		t.Fatalf("expected a cancelled context to prevent the run, got %v", res.Value)
+	}
+
+	res = NewScriptEngine().RunContext(context.Background(), `function f(n) { return f(n + 1) } f(0)`, Limits{MaxCallStack: 100})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "call stack") {
+		t.Fatalf("expected stack overflow, got %v", res.Err)
+	}
+
+	res = NewScriptEngine().RunContext(context.Background(), `const a = []; while (true) a.push("x".repeat(1024) + a.length)`, Limits{Timeout: 10 * time.Second, MaxProcessHeapGrowth: 32 << 20})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "process heap grew") {
+		t.Fatalf("expected the heap growth limit, got %v", res.Err)
+	}
+
+	// 超时后正在执行的阻塞调用也会被取消
+	aborted := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	res = NewSandboxedEngine(modules.Grants{HTTPHosts: []string{u.Host}}).RunContext(context.Background(), fmt.Sprintf(`http.get(%q)`, srv.URL), Limits{Timeout: 100 * time.Millisecond})
+	if !res.TimedOut {
+		t.Fatalf("expected timeout, got %v", res.Err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("http request kept running after the script timed out")
+	}
+
+	res = NewScriptEngine().RunContext(context.Background(), `"x".repeat(2048)`, Limits{MaxResultBytes: 1024})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "limit of 1024") {
+		t.Fatalf("expected result limit, got %v", res.Err)
+	}
+
+	res = NewScriptEngine().RunContext(context.Background(), `for (let i = 0; i < 10; i++) console.log("y".repeat(100))`, Limits{MaxConsoleBytes: 250})
+	if res.Err != nil || len(res.Console) != 3 || !strings.Contains(res.Console[2].Text, "8 more lines dropped") {
+		t.Fatalf("console: %+v, %v", res.Console, res.Err)
+	}
+}
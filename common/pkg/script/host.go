@@ -0,0 +1,136 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iat/common/model"
+
+	"github.com/dop251/goja"
+)
+
+// HostModule is the global (and require name) of the host API.
+const HostModule = "iat"
+
+// ChatMessage is a message passed to iat.ai.chat.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Host is what the application exposes to a script through the iat module.
+// Implementations enforce the permissions of whoever runs the script; ctx is
+// cancelled when the run ends or times out.
+type Host interface {
+	CallTool(ctx context.Context, name string, args map[string]any) (string, error)
+	RunAgent(ctx context.Context, name, query string) (string, error)
+	Chat(ctx context.Context, messages []ChatMessage, modelName string) (string, error)
+	ListTasks(ctx context.Context) ([]model.Task, error)
+	AddTask(ctx context.Context, content, priority string, parentID *uint) (*model.Task, error)
+	UpdateTask(ctx context.Context, id uint, status string) error
+	DeleteTask(ctx context.Context, id uint) error
+}
+
+// SetHost makes the iat module available to the scripts run by e.
+func (e *ScriptEngine) SetHost(h Host) {
+	e.host = h
+}
+
+// registerHost registers the iat global. Every call runs off the loop and
+// returns a promise, so scripts use await (top-level await is allowed).
+func (l *eventLoop) registerHost(ctx context.Context, h Host) {
+	vm := l.vm
+	plain := func(res any) goja.Value { return vm.ToValue(res) }
+	// 结构体先转成 JSON 再交给脚本，字段名与 API 保持一致
+	asJSON := func(res any) goja.Value {
+		b, err := json.Marshal(res)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		var v any
+		_ = json.Unmarshal(b, &v)
+		return vm.ToValue(v)
+	}
+	toolsObj := vm.NewObject()
+	_ = toolsObj.Set("call", func(name string, args map[string]any) goja.Value {
+		if args == nil {
+			args = map[string]any{}
+		}
+		return l.async(func() (any, error) { return h.CallTool(ctx, name, normalizeArgs(args)) }, plain)
+	})
+
+	agentsObj := vm.NewObject()
+	_ = agentsObj.Set("run", func(name, query string) goja.Value {
+		return l.async(func() (any, error) { return h.RunAgent(ctx, name, query) }, plain)
+	})
+
+	aiObj := vm.NewObject()
+	_ = aiObj.Set("chat", func(c goja.FunctionCall) goja.Value {
+		var messages []ChatMessage
+		switch v := c.Argument(0).Export().(type) {
+		case string:
+			messages = []ChatMessage{{Role: "user", Content: v}}
+		default:
+			if err := exportJSON(v, &messages); err != nil {
+				panic(vm.NewTypeError("messages must be a string or an array of {role, content}"))
+			}
+		}
+		var opts struct {
+			Model string `json:"model"`
+		}
+		_ = exportJSON(c.Argument(1).Export(), &opts)
+		return l.async(func() (any, error) { return h.Chat(ctx, messages, opts.Model) }, plain)
+	})
+
+	tasksObj := vm.NewObject()
+	_ = tasksObj.Set("list", func() goja.Value {
+		return l.async(func() (any, error) { return h.ListTasks(ctx) }, asJSON)
+	})
+	_ = tasksObj.Set("add", func(content string, opts map[string]any) goja.Value {
+		opts = normalizeArgs(opts)
+		priority, _ := opts["priority"].(string)
+		var parentID *uint
+		if pid, _ := opts["parentId"].(float64); pid > 0 {
+			id := uint(pid)
+			parentID = &id
+		}
+		return l.async(func() (any, error) { return h.AddTask(ctx, content, priority, parentID) }, asJSON)
+	})
+	_ = tasksObj.Set("update", func(id int64, status string) goja.Value {
+		return l.async(func() (any, error) { return nil, h.UpdateTask(ctx, uint(id), status) }, plain)
+	})
+	_ = tasksObj.Set("remove", func(id int64) goja.Value {
+		return l.async(func() (any, error) { return nil, h.DeleteTask(ctx, uint(id)) }, plain)
+	})
+
+	iat := vm.NewObject()
+	_ = iat.Set("tools", toolsObj)
+	_ = iat.Set("agents", agentsObj)
+	_ = iat.Set("ai", aiObj)
+	_ = iat.Set("tasks", tasksObj)
+	vm.Set(HostModule, iat)
+}
+
+// normalizeArgs makes script values look like decoded JSON tool arguments
+// (numbers as float64), which is what the tools expect.
+func normalizeArgs(args map[string]any) map[string]any {
+	var out map[string]any
+	if err := exportJSON(args, &out); err != nil {
+		return args
+	}
+	return out
+}
+
+func exportJSON(v any, dst any) error {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		return fmt.Errorf("invalid value: %w", err)
+	}
+	return nil
+}
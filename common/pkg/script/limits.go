@@ -0,0 +1,109 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// Limits bound one script run. Zero fields take the DefaultLimits value;
+// negative ones disable the limit.
+type Limits struct {
+	Timeout      time.Duration
+	MaxCallStack int // nested JS calls before the script is stopped
+	// MaxProcessHeapGrowth stops the run when the heap of the whole process
+	// grows by more than this many bytes while it runs. It is not a
+	// per-script limit: other work running at the same time counts too.
+	MaxProcessHeapGrowth int64
+	MaxConsoleBytes      int // console output kept, in bytes
+	MaxResultBytes       int // size of the result as JSON
+}
+
+// DefaultLimits are the limits of runs that don't set their own. There is no
+// default heap growth limit: the heap can only be measured for the whole
+// process, so concurrent work would count against the script.
+var DefaultLimits = Limits{
+	Timeout:         30 * time.Second,
+	MaxCallStack:    10000,
+	MaxConsoleBytes: 1 << 20,
+	MaxResultBytes:  1 << 20,
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.Timeout == 0 {
+		l.Timeout = DefaultLimits.Timeout
+	}
+	if l.MaxCallStack == 0 {
+		l.MaxCallStack = DefaultLimits.MaxCallStack
+	}
+	if l.MaxProcessHeapGrowth == 0 {
+		l.MaxProcessHeapGrowth = DefaultLimits.MaxProcessHeapGrowth
+	}
+	if l.MaxConsoleBytes == 0 {
+		l.MaxConsoleBytes = DefaultLimits.MaxConsoleBytes
+	}
+	if l.MaxResultBytes == 0 {
+		l.MaxResultBytes = DefaultLimits.MaxResultBytes
+	}
+	return l
+}
+
+const heapCheckInterval = 20 * time.Millisecond
+
+// heapBytes returns the bytes of live and not yet collected heap objects.
+func heapBytes() int64 {
+	s := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(s[0].Value.Uint64())
+}
+
+// watchHeapGrowth closes exceeded when the process heap has grown by more
+// than max since the watch started. goja can't account for what one runtime
+// allocates, so this is process-wide: other work running at the same time
+// counts too.
+// Garbage counts until it's collected, so a GC is forced before giving up.
+func watchHeapGrowth(ctx context.Context, max int64, exceeded chan<- struct{}) {
+	base := heapBytes()
+	ticker := time.NewTicker(heapCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if heapBytes()-base <= max {
+				continue
+			}
+			runtime.GC()
+			if heapBytes()-base > max {
+				close(exceeded)
+				return
+			}
+		}
+	}
+}
+
+// checkResultSize fails when v, as JSON, is larger than max bytes.
+func checkResultSize(v interface{}, max int) error {
+	if max < 0 || v == nil {
+		return nil
+	}
+	var size int
+	if s, ok := v.(string); ok {
+		size = len(s)
+	} else if b, err := json.Marshal(v); err == nil {
+		size = len(b)
+	} else {
+		size = len(fmt.Sprint(v))
+	}
+	if size > max {
+		return fmt.Errorf("script result is %d bytes, more than the limit of %d", size, max)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iat/common/pkg/tools"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// rejectionError is a rejected script promise, with the JS stack trace of
+// the rejection reason when it is an Error.
+type rejectionError struct {
+	msg   string
+	stack string
+}
+
+func (e *rejectionError) Error() string { return e.msg }
+
+// errLoopStopped is returned when the run was interrupted (timeout) while
+// tasks were still pending.
+var errLoopStopped = errors.New("script interrupted")
+
+// eventLoop runs timer callbacks and the completion of asynchronous Go calls
+// on the goroutine that runs the script, which goja requires. Go code hands
+// work to the loop through post; the loop keeps going while timers or async
+// calls are pending. Each run gets its own loop.
+type eventLoop struct {
+	vm       *goja.Runtime
+	jobs     chan func() error
+	stop     chan struct{}
+	stopOnce sync.Once
+	pending  int // timers and async calls in flight; loop goroutine only
+	timers   map[int64]*loopTimer
+	nextID   int64
+}
+
+type loopTimer struct {
+	t        *time.Timer
+	fn       goja.Callable
+	args     []goja.Value
+	interval time.Duration // 0 for setTimeout
+}
+
+func newEventLoop(vm *goja.Runtime) *eventLoop {
+	l := &eventLoop{
+		vm:     vm,
+		jobs:   make(chan func() error, 64),
+		stop:   make(chan struct{}),
+		timers: make(map[int64]*loopTimer),
+	}
+	vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value { return l.setTimer(call, false) })
+	vm.Set("setInterval", func(call goja.FunctionCall) goja.Value { return l.setTimer(call, true) })
+	vm.Set("clearTimeout", l.clearTimer)
+	vm.Set("clearInterval", l.clearTimer)
+	return l
+}
+
+// post queues fn to run on the loop goroutine; it is dropped once the run
+// has been stopped.
+func (l *eventLoop) post(fn func() error) {
+	select {
+	case l.jobs <- fn:
+	case <-l.stop:
+	}
+}
+
+// wait runs queued jobs until nothing is pending, then settles val if it is
+// a promise.
+func (l *eventLoop) wait(val goja.Value) (goja.Value, error) {
+	for l.pending > 0 {
+		select {
+		case job := <-l.jobs:
+			if err := job(); err != nil {
+				return nil, err
+			}
+		case <-l.stop:
+			return nil, errLoopStopped
+		}
+	}
+	if val == nil {
+		return val, nil
+	}
+	p, ok := val.Export().(*goja.Promise)
+	if !ok {
+		return val, nil
+	}
+	switch p.State() {
+	case goja.PromiseStateFulfilled:
+		return p.Result(), nil
+	case goja.PromiseStateRejected:
+		rej := &rejectionError{msg: "promise rejected: " + p.Result().String()}
+		if obj, ok := p.Result().(*goja.Object); ok {
+			if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+				rej.stack = strings.TrimSpace(stack.String())
+			}
+		}
+		return nil, rej
+	default:
+		return nil, errors.New("script promise never settled")
+	}
+}
+
+// interrupt stops the loop; timers that fire later find it stopped and
+// their callbacks are dropped. Safe to call from any goroutine.
+func (l *eventLoop) interrupt() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+func (l *eventLoop) setTimer(call goja.FunctionCall, repeat bool) goja.Value {
+	fn, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(l.vm.NewTypeError("callback must be a function"))
+	}
+	delay := time.Duration(call.Argument(1).ToInteger()) * time.Millisecond
+	if delay < 0 {
+		delay = 0
+	}
+	if repeat && delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	var args []goja.Value
+	if len(call.Arguments) > 2 {
+		args = append(args, call.Arguments[2:]...)
+	}
+
+	l.nextID++
+	id := l.nextID
+	lt := &loopTimer{fn: fn, args: args}
+	if repeat {
+		lt.interval = delay
+	}
+	l.timers[id] = lt
+	l.pending++
+	lt.t = time.AfterFunc(delay, func() { l.post(func() error { return l.fire(id) }) })
+	return l.vm.ToValue(id)
+}
+
+func (l *eventLoop) fire(id int64) error {
+	lt, ok := l.timers[id]
+	if !ok {
+		return nil // cleared meanwhile
+	}
+	if lt.interval == 0 {
+		delete(l.timers, id)
+		l.pending--
+	}
+	if _, err := lt.fn(goja.Undefined(), lt.args...); err != nil {
+		return err
+	}
+	if _, still := l.timers[id]; still && lt.interval > 0 {
+		lt.t = time.AfterFunc(lt.interval, func() { l.post(func() error { return l.fire(id) }) })
+	}
+	return nil
+}
+
+func (l *eventLoop) clearTimer(id int64) {
+	if lt, ok := l.timers[id]; ok {
+		lt.t.Stop()
+		delete(l.timers, id)
+		l.pending--
+	}
+}
+
+// async runs work in its own goroutine and settles the returned promise on
+// the loop with the value built by settle.
+func (l *eventLoop) async(work func() (any, error), settle func(any) goja.Value) goja.Value {
+	p, resolve, reject := l.vm.NewPromise()
+	l.pending++
+	go func() {
+		res, err := work()
+		l.post(func() error {
+			l.pending--
+			if err != nil {
+				return reject(l.vm.NewGoError(err))
+			}
+			return resolve(settle(res))
+		})
+	}()
+	return l.vm.ToValue(p)
+}
+
+// registerFetch adds a promise-returning fetch(url, {method, headers, body})
+// limited to the allowed hosts. The response has status, ok, headers and
+// text()/json() like the browser API. Requests end with ctx.
+func (l *eventLoop) registerFetch(ctx context.Context, hosts []string) {
+	policy := tools.HttpPolicy{AllowedHosts: hosts}
+	l.vm.Set("fetch", func(call goja.FunctionCall) goja.Value {
+		opts := tools.HttpRequestOptions{URL: call.Argument(0).String(), Method: http.MethodGet}
+		if o, ok := call.Argument(1).Export().(map[string]any); ok {
+			if m, ok := o["method"].(string); ok {
+				opts.Method = m
+			}
+			if b, ok := o["body"].(string); ok {
+				opts.Body = b
+			}
+			if h, ok := o["headers"].(map[string]any); ok {
+				opts.Headers = make(map[string]string, len(h))
+				for k, v := range h {
+					opts.Headers[k] = fmt.Sprint(v)
+				}
+			}
+		}
+		return l.async(func() (any, error) {
+			return tools.HttpRequest(ctx, policy, opts)
+		}, func(res any) goja.Value {
+			return l.fetchResponse(res.(*tools.HttpResponse))
+		})
+	})
+}
+
+func (l *eventLoop) fetchResponse(resp *tools.HttpResponse) goja.Value {
+	vm := l.vm
+	obj := vm.NewObject()
+	_ = obj.Set("status", resp.Status)
+	_ = obj.Set("ok", resp.Status >= 200 && resp.Status < 300)
+	_ = obj.Set("headers", resp.Headers)
+	_ = obj.Set("truncated", resp.Truncated)
+	resolved := func(v goja.Value, err error) goja.Value {
+		p, resolve, reject := vm.NewPromise()
+		if err != nil {
+			_ = reject(vm.NewGoError(err))
+		} else {
+			_ = resolve(v)
+		}
+		return vm.ToValue(p)
+	}
+	_ = obj.Set("text", func() goja.Value { return resolved(vm.ToValue(resp.Body), nil) })
+	_ = obj.Set("json", func() goja.Value {
+		parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+		v, err := parse(goja.Undefined(), vm.ToValue(resp.Body))
+		return resolved(v, err)
+	})
+	return obj
+}
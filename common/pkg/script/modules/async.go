@@ -0,0 +1,56 @@
+package modules
+
+func init() {
+	// 这些函数由脚本引擎的事件循环注册，这里只提供文档
+	Register(ModuleDoc{
+		Name:    "async",
+		Desc:    "Timers and fetch, backed by the engine's event loop (top-level await is supported)",
+		Globals: true,
+		Functions: []FunctionDoc{
+			{
+				Name: "setTimeout",
+				Desc: "Call a function once after a delay",
+				Params: []Parameter{
+					{Name: "fn", Type: "function", Desc: "Callback"},
+					{Name: "ms", Type: "number", Desc: "Delay in milliseconds"},
+				},
+				Returns: "number (timer id)",
+			},
+			{
+				Name: "setInterval",
+				Desc: "Call a function repeatedly until cleared",
+				Params: []Parameter{
+					{Name: "fn", Type: "function", Desc: "Callback"},
+					{Name: "ms", Type: "number", Desc: "Interval in milliseconds"},
+				},
+				Returns: "number (timer id)",
+			},
+			{
+				Name: "clearTimeout",
+				Desc: "Cancel a timeout",
+				Params: []Parameter{
+					{Name: "id", Type: "number", Desc: "Timer id"},
+				},
+				Returns: "void",
+			},
+			{
+				Name: "clearInterval",
+				Desc: "Cancel an interval",
+				Params: []Parameter{
+					{Name: "id", Type: "number", Desc: "Timer id"},
+				},
+				Returns: "void",
+			},
+			{
+				Name: "fetch",
+				Desc: "Perform an HTTP request asynchronously",
+				Params: []Parameter{
+					{Name: "url", Type: "string", Desc: "The URL"},
+					{Name: "options", Type: "{method, headers, body}", Desc: "Request options", Optional: true},
+				},
+				Returns:    "Promise<{status, ok, headers, text(), json()}>",
+				Capability: "http",
+			},
+		},
+	})
+}
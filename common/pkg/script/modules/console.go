@@ -13,7 +13,23 @@ func init() {
 		Functions: []FunctionDoc{
 			{
 				Name: "log",
-				Desc: "Log a message to stdout",
+				Desc: "Log a message (captured in the script run history)",
+				Params: []Parameter{
+					{Name: "...args", Type: "any", Desc: "Values to log"},
+				},
+				Returns: "void",
+			},
+			{
+				Name: "info",
+				Desc: "Log an informational message",
+				Params: []Parameter{
+					{Name: "...args", Type: "any", Desc: "Values to log"},
+				},
+				Returns: "void",
+			},
+			{
+				Name: "debug",
+				Desc: "Log a debug message",
 				Params: []Parameter{
 					{Name: "...args", Type: "any", Desc: "Values to log"},
 				},
@@ -21,7 +37,7 @@ func init() {
 			},
 			{
 				Name: "error",
-				Desc: "Log an error message to stdout",
+				Desc: "Log an error message",
 				Params: []Parameter{
 					{Name: "...args", Type: "any", Desc: "Values to log"},
 				},
@@ -29,7 +45,7 @@ func init() {
 			},
 			{
 				Name: "warn",
-				Desc: "Log a warning message to stdout",
+				Desc: "Log a warning message",
 				Params: []Parameter{
 					{Name: "...args", Type: "any", Desc: "Values to log"},
 				},
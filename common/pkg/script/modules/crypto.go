@@ -0,0 +1,121 @@
+package modules
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+)
+
+func init() {
+	Register(ModuleDoc{
+		Name: "crypto",
+		Desc: "Hashes, HMAC and random values",
+		Functions: []FunctionDoc{
+			{
+				Name: "hash",
+				Desc: "Hash a string (md5, sha1, sha256, sha512), hex encoded",
+				Params: []Parameter{
+					{Name: "algorithm", Type: "string", Desc: "md5, sha1, sha256 or sha512"},
+					{Name: "data", Type: "string", Desc: "Data to hash"},
+				},
+				Returns: "string",
+			},
+			{
+				Name: "sha256",
+				Desc: "SHA-256 of a string, hex encoded",
+				Params: []Parameter{
+					{Name: "data", Type: "string", Desc: "Data to hash"},
+				},
+				Returns: "string",
+			},
+			{
+				Name: "hmac",
+				Desc: "HMAC of a string, hex encoded",
+				Params: []Parameter{
+					{Name: "algorithm", Type: "string", Desc: "md5, sha1, sha256 or sha512"},
+					{Name: "key", Type: "string", Desc: "Secret key"},
+					{Name: "data", Type: "string", Desc: "Data to sign"},
+				},
+				Returns: "string",
+			},
+			{
+				Name:    "randomUUID",
+				Desc:    "Generate a random (v4) UUID",
+				Returns: "string",
+			},
+			{
+				Name: "randomBytes",
+				Desc: "Generate cryptographically secure random bytes, hex encoded",
+				Params: []Parameter{
+					{Name: "n", Type: "number", Desc: "Number of bytes (at most 1024)"},
+				},
+				Returns: "string",
+			},
+		},
+		Register: registerCrypto,
+	})
+}
+
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(strings.ReplaceAll(algorithm, "-", "")) {
+	case "md5":
+		return md5.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("crypto: unsupported algorithm %q", algorithm)
+}
+
+func registerCrypto(vm *goja.Runtime) {
+	vm.Set("crypto", map[string]interface{}{
+		"hash": func(algorithm, data string) (string, error) {
+			newHash, err := hashFunc(algorithm)
+			if err != nil {
+				return "", err
+			}
+			h := newHash()
+			h.Write([]byte(data))
+			return hex.EncodeToString(h.Sum(nil)), nil
+		},
+		"sha256": func(data string) string {
+			sum := sha256.Sum256([]byte(data))
+			return hex.EncodeToString(sum[:])
+		},
+		"hmac": func(algorithm, key, data string) (string, error) {
+			newHash, err := hashFunc(algorithm)
+			if err != nil {
+				return "", err
+			}
+			mac := hmac.New(newHash, []byte(key))
+			mac.Write([]byte(data))
+			return hex.EncodeToString(mac.Sum(nil)), nil
+		},
+		"randomUUID": func() string {
+			return uuid.NewString()
+		},
+		"randomBytes": func(n int) (string, error) {
+			if n <= 0 || n > 1024 {
+				return "", fmt.Errorf("crypto: randomBytes needs 1 to 1024 bytes, got %d", n)
+			}
+			b := make([]byte, n)
+			if _, err := rand.Read(b); err != nil {
+				return "", err
+			}
+			return hex.EncodeToString(b), nil
+		},
+	})
+}
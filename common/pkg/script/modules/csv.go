@@ -0,0 +1,151 @@
+package modules
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+)
+
+func init() {
+	Register(ModuleDoc{
+		Name: "csv",
+		Desc: "CSV encoding/decoding",
+		Functions: []FunctionDoc{
+			{
+				Name: "parse",
+				Desc: "Parse CSV; with header: true rows are objects keyed by the first line",
+				Params: []Parameter{
+					{Name: "text", Type: "string", Desc: "CSV to parse"},
+					{Name: "options", Type: "{header, delimiter}", Desc: "header (default false), delimiter (default \",\")", Optional: true},
+				},
+				Returns: "[]any",
+			},
+			{
+				Name: "stringify",
+				Desc: "Convert rows (arrays, or objects whose keys become the header line) to CSV",
+				Params: []Parameter{
+					{Name: "rows", Type: "[]any", Desc: "Rows to convert"},
+					{Name: "options", Type: "{header, delimiter}", Desc: "header: write the header line for object rows (default true), delimiter (default \",\")", Optional: true},
+				},
+				Returns: "string",
+			},
+		},
+		Register: registerCSV,
+	})
+}
+
+type csvOptions struct {
+	header    bool
+	hasHeader bool // header was given
+	comma     rune
+}
+
+func parseCSVOptions(opts map[string]interface{}) (csvOptions, error) {
+	o := csvOptions{comma: ','}
+	if h, ok := opts["header"].(bool); ok {
+		o.header, o.hasHeader = h, true
+	}
+	d, _ := opts["delimiter"].(string)
+	if d == "" {
+		return o, nil
+	}
+	r, size := utf8.DecodeRuneInString(d)
+	if size != len(d) || r == '"' || r == '\n' || r == '\r' {
+		return o, fmt.Errorf("csv: invalid delimiter %q", d)
+	}
+	o.comma = r
+	return o, nil
+}
+
+func registerCSV(vm *goja.Runtime) {
+	vm.Set("csv", map[string]interface{}{
+		"parse": func(text string, opts map[string]interface{}) (interface{}, error) {
+			options, err := parseCSVOptions(opts)
+			if err != nil {
+				return nil, err
+			}
+			r := csv.NewReader(strings.NewReader(text))
+			r.Comma = options.comma
+			r.FieldsPerRecord = -1
+			records, err := r.ReadAll()
+			if err != nil {
+				return nil, fmt.Errorf("csv: %v", err)
+			}
+			if !options.header {
+				return records, nil
+			}
+			if len(records) == 0 {
+				return []map[string]string{}, nil
+			}
+			header := records[0]
+			rows := make([]map[string]string, 0, len(records)-1)
+			for _, rec := range records[1:] {
+				row := make(map[string]string, len(header))
+				for i, name := range header {
+					if i < len(rec) {
+						row[name] = rec[i]
+					} else {
+						row[name] = ""
+					}
+				}
+				rows = append(rows, row)
+			}
+			return rows, nil
+		},
+		"stringify": func(rows []goja.Value, opts map[string]interface{}) (string, error) {
+			options, err := parseCSVOptions(opts)
+			if err != nil {
+				return "", err
+			}
+			var b strings.Builder
+			w := csv.NewWriter(&b)
+			w.Comma = options.comma
+
+			// 对象行按第一行的键顺序输出
+			var columns []string
+			for i, row := range rows {
+				obj, ok := row.(*goja.Object)
+				if ok && obj.ClassName() != "Array" {
+					if columns == nil {
+						columns = obj.Keys()
+						if options.header || !options.hasHeader {
+							if err := w.Write(columns); err != nil {
+								return "", err
+							}
+						}
+					}
+					rec := make([]string, len(columns))
+					for j, col := range columns {
+						rec[j] = csvField(obj.Get(col))
+					}
+					if err := w.Write(rec); err != nil {
+						return "", err
+					}
+					continue
+				}
+				if !ok {
+					return "", fmt.Errorf("csv: row %d is not an array or object", i)
+				}
+				var rec []string
+				for _, k := range obj.Keys() {
+					rec = append(rec, csvField(obj.Get(k)))
+				}
+				if err := w.Write(rec); err != nil {
+					return "", err
+				}
+			}
+			w.Flush()
+			return b.String(), w.Error()
+		},
+	})
+}
+
+func csvField(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return ""
+	}
+	return v.String()
+}
@@ -0,0 +1,163 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dtsPrelude declares the globals the engine provides besides the modules.
+const dtsPrelude = `// Type declarations of the iat script engine, generated from the module docs.
+
+/** Arguments of a script tool or a manual run. */
+declare const args: Record<string, any>;
+/** Event data of a hook script. */
+declare const context: Record<string, any>;
+/** CommonJS exports of a required module. */
+declare const module: { exports: any };
+declare const exports: any;
+declare const __filename: string;
+declare const __dirname: string;
+`
+
+// TypeDeclarations renders the registered modules as a TypeScript
+// declaration file (.d.ts), so editors can type-check scripts. Parameter and
+// return types come from the docs: Go-style types are translated and
+// shorthand objects like {status, body} become objects with any fields.
+func TypeDeclarations() string {
+	var b strings.Builder
+	b.WriteString(dtsPrelude)
+
+	var requireable []string
+	for _, m := range GetModuleDocs() {
+		b.WriteString("\n")
+		if m.Globals {
+			for _, f := range m.Functions {
+				writeDocComment(&b, "", f)
+				fmt.Fprintf(&b, "declare function %s;\n", functionSignature(f.Name, f))
+			}
+			continue
+		}
+		if m.Desc != "" {
+			fmt.Fprintf(&b, "/** %s */\n", m.Desc)
+		}
+		fmt.Fprintf(&b, "declare const %s: ", m.Name)
+		writeMembers(&b, "", m.Functions)
+		b.WriteString(";\n")
+		requireable = append(requireable, m.Name)
+	}
+
+	b.WriteString("\n")
+	sort.Strings(requireable)
+	for _, name := range requireable {
+		fmt.Fprintf(&b, "declare function require(name: %q): typeof %s;\n", name, name)
+	}
+	b.WriteString("declare function require(name: string): any;\n")
+	return b.String()
+}
+
+// writeMembers writes an object type with the functions; dotted names like
+// "tools.call" become nested objects.
+func writeMembers(b *strings.Builder, indent string, funcs []FunctionDoc) {
+	b.WriteString("{\n")
+	var groups []string
+	nested := make(map[string][]FunctionDoc)
+	for _, f := range funcs {
+		if head, rest, ok := strings.Cut(f.Name, "."); ok {
+			if _, seen := nested[head]; !seen {
+				groups = append(groups, head)
+			}
+			f.Name = rest
+			nested[head] = append(nested[head], f)
+			continue
+		}
+		writeDocComment(b, indent+"  ", f)
+		fmt.Fprintf(b, "%s  %s;\n", indent, functionSignature(f.Name, f))
+	}
+	for _, g := range groups {
+		fmt.Fprintf(b, "%s  %s: ", indent, g)
+		writeMembers(b, indent+"  ", nested[g])
+		b.WriteString(";\n")
+	}
+	b.WriteString(indent + "}")
+}
+
+func writeDocComment(b *strings.Builder, indent string, f FunctionDoc) {
+	var lines []string
+	if f.Desc != "" {
+		lines = append(lines, f.Desc)
+	}
+	if f.Capability != "" {
+		lines = append(lines, fmt.Sprintf("Requires the %q capability.", f.Capability))
+	}
+	for _, p := range f.Params {
+		if p.Desc != "" {
+			lines = append(lines, fmt.Sprintf("@param %s %s", strings.TrimPrefix(p.Name, "..."), p.Desc))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s/**\n", indent)
+	for _, l := range lines {
+		fmt.Fprintf(b, "%s * %s\n", indent, l)
+	}
+	fmt.Fprintf(b, "%s */\n", indent)
+}
+
+func functionSignature(name string, f FunctionDoc) string {
+	params := make([]string, 0, len(f.Params))
+	for _, p := range f.Params {
+		if rest, ok := strings.CutPrefix(p.Name, "..."); ok {
+			params = append(params, fmt.Sprintf("...%s: %s[]", rest, tsType(p.Type, true)))
+			continue
+		}
+		opt := ""
+		if p.Optional {
+			opt = "?"
+		}
+		params = append(params, fmt.Sprintf("%s%s: %s", p.Name, opt, tsType(p.Type, true)))
+	}
+	return fmt.Sprintf("%s(%s): %s", name, strings.Join(params, ", "), tsType(f.Returns, false))
+}
+
+var shorthandObject = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// tsType translates a documented type to TypeScript. Fields of shorthand
+// objects are optional in parameters.
+func tsType(t string, param bool) string {
+	t = strings.TrimSpace(t)
+	if i := strings.Index(t, " ("); i > 0 {
+		t = t[:i] // "string (output)"
+	}
+	t = strings.TrimSpace(strings.TrimPrefix(t, "object "))
+	switch t {
+	case "", "void", "error":
+		return "void"
+	case "object":
+		return "Record<string, any>"
+	case "function":
+		return "(...args: any[]) => void"
+	}
+	if elem, ok := strings.CutPrefix(t, "[]"); ok {
+		return tsType(elem, param) + "[]"
+	}
+	return shorthandObject.ReplaceAllStringFunc(t, func(obj string) string {
+		fields := strings.Split(strings.Trim(obj, "{}"), ",")
+		out := make([]string, 0, len(fields))
+		for _, field := range fields {
+			field = strings.TrimSpace(field)
+			switch {
+			case field == "":
+			case strings.HasSuffix(field, "()"):
+				out = append(out, field+": any")
+			case param:
+				out = append(out, field+"?: any")
+			default:
+				out = append(out, field+": any")
+			}
+		}
+		return "{ " + strings.Join(out, "; ") + " }"
+	})
+}
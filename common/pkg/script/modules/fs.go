@@ -1,7 +1,9 @@
 package modules
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"iat/common/pkg/tools"
 
@@ -19,7 +21,8 @@ func init() {
 				Params: []Parameter{
 					{Name: "path", Type: "string", Desc: "Path to file"},
 				},
-				Returns: "string",
+				Returns:    "string",
+				Capability: "fs",
 			},
 			{
 				Name: "writeFile",
@@ -28,7 +31,8 @@ func init() {
 					{Name: "path", Type: "string", Desc: "Path to file"},
 					{Name: "content", Type: "string", Desc: "Content to write"},
 				},
-				Returns: "string (status)",
+				Returns:    "string (status)",
+				Capability: "fs:write",
 			},
 			{
 				Name: "listFiles",
@@ -36,7 +40,8 @@ func init() {
 				Params: []Parameter{
 					{Name: "path", Type: "string", Desc: "Directory path"},
 				},
-				Returns: "string (formatted list)",
+				Returns:    "string (formatted list)",
+				Capability: "fs",
 			},
 			{
 				Name: "remove",
@@ -44,7 +49,8 @@ func init() {
 				Params: []Parameter{
 					{Name: "path", Type: "string", Desc: "Path to remove"},
 				},
-				Returns: "error",
+				Returns:    "error",
+				Capability: "fs:write",
 			},
 			{
 				Name: "exists",
@@ -52,7 +58,8 @@ func init() {
 				Params: []Parameter{
 					{Name: "path", Type: "string", Desc: "Path to check"},
 				},
-				Returns: "boolean",
+				Returns:    "boolean",
+				Capability: "fs",
 			},
 			{
 				Name: "mkdir",
@@ -60,10 +67,12 @@ func init() {
 				Params: []Parameter{
 					{Name: "path", Type: "string", Desc: "Directory path"},
 				},
-				Returns: "error",
+				Returns:    "error",
+				Capability: "fs:write",
 			},
 		},
-		Register: registerFS,
+		Register:  registerFS,
+		Sandboxed: registerFSGranted,
 	})
 }
 
@@ -84,3 +93,101 @@ func registerFS(vm *goja.Runtime) {
 		},
 	})
 }
+
+// registerFSGranted registers fs with every path confined to the granted
+// base directory; write functions need the "write" grant.
+func registerFSGranted(vm *goja.Runtime, g Grants) {
+	if g.FS != "read" && g.FS != "write" {
+		return
+	}
+	resolve := func(path string) (string, error) {
+		return ConfinePath(g.BaseDir, path)
+	}
+	fs := map[string]interface{}{
+		"readFile": func(path string) (string, error) {
+			p, err := resolve(path)
+			if err != nil {
+				return "", err
+			}
+			return tools.ReadFile(p)
+		},
+		"listFiles": func(path string) (string, error) {
+			p, err := resolve(path)
+			if err != nil {
+				return "", err
+			}
+			return tools.ListFiles(p)
+		},
+		"exists": func(path string) bool {
+			p, err := resolve(path)
+			if err != nil {
+				return false
+			}
+			_, err = os.Stat(p)
+			return err == nil || !os.IsNotExist(err)
+		},
+	}
+	if g.FS == "write" {
+		fs["writeFile"] = func(path, content string) (string, error) {
+			p, err := resolve(path)
+			if err != nil {
+				return "", err
+			}
+			return tools.WriteFile(p, content)
+		}
+		fs["remove"] = func(path string) error {
+			p, err := resolve(path)
+			if err != nil {
+				return err
+			}
+			if base, _ := filepath.Abs(g.BaseDir); p == base {
+				return fmt.Errorf("fs: cannot remove the base directory")
+			}
+			return os.RemoveAll(p)
+		}
+		fs["mkdir"] = func(path string) error {
+			p, err := resolve(path)
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(p, 0755)
+		}
+	}
+	vm.Set("fs", fs)
+}
+
+// ConfinePath resolves path inside base and rejects symlinks that lead out
+// of it.
+func ConfinePath(base, path string) (string, error) {
+	if base == "" {
+		return "", fmt.Errorf("fs: no base directory granted")
+	}
+	p, err := tools.ResolvePathInBase(base, path)
+	if err != nil {
+		return "", err
+	}
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", err
+	}
+	// 从最近的已存在的祖先目录开始解析符号链接
+	existing := p
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tools.ResolvePathInBase(realBase, real); err != nil {
+		return "", fmt.Errorf("path escapes base directory")
+	}
+	return p, nil
+}
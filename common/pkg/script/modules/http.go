@@ -22,7 +22,8 @@ func init() {
 				Params: []Parameter{
 					{Name: "url", Type: "string", Desc: "The URL to fetch"},
 				},
-				Returns: "string (body)",
+				Returns:    "string (body)",
+				Capability: "http",
 			},
 			{
 				Name: "post",
@@ -32,7 +33,8 @@ func init() {
 					{Name: "contentType", Type: "string", Desc: "MIME type of body"},
 					{Name: "body", Type: "string", Desc: "Request body"},
 				},
-				Returns: "string (body)",
+				Returns:    "string (body)",
+				Capability: "http",
 			},
 			{
 				Name: "request",
@@ -43,10 +45,12 @@ func init() {
 					{Name: "headers", Type: "object", Desc: "Map of header key-values"},
 					{Name: "body", Type: "string", Desc: "Request body"},
 				},
-				Returns: "object {status, body, headers}",
+				Returns:    "object {status, body, headers}",
+				Capability: "http",
 			},
 		},
-		Register: registerHTTP,
+		Register:  registerHTTP,
+		Sandboxed: registerHTTPGranted,
 	})
 }
 
@@ -89,3 +93,41 @@ func registerHTTP(vm *goja.Runtime) {
 		},
 	})
 }
+
+// registerHTTPGranted registers http limited to the granted hosts.
+func registerHTTPGranted(vm *goja.Runtime, g Grants) {
+	if len(g.HTTPHosts) == 0 {
+		return
+	}
+	policy := tools.HttpPolicy{AllowedHosts: g.HTTPHosts}
+	do := func(opts tools.HttpRequestOptions) (*tools.HttpResponse, error) {
+		return tools.HttpRequest(g.Run.Context(), policy, opts)
+	}
+	vm.Set("http", map[string]interface{}{
+		"get": func(url string) (string, error) {
+			resp, err := do(tools.HttpRequestOptions{URL: url})
+			if err != nil {
+				return "", err
+			}
+			return resp.Body, nil
+		},
+		"post": func(url, contentType, body string) (string, error) {
+			resp, err := do(tools.HttpRequestOptions{Method: http.MethodPost, URL: url, Body: body, Headers: map[string]string{"Content-Type": contentType}})
+			if err != nil {
+				return "", err
+			}
+			return resp.Body, nil
+		},
+		"request": func(method, url string, headers map[string]string, body string) (map[string]interface{}, error) {
+			resp, err := do(tools.HttpRequestOptions{Method: method, URL: url, Headers: headers, Body: body})
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"status":  resp.Status,
+				"body":    resp.Body,
+				"headers": resp.Headers,
+			}, nil
+		},
+	})
+}
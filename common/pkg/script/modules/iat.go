@@ -0,0 +1,69 @@
+package modules
+
+func init() {
+	// iat 由脚本引擎在有宿主时注册（目前是脚本工具），这里只提供文档
+	Register(ModuleDoc{
+		Name: "iat",
+		Desc: "Application API for script tools: call tools, agents and the model with the calling agent's permissions. Every function returns a Promise",
+		Functions: []FunctionDoc{
+			{
+				Name: "tools.call",
+				Desc: "Call a tool available to the calling agent (builtin, script, API or MCP)",
+				Params: []Parameter{
+					{Name: "name", Type: "string", Desc: "Tool name"},
+					{Name: "args", Type: "object", Desc: "Tool arguments", Optional: true},
+				},
+				Returns: "Promise<string>",
+			},
+			{
+				Name: "agents.run",
+				Desc: "Run an agent as a sub-agent (requires call_subagent)",
+				Params: []Parameter{
+					{Name: "name", Type: "string", Desc: "Agent name"},
+					{Name: "query", Type: "string", Desc: "Task for the agent"},
+				},
+				Returns: "Promise<string>",
+			},
+			{
+				Name: "ai.chat",
+				Desc: "Ask a model, the calling agent's model by default",
+				Params: []Parameter{
+					{Name: "messages", Type: "string | {role, content}[]", Desc: "Prompt or conversation"},
+					{Name: "options", Type: "{model}", Desc: "model: name of a configured model", Optional: true},
+				},
+				Returns: "Promise<string>",
+			},
+			{
+				Name:    "tasks.list",
+				Desc:    "List the session tasks (requires manage_tasks)",
+				Returns: "Promise<{id, content, status, priority, parentId}[]>",
+			},
+			{
+				Name: "tasks.add",
+				Desc: "Create a session task (requires manage_tasks)",
+				Params: []Parameter{
+					{Name: "content", Type: "string", Desc: "Task description"},
+					{Name: "options", Type: "{priority, parentId}", Desc: "priority: high, medium (default) or low", Optional: true},
+				},
+				Returns: "Promise<{id, content, status, priority, parentId}>",
+			},
+			{
+				Name: "tasks.update",
+				Desc: "Set the status of a session task (requires manage_tasks)",
+				Params: []Parameter{
+					{Name: "id", Type: "number", Desc: "Task ID"},
+					{Name: "status", Type: "string", Desc: "New status"},
+				},
+				Returns: "Promise<void>",
+			},
+			{
+				Name: "tasks.remove",
+				Desc: "Delete a session task (requires manage_tasks)",
+				Params: []Parameter{
+					{Name: "id", Type: "number", Desc: "Task ID"},
+				},
+				Returns: "Promise<void>",
+			},
+		},
+	})
+}
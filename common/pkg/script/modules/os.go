@@ -3,6 +3,8 @@ package modules
 import (
 	"os"
 
+	"iat/common/model"
+
 	"iat/common/pkg/tools"
 
 	"github.com/dop251/goja"
@@ -19,11 +21,12 @@ func init() {
 				Params: []Parameter{
 					{Name: "key", Type: "string", Desc: "Environment variable name"},
 				},
-				Returns: "string",
+				Returns:    "string",
+				Capability: "env",
 			},
 			{
 				Name: "setenv",
-				Desc: "Set environment variable",
+				Desc: "Set environment variable (not available to sandboxed scripts)",
 				Params: []Parameter{
 					{Name: "key", Type: "string", Desc: "Variable name"},
 					{Name: "value", Type: "string", Desc: "Variable value"},
@@ -32,15 +35,17 @@ func init() {
 			},
 			{
 				Name: "exec",
-				Desc: "Execute shell command",
+				Desc: "Execute a command (sandboxed scripts run it without a shell)",
 				Params: []Parameter{
 					{Name: "command", Type: "string", Desc: "Command to run"},
 					{Name: "args", Type: "[]string", Desc: "Command arguments"},
 				},
-				Returns: "string (output)",
+				Returns:    "string (output)",
+				Capability: "exec",
 			},
 		},
-		Register: registerOS,
+		Register:  registerOS,
+		Sandboxed: registerOSGranted,
 	})
 }
 
@@ -51,3 +56,34 @@ func registerOS(vm *goja.Runtime) {
 		"exec":   tools.RunCommand,
 	})
 }
+
+// registerOSGranted exposes only the granted environment variables and
+// commands; commands run in the granted base directory without a shell, so
+// the grant is checked against exactly what runs. setenv is never available
+// because it changes the environment of the whole process.
+func registerOSGranted(vm *goja.Runtime, g Grants) {
+	m := map[string]interface{}{}
+	if len(g.Env) > 0 {
+		m["getenv"] = func(key string) string {
+			if !model.MatchToolName(g.Env, key) {
+				return ""
+			}
+			return os.Getenv(key)
+		}
+	}
+	if len(g.Exec) > 0 {
+		m["exec"] = func(command string, args []string) (string, error) {
+			argv, err := tools.CommandArgv(command, args)
+			if err != nil {
+				return "", err
+			}
+			if err := tools.CheckCommandPolicy(model.CommandPolicy{Allow: g.Exec}, argv); err != nil {
+				return "", err
+			}
+			return tools.ExecCommand(g.Run.Context(), g.BaseDir, argv, nil)
+		}
+	}
+	if len(m) > 0 {
+		vm.Set("os", m)
+	}
+}
@@ -0,0 +1,150 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/dop251/goja"
+)
+
+func init() {
+	Register(ModuleDoc{
+		Name: "regexp",
+		Desc: "Go (RE2) regular expressions with named groups: (?P<name>...) or (?<name>...)",
+		Functions: []FunctionDoc{
+			{
+				Name: "match",
+				Desc: "First match, or null",
+				Params: []Parameter{
+					{Name: "pattern", Type: "string", Desc: "Regular expression"},
+					{Name: "text", Type: "string", Desc: "Text to search"},
+				},
+				Returns: "{match, index, groups, captures}",
+			},
+			{
+				Name: "matchAll",
+				Desc: "All matches",
+				Params: []Parameter{
+					{Name: "pattern", Type: "string", Desc: "Regular expression"},
+					{Name: "text", Type: "string", Desc: "Text to search"},
+					{Name: "limit", Type: "number", Desc: "Maximum number of matches (default all)", Optional: true},
+				},
+				Returns: "[]{match, index, groups, captures}",
+			},
+			{
+				Name: "test",
+				Desc: "Whether the pattern matches",
+				Params: []Parameter{
+					{Name: "pattern", Type: "string", Desc: "Regular expression"},
+					{Name: "text", Type: "string", Desc: "Text to search"},
+				},
+				Returns: "boolean",
+			},
+			{
+				Name: "replace",
+				Desc: "Replace all matches; $1 and ${name} refer to groups",
+				Params: []Parameter{
+					{Name: "pattern", Type: "string", Desc: "Regular expression"},
+					{Name: "text", Type: "string", Desc: "Text to search"},
+					{Name: "replacement", Type: "string", Desc: "Replacement template"},
+				},
+				Returns: "string",
+			},
+			{
+				Name: "split",
+				Desc: "Split text around matches",
+				Params: []Parameter{
+					{Name: "pattern", Type: "string", Desc: "Regular expression"},
+					{Name: "text", Type: "string", Desc: "Text to split"},
+					{Name: "limit", Type: "number", Desc: "Maximum number of parts (default all)", Optional: true},
+				},
+				Returns: "[]string",
+			},
+		},
+		Register: registerRegexp,
+	})
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("regexp: %v", err)
+	}
+	return re, nil
+}
+
+// regexpMatch describes one match; index is the byte offset in text.
+func regexpMatch(re *regexp.Regexp, text string, loc []int) map[string]interface{} {
+	groups := make(map[string]interface{})
+	captures := make([]interface{}, 0, re.NumSubexp())
+	for i := 1; i <= re.NumSubexp(); i++ {
+		var v interface{}
+		if loc[2*i] >= 0 {
+			v = text[loc[2*i]:loc[2*i+1]]
+		}
+		captures = append(captures, v)
+		if name := re.SubexpNames()[i]; name != "" {
+			groups[name] = v
+		}
+	}
+	return map[string]interface{}{
+		"match":    text[loc[0]:loc[1]],
+		"index":    loc[0],
+		"groups":   groups,
+		"captures": captures,
+	}
+}
+
+func registerRegexp(vm *goja.Runtime) {
+	vm.Set("regexp", map[string]interface{}{
+		"match": func(pattern, text string) (interface{}, error) {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				return nil, err
+			}
+			loc := re.FindStringSubmatchIndex(text)
+			if loc == nil {
+				return nil, nil
+			}
+			return regexpMatch(re, text, loc), nil
+		},
+		"matchAll": func(pattern, text string, limit int) ([]map[string]interface{}, error) {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if limit <= 0 {
+				limit = -1
+			}
+			matches := []map[string]interface{}{}
+			for _, loc := range re.FindAllStringSubmatchIndex(text, limit) {
+				matches = append(matches, regexpMatch(re, text, loc))
+			}
+			return matches, nil
+		},
+		"test": func(pattern, text string) (bool, error) {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				return false, err
+			}
+			return re.MatchString(text), nil
+		},
+		"replace": func(pattern, text, replacement string) (string, error) {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				return "", err
+			}
+			return re.ReplaceAllString(text, replacement), nil
+		},
+		"split": func(pattern, text string, limit int) ([]string, error) {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if limit <= 0 {
+				limit = -1
+			}
+			return re.Split(text, limit), nil
+		},
+	})
+}
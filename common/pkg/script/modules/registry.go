@@ -1,25 +1,74 @@
 package modules
 
-import "github.com/dop251/goja"
+import (
+	"context"
+	"sync"
+
+	"github.com/dop251/goja"
+)
 
 type Parameter struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
-	Desc string `json:"desc"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Desc     string `json:"desc"`
+	Optional bool   `json:"optional,omitempty"`
 }
 
 type FunctionDoc struct {
-	Name    string      `json:"name"`
-	Desc    string      `json:"desc"`
-	Params  []Parameter `json:"params"`
-	Returns string      `json:"returns"`
+	Name       string      `json:"name"`
+	Desc       string      `json:"desc"`
+	Params     []Parameter `json:"params"`
+	Returns    string      `json:"returns"`
+	Capability string      `json:"capability,omitempty"` // grant needed in a sandboxed engine
 }
 
 type ModuleDoc struct {
 	Name      string                 `json:"name"`
 	Desc      string                 `json:"desc"`
+	Globals   bool                   `json:"globals,omitempty"` // functions are globals, not members of Name
 	Functions []FunctionDoc          `json:"functions"`
 	Register  func(vm *goja.Runtime) `json:"-"`
+	// Sandboxed registers only what the grants allow. Modules without it
+	// have no side effects and are registered as is.
+	Sandboxed func(vm *goja.Runtime, g Grants) `json:"-"`
+}
+
+// Grants are the capabilities of a sandboxed script. The zero value grants
+// nothing: fs, http, os.exec and os.getenv are left out of the runtime.
+type Grants struct {
+	FS        string   // "", "read" or "write"
+	BaseDir   string   // fs paths and os.exec are confined to it
+	HTTPHosts []string // hosts http may reach
+	Exec      []string // command patterns os.exec may run
+	Env       []string // variables os.getenv may read
+	// Run is the context of the engine's current run; blocking calls
+	// (os.exec, sqlite, http) end with it. nil means no cancellation.
+	Run *RunContext
+}
+
+// RunContext holds the context of the run a sandboxed engine is executing.
+type RunContext struct {
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+func (r *RunContext) Set(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+}
+
+// Context returns the context of the current run, or context.Background.
+func (r *RunContext) Context() context.Context {
+	if r == nil {
+		return context.Background()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
 }
 
 var registry []ModuleDoc
@@ -36,6 +85,30 @@ func RegisterAll(vm *goja.Runtime) {
 	}
 }
 
+// RegisterGranted registers the side-effect free modules and the granted
+// functions of the others.
+func RegisterGranted(vm *goja.Runtime, g Grants) {
+	for _, m := range registry {
+		switch {
+		case m.Sandboxed != nil:
+			m.Sandboxed(vm, g)
+		case m.Register != nil:
+			m.Register(vm)
+		}
+	}
+}
+
 func GetModuleDocs() []ModuleDoc {
 	return registry
 }
+
+// IsBuiltin reports whether name is a module scripts can require. Its value
+// is the global of the same name, absent when the capability isn't granted.
+func IsBuiltin(name string) bool {
+	for _, m := range registry {
+		if m.Name == name && (m.Register != nil || m.Sandboxed != nil) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package modules
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// MaxSQLiteRows caps the rows one sqlite.query returns.
+const MaxSQLiteRows = 10000
+
+const sqliteQueryTimeout = 30 * time.Second
+
+func init() {
+	Register(ModuleDoc{
+		Name: "sqlite",
+		Desc: "Read-only queries against SQLite database files",
+		Functions: []FunctionDoc{
+			{
+				Name: "query",
+				Desc: fmt.Sprintf("Run a read-only query; rows are objects keyed by column (at most %d rows)", MaxSQLiteRows),
+				Params: []Parameter{
+					{Name: "path", Type: "string", Desc: "Database file"},
+					{Name: "sql", Type: "string", Desc: "SQL with ? placeholders"},
+					{Name: "...params", Type: "any", Desc: "Placeholder values"},
+				},
+				Returns:    "[]object",
+				Capability: "fs",
+			},
+		},
+		Register:  registerSQLite,
+		Sandboxed: registerSQLiteGranted,
+	})
+}
+
+func registerSQLite(vm *goja.Runtime) {
+	vm.Set("sqlite", map[string]interface{}{
+		"query": func(path, query string, params ...interface{}) ([]map[string]interface{}, error) {
+			return sqliteQuery(context.Background(), path, query, params...)
+		},
+	})
+}
+
+// registerSQLiteGranted registers sqlite with database paths confined to the
+// granted base directory, like fs.
+func registerSQLiteGranted(vm *goja.Runtime, g Grants) {
+	if g.FS != "read" && g.FS != "write" {
+		return
+	}
+	vm.Set("sqlite", map[string]interface{}{
+		"query": func(path, query string, params ...interface{}) ([]map[string]interface{}, error) {
+			p, err := ConfinePath(g.BaseDir, path)
+			if err != nil {
+				return nil, err
+			}
+			return sqliteQuery(g.Run.Context(), p, query, params...)
+		},
+	})
+}
+
+// sqliteQuery opens path read-only (query_only also rejects writes through
+// ATTACH or pragmas) and returns the rows. Only a single SELECT-like
+// statement is accepted, so ATTACH can't open a database outside path. The
+// query is interrupted when ctx ends.
+func sqliteQuery(ctx context.Context, path, query string, params ...interface{}) ([]map[string]interface{}, error) {
+	query, err := checkSQLiteQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("sqlite: %v", err)
+	}
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro&_pragma=query_only(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, sqliteQueryTimeout)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %v", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %v", err)
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		if len(result) >= MaxSQLiteRows {
+			return nil, fmt.Errorf("sqlite: more than %d rows, add a LIMIT", MaxSQLiteRows)
+		}
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("sqlite: %v", err)
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: %v", err)
+	}
+	return result, nil
+}
+
+// sqliteReadStatements are the statements sqlite.query runs.
+var sqliteReadStatements = map[string]bool{"SELECT": true, "WITH": true, "VALUES": true, "EXPLAIN": true}
+
+// checkSQLiteQuery returns the single statement of query, which must start
+// with SELECT, WITH, VALUES or EXPLAIN. The driver runs every statement of a
+// multi-statement string, which would let "SELECT 1; ATTACH ..." through.
+func checkSQLiteQuery(query string) (string, error) {
+	stmt, rest := splitSQLStatement(query)
+	if strings.TrimSpace(skipSQLComments(rest)) != "" {
+		return "", fmt.Errorf("sqlite: only a single statement is allowed")
+	}
+	word := strings.TrimSpace(skipSQLComments(stmt))
+	if i := strings.IndexFunc(word, func(r rune) bool { return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') }); i >= 0 {
+		word = word[:i]
+	}
+	if !sqliteReadStatements[strings.ToUpper(word)] {
+		return "", fmt.Errorf("sqlite: only SELECT, WITH, VALUES and EXPLAIN statements are allowed")
+	}
+	return stmt, nil
+}
+
+// splitSQLStatement returns the first statement of query and what follows
+// its terminating ";". Quotes, identifiers and comments are skipped.
+func splitSQLStatement(query string) (stmt, rest string) {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"', '`':
+			if j := strings.IndexByte(query[i+1:], c); j >= 0 {
+				i += j + 1
+			} else {
+				return query, ""
+			}
+		case '[':
+			if j := strings.IndexByte(query[i+1:], ']'); j >= 0 {
+				i += j + 1
+			} else {
+				return query, ""
+			}
+		case '-':
+			if strings.HasPrefix(query[i:], "--") {
+				if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+					i += j
+				} else {
+					return query, ""
+				}
+			}
+		case '/':
+			if strings.HasPrefix(query[i:], "/*") {
+				if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+					i += j + 3
+				} else {
+					return query, ""
+				}
+			}
+		case ';':
+			return query[:i], query[i+1:]
+		}
+	}
+	return query, ""
+}
+
+// skipSQLComments drops leading whitespace, "--" and "/* */" comments.
+func skipSQLComments(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		switch {
+		case strings.HasPrefix(s, "--"):
+			j := strings.IndexByte(s, '\n')
+			if j < 0 {
+				return ""
+			}
+			s = s[j+1:]
+		case strings.HasPrefix(s, "/*"):
+			j := strings.Index(s[2:], "*/")
+			if j < 0 {
+				return ""
+			}
+			s = s[j+4:]
+		default:
+			return s
+		}
+	}
+}
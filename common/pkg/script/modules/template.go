@@ -0,0 +1,68 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/dop251/goja"
+)
+
+func init() {
+	Register(ModuleDoc{
+		Name: "template",
+		Desc: "Go text/template rendering, e.g. \"Hello {{.name}}\"; functions: upper, lower, trim, join, json, default",
+		Functions: []FunctionDoc{
+			{
+				Name: "render",
+				Desc: "Render a template with data",
+				Params: []Parameter{
+					{Name: "template", Type: "string", Desc: "Template source"},
+					{Name: "data", Type: "any", Desc: "Value of . in the template", Optional: true},
+				},
+				Returns: "string",
+			},
+		},
+		Register: registerTemplate,
+	})
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"join": func(sep string, items []interface{}) string {
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+func registerTemplate(vm *goja.Runtime) {
+	vm.Set("template", map[string]interface{}{
+		"render": func(src string, data interface{}) (string, error) {
+			tpl, err := template.New("template").Funcs(templateFuncs).Option("missingkey=zero").Parse(src)
+			if err != nil {
+				return "", fmt.Errorf("template: %v", err)
+			}
+			var b strings.Builder
+			if err := tpl.Execute(&b, data); err != nil {
+				return "", fmt.Errorf("template: %v", err)
+			}
+			return b.String(), nil
+		},
+	})
+}
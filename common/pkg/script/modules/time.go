@@ -0,0 +1,148 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func init() {
+	Register(ModuleDoc{
+		Name: "time",
+		Desc: "Date parsing, formatting and durations. Timestamps are Unix milliseconds; layouts are Go layouts (2006-01-02 15:04:05) or a name: RFC3339, RFC1123, DateTime, DateOnly, TimeOnly, Kitchen",
+		Functions: []FunctionDoc{
+			{
+				Name:    "now",
+				Desc:    "Current time",
+				Returns: "number (ms)",
+			},
+			{
+				Name: "parse",
+				Desc: "Parse a date; without a layout RFC3339, DateTime and DateOnly are tried",
+				Params: []Parameter{
+					{Name: "value", Type: "string", Desc: "Date to parse"},
+					{Name: "layout", Type: "string", Desc: "Layout of value", Optional: true},
+					{Name: "timezone", Type: "string", Desc: "IANA zone for values without an offset (default UTC)", Optional: true},
+				},
+				Returns: "number (ms)",
+			},
+			{
+				Name: "format",
+				Desc: "Format a timestamp (default RFC3339)",
+				Params: []Parameter{
+					{Name: "ms", Type: "number", Desc: "Timestamp"},
+					{Name: "layout", Type: "string", Desc: "Output layout", Optional: true},
+					{Name: "timezone", Type: "string", Desc: "IANA zone (default UTC)", Optional: true},
+				},
+				Returns: "string",
+			},
+			{
+				Name: "duration",
+				Desc: "Parse a duration such as 1h30m or 250ms",
+				Params: []Parameter{
+					{Name: "value", Type: "string", Desc: "Duration"},
+				},
+				Returns: "number (ms)",
+			},
+			{
+				Name: "formatDuration",
+				Desc: "Format milliseconds as a duration such as 1h30m0s",
+				Params: []Parameter{
+					{Name: "ms", Type: "number", Desc: "Duration in milliseconds"},
+				},
+				Returns: "string",
+			},
+			{
+				Name: "add",
+				Desc: "Add a duration to a timestamp",
+				Params: []Parameter{
+					{Name: "ms", Type: "number", Desc: "Timestamp"},
+					{Name: "duration", Type: "string", Desc: "Duration such as 24h or -15m"},
+				},
+				Returns: "number (ms)",
+			},
+		},
+		Register: registerTime,
+	})
+}
+
+var namedLayouts = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"rfc1123":  time.RFC1123,
+	"datetime": time.DateTime,
+	"dateonly": time.DateOnly,
+	"date":     time.DateOnly,
+	"timeonly": time.TimeOnly,
+	"kitchen":  time.Kitchen,
+}
+
+func timeLayout(layout string) string {
+	if l, ok := namedLayouts[strings.ToLower(layout)]; ok {
+		return l
+	}
+	return layout
+}
+
+func timeLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("time: unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+func registerTime(vm *goja.Runtime) {
+	vm.Set("time", map[string]interface{}{
+		"now": func() int64 {
+			return time.Now().UnixMilli()
+		},
+		"parse": func(value, layout, timezone string) (int64, error) {
+			loc, err := timeLocation(timezone)
+			if err != nil {
+				return 0, err
+			}
+			layouts := []string{time.RFC3339Nano, time.DateTime, time.DateOnly}
+			if layout != "" {
+				layouts = []string{timeLayout(layout)}
+			}
+			for _, l := range layouts {
+				if t, err := time.ParseInLocation(l, strings.TrimSpace(value), loc); err == nil {
+					return t.UnixMilli(), nil
+				}
+			}
+			return 0, fmt.Errorf("time: cannot parse %q", value)
+		},
+		"format": func(ms int64, layout, timezone string) (string, error) {
+			loc, err := timeLocation(timezone)
+			if err != nil {
+				return "", err
+			}
+			if layout == "" {
+				layout = time.RFC3339
+			}
+			return time.UnixMilli(ms).In(loc).Format(timeLayout(layout)), nil
+		},
+		"duration": func(value string) (int64, error) {
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return 0, fmt.Errorf("time: %v", err)
+			}
+			return d.Milliseconds(), nil
+		},
+		"formatDuration": func(ms int64) string {
+			return (time.Duration(ms) * time.Millisecond).String()
+		},
+		"add": func(ms int64, duration string) (int64, error) {
+			d, err := time.ParseDuration(strings.TrimSpace(duration))
+			if err != nil {
+				return 0, fmt.Errorf("time: %v", err)
+			}
+			return time.UnixMilli(ms).Add(d).UnixMilli(), nil
+		},
+	})
+}
@@ -0,0 +1,53 @@
+package modules
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	Register(ModuleDoc{
+		Name: "yaml",
+		Desc: "YAML encoding/decoding",
+		Functions: []FunctionDoc{
+			{
+				Name: "parse",
+				Desc: "Parse a YAML document",
+				Params: []Parameter{
+					{Name: "text", Type: "string", Desc: "YAML to parse"},
+				},
+				Returns: "any",
+			},
+			{
+				Name: "stringify",
+				Desc: "Convert a value to YAML",
+				Params: []Parameter{
+					{Name: "value", Type: "any", Desc: "Value to convert"},
+				},
+				Returns: "string",
+			},
+		},
+		Register: registerYAML,
+	})
+}
+
+func registerYAML(vm *goja.Runtime) {
+	vm.Set("yaml", map[string]interface{}{
+		"parse": func(text string) (interface{}, error) {
+			var v interface{}
+			if err := yaml.Unmarshal([]byte(text), &v); err != nil {
+				return nil, fmt.Errorf("yaml: %v", err)
+			}
+			return v, nil
+		},
+		"stringify": func(value interface{}) (string, error) {
+			b, err := yaml.Marshal(value)
+			if err != nil {
+				return "", fmt.Errorf("yaml: %v", err)
+			}
+			return string(b), nil
+		},
+	})
+}
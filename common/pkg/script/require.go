@@ -0,0 +1,181 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"iat/common/pkg/script/modules"
+	"iat/common/pkg/tools"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ProjectScriptsDir is where require() looks for a project's script files.
+const ProjectScriptsDir = ".iat/scripts"
+
+// ModuleSource tells require() where to find modules besides the builtins.
+type ModuleSource struct {
+	// ProjectRoot enables requiring .js and .ts files under
+	// ProjectRoot/.iat/scripts.
+	ProjectRoot string
+	// Stored looks up a stored script by name; found is false when there is
+	// none; content must be JavaScript (see Compile). Stored scripts run
+	// with the grants of the requiring script.
+	Stored func(name string) (content string, found bool, err error)
+}
+
+// moduleRegistry implements CommonJS require() for one run: every module is
+// evaluated at most once and cyclic requires fail.
+type moduleRegistry struct {
+	vm      *goja.Runtime
+	src     ModuleSource
+	modules map[string]*goja.Object // key -> module object
+	loading []string                // keys being evaluated, outermost first
+}
+
+func newModuleRegistry(vm *goja.Runtime, src ModuleSource) *moduleRegistry {
+	r := &moduleRegistry{vm: vm, src: src, modules: make(map[string]*goja.Object)}
+	vm.Set("require", r.requireFrom(""))
+	return r
+}
+
+// requireFrom returns the require function of a module; dir is the module's
+// directory for relative requires, "" when relative requires aren't possible
+// (the main script and stored scripts resolve them against the scripts dir).
+func (r *moduleRegistry) requireFrom(dir string) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		name := strings.TrimSpace(call.Argument(0).String())
+		v, err := r.require(name, dir)
+		if err != nil {
+			panic(r.vm.NewGoError(err))
+		}
+		return v
+	}
+}
+
+func (r *moduleRegistry) require(name, dir string) (goja.Value, error) {
+	if name == "" {
+		return nil, errors.New("require: module name is required")
+	}
+	if modules.IsBuiltin(name) || name == HostModule {
+		v := r.vm.Get(name)
+		if v == nil || goja.IsUndefined(v) {
+			return nil, fmt.Errorf("require: module %q is not available to this script (capability not granted)", name)
+		}
+		return v, nil
+	}
+
+	key, source, modDir, err := r.resolve(name, dir)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := r.modules[key]; ok {
+		return m.Get("exports"), nil
+	}
+	for i, k := range r.loading {
+		if k == key {
+			chain := append(append([]string{}, r.loading[i:]...), key)
+			return nil, fmt.Errorf("require: cyclic dependency %s", strings.Join(chain, " -> "))
+		}
+	}
+	return r.load(key, source, modDir)
+}
+
+// resolve finds the module for name. Relative names ("./x", "../x") are
+// files next to the requiring module; bare names are stored scripts first,
+// then files in the project scripts dir.
+func (r *moduleRegistry) resolve(name, dir string) (key, source, modDir string, err error) {
+	scriptsDir := ""
+	if r.src.ProjectRoot != "" {
+		scriptsDir = filepath.Join(r.src.ProjectRoot, filepath.FromSlash(ProjectScriptsDir))
+	}
+	relative := strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../")
+
+	if !relative && r.src.Stored != nil {
+		content, found, err := r.src.Stored(name)
+		if err != nil {
+			return "", "", "", fmt.Errorf("require %q: %v", name, err)
+		}
+		if found {
+			return "script:" + name, content, "", nil
+		}
+	}
+	if scriptsDir == "" {
+		return "", "", "", fmt.Errorf("require: cannot find module %q", name)
+	}
+
+	base := scriptsDir
+	if relative && dir != "" {
+		base = dir
+	}
+	for _, candidate := range moduleCandidates(name) {
+		p := filepath.Join(base, filepath.FromSlash(candidate))
+		// 模块文件必须位于项目脚本目录内
+		if _, err := tools.ResolvePathInBase(scriptsDir, p); err != nil {
+			return "", "", "", fmt.Errorf("require %q: path escapes %s", name, ProjectScriptsDir)
+		}
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		// 符号链接也不能指向脚本目录之外
+		if _, err := modules.ConfinePath(scriptsDir, p); err != nil {
+			return "", "", "", fmt.Errorf("require %q: path escapes %s", name, ProjectScriptsDir)
+		}
+		if _, err := modules.ConfinePath(r.src.ProjectRoot, p); err != nil {
+			return "", "", "", fmt.Errorf("require %q: path escapes the project", name)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return "", "", "", fmt.Errorf("require %q: %v", name, err)
+		}
+		rel, _ := filepath.Rel(r.src.ProjectRoot, p)
+		rel = filepath.ToSlash(rel)
+		code := string(data)
+		if strings.HasSuffix(p, ".ts") {
+			if code, err = Transpile(code, rel); err != nil {
+				return "", "", "", err
+			}
+		}
+		return "file:" + rel, code, filepath.Dir(p), nil
+	}
+	return "", "", "", fmt.Errorf("require: cannot find module %q", name)
+}
+
+func moduleCandidates(name string) []string {
+	if strings.HasSuffix(name, ".js") || strings.HasSuffix(name, ".ts") {
+		return []string{name}
+	}
+	return []string{name + ".js", name + ".ts", name, name + "/index.js", name + "/index.ts"}
+}
+
+func (r *moduleRegistry) load(key, source, dir string) (goja.Value, error) {
+	r.loading = append(r.loading, key)
+	defer func() { r.loading = r.loading[:len(r.loading)-1] }()
+
+	prog, err := goja.Compile(key, "(function (exports, require, module, __filename, __dirname) {"+source+"\n})", false)
+	if err != nil {
+		return nil, fmt.Errorf("require %s: %v", key, err)
+	}
+	fnVal, err := r.vm.RunProgram(prog)
+	if err != nil {
+		return nil, err
+	}
+	fn, _ := goja.AssertFunction(fnVal)
+
+	module := r.vm.NewObject()
+	exports := r.vm.NewObject()
+	_ = module.Set("exports", exports)
+	_ = module.Set("id", key)
+	filename := ""
+	if dir != "" {
+		filename = strings.TrimPrefix(key, "file:")
+	}
+	if _, err := fn(goja.Undefined(), exports, r.vm.ToValue(r.requireFrom(dir)), module, r.vm.ToValue(filename), r.vm.ToValue(dir)); err != nil {
+		return nil, err
+	}
+	r.modules[key] = module
+	return module.Get("exports"), nil
+}
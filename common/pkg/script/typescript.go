@@ -0,0 +1,87 @@
+package script
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"iat/common/model"
+	"strings"
+	"sync"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// maxTranspileCache bounds the transpiled sources kept in memory.
+const maxTranspileCache = 256
+
+var transpileCache = struct {
+	sync.Mutex
+	entries map[[sha256.Size]byte]string
+}{entries: make(map[[sha256.Size]byte]string)}
+
+// IsTypeScript reports whether lang names TypeScript.
+func IsTypeScript(lang string) bool {
+	switch strings.ToLower(strings.TrimSpace(lang)) {
+	case model.ScriptLangTypeScript, "ts":
+		return true
+	}
+	return false
+}
+
+// Compile returns the JavaScript to run for src written in lang; TypeScript
+// is transpiled, anything else is returned as is. filename names the source
+// in diagnostics and stack traces.
+func Compile(lang, src, filename string) (string, error) {
+	if !IsTypeScript(lang) {
+		return src, nil
+	}
+	return Transpile(src, filename)
+}
+
+// Transpile strips the types of a TypeScript source. The output carries an
+// inline source map, so goja reports stack traces in TS line numbers; syntax
+// errors are reported as "file:line:column: message". Results are cached by
+// content hash. Types are not checked: use the declarations of
+// modules.TypeDeclarations in an editor for that.
+func Transpile(src, filename string) (string, error) {
+	if filename == "" {
+		filename = "script.ts"
+	}
+	key := sha256.Sum256([]byte(filename + "\x00" + src))
+	transpileCache.Lock()
+	code, ok := transpileCache.entries[key]
+	transpileCache.Unlock()
+	if ok {
+		return code, nil
+	}
+
+	res := api.Transform(src, api.TransformOptions{
+		Loader:     api.LoaderTS,
+		Sourcefile: filename,
+		Sourcemap:  api.SourceMapInline,
+		Target:     api.ES2022, // 保留顶层 await，由引擎包装
+	})
+	if len(res.Errors) > 0 {
+		return "", transpileError(filename, res.Errors)
+	}
+	code = string(res.Code)
+
+	transpileCache.Lock()
+	if len(transpileCache.entries) >= maxTranspileCache {
+		transpileCache.entries = make(map[[sha256.Size]byte]string)
+	}
+	transpileCache.entries[key] = code
+	transpileCache.Unlock()
+	return code, nil
+}
+
+func transpileError(filename string, msgs []api.Message) error {
+	lines := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Location == nil {
+			lines = append(lines, fmt.Sprintf("%s: %s", filename, m.Text))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s:%d:%d: %s", m.Location.File, m.Location.Line, m.Location.Column+1, m.Text))
+	}
+	return fmt.Errorf("typescript: %s", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,255 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// --- Declarative API Tools ---
+
+// APIToolSpec is the Content of a tool with type "api". Strings may contain
+// {{arg}} placeholders that are filled from the tool call arguments; nested
+// values are addressed with dots ({{user.id}}). A filter picks the encoding:
+// {{arg|json}} inserts the JSON encoding, {{arg|url}} URL-escapes, {{arg|raw}}
+// inserts the value as is. Placeholders in the URL are URL-escaped by default,
+// everywhere else they are inserted raw.
+//
+//	{
+//	  "method": "POST",
+//	  "url": "https://api.internal/v1/users/{{id}}?expand={{expand}}",
+//	  "headers": {"Accept": "application/json"},
+//	  "body": "{\"note\": {{note|json}}}",
+//	  "auth": {"type": "bearer", "secret": "env:INTERNAL_API_TOKEN"},
+//	  "extract": "$.data.name"
+//	}
+type APIToolSpec struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Auth    *APIToolAuth      `json:"auth,omitempty"`
+	Extract string            `json:"extract,omitempty"` // JSONPath applied to a JSON response
+	Timeout int               `json:"timeout,omitempty"` // seconds
+}
+
+// APIToolAuth references a credential instead of embedding it in the tool.
+// Secret is a reference such as "env:NAME"; the value is read when the tool
+// is called.
+type APIToolAuth struct {
+	Type     string `json:"type"`               // bearer, basic, header
+	Secret   string `json:"secret"`             // token, password or header value
+	Username string `json:"username,omitempty"` // basic auth
+	Header   string `json:"header,omitempty"`   // header auth, e.g. X-Api-Key
+}
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*(?:\|\s*(json|url|raw)\s*)?\}\}`)
+
+// ParseAPIToolSpec parses and checks the Content of an api tool.
+func ParseAPIToolSpec(content string) (*APIToolSpec, error) {
+	var spec APIToolSpec
+	if err := json.Unmarshal([]byte(content), &spec); err != nil {
+		return nil, fmt.Errorf("invalid api tool definition: %v", err)
+	}
+	if strings.TrimSpace(spec.URL) == "" {
+		return nil, fmt.Errorf("invalid api tool definition: url is required")
+	}
+	if _, err := apiTemplateHost(spec.URL); err != nil {
+		return nil, fmt.Errorf("invalid api tool definition: %v", err)
+	}
+	if spec.Extract != "" {
+		if _, err := compileJSONPath(spec.Extract); err != nil {
+			return nil, fmt.Errorf("invalid api tool definition: %v", err)
+		}
+	}
+	if spec.Auth != nil {
+		switch strings.ToLower(spec.Auth.Type) {
+		case "bearer", "basic":
+		case "header":
+			if spec.Auth.Header == "" {
+				return nil, fmt.Errorf("invalid api tool definition: auth.header is required for header auth")
+			}
+		default:
+			return nil, fmt.Errorf("invalid api tool definition: unknown auth type %q", spec.Auth.Type)
+		}
+	}
+	return &spec, nil
+}
+
+// apiTemplateHost returns the host of a URL template. Placeholders are not
+// allowed in the scheme or host so a tool call can't redirect the request to
+// another server.
+func apiTemplateHost(tmpl string) (string, error) {
+	u, err := url.Parse(placeholderRe.ReplaceAllString(tmpl, "x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("url must be http or https")
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("url has no host")
+	}
+	if end := strings.Index(tmpl, u.Host); end < 0 || strings.Contains(tmpl[:end+len(u.Host)], "{{") {
+		return "", fmt.Errorf("placeholders are not allowed in the url scheme or host")
+	}
+	return u.Host, nil
+}
+
+// RenderAPITemplate fills the placeholders in tmpl. inURL selects the
+// default encoding: URL-escaped (path or query escaping depending on where
+// the placeholder is) instead of raw.
+func RenderAPITemplate(tmpl string, args map[string]any, inURL bool) string {
+	query := len(tmpl)
+	if i := strings.Index(tmpl, "?"); inURL && i >= 0 {
+		query = i
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(tmpl, -1) {
+		sb.WriteString(tmpl[last:m[0]])
+		last = m[1]
+
+		val, found := lookupArg(args, tmpl[m[2]:m[3]])
+		filter := "raw"
+		if m[4] >= 0 {
+			filter = tmpl[m[4]:m[5]]
+		} else if inURL {
+			filter = "url"
+		}
+		switch {
+		case filter == "json":
+			b, _ := json.Marshal(val)
+			sb.Write(b)
+		case !found:
+		case filter == "url" && m[0] < query:
+			sb.WriteString(url.PathEscape(argString(val)))
+		case filter == "url":
+			sb.WriteString(url.QueryEscape(argString(val)))
+		default:
+			sb.WriteString(argString(val))
+		}
+	}
+	sb.WriteString(tmpl[last:])
+	return sb.String()
+}
+
+func lookupArg(args map[string]any, path string) (any, bool) {
+	var cur any = args
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func argString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case map[string]any, []any:
+		b, _ := json.Marshal(val)
+		return string(b)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// resolveSecretRef resolves a credential reference. Only environment
+// variables ("env:NAME") are supported.
+func resolveSecretRef(ref string) (string, error) {
+	name, ok := strings.CutPrefix(strings.TrimSpace(ref), "env:")
+	if !ok || name == "" {
+		return "", fmt.Errorf("unsupported secret reference %q (expected env:NAME)", ref)
+	}
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("secret %s is not set", ref)
+	}
+	return val, nil
+}
+
+// CallAPITool executes an api tool. Requests may only go to the host in the
+// tool's URL template (redirects included), and that host must be allowed by
+// policy like any other outgoing request. Non-2xx responses are errors; with
+// an extractor the selected JSON value is returned, otherwise the body.
+// Cancelling ctx aborts the request.
+func CallAPITool(ctx context.Context, policy HttpPolicy, content string, args map[string]any) (string, error) {
+	spec, err := ParseAPIToolSpec(content)
+	if err != nil {
+		return "", err
+	}
+	host, _ := apiTemplateHost(spec.URL)
+	if !HostAllowed(policy.AllowedHosts, host) {
+		return "", fmt.Errorf("host %q is not in the project's HTTP allowlist", host)
+	}
+
+	headers := make(map[string]string, len(spec.Headers)+1)
+	for k, v := range spec.Headers {
+		headers[k] = RenderAPITemplate(v, args, false)
+	}
+	if spec.Auth != nil {
+		secret, err := resolveSecretRef(spec.Auth.Secret)
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(spec.Auth.Type) {
+		case "bearer":
+			headers["Authorization"] = "Bearer " + secret
+		case "basic":
+			headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(spec.Auth.Username+":"+secret))
+		case "header":
+			headers[spec.Auth.Header] = secret
+		}
+	}
+
+	resp, err := HttpRequest(ctx, HttpPolicy{AllowedHosts: []string{host}, MaxBodyBytes: policy.MaxBodyBytes}, HttpRequestOptions{
+		Method:  spec.Method,
+		URL:     RenderAPITemplate(spec.URL, args, true),
+		Headers: headers,
+		Body:    RenderAPITemplate(spec.Body, args, false),
+		Timeout: time.Duration(spec.Timeout) * time.Second,
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Status < 200 || resp.Status > 299 {
+		body := resp.Body
+		if len(body) > 2000 {
+			body = body[:2000] + "..."
+		}
+		return "", fmt.Errorf("api returned status %d: %s", resp.Status, body)
+	}
+	if spec.Extract == "" {
+		return resp.Body, nil
+	}
+
+	var doc any
+	if err := json.Unmarshal([]byte(resp.Body), &doc); err != nil {
+		return "", fmt.Errorf("cannot apply extractor, response is not JSON: %v", err)
+	}
+	val, err := EvalJSONPath(spec.Extract, doc)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
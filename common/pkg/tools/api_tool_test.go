@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCallAPITool(t *testing.T) {
+	var gotPath, gotQuery, gotAuth, gotBody, gotMethod string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotPath = r.URL.EscapedPath()
+		gotQuery = r.URL.RawQuery
+		gotAuth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		if r.URL.Path == "/missing" {
+			http.Error(w, "not here", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"name":"Ada","items":[{"id":1},{"id":2}]}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("TEST_API_TOKEN", "s3cret")
+
+	spec := map[string]any{
+		"method":  "POST",
+		"url":     srv.URL + "/users/{{id}}?q={{query}}",
+		"headers": map[string]string{"X-Trace": "{{trace}}"},
+		"body":    `{"note": {{note|json}}, "tags": {{tags|json}}}`,
+		"auth":    map[string]string{"type": "bearer", "secret": "env:TEST_API_TOKEN"},
+		"extract": "$.data.name",
+	}
+	content, _ := json.Marshal(spec)
+	if _, err := CallAPITool(context.Background(), HttpPolicy{AllowedHosts: []string{"example.com"}}, string(content), map[string]any{"id": "1"}); err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("expected host outside the allowlist to be refused, got %v", err)
+	}
+	policy := HttpPolicy{AllowedHosts: []string{"127.0.0.1"}}
+	out, err := CallAPITool(context.Background(), policy, string(content), map[string]any{
+		"id":    "a/b",
+		"query": "x y",
+		"trace": "t-1",
+		"note":  `say "hi"`,
+		"tags":  []any{"a"},
+	})
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if out != "Ada" {
+		t.Fatalf("unexpected extract result %q", out)
+	}
+	if gotMethod != "POST" || gotPath != "/users/a%2Fb" || gotQuery != "q=x+y" || gotAuth != "Bearer s3cret" {
+		t.Fatalf("unexpected request: %s %s?%s auth=%q", gotMethod, gotPath, gotQuery, gotAuth)
+	}
+	if gotBody != `{"note": "say \"hi\"", "tags": ["a"]}` {
+		t.Fatalf("unexpected body %s", gotBody)
+	}
+
+	spec["extract"] = "$.data.items[*].id"
+	content, _ = json.Marshal(spec)
+	if out, err := CallAPITool(context.Background(), policy, string(content), map[string]any{"id": "1"}); err != nil || out != "[1,2]" {
+		t.Fatalf("wildcard extract: %q %v", out, err)
+	}
+
+	spec["url"] = srv.URL + "/missing"
+	content, _ = json.Marshal(spec)
+	if _, err := CallAPITool(context.Background(), policy, string(content), nil); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestParseAPIToolSpec_RejectsHostPlaceholder(t *testing.T) {
+	for _, content := range []string{
+		`{"url": "https://{{host}}/api"}`,
+		`{"url": "{{scheme}}://example.com/api"}`,
+		`{"url": "ftp://example.com/api"}`,
+		`{"url": "https://example.com/api", "extract": "data.name"}`,
+		`{"url": "https://example.com/api", "auth": {"type": "oauth"}}`,
+	} {
+		if _, err := ParseAPIToolSpec(content); err == nil {
+			t.Errorf("expected %s to be rejected", content)
+		}
+	}
+	if _, err := ParseAPIToolSpec(`{"url": "https://example.com/api/{{id}}"}`); err != nil {
+		t.Errorf("expected path placeholder to be accepted: %v", err)
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"a":{"b":[{"c":1},{"c":2},{"d":{"c":3}}]},"k-1":"v"}`), &doc)
+	cases := map[string]string{
+		"$.a.b[0].c":  `1`,
+		"$.a.b[-1].d": `{"c":3}`,
+		"$['k-1']":    `"v"`,
+		"$.a.b[*].c":  `[1,2]`,
+		"$..c":        `[1,2,3]`,
+	}
+	for expr, want := range cases {
+		v, err := EvalJSONPath(expr, doc)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := compactJSON(v); got != want {
+			t.Errorf("%s = %s, want %s", expr, got, want)
+		}
+	}
+	if _, err := EvalJSONPath("$.nope", doc); err == nil {
+		t.Error("expected error for missing key")
+	}
+}
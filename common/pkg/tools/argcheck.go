@@ -0,0 +1,364 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --- Tool Argument Validation ---
+
+// ArgProblem is a single violation of a tool's parameter schema. Path is a
+// dotted path into the arguments ("" for the root, "paths[2]" for array items).
+type ArgProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ArgValidationError is returned when tool arguments don't match the schema
+// declared for the tool.
+type ArgValidationError struct {
+	Tool     string       `json:"tool"`
+	Problems []ArgProblem `json:"problems"`
+}
+
+func (e *ArgValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		if p.Path == "" {
+			msgs = append(msgs, p.Message)
+		} else {
+			msgs = append(msgs, p.Path+": "+p.Message)
+		}
+	}
+	return fmt.Sprintf("invalid arguments for tool %s: %s", e.Tool, strings.Join(msgs, "; "))
+}
+
+// Feedback renders the error as JSON for the model, so it can fix the call.
+func (e *ArgValidationError) Feedback() string {
+	b, _ := json.Marshal(struct {
+		Error    string       `json:"error"`
+		Tool     string       `json:"tool"`
+		Problems []ArgProblem `json:"problems"`
+		Hint     string       `json:"hint"`
+	}{
+		Error:    "invalid_arguments",
+		Tool:     e.Tool,
+		Problems: e.Problems,
+		Hint:     "The call was not executed. Fix the listed arguments to match the tool's parameter schema and call it again.",
+	})
+	return string(b)
+}
+
+// ParseToolArgs decodes the raw JSON arguments of a tool call. An empty
+// string is treated as an empty object.
+func ParseToolArgs(tool, raw string) (map[string]any, error) {
+	args := map[string]any{}
+	if strings.TrimSpace(raw) == "" {
+		return args, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &args); err != nil {
+		return nil, &ArgValidationError{Tool: tool, Problems: []ArgProblem{{Message: "arguments are not a valid JSON object: " + err.Error()}}}
+	}
+	if args == nil {
+		args = map[string]any{}
+	}
+	return args, nil
+}
+
+// ValidateToolArgs checks args against a JSON schema (decoded into generic
+// maps). It supports the subset used by tool declarations: type, properties,
+// required, additionalProperties, items, enum, const, min/max constraints,
+// pattern and anyOf/oneOf/allOf.
+func ValidateToolArgs(tool string, schema map[string]any, args map[string]any) error {
+	if len(schema) == 0 {
+		return nil
+	}
+	var problems []ArgProblem
+	validateValue(schema, args, "", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ArgValidationError{Tool: tool, Problems: problems}
+}
+
+// SchemaToMap converts any JSON-marshalable schema (string, []byte, struct)
+// into a generic map for ValidateToolArgs.
+func SchemaToMap(schema any) (map[string]any, error) {
+	var raw []byte
+	switch v := schema.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	case map[string]any:
+		return v, nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func validateValue(schema map[string]any, v any, path string, problems *[]ArgProblem) {
+	add := func(format string, a ...any) {
+		*problems = append(*problems, ArgProblem{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		ok := false
+		for _, t := range types {
+			if matchesType(t, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			add("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(v))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("must be one of %s, got %s", compactJSON(enum), compactJSON(v))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, v) {
+		add("must be %s", compactJSON(c))
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		validateObject(schema, val, path, problems)
+	case []any:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(val)) < n {
+			add("must have at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(val)) > n {
+			add("must have at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case string:
+		n := float64(len([]rune(val)))
+		if min, ok := schemaNumber(schema["minLength"]); ok && n < min {
+			add("must be at least %v characters", min)
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && n > max {
+			add("must be at most %v characters", max)
+		}
+		if pat, ok := schema["pattern"].(string); ok && pat != "" {
+			if re, err := regexp.Compile(pat); err == nil && !re.MatchString(val) {
+				add("must match pattern %q", pat)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema["minimum"]); ok && val < min {
+			add("must be >= %v", min)
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && val > max {
+			add("must be <= %v", max)
+		}
+		if min, ok := schemaNumber(schema["exclusiveMinimum"]); ok && val <= min {
+			add("must be > %v", min)
+		}
+		if max, ok := schemaNumber(schema["exclusiveMaximum"]); ok && val >= max {
+			add("must be < %v", max)
+		}
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			if m, ok := sub.(map[string]any); ok {
+				validateValue(m, v, path, problems)
+			}
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		alts, ok := schema[key].([]any)
+		if !ok || len(alts) == 0 {
+			continue
+		}
+		matched := 0
+		for _, sub := range alts {
+			m, ok := sub.(map[string]any)
+			if !ok {
+				continue
+			}
+			var p []ArgProblem
+			validateValue(m, v, path, &p)
+			if len(p) == 0 {
+				matched++
+			}
+		}
+		if key == "anyOf" && matched == 0 {
+			add("must match at least one of the allowed schemas")
+		}
+		if key == "oneOf" && matched != 1 {
+			add("must match exactly one of the allowed schemas")
+		}
+	}
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string, problems *[]ArgProblem) {
+	props, _ := schema["properties"].(map[string]any)
+
+	if req, ok := schema["required"].([]any); ok {
+		for _, r := range req {
+			name, _ := r.(string)
+			if _, present := obj[name]; name != "" && !present {
+				*problems = append(*problems, ArgProblem{Path: joinArgPath(path, name), Message: "required property is missing"})
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if sub, ok := props[k].(map[string]any); ok {
+			validateValue(sub, obj[k], joinArgPath(path, k), problems)
+			continue
+		}
+		switch ap := schema["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				msg := "unknown property"
+				if len(props) > 0 {
+					names := make([]string, 0, len(props))
+					for n := range props {
+						names = append(names, n)
+					}
+					sort.Strings(names)
+					msg += fmt.Sprintf(" (allowed: %s)", strings.Join(names, ", "))
+				}
+				*problems = append(*problems, ArgProblem{Path: joinArgPath(path, k), Message: msg})
+			}
+		case map[string]any:
+			validateValue(ap, obj[k], joinArgPath(path, k), problems)
+		}
+	}
+}
+
+func joinArgPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func schemaTypes(t any) []string {
+	switch v := t.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func matchesType(t string, v any) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+func jsonTypeName(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func jsonEqual(a, b any) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
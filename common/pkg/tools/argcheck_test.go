@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const readRangeSchema = `{
+	"type": "object",
+	"properties": {
+		"path":      {"type": "string"},
+		"startLine": {"type": "integer", "minimum": 1},
+		"limit":     {"type": "integer"},
+		"mode":      {"type": "string", "enum": ["a", "b"]},
+		"tags":      {"type": "array", "items": {"type": "string"}}
+	},
+	"required": ["path", "startLine", "limit"]
+}`
+
+func TestValidateToolArgs(t *testing.T) {
+	schema, err := SchemaToMap(readRangeSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, _ := ParseToolArgs("read_file_range", `{"path":"a.go","startLine":3,"limit":10,"tags":["x"]}`)
+	if err := ValidateToolArgs("read_file_range", schema, valid); err != nil {
+		t.Fatalf("expected valid args, got %v", err)
+	}
+
+	bad, _ := ParseToolArgs("read_file_range", `{"startLine":"3","limit":1.5,"mode":"c","tags":["x",2]}`)
+	err = ValidateToolArgs("read_file_range", schema, bad)
+	var verr *ArgValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ArgValidationError, got %v", err)
+	}
+	want := map[string]string{
+		"path":      "required property is missing",
+		"startLine": "expected integer, got string",
+		"limit":     "expected integer, got number",
+		"mode":      "must be one of",
+		"tags[1]":   "expected string, got integer",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %+v", len(want), verr.Problems)
+	}
+	for _, p := range verr.Problems {
+		if msg, ok := want[p.Path]; !ok || !strings.Contains(p.Message, msg) {
+			t.Errorf("unexpected problem %+v", p)
+		}
+	}
+
+	var feedback map[string]any
+	if err := json.Unmarshal([]byte(verr.Feedback()), &feedback); err != nil || feedback["error"] != "invalid_arguments" {
+		t.Fatalf("feedback is not structured JSON: %s", verr.Feedback())
+	}
+}
+
+func TestParseToolArgs_Malformed(t *testing.T) {
+	if args, err := ParseToolArgs("x", ""); err != nil || len(args) != 0 {
+		t.Fatalf("empty arguments should parse as {}, got %v %v", args, err)
+	}
+	var verr *ArgValidationError
+	if _, err := ParseToolArgs("x", `{"path":`); !errors.As(err, &verr) {
+		t.Fatalf("expected ArgValidationError for malformed JSON, got %v", err)
+	}
+}
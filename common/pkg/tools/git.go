@@ -0,0 +1,639 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// --- Git ---
+
+// GitPolicy controls which destructive git operations tools may perform.
+type GitPolicy struct {
+	AllowHistoryRewrite bool // amend, force-push, reset --hard, rebase, force branch/worktree deletion
+}
+
+// MaxGitPatchBytes caps the patch text returned by GitDiff.
+const MaxGitPatchBytes = 100 * 1024
+
+type GitFileStatus struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"origPath,omitempty"` // source path of a rename/copy
+	Index    string `json:"index"`              // staged status code (e.g. "M", "A", "D", "R", "?")
+	Worktree string `json:"worktree"`           // unstaged status code
+}
+
+type GitStatusResult struct {
+	Branch   string          `json:"branch"`
+	Upstream string          `json:"upstream,omitempty"`
+	Ahead    int             `json:"ahead"`
+	Behind   int             `json:"behind"`
+	Clean    bool            `json:"clean"`
+	Files    []GitFileStatus `json:"files"`
+}
+
+type GitDiffOptions struct {
+	Staged bool     // diff the index against HEAD
+	From   string   // optional start revision; with To empty compares From to the worktree
+	To     string   // optional end revision
+	Paths  []string // limit to these paths
+}
+
+type GitDiffFile struct {
+	Path      string `json:"path"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary"`
+}
+
+type GitDiffResult struct {
+	Files     []GitDiffFile `json:"files"`
+	Patch     string        `json:"patch"`
+	Truncated bool          `json:"truncated"`
+}
+
+type GitCommitInfo struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+type GitCommitOptions struct {
+	Message string
+	Paths   []string // commit only these paths (they are staged first)
+	All     bool     // stage all tracked modifications (git commit -a)
+	Amend   bool     // rewrites history, requires GitPolicy.AllowHistoryRewrite
+}
+
+type GitCommitResult struct {
+	Hash    string `json:"hash"`
+	Branch  string `json:"branch"`
+	Summary string `json:"summary"`
+}
+
+type GitBranchOptions struct {
+	Action     string // list (default), create, switch, delete
+	Name       string
+	StartPoint string // for create / switch with Create
+	Create     bool   // switch: create the branch first
+	Force      bool   // delete: delete even if unmerged (requires AllowHistoryRewrite)
+}
+
+type GitBranchInfo struct {
+	Name     string `json:"name"`
+	Commit   string `json:"commit"`
+	Upstream string `json:"upstream,omitempty"`
+	Current  bool   `json:"current"`
+}
+
+type GitBranchResult struct {
+	Current  string          `json:"current"`
+	Branches []GitBranchInfo `json:"branches"`
+}
+
+type GitWorktreeOptions struct {
+	Action    string // list (default), add, remove
+	Path      string // absolute worktree path
+	Branch    string // add: branch to check out
+	NewBranch bool   // add: create Branch
+	Force     bool   // remove: discard local changes (requires AllowHistoryRewrite)
+}
+
+type GitWorktreeInfo struct {
+	Path     string `json:"path"`
+	Head     string `json:"head"`
+	Branch   string `json:"branch,omitempty"`
+	Detached bool   `json:"detached,omitempty"`
+	Bare     bool   `json:"bare,omitempty"`
+	Locked   bool   `json:"locked,omitempty"`
+}
+
+// runGit runs git in dir and returns stdout. Errors include stderr so the
+// model can see what git complained about.
+func runGit(dir string, args ...string) (string, error) {
+	if strings.TrimSpace(dir) == "" {
+		return "", fmt.Errorf("git requires a project directory")
+	}
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+func GitStatus(dir string) (*GitStatusResult, error) {
+	out, err := runGit(dir, "status", "--porcelain=v1", "--branch", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	res := &GitStatusResult{Files: []GitFileStatus{}}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if e == "" {
+			continue
+		}
+		if strings.HasPrefix(e, "## ") {
+			parseGitBranchHeader(res, strings.TrimPrefix(e, "## "))
+			continue
+		}
+		if len(e) < 4 {
+			continue
+		}
+		f := GitFileStatus{
+			Index:    strings.TrimSpace(e[0:1]),
+			Worktree: strings.TrimSpace(e[1:2]),
+			Path:     e[3:],
+		}
+		// Renames and copies are followed by the original path.
+		if (e[0] == 'R' || e[0] == 'C') && i+1 < len(entries) {
+			f.OrigPath = entries[i+1]
+			i++
+		}
+		res.Files = append(res.Files, f)
+	}
+	res.Clean = len(res.Files) == 0
+	return res, nil
+}
+
+// parseGitBranchHeader parses "main...origin/main [ahead 1, behind 2]".
+func parseGitBranchHeader(res *GitStatusResult, header string) {
+	if i := strings.Index(header, " ["); i >= 0 {
+		track := strings.TrimSuffix(header[i+2:], "]")
+		header = header[:i]
+		for _, part := range strings.Split(track, ", ") {
+			fields := strings.Fields(part)
+			if len(fields) != 2 {
+				continue
+			}
+			n, _ := strconv.Atoi(fields[1])
+			switch fields[0] {
+			case "ahead":
+				res.Ahead = n
+			case "behind":
+				res.Behind = n
+			}
+		}
+	}
+	header = strings.TrimPrefix(header, "No commits yet on ")
+	if branch, upstream, ok := strings.Cut(header, "..."); ok {
+		res.Branch, res.Upstream = branch, upstream
+	} else {
+		res.Branch = header
+	}
+}
+
+func GitDiff(dir string, opts GitDiffOptions) (*GitDiffResult, error) {
+	args := []string{}
+	if opts.Staged {
+		args = append(args, "--cached")
+	}
+	for _, rev := range []string{opts.From, opts.To} {
+		if rev == "" {
+			continue
+		}
+		if strings.HasPrefix(rev, "-") {
+			return nil, fmt.Errorf("invalid revision %q", rev)
+		}
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	args = append(args, opts.Paths...)
+
+	numstat, err := runGit(dir, append([]string{"diff", "--numstat", "-z"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := runGit(dir, append([]string{"diff"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GitDiffResult{Files: parseGitNumstat(numstat), Patch: patch}
+	if len(res.Patch) > MaxGitPatchBytes {
+		res.Patch = res.Patch[:MaxGitPatchBytes]
+		res.Truncated = true
+	}
+	return res, nil
+}
+
+// parseGitNumstat parses `git diff --numstat -z`. Renames are emitted as
+// "adds\tdels\t\x00old\x00new\x00".
+func parseGitNumstat(out string) []GitDiffFile {
+	files := []GitDiffFile{}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		fields := strings.SplitN(entries[i], "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		f := GitDiffFile{Path: fields[2]}
+		if fields[0] == "-" && fields[1] == "-" {
+			f.Binary = true
+		} else {
+			f.Additions, _ = strconv.Atoi(fields[0])
+			f.Deletions, _ = strconv.Atoi(fields[1])
+		}
+		if f.Path == "" && i+2 < len(entries) {
+			f.Path = entries[i+2]
+			i += 2
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func GitLog(dir string, limit int, ref string, paths []string) ([]GitCommitInfo, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	args := []string{"log", fmt.Sprintf("-n%d", limit), "--pretty=format:%H%x1f%an%x1f%ae%x1f%aI%x1f%s%x1e"}
+	if ref != "" {
+		if strings.HasPrefix(ref, "-") {
+			return nil, fmt.Errorf("invalid revision %q", ref)
+		}
+		args = append(args, ref)
+	}
+	args = append(args, "--")
+	args = append(args, paths...)
+	out, err := runGit(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	commits := []GitCommitInfo{}
+	for _, rec := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(rec), "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		commits = append(commits, GitCommitInfo{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    fields[3],
+			Subject: fields[4],
+		})
+	}
+	return commits, nil
+}
+
+func GitCommit(dir string, policy GitPolicy, opts GitCommitOptions) (*GitCommitResult, error) {
+	if strings.TrimSpace(opts.Message) == "" {
+		return nil, fmt.Errorf("commit message is required")
+	}
+	if opts.Amend && !policy.AllowHistoryRewrite {
+		return nil, fmt.Errorf("amending commits rewrites history and is not allowed in this mode")
+	}
+	if len(opts.Paths) > 0 {
+		if _, err := runGit(dir, append([]string{"add", "--"}, opts.Paths...)...); err != nil {
+			return nil, err
+		}
+	}
+	args := []string{"commit", "-m", opts.Message}
+	if opts.All {
+		args = append(args, "-a")
+	}
+	if opts.Amend {
+		args = append(args, "--amend")
+	}
+	if len(opts.Paths) > 0 {
+		args = append(args, "--")
+		args = append(args, opts.Paths...)
+	}
+	out, err := runGit(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	branch, _ := runGit(dir, "branch", "--show-current")
+	return &GitCommitResult{
+		Hash:    strings.TrimSpace(hash),
+		Branch:  strings.TrimSpace(branch),
+		Summary: strings.TrimSpace(out),
+	}, nil
+}
+
+// GitCommitPaths lists the files (absolute paths) a commit with opts would
+// record, so callers can check them against a path policy first.
+func GitCommitPaths(dir string, opts GitCommitOptions) ([]string, error) {
+	queries := [][]string{{"diff", "--cached", "--name-only", "--no-renames", "-z"}}
+	if opts.All {
+		queries = append(queries, []string{"diff", "--name-only", "--no-renames", "-z"})
+	}
+	if len(opts.Paths) > 0 {
+		queries = append(queries,
+			append([]string{"diff", "HEAD", "--name-only", "--no-renames", "-z", "--"}, opts.Paths...),
+			append([]string{"ls-files", "--others", "--exclude-standard", "--full-name", "-z", "--"}, opts.Paths...))
+	}
+	return gitChangedPaths(dir, queries...)
+}
+
+// GitSwitchPaths lists the files (absolute paths) switching branches with
+// opts would rewrite in the working tree.
+func GitSwitchPaths(dir string, opts GitBranchOptions) ([]string, error) {
+	target := opts.Name
+	if opts.Create {
+		if opts.StartPoint == "" {
+			return nil, nil // a new branch at HEAD changes no files
+		}
+		target = opts.StartPoint
+	}
+	if target == "" || strings.HasPrefix(target, "-") {
+		return nil, fmt.Errorf("invalid branch name %q", target)
+	}
+	return gitChangedPaths(dir, []string{"diff", "HEAD", target, "--name-only", "--no-renames", "-z", "--"})
+}
+
+// gitChangedPaths runs git queries that print NUL separated paths relative
+// to the repository root and returns the distinct absolute paths.
+func gitChangedPaths(dir string, queries ...[]string) ([]string, error) {
+	// Relative to dir rather than --show-toplevel so the paths keep dir's
+	// spelling even when it goes through a symlink.
+	cdup, err := runGit(dir, "rev-parse", "--show-cdup")
+	if err != nil {
+		return nil, err
+	}
+	top := filepath.Join(dir, strings.TrimSpace(cdup))
+	seen := make(map[string]bool)
+	var paths []string
+	for _, q := range queries {
+		out, err := runGit(dir, q...)
+		if err != nil {
+			// A repository without commits has no HEAD to diff against.
+			if q[0] == "diff" && strings.Contains(err.Error(), "HEAD") {
+				continue
+			}
+			return nil, err
+		}
+		for _, rel := range strings.Split(out, "\x00") {
+			if rel == "" {
+				continue
+			}
+			abs := filepath.Join(top, filepath.FromSlash(rel))
+			if !seen[abs] {
+				seen[abs] = true
+				paths = append(paths, abs)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func GitBranch(dir string, policy GitPolicy, opts GitBranchOptions) (*GitBranchResult, error) {
+	action := strings.ToLower(strings.TrimSpace(opts.Action))
+	if action != "" && action != "list" {
+		if opts.Name == "" || strings.HasPrefix(opts.Name, "-") {
+			return nil, fmt.Errorf("invalid branch name %q", opts.Name)
+		}
+		if strings.HasPrefix(opts.StartPoint, "-") {
+			return nil, fmt.Errorf("invalid start point %q", opts.StartPoint)
+		}
+	}
+
+	var err error
+	switch action {
+	case "", "list":
+	case "create":
+		args := []string{"branch", opts.Name}
+		if opts.StartPoint != "" {
+			args = append(args, opts.StartPoint)
+		}
+		_, err = runGit(dir, args...)
+	case "switch":
+		args := []string{"switch"}
+		if opts.Create {
+			args = append(args, "-c")
+		}
+		args = append(args, opts.Name)
+		if opts.Create && opts.StartPoint != "" {
+			args = append(args, opts.StartPoint)
+		}
+		_, err = runGit(dir, args...)
+	case "delete":
+		flag := "-d"
+		if opts.Force {
+			if !policy.AllowHistoryRewrite {
+				return nil, fmt.Errorf("force-deleting branches can discard commits and is not allowed in this mode")
+			}
+			flag = "-D"
+		}
+		_, err = runGit(dir, "branch", flag, opts.Name)
+	default:
+		return nil, fmt.Errorf("unknown branch action: %s", opts.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listGitBranches(dir)
+}
+
+func listGitBranches(dir string) (*GitBranchResult, error) {
+	out, err := runGit(dir, "for-each-ref", "--format=%(refname:short)%1f%(objectname:short)%1f%(upstream:short)%1f%(HEAD)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	res := &GitBranchResult{Branches: []GitBranchInfo{}}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		b := GitBranchInfo{Name: fields[0], Commit: fields[1], Upstream: fields[2], Current: fields[3] == "*"}
+		if b.Current {
+			res.Current = b.Name
+		}
+		res.Branches = append(res.Branches, b)
+	}
+	return res, nil
+}
+
+func GitWorktree(dir string, policy GitPolicy, opts GitWorktreeOptions) ([]GitWorktreeInfo, error) {
+	action := strings.ToLower(strings.TrimSpace(opts.Action))
+	var err error
+	switch action {
+	case "", "list":
+	case "add":
+		if opts.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		args := []string{"worktree", "add"}
+		if opts.NewBranch {
+			if opts.Branch == "" || strings.HasPrefix(opts.Branch, "-") {
+				return nil, fmt.Errorf("invalid branch name %q", opts.Branch)
+			}
+			args = append(args, "-b", opts.Branch, opts.Path)
+		} else {
+			args = append(args, opts.Path)
+			if opts.Branch != "" {
+				if strings.HasPrefix(opts.Branch, "-") {
+					return nil, fmt.Errorf("invalid branch name %q", opts.Branch)
+				}
+				args = append(args, opts.Branch)
+			}
+		}
+		_, err = runGit(dir, args...)
+	case "remove":
+		if opts.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		args := []string{"worktree", "remove"}
+		if opts.Force {
+			if !policy.AllowHistoryRewrite {
+				return nil, fmt.Errorf("force-removing a worktree discards its changes and is not allowed in this mode")
+			}
+			args = append(args, "--force")
+		}
+		_, err = runGit(dir, append(args, opts.Path)...)
+	default:
+		return nil, fmt.Errorf("unknown worktree action: %s", opts.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := runGit(dir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	var list []GitWorktreeInfo
+	var cur *GitWorktreeInfo
+	for _, line := range strings.Split(out, "\n") {
+		key, val, _ := strings.Cut(line, " ")
+		switch key {
+		case "worktree":
+			list = append(list, GitWorktreeInfo{Path: filepath.FromSlash(val)})
+			cur = &list[len(list)-1]
+		case "HEAD":
+			if cur != nil {
+				cur.Head = val
+			}
+		case "branch":
+			if cur != nil {
+				cur.Branch = strings.TrimPrefix(val, "refs/heads/")
+			}
+		case "detached":
+			if cur != nil {
+				cur.Detached = true
+			}
+		case "bare":
+			if cur != nil {
+				cur.Bare = true
+			}
+		case "locked":
+			if cur != nil {
+				cur.Locked = true
+			}
+		}
+	}
+	if list == nil {
+		list = []GitWorktreeInfo{}
+	}
+	return list, nil
+}
+
+// CheckGitArgv applies CheckGitCommand to a run_command argv when the
+// program it runs (after wrappers such as env or timeout) is git.
+func CheckGitArgv(policy GitPolicy, argv []string) error {
+	prog := CommandProgram(argv)
+	if len(prog) == 0 || commandName(prog[0]) != "git" {
+		return nil
+	}
+	return CheckGitCommand(policy, prog[1:])
+}
+
+// CheckGitCommand rejects history rewriting git invocations (force push,
+// reset --hard, rebase, amend, ...) made through run_command unless the
+// policy allows them. args are the arguments after "git".
+func CheckGitCommand(policy GitPolicy, args []string) error {
+	if policy.AllowHistoryRewrite {
+		return nil
+	}
+	// Skip global options such as "-C dir" or "-c key=value". Aliases set on
+	// the command line could hide any subcommand, so they are refused.
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		opt := args[i]
+		if opt == "-C" || opt == "-c" {
+			i++
+		}
+		config := ""
+		if opt == "-c" && i < len(args) {
+			config = args[i]
+		} else if v, ok := strings.CutPrefix(opt, "--config-env="); ok {
+			config = v
+		}
+		if strings.HasPrefix(strings.ToLower(config), "alias.") {
+			return fmt.Errorf("defining git aliases on the command line is not allowed in this mode")
+		}
+		i++
+	}
+	if i >= len(args) {
+		return nil
+	}
+	sub, rest := args[i], args[i+1:]
+	has := func(flags ...string) bool {
+		for _, a := range rest {
+			for _, f := range flags {
+				if a == f || strings.HasPrefix(a, f+"=") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var reason string
+	switch sub {
+	case "push":
+		if has("-f", "--force", "--force-with-lease", "--force-if-includes", "--mirror") {
+			reason = "force push"
+		}
+		for _, a := range rest {
+			if strings.HasPrefix(a, "+") {
+				reason = "force push"
+			}
+		}
+	case "reset":
+		if has("--hard", "--merge", "--keep") {
+			reason = "reset " + strings.Join(rest, " ")
+		}
+	case "rebase", "filter-branch", "filter-repo":
+		reason = sub
+	case "commit":
+		if has("--amend") {
+			reason = "commit --amend"
+		}
+	case "reflog":
+		if len(rest) > 0 && (rest[0] == "expire" || rest[0] == "delete") {
+			reason = "reflog " + rest[0]
+		}
+	case "update-ref":
+		reason = sub
+	case "branch":
+		if has("-D", "-f", "--force") {
+			reason = "forced branch update"
+		}
+	}
+	if reason != "" {
+		return fmt.Errorf("git %s rewrites history and is not allowed in this mode", reason)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+	} {
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	return dir
+}
+
+func TestGitTools_CommitStatusLogDiff(t *testing.T) {
+	dir := newTestRepo(t)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("two\n"), 0644)
+
+	st, err := GitStatus(dir)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if st.Branch != "main" || st.Clean || len(st.Files) != 2 || st.Files[0].Index != "?" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	if _, err := GitCommit(dir, GitPolicy{}, GitCommitOptions{}); err == nil {
+		t.Fatal("expected error without commit message")
+	}
+	res, err := GitCommit(dir, GitPolicy{}, GitCommitOptions{Message: "add a", Paths: []string{"a.txt"}})
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if len(res.Hash) != 40 || res.Branch != "main" {
+		t.Fatalf("unexpected commit result: %+v", res)
+	}
+	if st, _ := GitStatus(dir); len(st.Files) != 1 || st.Files[0].Path != "b.txt" {
+		t.Fatalf("expected only b.txt left, got %+v", st.Files)
+	}
+
+	if _, err := GitCommit(dir, GitPolicy{}, GitCommitOptions{Message: "x", Amend: true}); err == nil {
+		t.Fatal("expected amend to be refused")
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\nmore\n"), 0644)
+	diff, err := GitDiff(dir, GitDiffOptions{})
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if len(diff.Files) != 1 || diff.Files[0].Path != "a.txt" || diff.Files[0].Additions != 1 || !strings.Contains(diff.Patch, "+more") {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+
+	log, err := GitLog(dir, 5, "", nil)
+	if err != nil || len(log) != 1 || log[0].Subject != "add a" || log[0].Author != "Test" {
+		t.Fatalf("unexpected log: %+v (%v)", log, err)
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	dir := newTestRepo(t)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0644)
+	if _, err := GitCommit(dir, GitPolicy{}, GitCommitOptions{Message: "init", Paths: []string{"a.txt"}}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	res, err := GitBranch(dir, GitPolicy{}, GitBranchOptions{Action: "switch", Name: "feature", Create: true})
+	if err != nil || res.Current != "feature" || len(res.Branches) != 2 {
+		t.Fatalf("unexpected branch result: %+v (%v)", res, err)
+	}
+	if _, err := GitBranch(dir, GitPolicy{}, GitBranchOptions{Action: "delete", Name: "main", Force: true}); err == nil {
+		t.Fatal("expected force delete to be refused")
+	}
+	if _, err := GitBranch(dir, GitPolicy{}, GitBranchOptions{Action: "create", Name: "--evil"}); err == nil {
+		t.Fatal("expected option-like branch name to be rejected")
+	}
+}
+
+func TestCheckGitCommand(t *testing.T) {
+	blocked := [][]string{
+		{"push", "--force"},
+		{"push", "origin", "+main"},
+		{"-C", "x", "reset", "--hard", "HEAD~1"},
+		{"rebase", "main"},
+		{"commit", "--amend", "-m", "x"},
+	}
+	for _, args := range blocked {
+		if err := CheckGitCommand(GitPolicy{}, args); err == nil {
+			t.Errorf("expected %v to be blocked", args)
+		}
+		if err := CheckGitCommand(GitPolicy{AllowHistoryRewrite: true}, args); err != nil {
+			t.Errorf("expected %v to be allowed with rewrite policy: %v", args, err)
+		}
+	}
+	for _, args := range [][]string{{"status"}, {"push", "origin", "main"}, {"reset", "HEAD", "a.txt"}, {"commit", "-m", "x"}} {
+		if err := CheckGitCommand(GitPolicy{}, args); err != nil {
+			t.Errorf("expected %v to be allowed: %v", args, err)
+		}
+	}
+}
+
+func TestCheckGitArgv(t *testing.T) {
+	blocked := []struct {
+		command string
+		args    []string
+	}{
+		{"git push --force", nil},
+		{"git", []string{"push", "-f"}},
+		{"env GIT_DIR=.git git rebase main", nil},
+		{"timeout 10 git reset --hard", nil},
+		{"git -c alias.p=push p", []string{"-f"}},
+	}
+	for _, c := range blocked {
+		argv, err := CommandArgv(c.command, c.args)
+		if err != nil {
+			t.Fatalf("CommandArgv(%q): %v", c.command, err)
+		}
+		if err := CheckGitArgv(GitPolicy{}, argv); err == nil {
+			t.Errorf("expected %v to be blocked", argv)
+		}
+	}
+	for _, command := range []string{"cd x && git reset --hard", "git status; git push -f", "sh -c 'git push -f'", "env bash -c x", "git log | head", "env FOO=1", "timeout 5"} {
+		if _, err := CommandArgv(command, nil); err == nil {
+			t.Errorf("expected %q to be rejected", command)
+		}
+	}
+	argv, err := CommandArgv(`git commit -m "fix: a; b"`, []string{"--", "a b.txt"})
+	if err != nil || len(argv) != 6 || argv[3] != "fix: a; b" || argv[5] != "a b.txt" {
+		t.Fatalf("unexpected argv %q (%v)", argv, err)
+	}
+	if err := CheckGitArgv(GitPolicy{}, argv); err != nil {
+		t.Fatalf("plain commit should be allowed: %v", err)
+	}
+}
+
+func TestShellCommands(t *testing.T) {
+	cases := map[string][][]string{
+		"go test ./...":                                  {{"go", "test", "./..."}},
+		"cd x && git reset --hard":                       {{"cd", "x"}, {"git", "reset", "--hard"}},
+		"FOO=1 go test ./... 2>&1 | tail -n 5 > out.txt": {{"go", "test", "./..."}, {"tail", "-n", "5"}},
+		`git commit -m "fix: a; b" # done`:               {{"git", "commit", "-m", "fix: a; b"}},
+		"echo $(git push -f)":                            {{"echo"}, {"git", "push", "-f"}},
+		"if true; then rm -rf x; fi":                     {{"true"}, {"rm", "-rf", "x"}},
+		"sh -c 'git push -f'":                            {{"sh", "-c", "git push -f"}, {"git", "push", "-f"}},
+	}
+	for line, want := range cases {
+		got := ShellCommands(line)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("ShellCommands(%q) = %q, want %q", line, got, want)
+		}
+	}
+	blocked := 0
+	for _, argv := range ShellCommands("git status; sh -c 'git push -f'") {
+		if CheckGitArgv(GitPolicy{}, argv) != nil {
+			blocked++
+		}
+	}
+	if blocked != 1 {
+		t.Fatalf("expected the force push inside sh -c to be blocked")
+	}
+}
+
+func TestGitSwitchPaths(t *testing.T) {
+	dir := newTestRepo(t)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0644)
+	if _, err := GitCommit(dir, GitPolicy{}, GitCommitOptions{Message: "init", Paths: []string{"a.txt"}}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if _, err := GitBranch(dir, GitPolicy{}, GitBranchOptions{Action: "create", Name: "other"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("two\n"), 0644)
+	if _, err := GitCommit(dir, GitPolicy{}, GitCommitOptions{Message: "b", Paths: []string{"b.txt"}}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	paths, err := GitSwitchPaths(dir, GitBranchOptions{Action: "switch", Name: "other"})
+	if err != nil || len(paths) != 1 || paths[0] != filepath.Join(dir, "b.txt") {
+		t.Fatalf("unexpected switch paths %v (%v)", paths, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed\n"), 0644)
+	paths, err = GitCommitPaths(dir, GitCommitOptions{All: true})
+	if err != nil || len(paths) != 1 || paths[0] != filepath.Join(dir, "a.txt") {
+		t.Fatalf("unexpected commit paths %v (%v)", paths, err)
+	}
+}
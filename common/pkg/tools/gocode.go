@@ -0,0 +1,922 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Go Code Intelligence ---
+
+// MaxGoReferences caps the number of references returned by GoFindReferences.
+const MaxGoReferences = 500
+
+// GoQuery selects a Go identifier, either by position (Path is a file, Line
+// and optionally Column are set) or by name. Symbol may be "Name",
+// "Type.Method", "Type.Field", "pkg.Name" or "pkg.Type.Method"; with Path
+// set to a file or directory the search is limited to that package.
+type GoQuery struct {
+	Path   string
+	Symbol string
+	Line   int
+	Column int // 1-based; 0 picks the first identifier on the line
+}
+
+// GoSymbol is a declaration. Location is "file:line", relative to the
+// project root for files inside it.
+type GoSymbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"` // func, method, type, var, const, field, package
+	Recv      string `json:"recv,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Location  string `json:"location"`
+	Doc       string `json:"doc,omitempty"`
+}
+
+type GoReference struct {
+	Location string `json:"location"`
+	Kind     string `json:"kind"` // definition or use
+	Text     string `json:"text"` // the source line
+}
+
+type GoReferencesResult struct {
+	Symbol     GoSymbol      `json:"symbol"`
+	References []GoReference `json:"references"`
+	Truncated  bool          `json:"truncated"`
+}
+
+type GoTypeOutline struct {
+	GoSymbol
+	Constructors []GoSymbol `json:"constructors,omitempty"`
+	Methods      []GoSymbol `json:"methods,omitempty"`
+}
+
+type GoOutline struct {
+	Name       string          `json:"name"`
+	ImportPath string          `json:"importPath"`
+	Dir        string          `json:"dir"`
+	Doc        string          `json:"doc,omitempty"`
+	Consts     []GoSymbol      `json:"consts,omitempty"`
+	Vars       []GoSymbol      `json:"vars,omitempty"`
+	Funcs      []GoSymbol      `json:"funcs,omitempty"`
+	Types      []GoTypeOutline `json:"types,omitempty"`
+}
+
+// GoFindDefinition returns where the queried identifier is declared.
+func GoFindDefinition(base string, q GoQuery) ([]GoSymbol, error) {
+	m, err := loadGoModuleFor(base, q.Path)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objs, err := m.resolve(q)
+	if err != nil {
+		return nil, err
+	}
+	var out []GoSymbol
+	for _, obj := range objs {
+		out = append(out, m.symbolFor(obj))
+	}
+	return out, nil
+}
+
+// GoFindReferences returns every use of the queried identifier in the
+// module, including its declaration.
+func GoFindReferences(base string, q GoQuery) (*GoReferencesResult, error) {
+	m, err := loadGoModuleFor(base, q.Path)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objs, err := m.resolve(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) > 1 {
+		var names []string
+		for _, obj := range objs {
+			s := m.symbolFor(obj)
+			names = append(names, s.Location+" "+s.Signature)
+		}
+		return nil, fmt.Errorf("%q is ambiguous, qualify it or pass a position:\n%s", q.Symbol, strings.Join(names, "\n"))
+	}
+	target := objs[0]
+	res := &GoReferencesResult{Symbol: m.symbolFor(target), References: []GoReference{}}
+	lines := newLineReader()
+	var positions []token.Position
+
+	for _, p := range m.sortedPackages() {
+		m.check(p)
+		if p.info == nil {
+			continue
+		}
+		var idents []*ast.Ident
+		for id, obj := range p.info.Defs {
+			if obj != nil && sameObject(obj, target) {
+				idents = append(idents, id)
+			}
+		}
+		for id, obj := range p.info.Uses {
+			if sameObject(obj, target) {
+				idents = append(idents, id)
+			}
+		}
+		for _, id := range idents {
+			pos := m.fset.Position(id.Pos())
+			kind := "use"
+			if p.info.Defs[id] != nil {
+				kind = "definition"
+			}
+			res.References = append(res.References, GoReference{
+				Location: m.location(pos),
+				Kind:     kind,
+				Text:     lines.line(pos.Filename, pos.Line),
+			})
+			positions = append(positions, pos)
+		}
+	}
+	sort.Sort(byPosition{res.References, positions})
+	if len(res.References) > MaxGoReferences {
+		res.References = res.References[:MaxGoReferences]
+		res.Truncated = true
+	}
+	return res, nil
+}
+
+// GoListSymbols lists the top-level declarations (exported or not) of a Go
+// file, or of the package in a directory.
+func GoListSymbols(base, path string) ([]GoSymbol, error) {
+	m, err := loadGoModuleFor(base, path)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, file, err := m.packageFor(path)
+	if err != nil {
+		return nil, err
+	}
+	out := []GoSymbol{}
+	for _, f := range p.files {
+		name := m.fset.Position(f.Pos()).Filename
+		if (file != "" && name != file) || (file == "" && strings.HasSuffix(name, "_test.go")) {
+			continue
+		}
+		for _, decl := range f.Decls {
+			out = append(out, m.declSymbols(decl, false)...)
+		}
+	}
+	return out, nil
+}
+
+// GoPackageOutline describes the exported API of the package in dir with
+// doc comments.
+func GoPackageOutline(base, dir string) (*GoOutline, error) {
+	m, err := loadGoModuleFor(base, dir)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, _, err := m.packageFor(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, f := range p.files {
+		if !strings.HasSuffix(m.fset.Position(f.Pos()).Filename, "_test.go") {
+			files = append(files, f)
+		}
+	}
+	dp, err := doc.NewFromFiles(m.fset, files, p.path, doc.PreserveAST)
+	if err != nil {
+		return nil, err
+	}
+	out := &GoOutline{Name: dp.Name, ImportPath: p.path, Dir: m.relPath(p.dir), Doc: strings.TrimSpace(dp.Doc)}
+	values := func(vals []*doc.Value) []GoSymbol {
+		var syms []GoSymbol
+		for _, v := range vals {
+			for _, s := range m.declSymbols(v.Decl, true) {
+				if s.Doc == "" {
+					s.Doc = strings.TrimSpace(v.Doc)
+				}
+				syms = append(syms, s)
+			}
+		}
+		return syms
+	}
+	funcs := func(fns []*doc.Func) []GoSymbol {
+		var syms []GoSymbol
+		for _, fn := range fns {
+			syms = append(syms, m.declSymbols(fn.Decl, true)...)
+		}
+		return syms
+	}
+	out.Consts = values(dp.Consts)
+	out.Vars = values(dp.Vars)
+	out.Funcs = funcs(dp.Funcs)
+	for _, t := range dp.Types {
+		var ts GoTypeOutline
+		for _, s := range m.declSymbols(t.Decl, true) {
+			if s.Name == t.Name {
+				ts.GoSymbol = s
+			}
+		}
+		if ts.Doc == "" {
+			ts.Doc = strings.TrimSpace(t.Doc)
+		}
+		ts.Constructors = funcs(t.Funcs)
+		ts.Methods = funcs(t.Methods)
+		out.Consts = append(out.Consts, values(t.Consts)...)
+		out.Vars = append(out.Vars, values(t.Vars)...)
+		out.Types = append(out.Types, ts)
+	}
+	return out, nil
+}
+
+// --- module loading ---
+
+type goPackage struct {
+	path     string // import path
+	dir      string
+	files    []*ast.File // including the in-package _test.go files
+	xtest    *goPackage  // the external <name>_test package, if any
+	types    *types.Package
+	info     *types.Info
+	checking bool
+}
+
+// goModule holds the parsed (and lazily type-checked) packages of one Go
+// module. Packages outside the module are loaded from the compiler's export
+// data (via go list -export), or type-checked from source if that fails.
+type goModule struct {
+	root        string
+	modPath     string
+	base        string // project root, for relative locations
+	fingerprint uint64
+	fset        *token.FileSet
+	pkgs        map[string]*goPackage // by import path
+	byDir       map[string]*goPackage
+	fallback    types.ImporterFrom
+	mu          sync.Mutex // held while a tool uses the module; type-checking is lazy
+}
+
+var goModules = struct {
+	sync.Mutex
+	m map[string]*goModule
+}{m: make(map[string]*goModule)}
+
+// loadGoModuleFor finds the go.mod governing path (searching upwards, but
+// not above base) and returns the module, reusing the cached one while no
+// Go file changed.
+func loadGoModuleFor(base, path string) (*goModule, error) {
+	if path == "" {
+		path = base
+	}
+	root, modPath, err := findGoModule(base, path)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := goSourceFingerprint(root)
+	if err != nil {
+		return nil, err
+	}
+
+	goModules.Lock()
+	defer goModules.Unlock()
+	if m, ok := goModules.m[root]; ok && m.fingerprint == fp && m.base == base {
+		return m, nil
+	}
+	m, err := parseGoModule(root, modPath, base)
+	if err != nil {
+		return nil, err
+	}
+	m.fingerprint = fp
+	goModules.m[root] = m
+	return m, nil
+}
+
+func findGoModule(base, path string) (string, string, error) {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	for {
+		if modPath, err := readModulePath(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, modPath, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || (base != "" && !isWithin(base, parent)) {
+			return "", "", fmt.Errorf("no go.mod found for %s", path)
+		}
+		dir = parent
+	}
+}
+
+func isWithin(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func readModulePath(gomod string) (string, error) {
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return "", err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "module"); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no module directive", gomod)
+}
+
+// walkGoDirs calls fn for every package directory of the module at root,
+// skipping hidden, vendor, testdata and node_modules directories and nested
+// modules.
+func walkGoDirs(root string, fn func(dir string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != root {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata" || name == "node_modules" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		return fn(path, d)
+	})
+}
+
+func goSourceFingerprint(root string) (uint64, error) {
+	h := fnv.New64a()
+	err := walkGoDirs(root, func(dir string, _ fs.DirEntry) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+				continue
+			}
+			if info, err := e.Info(); err == nil {
+				fmt.Fprintf(h, "%s/%s:%d:%d;", dir, e.Name(), info.Size(), info.ModTime().UnixNano())
+			}
+		}
+		return nil
+	})
+	return h.Sum64(), err
+}
+
+func parseGoModule(root, modPath, base string) (*goModule, error) {
+	m := &goModule{
+		root:    root,
+		modPath: modPath,
+		base:    base,
+		fset:    token.NewFileSet(),
+		pkgs:    make(map[string]*goPackage),
+		byDir:   make(map[string]*goPackage),
+	}
+
+	ctx := build.Default
+	ctx.CgoEnabled = false
+	err := walkGoDirs(root, func(dir string, _ fs.DirEntry) error {
+		bp, err := ctx.ImportDir(dir, 0)
+		if err != nil || len(bp.GoFiles)+len(bp.TestGoFiles)+len(bp.XTestGoFiles) == 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, dir)
+		p := &goPackage{path: modPath, dir: dir}
+		if rel != "." {
+			p.path = modPath + "/" + filepath.ToSlash(rel)
+		}
+		parse := func(names []string) ([]*ast.File, error) {
+			var files []*ast.File
+			for _, name := range names {
+				f, err := parser.ParseFile(m.fset, filepath.Join(dir, name), nil, parser.ParseComments)
+				if f == nil {
+					return nil, fmt.Errorf("parse %s: %v", name, err)
+				}
+				files = append(files, f)
+			}
+			return files, nil
+		}
+		// 包内测试与包一起检查（go 不允许它们引入循环），外部测试包单独检查
+		if p.files, err = parse(append(bp.GoFiles, bp.TestGoFiles...)); err != nil {
+			return err
+		}
+		if len(bp.XTestGoFiles) > 0 {
+			p.xtest = &goPackage{path: p.path + "_test", dir: dir}
+			if p.xtest.files, err = parse(bp.XTestGoFiles); err != nil {
+				return err
+			}
+		}
+		m.pkgs[p.path] = p
+		m.byDir[dir] = p
+		return nil
+	})
+	return m, err
+}
+
+func (m *goModule) Import(path string) (*types.Package, error) {
+	return m.ImportFrom(path, m.root, 0)
+}
+
+func (m *goModule) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if p, ok := m.pkgs[path]; ok {
+		if p.checking {
+			return nil, fmt.Errorf("import cycle through %s", path)
+		}
+		m.check(p)
+		return p.types, nil
+	}
+	if m.fallback == nil {
+		m.fallback = m.externalImporter()
+	}
+	return m.fallback.ImportFrom(path, dir, mode)
+}
+
+// externalImporter builds the importer for dependencies. go list compiles
+// the dependencies once (then the build cache makes it cheap) and reports
+// their export data files.
+func (m *goModule) externalImporter() types.ImporterFrom {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-export", "-deps",
+		"-f", "{{if .Export}}{{.ImportPath}}={{.Export}}{{end}}", "./...")
+	cmd.Dir = m.root
+	out, err := cmd.Output()
+	if err != nil {
+		return importer.ForCompiler(m.fset, "source", nil).(types.ImporterFrom)
+	}
+	exports := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if path, file, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			exports[path] = file
+		}
+	}
+	lookup := func(path string) (io.ReadCloser, error) {
+		file, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(file)
+	}
+	return importer.ForCompiler(m.fset, "gc", lookup).(types.ImporterFrom)
+}
+
+// check type-checks a package once. Type errors (e.g. missing dependencies)
+// are tolerated; whatever could be resolved is kept.
+func (m *goModule) check(p *goPackage) {
+	if p.types != nil || p.checking {
+		return
+	}
+	p.checking = true
+	defer func() { p.checking = false }()
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: m, Error: func(error) {}, FakeImportC: true}
+	pkg, _ := conf.Check(p.path, m.fset, p.files, info)
+	p.types, p.info = pkg, info
+}
+
+func (m *goModule) sortedPackages() []*goPackage {
+	pkgs := make([]*goPackage, 0, len(m.pkgs))
+	for _, p := range m.pkgs {
+		pkgs = append(pkgs, p)
+		if p.xtest != nil {
+			pkgs = append(pkgs, p.xtest)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].path < pkgs[j].path })
+	return pkgs
+}
+
+// packageFor returns the package containing path (a file or directory) and,
+// for files, the file name.
+func (m *goModule) packageFor(path string) (*goPackage, string, error) {
+	dir, file := path, ""
+	if info, err := os.Stat(path); err != nil {
+		return nil, "", err
+	} else if !info.IsDir() {
+		dir, file = filepath.Dir(path), path
+	}
+	p, ok := m.byDir[dir]
+	if !ok {
+		return nil, "", fmt.Errorf("%s is not a Go package in module %s", m.relPath(dir), m.modPath)
+	}
+	if file != "" {
+		for _, pkg := range []*goPackage{p, p.xtest} {
+			if pkg == nil {
+				continue
+			}
+			for _, f := range pkg.files {
+				if m.fset.Position(f.Pos()).Filename == file {
+					return pkg, file, nil
+				}
+			}
+		}
+		return nil, "", fmt.Errorf("%s is not part of package %s (excluded by build constraints?)", m.relPath(file), p.path)
+	}
+	return p, "", nil
+}
+
+// resolve finds the objects a query refers to.
+func (m *goModule) resolve(q GoQuery) ([]types.Object, error) {
+	if q.Line > 0 {
+		return m.resolvePosition(q)
+	}
+	if strings.TrimSpace(q.Symbol) == "" {
+		return nil, errors.New("symbol or line is required")
+	}
+	candidates := m.sortedPackages()
+	if q.Path != "" && q.Path != m.base && q.Path != m.root {
+		p, _, err := m.packageFor(q.Path)
+		if err != nil {
+			return nil, err
+		}
+		candidates = []*goPackage{p}
+	}
+
+	parts := strings.Split(strings.TrimSpace(q.Symbol), ".")
+	var objs []types.Object
+	for _, p := range candidates {
+		m.check(p)
+		if p.types == nil {
+			continue
+		}
+		scope := p.types.Scope()
+		if len(parts) > 1 && (p.types.Name() == parts[0] || strings.HasSuffix(p.path, "/"+parts[0])) {
+			if obj := lookupMember(p.types, scope, parts[1:]); obj != nil {
+				objs = append(objs, obj)
+				continue
+			}
+		}
+		if obj := lookupMember(p.types, scope, parts); obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("symbol %q not found in module %s", q.Symbol, m.modPath)
+	}
+	return objs, nil
+}
+
+func lookupMember(pkg *types.Package, scope *types.Scope, parts []string) types.Object {
+	switch len(parts) {
+	case 1:
+		return scope.Lookup(parts[0])
+	case 2:
+		tn, ok := scope.Lookup(parts[0]).(*types.TypeName)
+		if !ok {
+			return nil
+		}
+		obj, _, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, parts[1])
+		return obj
+	}
+	return nil
+}
+
+func (m *goModule) resolvePosition(q GoQuery) ([]types.Object, error) {
+	p, file, err := m.packageFor(q.Path)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		return nil, errors.New("path must be a Go file when line is given")
+	}
+	m.check(p)
+	for _, f := range p.files {
+		if m.fset.Position(f.Pos()).Filename != file {
+			continue
+		}
+		var found types.Object
+		ast.Inspect(f, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok || found != nil {
+				return found == nil
+			}
+			pos := m.fset.Position(id.Pos())
+			if pos.Line != q.Line {
+				return true
+			}
+			if q.Column > 0 && (q.Column < pos.Column || q.Column > pos.Column+len(id.Name)) {
+				return true
+			}
+			obj := p.info.Uses[id]
+			if obj == nil {
+				obj = p.info.Defs[id]
+			}
+			if _, isPkg := obj.(*types.PkgName); obj != nil && (!isPkg || q.Column > 0) {
+				found = obj
+			}
+			return true
+		})
+		if found == nil {
+			return nil, fmt.Errorf("no identifier at %s:%d:%d", m.relPath(file), q.Line, q.Column)
+		}
+		return []types.Object{found}, nil
+	}
+	return nil, fmt.Errorf("%s not found", m.relPath(file))
+}
+
+// sameObject compares objects across packages; methods and fields of
+// instantiated generic types are compared by their origin.
+func sameObject(a, b types.Object) bool {
+	if a == b {
+		return true
+	}
+	switch av := a.(type) {
+	case *types.Func:
+		if bv, ok := b.(*types.Func); ok {
+			return av.Origin() == bv.Origin()
+		}
+	case *types.Var:
+		if bv, ok := b.(*types.Var); ok {
+			return av.Origin() == bv.Origin()
+		}
+	}
+	return false
+}
+
+func (m *goModule) symbolFor(obj types.Object) GoSymbol {
+	s := GoSymbol{
+		Name:     obj.Name(),
+		Location: m.location(m.fset.Position(obj.Pos())),
+	}
+	qual := types.RelativeTo(obj.Pkg())
+	switch o := obj.(type) {
+	case *types.Func:
+		s.Kind = "func"
+		if sig, ok := o.Type().(*types.Signature); ok && sig.Recv() != nil {
+			s.Kind = "method"
+			s.Recv = types.TypeString(sig.Recv().Type(), qual)
+		}
+	case *types.TypeName:
+		s.Kind = "type"
+	case *types.Const:
+		s.Kind = "const"
+	case *types.Var:
+		s.Kind = "var"
+		if o.IsField() {
+			s.Kind = "field"
+		}
+	case *types.PkgName:
+		s.Kind = "package"
+	default:
+		s.Kind = strings.ToLower(strings.TrimPrefix(fmt.Sprintf("%T", obj), "*types."))
+	}
+	s.Signature = types.ObjectString(obj, qual)
+	s.Doc = m.docFor(obj.Pos())
+	return s
+}
+
+// docFor returns the doc comment of the declaration whose name is at pos.
+func (m *goModule) docFor(pos token.Pos) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	for _, p := range m.sortedPackages() {
+		for _, f := range p.files {
+			if pos < f.Pos() || pos > f.End() {
+				continue
+			}
+			var text string
+			ast.Inspect(f, func(n ast.Node) bool {
+				if text != "" || n == nil || pos < n.Pos() || pos > n.End() {
+					return false
+				}
+				switch d := n.(type) {
+				case *ast.FuncDecl:
+					if d.Name.Pos() == pos {
+						text = d.Doc.Text()
+					}
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						var names []*ast.Ident
+						var specDoc *ast.CommentGroup
+						switch sp := spec.(type) {
+						case *ast.TypeSpec:
+							names, specDoc = []*ast.Ident{sp.Name}, sp.Doc
+						case *ast.ValueSpec:
+							names, specDoc = sp.Names, sp.Doc
+						}
+						for _, id := range names {
+							if id.Pos() == pos {
+								text = specDoc.Text()
+								if text == "" {
+									text = d.Doc.Text()
+								}
+							}
+						}
+					}
+				case *ast.Field:
+					for _, id := range d.Names {
+						if id.Pos() == pos {
+							text = d.Doc.Text()
+						}
+					}
+				}
+				return true
+			})
+			return strings.TrimSpace(text)
+		}
+	}
+	return ""
+}
+
+// declSymbols describes a top-level declaration using the syntax tree only.
+// With exportedOnly, unexported names and struct fields are left out.
+func (m *goModule) declSymbols(decl ast.Decl, exportedOnly bool) []GoSymbol {
+	var out []GoSymbol
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if exportedOnly && !d.Name.IsExported() {
+			return nil
+		}
+		s := GoSymbol{Name: d.Name.Name, Kind: "func", Location: m.location(m.fset.Position(d.Name.Pos())), Doc: strings.TrimSpace(d.Doc.Text())}
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			s.Kind = "method"
+			s.Recv = m.nodeString(d.Recv.List[0].Type)
+		}
+		sig := *d
+		sig.Body, sig.Doc = nil, nil
+		s.Signature = m.nodeString(&sig)
+		out = append(out, s)
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch sp := spec.(type) {
+			case *ast.TypeSpec:
+				if exportedOnly && !sp.Name.IsExported() {
+					continue
+				}
+				doc := sp.Doc.Text()
+				if doc == "" {
+					doc = d.Doc.Text()
+				}
+				out = append(out, GoSymbol{
+					Name:      sp.Name.Name,
+					Kind:      "type",
+					Signature: "type " + m.nodeString(typeSpecOutline(sp, exportedOnly)),
+					Location:  m.location(m.fset.Position(sp.Name.Pos())),
+					Doc:       strings.TrimSpace(doc),
+				})
+			case *ast.ValueSpec:
+				doc := sp.Doc.Text()
+				if doc == "" {
+					doc = d.Doc.Text()
+				}
+				for _, id := range sp.Names {
+					if id.Name == "_" || (exportedOnly && !id.IsExported()) {
+						continue
+					}
+					sig := d.Tok.String() + " " + id.Name
+					if sp.Type != nil {
+						sig += " " + m.nodeString(sp.Type)
+					}
+					out = append(out, GoSymbol{
+						Name:      id.Name,
+						Kind:      d.Tok.String(),
+						Signature: sig,
+						Location:  m.location(m.fset.Position(id.Pos())),
+						Doc:       strings.TrimSpace(doc),
+					})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// typeSpecOutline returns a copy of spec without field/method comments and,
+// with exportedOnly, without unexported struct fields and interface methods.
+func typeSpecOutline(spec *ast.TypeSpec, exportedOnly bool) *ast.TypeSpec {
+	out := *spec
+	out.Doc, out.Comment = nil, nil
+	filter := func(fl *ast.FieldList) *ast.FieldList {
+		if fl == nil {
+			return nil
+		}
+		res := &ast.FieldList{Opening: fl.Opening, Closing: fl.Closing}
+		for _, f := range fl.List {
+			field := *f
+			field.Doc, field.Comment = nil, nil
+			if exportedOnly && len(field.Names) > 0 {
+				var names []*ast.Ident
+				for _, id := range field.Names {
+					if id.IsExported() {
+						names = append(names, id)
+					}
+				}
+				if len(names) == 0 {
+					continue
+				}
+				field.Names = names
+			}
+			res.List = append(res.List, &field)
+		}
+		return res
+	}
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		out.Type = &ast.StructType{Struct: t.Struct, Fields: filter(t.Fields)}
+	case *ast.InterfaceType:
+		out.Type = &ast.InterfaceType{Interface: t.Interface, Methods: filter(t.Methods)}
+	}
+	return &out
+}
+
+func (m *goModule) nodeString(n any) string {
+	var buf bytes.Buffer
+	// A fresh FileSet makes the printer lay the node out on its own instead
+	// of reproducing the original line breaks and comments.
+	if err := printer.Fprint(&buf, token.NewFileSet(), n); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+func (m *goModule) relPath(path string) string {
+	if m.base != "" && isWithin(m.base, path) {
+		if rel, err := filepath.Rel(m.base, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+func (m *goModule) location(pos token.Position) string {
+	if pos.Filename == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", m.relPath(pos.Filename), pos.Line)
+}
+
+// byPosition sorts references by file and line.
+type byPosition struct {
+	refs []GoReference
+	pos  []token.Position
+}
+
+func (b byPosition) Len() int { return len(b.refs) }
+func (b byPosition) Less(i, j int) bool {
+	if b.pos[i].Filename != b.pos[j].Filename {
+		return b.pos[i].Filename < b.pos[j].Filename
+	}
+	return b.pos[i].Offset < b.pos[j].Offset
+}
+func (b byPosition) Swap(i, j int) {
+	b.refs[i], b.refs[j] = b.refs[j], b.refs[i]
+	b.pos[i], b.pos[j] = b.pos[j], b.pos[i]
+}
+
+// lineReader reads source lines, caching files for the duration of a call.
+type lineReader struct {
+	files map[string][]string
+}
+
+func newLineReader() *lineReader {
+	return &lineReader{files: make(map[string][]string)}
+}
+
+func (r *lineReader) line(file string, n int) string {
+	lines, ok := r.files[file]
+	if !ok {
+		data, _ := os.ReadFile(file)
+		lines = strings.Split(string(data), "\n")
+		r.files[file] = lines
+	}
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[n-1])
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeGoModule(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.21\n",
+		"cart/cart.go": `// Package cart keeps items.
+package cart
+
+// Cart holds items.
+type Cart struct {
+	Items []string
+	owner string
+}
+
+// New returns an empty cart.
+func New() *Cart { return &Cart{} }
+
+// Add puts an item in the cart.
+func (c *Cart) Add(item string) { c.Items = append(c.Items, item) }
+
+func (c *Cart) count() int { return len(c.Items) }
+`,
+		"main.go": `package main
+
+import "example.com/shop/cart"
+
+// Add is not the cart method.
+func Add() {}
+
+func main() {
+	c := cart.New()
+	c.Add("apple")
+	c.Add("pear")
+	Add()
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestGoFindDefinitionAndReferences(t *testing.T) {
+	root := writeGoModule(t)
+
+	defs, err := GoFindDefinition(root, GoQuery{Path: filepath.Join(root, "main.go"), Line: 10, Column: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].Location != "cart/cart.go:14" || defs[0].Kind != "method" || defs[0].Doc != "Add puts an item in the cart." {
+		t.Fatalf("unexpected definition: %+v", defs)
+	}
+
+	refs, err := GoFindReferences(root, GoQuery{Symbol: "Cart.Add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locs []string
+	for _, r := range refs.References {
+		locs = append(locs, r.Location)
+	}
+	if got := strings.Join(locs, ","); got != "cart/cart.go:14,main.go:10,main.go:11" {
+		t.Fatalf("unexpected references %s", got)
+	}
+
+	refs, err = GoFindReferences(root, GoQuery{Symbol: "Add"})
+	if err != nil || len(refs.References) != 2 || refs.References[1].Text != "Add()" {
+		t.Fatalf("expected only main.Add and its call, got %+v (%v)", refs, err)
+	}
+}
+
+func TestGoListSymbolsAndOutline(t *testing.T) {
+	root := writeGoModule(t)
+
+	syms, err := GoListSymbols(root, filepath.Join(root, "cart", "cart.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range syms {
+		names = append(names, s.Kind+" "+s.Name+"@"+s.Location)
+	}
+	want := "type Cart@cart/cart.go:5,func New@cart/cart.go:11,method Add@cart/cart.go:14,method count@cart/cart.go:16"
+	if got := strings.Join(names, ","); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	out, err := GoPackageOutline(root, filepath.Join(root, "cart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ImportPath != "example.com/shop/cart" || out.Doc != "Package cart keeps items." || len(out.Types) != 1 {
+		t.Fatalf("unexpected outline: %+v", out)
+	}
+	typ := out.Types[0]
+	if strings.Contains(typ.Signature, "owner") || len(typ.Constructors) != 1 || len(typ.Methods) != 1 {
+		t.Fatalf("outline should only have the exported API: %+v", typ)
+	}
+}
+
+func TestGoCode_TestFiles(t *testing.T) {
+	root := writeGoModule(t)
+	tests := map[string]string{
+		"cart/cart_test.go": `package cart
+
+import "testing"
+
+func TestCount(t *testing.T) {
+	c := New()
+	c.Add("apple")
+	if c.count() != 1 {
+		t.Fatal(c.Items)
+	}
+}
+`,
+		"cart/cart_x_test.go": `package cart_test
+
+import "example.com/shop/cart"
+
+func ExampleCart_Add() {
+	cart.New().Add("pear")
+}
+`,
+	}
+	for name, content := range tests {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refs, err := GoFindReferences(root, GoQuery{Symbol: "Cart.Add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locs []string
+	for _, r := range refs.References {
+		locs = append(locs, r.Location)
+	}
+	if got := strings.Join(locs, ","); got != "cart/cart.go:14,cart/cart_test.go:7,cart/cart_x_test.go:6,main.go:10,main.go:11" {
+		t.Fatalf("unexpected references %s", got)
+	}
+
+	for _, name := range []string{"cart_test.go", "cart_x_test.go"} {
+		syms, err := GoListSymbols(root, filepath.Join(root, "cart", name))
+		if err != nil || len(syms) != 1 {
+			t.Fatalf("%s: got %+v, %v", name, syms, err)
+		}
+	}
+	// 列出目录时只有包本身的声明
+	syms, err := GoListSymbols(root, filepath.Join(root, "cart"))
+	if err != nil || len(syms) != 4 {
+		t.Fatalf("got %+v, %v", syms, err)
+	}
+}
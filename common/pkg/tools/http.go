@@ -0,0 +1,500 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// --- HTTP Egress ---
+
+const (
+	DefaultHttpTimeout      = 30 * time.Second
+	MaxHttpTimeout          = 120 * time.Second
+	DefaultHttpMaxBodyBytes = 1024 * 1024 // 1MB
+)
+
+// HttpPolicy 控制 agent 发起的出站请求：只允许访问白名单中的主机，并限制响应体大小
+type HttpPolicy struct {
+	AllowedHosts []string
+	MaxBodyBytes int64
+}
+
+type HttpRequestOptions struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	Timeout time.Duration
+}
+
+type HttpResponse struct {
+	Status    int               `json:"status"`
+	Headers   map[string]string `json:"headers"`
+	Body      string            `json:"body"`
+	Truncated bool              `json:"truncated"`
+}
+
+// HostAllowed reports whether host (optionally with port) matches one of the
+// allowlist entries. Entries may be an exact host, host:port, "*.suffix" for
+// subdomains, or "*" to allow everything.
+func HostAllowed(allowlist []string, hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	hostport = strings.ToLower(hostport)
+
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || entry == host || entry == hostport {
+			return true
+		}
+		if strings.HasPrefix(entry, "*.") && strings.HasSuffix(host, entry[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p HttpPolicy) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	if !HostAllowed(p.AllowedHosts, u.Host) {
+		return fmt.Errorf("host %q is not in the project's HTTP allowlist", u.Host)
+	}
+	return nil
+}
+
+func (p HttpPolicy) maxBody() int64 {
+	if p.MaxBodyBytes > 0 {
+		return p.MaxBodyBytes
+	}
+	return DefaultHttpMaxBodyBytes
+}
+
+func (p HttpPolicy) client(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = DefaultHttpTimeout
+	}
+	if timeout > MaxHttpTimeout {
+		timeout = MaxHttpTimeout
+	}
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			// Redirect targets must satisfy the allowlist as well
+			return p.checkURL(req.URL)
+		},
+	}
+}
+
+// HttpRequest performs a request under the given policy. The response body is
+// capped at the policy's size limit; anything beyond it is dropped and the
+// result is flagged as truncated. Cancelling ctx aborts the request.
+func HttpRequest(ctx context.Context, policy HttpPolicy, opts HttpRequestOptions) (*HttpResponse, error) {
+	u, err := url.Parse(strings.TrimSpace(opts.URL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if err := policy.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(opts.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if opts.Body != "" {
+		body = strings.NewReader(opts.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := policy.client(opts.Timeout).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	limit := policy.maxBody()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	truncated := int64(len(data)) > limit
+	if truncated {
+		data = data[:limit]
+	}
+
+	headers := make(map[string]string, len(resp.Header))
+	for k, v := range resp.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+
+	return &HttpResponse{
+		Status:    resp.StatusCode,
+		Headers:   headers,
+		Body:      string(data),
+		Truncated: truncated,
+	}, nil
+}
+
+// HttpRequestJSON is HttpRequest with the result encoded for a tool message.
+func HttpRequestJSON(ctx context.Context, policy HttpPolicy, opts HttpRequestOptions) (string, error) {
+	resp, err := HttpRequest(ctx, policy, opts)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// FetchURL GETs a page and returns it as readable markdown. Non-HTML bodies
+// are returned as-is.
+func FetchURL(ctx context.Context, policy HttpPolicy, rawURL string, timeout time.Duration) (string, error) {
+	resp, err := HttpRequest(ctx, policy, HttpRequestOptions{
+		Method:  http.MethodGet,
+		URL:     rawURL,
+		Headers: map[string]string{"Accept": "text/html, text/plain;q=0.9, */*;q=0.5"},
+		Timeout: timeout,
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Status >= 400 {
+		return "", fmt.Errorf("fetch failed with status %d", resp.Status)
+	}
+
+	out := resp.Body
+	contentType := strings.ToLower(resp.Headers["Content-Type"])
+	if strings.Contains(contentType, "html") || (contentType == "" && looksLikeHTML(out)) {
+		out = HTMLToMarkdown(out)
+	}
+	if resp.Truncated {
+		out += fmt.Sprintf("\n\n... (truncated, response exceeded %d bytes)", policy.maxBody())
+	}
+	return out, nil
+}
+
+func looksLikeHTML(s string) bool {
+	head := strings.ToLower(strings.TrimSpace(s))
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return strings.HasPrefix(head, "<!doctype html") || strings.Contains(head, "<html")
+}
+
+// --- HTML to Markdown ---
+
+var (
+	blankLinesRe  = regexp.MustCompile(`\n{3,}`)
+	inlineSpaceRe = regexp.MustCompile(`[ \t]+`)
+)
+
+// HTMLToMarkdown converts an HTML document to a compact markdown rendering.
+// It keeps headings, paragraphs, links, lists, code and tables, and drops
+// scripts, styles and page chrome such as nav and footer.
+func HTMLToMarkdown(src string) string {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return src
+	}
+
+	root := doc
+	if body := findElement(doc, "body"); body != nil {
+		root = body
+	}
+
+	var sb strings.Builder
+	if title := findElement(doc, "title"); title != nil {
+		if t := strings.TrimSpace(textContent(title)); t != "" {
+			sb.WriteString("# " + t + "\n\n")
+		}
+	}
+
+	c := &mdConverter{sb: &sb}
+	c.children(root)
+
+	out := blankLinesRe.ReplaceAllString(sb.String(), "\n\n")
+	lines := strings.Split(out, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+type mdConverter struct {
+	sb        *strings.Builder
+	listStack []listState
+	inPre     bool
+}
+
+type listState struct {
+	ordered bool
+	index   int
+}
+
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"nav": true, "footer": true, "header": true, "aside": true,
+	"svg": true, "iframe": true, "form": true, "button": true, "head": true,
+}
+
+func (c *mdConverter) children(n *html.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.node(ch)
+	}
+}
+
+func (c *mdConverter) block(s string) {
+	c.sb.WriteString("\n\n" + s)
+}
+
+func (c *mdConverter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if c.inPre {
+			c.sb.WriteString(n.Data)
+			return
+		}
+		c.sb.WriteString(inlineSpaceRe.ReplaceAllString(strings.ReplaceAll(n.Data, "\n", " "), " "))
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+
+	tag := n.Data
+	if skippedElements[tag] {
+		return
+	}
+
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(tag[1] - '0')
+		c.block(strings.Repeat("#", level) + " " + strings.TrimSpace(c.inline(n)) + "\n\n")
+	case "p", "div", "section", "article", "main":
+		c.sb.WriteString("\n\n")
+		c.children(n)
+		c.sb.WriteString("\n\n")
+	case "br":
+		c.sb.WriteString("  \n")
+	case "hr":
+		c.block("---\n\n")
+	case "strong", "b":
+		c.wrapInline(n, "**")
+	case "em", "i":
+		c.wrapInline(n, "*")
+	case "code":
+		if c.inPre {
+			c.children(n)
+		} else {
+			c.wrapInline(n, "`")
+		}
+	case "pre":
+		lang := ""
+		if code := findElement(n, "code"); code != nil {
+			for _, cls := range strings.Fields(attr(code, "class")) {
+				if strings.HasPrefix(cls, "language-") {
+					lang = strings.TrimPrefix(cls, "language-")
+				}
+			}
+		}
+		c.sb.WriteString("\n\n```" + lang + "\n")
+		c.inPre = true
+		c.children(n)
+		c.inPre = false
+		c.sb.WriteString("\n```\n\n")
+	case "a":
+		text := strings.TrimSpace(c.inline(n))
+		href := strings.TrimSpace(attr(n, "href"))
+		if href == "" || strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "#") {
+			c.sb.WriteString(text)
+		} else if text == "" {
+			c.sb.WriteString("<" + href + ">")
+		} else {
+			c.sb.WriteString("[" + text + "](" + href + ")")
+		}
+	case "img":
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			c.sb.WriteString("![" + alt + "](" + attr(n, "src") + ")")
+		}
+	case "ul", "ol":
+		c.listStack = append(c.listStack, listState{ordered: tag == "ol"})
+		c.sb.WriteString("\n")
+		c.children(n)
+		c.listStack = c.listStack[:len(c.listStack)-1]
+		c.sb.WriteString("\n")
+	case "li":
+		indent := ""
+		marker := "-"
+		if depth := len(c.listStack); depth > 0 {
+			indent = strings.Repeat("  ", depth-1)
+			st := &c.listStack[depth-1]
+			if st.ordered {
+				st.index++
+				marker = fmt.Sprintf("%d.", st.index)
+			}
+		}
+		c.sb.WriteString("\n" + indent + marker + " " + strings.TrimSpace(c.inline(n)))
+	case "blockquote":
+		text := strings.TrimSpace(c.inline(n))
+		var quoted []string
+		for _, l := range strings.Split(text, "\n") {
+			quoted = append(quoted, "> "+strings.TrimSpace(l))
+		}
+		c.block(strings.Join(quoted, "\n") + "\n\n")
+	case "table":
+		c.table(n)
+	default:
+		c.children(n)
+	}
+}
+
+// inline renders the children of n into a separate buffer so callers can trim
+// or wrap the result.
+func (c *mdConverter) inline(n *html.Node) string {
+	var sb strings.Builder
+	sub := &mdConverter{sb: &sb, listStack: c.listStack, inPre: c.inPre}
+	sub.children(n)
+	c.listStack = sub.listStack
+	return blankLinesRe.ReplaceAllString(sb.String(), "\n")
+}
+
+func (c *mdConverter) wrapInline(n *html.Node, mark string) {
+	text := strings.TrimSpace(c.inline(n))
+	if text == "" {
+		return
+	}
+	c.sb.WriteString(mark + text + mark)
+}
+
+func (c *mdConverter) table(n *html.Node) {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(x *html.Node) {
+		if x.Type == html.ElementNode && x.Data == "tr" {
+			var cells []string
+			for cell := x.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					text := strings.TrimSpace(strings.ReplaceAll(c.inline(cell), "\n", " "))
+					cells = append(cells, strings.ReplaceAll(text, "|", "\\|"))
+				}
+			}
+			if len(cells) > 0 {
+				rows = append(rows, cells)
+			}
+			return
+		}
+		for ch := x.FirstChild; ch != nil; ch = ch.NextSibling {
+			walk(ch)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	cols := 0
+	for _, r := range rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	var sb strings.Builder
+	for i, r := range rows {
+		for len(r) < cols {
+			r = append(r, "")
+		}
+		sb.WriteString("| " + strings.Join(r, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	c.block(sb.String() + "\n")
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if found := findElement(ch, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(textContent(ch))
+	}
+	return sb.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// ParseHostList decodes an allowlist stored as a JSON array. A plain comma or
+// newline separated list is accepted as well for hand-edited values.
+func ParseHostList(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var hosts []string
+	if strings.HasPrefix(raw, "[") {
+		if err := json.Unmarshal([]byte(raw), &hosts); err == nil {
+			return hosts
+		}
+	}
+	for _, h := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Token", r.Header.Get("X-Token"))
+		w.Write(body)
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 4096)))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Docs</title><script>alert(1)</script></head>
+<body><nav>menu</nav><h2>Install</h2><p>Run <code>go build</code> then see <a href="/more">more</a>.</p>
+<ul><li>one</li><li>two</li></ul><pre><code class="language-go">fmt.Println("hi")</code></pre></body></html>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://blocked.example/", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return srv, u.Hostname()
+}
+
+func TestHttpRequest_AllowlistAndEcho(t *testing.T) {
+	srv, host := newTestServer(t)
+
+	_, err := HttpRequest(context.Background(), HttpPolicy{}, HttpRequestOptions{URL: srv.URL + "/echo"})
+	if err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("expected allowlist error with empty policy, got %v", err)
+	}
+
+	policy := HttpPolicy{AllowedHosts: []string{host}}
+	resp, err := HttpRequest(context.Background(), policy, HttpRequestOptions{
+		Method:  "post",
+		URL:     srv.URL + "/echo",
+		Headers: map[string]string{"X-Token": "abc"},
+		Body:    "payload",
+	})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.Status != 200 || resp.Body != "payload" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Headers["X-Method"] != "POST" || resp.Headers["X-Token"] != "abc" {
+		t.Fatalf("method/headers not forwarded: %+v", resp.Headers)
+	}
+}
+
+func TestHttpRequest_SizeCapAndRedirect(t *testing.T) {
+	srv, host := newTestServer(t)
+	policy := HttpPolicy{AllowedHosts: []string{host}, MaxBodyBytes: 100}
+
+	resp, err := HttpRequest(context.Background(), policy, HttpRequestOptions{URL: srv.URL + "/big"})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if !resp.Truncated || len(resp.Body) != 100 {
+		t.Fatalf("expected body truncated to 100 bytes, got %d (truncated=%v)", len(resp.Body), resp.Truncated)
+	}
+
+	if _, err := HttpRequest(context.Background(), policy, HttpRequestOptions{URL: srv.URL + "/redirect"}); err == nil || !strings.Contains(err.Error(), "blocked.example") {
+		t.Fatalf("expected redirect to non-allowlisted host to fail, got %v", err)
+	}
+}
+
+func TestHttpRequest_Cancel(t *testing.T) {
+	srv, host := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := HttpRequest(ctx, HttpPolicy{AllowedHosts: []string{host}}, HttpRequestOptions{URL: srv.URL + "/echo"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled request to fail, got %v", err)
+	}
+}
+
+func TestFetchURL_Markdown(t *testing.T) {
+	srv, host := newTestServer(t)
+
+	md, err := FetchURL(context.Background(), HttpPolicy{AllowedHosts: []string{host}}, srv.URL+"/page", 0)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	for _, want := range []string{"# Docs", "## Install", "`go build`", "[more](/more)", "- one", "```go\nfmt.Println(\"hi\")\n```"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	for _, unwanted := range []string{"alert(1)", "menu"} {
+		if strings.Contains(md, unwanted) {
+			t.Errorf("markdown should not contain %q:\n%s", unwanted, md)
+		}
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	list := []string{"api.example.com", "*.internal.dev", "localhost:9000"}
+	cases := map[string]bool{
+		"api.example.com":     true,
+		"API.example.com:443": true,
+		"svc.internal.dev":    true,
+		"internal.dev":        false,
+		"localhost:9000":      true,
+		"localhost:9001":      false,
+		"evil.com":            false,
+	}
+	for host, want := range cases {
+		if got := HostAllowed(list, host); got != want {
+			t.Errorf("HostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
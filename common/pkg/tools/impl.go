@@ -1,7 +1,9 @@
 package tools
 
 import (
+	"context"
 	"fmt"
+	"iat/common/model"
 	"io"
 	"net/http"
 	"os"
@@ -204,9 +206,51 @@ func DiffFile(path1, path2 string) (string, error) {
 	return dmp.DiffPrettyText(diffs), nil
 }
 
+// DiffText returns a line based diff of two texts. Every line is prefixed
+// with "-" (removed), "+" (added) or " " (unchanged).
+func DiffText(oldText, newText string) string {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(oldText, newText)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+
+	var sb strings.Builder
+	for _, d := range diffs {
+		prefix := " "
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		}
+		for _, line := range strings.SplitAfter(d.Text, "\n") {
+			if line == "" {
+				continue
+			}
+			sb.WriteString(prefix)
+			sb.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				sb.WriteString("\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
 // --- Command Execution ---
 
 func RunCommand(command string, args []string) (string, error) {
+	return RunCommandInDir("", command, args)
+}
+
+// RunCommandInDir runs the command with dir as working directory (the
+// process working directory when dir is empty).
+func RunCommandInDir(dir string, command string, args []string) (string, error) {
+	return RunCommandWithEnv(context.Background(), dir, command, args, nil)
+}
+
+// RunCommandWithEnv is RunCommandInDir with extra "KEY=value" environment
+// entries added to the process environment. Cancelling ctx kills the shell.
+func RunCommandWithEnv(ctx context.Context, dir string, command string, args []string, env []string) (string, error) {
 	if strings.TrimSpace(command) == "" {
 		return "", fmt.Errorf("command is required")
 	}
@@ -224,11 +268,34 @@ func RunCommand(command string, args []string) (string, error) {
 	fullCmd := fullCmdBuilder.String()
 
 	if runtime.GOOS == "windows" {
-		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", fullCmd)
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", fullCmd)
 	} else {
-		cmd = exec.Command("sh", "-lc", fullCmd)
+		cmd = exec.CommandContext(ctx, "sh", "-lc", fullCmd)
+	}
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("command failed: %v, output: %s", err, string(output))
 	}
+	return string(output), nil
+}
 
+// ExecCommand runs argv directly, without a shell, so arguments are never
+// interpreted as shell syntax. dir is the working directory and env holds
+// extra "KEY=value" entries added to the process environment.
+func ExecCommand(ctx context.Context, dir string, argv []string, env []string) (string, error) {
+	if len(argv) == 0 || strings.TrimSpace(argv[0]) == "" {
+		return "", fmt.Errorf("command is required")
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return string(output), fmt.Errorf("command failed: %v, output: %s", err, string(output))
@@ -236,20 +303,407 @@ func RunCommand(command string, args []string) (string, error) {
 	return string(output), nil
 }
 
+// CommandArgv builds the argv of a command run without a shell: command is
+// split into words with SplitCommandLine and args are appended verbatim.
+// Shell interpreters are refused, since "sh -c" would bring back everything
+// running without a shell is meant to rule out, and so are wrappers whose
+// program can't be told.
+func CommandArgv(command string, args []string) ([]string, error) {
+	argv, err := SplitCommandLine(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("command is required")
+	}
+	argv = append(argv, args...)
+	prog := CommandProgram(argv)
+	if len(prog) == 0 {
+		return nil, fmt.Errorf("%s: can't tell which program the command runs", argv[0])
+	}
+	if shellInterpreters[commandName(prog[0])] {
+		return nil, fmt.Errorf("%s: shell interpreters can't be run as commands; run each program directly or use run_script", prog[0])
+	}
+	return argv, nil
+}
+
+// ShellCommands splits a shell command line into the argv of each simple
+// command in it, for checking run_command lines that a shell will run.
+// Commands are separated by ";", "&", "|", newlines, parentheses and the
+// start of a command substitution; redirections, leading assignments and
+// reserved words are dropped, and the script of "sh -c" is split as well.
+// Quoted text isn't looked into and nothing is expanded, so the result is
+// a best effort, not a parse the shell is bound to agree with.
+func ShellCommands(line string) [][]string {
+	var cmds [][]string
+	var words []string
+	var cur strings.Builder
+	inWord, dropWord := false, false
+	var quote rune
+	endWord := func() {
+		if inWord && !dropWord {
+			words = append(words, cur.String())
+		}
+		if inWord {
+			dropWord = false
+		}
+		cur.Reset()
+		inWord = false
+	}
+	endCmd := func() {
+		endWord()
+		for len(words) > 0 && (shellReservedWords[words[0]] || isShellAssignment(words[0])) {
+			words = words[1:]
+		}
+		if len(words) > 0 {
+			cmds = append(cmds, words)
+		}
+		words = nil
+		dropWord = false
+	}
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(runes):
+				i++
+				cur.WriteRune(runes[i])
+			default:
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			}
+			inWord = true
+		case c == ' ' || c == '\t':
+			endWord()
+		case c == '#' && !inWord:
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case c == '<' || c == '>':
+			// "2>&1", "> out.txt": the file descriptor and the target aren't commands
+			if inWord && strings.Trim(cur.String(), "0123456789") == "" {
+				cur.Reset()
+				inWord = false
+			}
+			endWord()
+			for i+1 < len(runes) && strings.ContainsRune("<>&|", runes[i+1]) {
+				i++
+			}
+			dropWord = true
+		case c == '$' && i+1 < len(runes) && runes[i+1] == '(':
+			i++
+			endCmd()
+		case strings.ContainsRune(";&|()`\n\r", c):
+			endCmd()
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	endCmd()
+
+	var all [][]string
+	for _, argv := range cmds {
+		all = append(all, argv)
+		prog := CommandProgram(argv)
+		if len(prog) < 3 || !shellInterpreters[commandName(prog[0])] {
+			continue
+		}
+		for j, a := range prog[1 : len(prog)-1] {
+			if strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.Contains(a, "c") {
+				all = append(all, ShellCommands(prog[j+2])...)
+				break
+			}
+		}
+	}
+	return all
+}
+
+var shellReservedWords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true, "do": true, "done": true,
+	"while": true, "until": true, "!": true, "{": true, "}": true,
+}
+
+// isShellAssignment reports whether word is a "NAME=value" prefix.
+func isShellAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+var shellInterpreters = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "mksh": true, "ash": true,
+	"fish": true, "csh": true, "tcsh": true, "busybox": true,
+	"powershell": true, "pwsh": true, "cmd": true,
+}
+
+// commandWrappers are programs that run another program given as their
+// arguments. The value reports whether a flag takes a separate value.
+// Privilege wrappers (sudo, doas) are deliberately not listed: they are
+// checked as programs of their own, so a policy has to allow them by name.
+var commandWrappers = map[string]func(flag string) bool{
+	"env":     func(f string) bool { return f == "-u" || f == "-C" },
+	"nohup":   func(string) bool { return false },
+	"nice":    func(f string) bool { return f == "-n" },
+	"time":    func(f string) bool { return f == "-f" || f == "-o" },
+	"timeout": func(f string) bool { return f == "-s" || f == "-k" },
+	"command": func(string) bool { return false },
+	"stdbuf":  func(f string) bool { return f == "-i" || f == "-o" || f == "-e" },
+	"xargs":   func(f string) bool { return len(f) == 2 && strings.ContainsAny(f[1:], "adEeIiLlnPs") },
+}
+
+// CommandProgram strips wrappers such as env, nohup or timeout from argv and
+// returns the argv of the program that actually runs.
+func CommandProgram(argv []string) []string {
+next:
+	for len(argv) > 0 {
+		name := commandName(argv[0])
+		takesValue, ok := commandWrappers[name]
+		if !ok {
+			return argv
+		}
+		i := 1
+	flags:
+		for i < len(argv) {
+			a := argv[i]
+			if name == "env" {
+				// env -S 'prog args' 把一个参数拆成命令行
+				if value, rest, ok := envSplitString(argv, i); ok {
+					cmds := ShellCommands(value)
+					if len(cmds) != 1 {
+						return nil
+					}
+					argv = append(cmds[0], argv[rest:]...)
+					continue next
+				}
+			}
+			switch {
+			case a == "--":
+				i++
+				break flags
+			case strings.HasPrefix(a, "-") && len(a) > 1:
+				if takesValue(a) {
+					i++
+				}
+				i++
+			case name == "env" && strings.Contains(a, "="):
+				i++
+			default:
+				break flags
+			}
+		}
+		if name == "timeout" {
+			i++ // the duration
+		}
+		if i >= len(argv) {
+			return nil
+		}
+		argv = argv[i:]
+	}
+	return argv
+}
+
+// envSplitString returns the value of an env -S (--split-string) option at
+// argv[i] and the index of the argument after it.
+func envSplitString(argv []string, i int) (string, int, bool) {
+	a := argv[i]
+	if value, ok := strings.CutPrefix(a, "--split-string="); ok {
+		return value, i + 1, true
+	}
+	inline, separate := "", a == "--split-string"
+	if !separate {
+		// 单字母选项可以合写，如 -iS
+		flags, v, ok := strings.Cut(a, "S")
+		if !ok || !strings.HasPrefix(flags, "-") || strings.HasPrefix(flags, "--") || strings.Trim(flags[1:], "iv0") != "" {
+			return "", 0, false
+		}
+		inline, separate = v, v == ""
+	}
+	if !separate {
+		return inline, i + 1, true
+	}
+	if i+1 >= len(argv) {
+		return "", 0, false
+	}
+	return argv[i+1], i + 2, true
+}
+
+// commandName returns the program name of an argv[0] without directory or
+// Windows executable suffix.
+func commandName(arg string) string {
+	name := strings.ToLower(filepath.Base(filepath.ToSlash(arg)))
+	return strings.TrimSuffix(name, ".exe")
+}
+
+// SplitCommandLine splits a command line into words like a POSIX shell does
+// for a simple command: whitespace separates words, quotes group them and a
+// backslash escapes the next character outside single quotes. Operators,
+// redirections, substitutions and expansions are rejected rather than run,
+// because commands are executed without a shell.
+func SplitCommandLine(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case quote == '"':
+			switch c {
+			case '"':
+				quote = 0
+			case '\\':
+				if i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+					i++
+					cur.WriteRune(runes[i])
+				} else {
+					cur.WriteRune(c)
+				}
+			case '$', '`':
+				return nil, fmt.Errorf("unsupported shell syntax %q in command; commands run without a shell", string(c))
+			default:
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			}
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case strings.ContainsRune(";&|<>()$`\n\r", c):
+			return nil, fmt.Errorf("unsupported shell syntax %q in command; commands run without a shell, run one program per call", string(c))
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// CheckCommandPolicy rejects a command the project's command policy doesn't
+// allow. argv is a single program invocation: the argv run without a shell
+// (see CommandArgv and ScriptArgv) or one command of a shell line (see
+// ShellCommands), so a pattern can't be sidestepped with ";" or "cd x &&".
+// Wrappers like env or timeout are looked through: patterns match the name
+// and the line of the wrapped program ("env rm -rf x" is "rm -rf x"), and
+// deny patterns also match the full line.
+func CheckCommandPolicy(policy model.CommandPolicy, argv []string) error {
+	if policy.IsEmpty() {
+		return nil
+	}
+	if len(argv) == 0 {
+		return fmt.Errorf("command is required")
+	}
+	full := strings.Join(argv, " ")
+	prog := CommandProgram(argv)
+	if len(prog) == 0 {
+		prog = argv
+	}
+	line := strings.Join(prog, " ")
+	name := commandName(prog[0])
+	matches := func(patterns []string, lines ...string) bool {
+		for _, pat := range patterns {
+			if pat = strings.TrimSpace(pat); pat == "" {
+				continue
+			}
+			if pat == name {
+				return true
+			}
+			for _, l := range lines {
+				if matchCommandPattern(pat, l) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if matches(policy.Deny, line, full) {
+		return fmt.Errorf("command %q is denied by the project command policy", full)
+	}
+	if len(policy.Allow) > 0 && !matches(policy.Allow, line) {
+		return fmt.Errorf("command %q is not in the project's allowed commands", full)
+	}
+	return nil
+}
+
+// matchCommandPattern matches a command line against a pattern in which "*"
+// matches any text, spaces and slashes included.
+func matchCommandPattern(pattern, line string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == line
+	}
+	if !strings.HasPrefix(line, parts[0]) {
+		return false
+	}
+	line = line[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(line, part)
+		if i < 0 {
+			return false
+		}
+		line = line[i+len(part):]
+	}
+	return strings.HasSuffix(line, parts[len(parts)-1])
+}
+
 func RunScript(scriptPath string, args []string) (string, error) {
-	// Determine the interpreter based on file extension
-	var cmd *exec.Cmd
-	if strings.HasSuffix(scriptPath, ".py") {
-		cmd = exec.Command("python", append([]string{scriptPath}, args...)...)
-	} else if strings.HasSuffix(scriptPath, ".js") {
-		cmd = exec.Command("node", append([]string{scriptPath}, args...)...)
-	} else if strings.HasSuffix(scriptPath, ".sh") {
-		cmd = exec.Command("bash", append([]string{scriptPath}, args...)...)
-	} else if strings.HasSuffix(scriptPath, ".go") {
-		cmd = exec.Command("go", append([]string{"run", scriptPath}, args...)...)
-	} else {
-		return "", fmt.Errorf("unsupported script type: %s", scriptPath)
+	return RunScriptInDir("", scriptPath, args)
+}
+
+func RunScriptInDir(dir string, scriptPath string, args []string) (string, error) {
+	argv, err := ScriptArgv(scriptPath, args)
+	if err != nil {
+		return "", err
 	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = dir
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -258,6 +712,25 @@ func RunScript(scriptPath string, args []string) (string, error) {
 	return string(output), nil
 }
 
+// ScriptArgv returns the argv that runs a script, the interpreter being
+// chosen by the file extension.
+func ScriptArgv(scriptPath string, args []string) ([]string, error) {
+	var argv []string
+	switch {
+	case strings.HasSuffix(scriptPath, ".py"):
+		argv = []string{"python", scriptPath}
+	case strings.HasSuffix(scriptPath, ".js"):
+		argv = []string{"node", scriptPath}
+	case strings.HasSuffix(scriptPath, ".sh"):
+		argv = []string{"bash", scriptPath}
+	case strings.HasSuffix(scriptPath, ".go"):
+		argv = []string{"go", "run", scriptPath}
+	default:
+		return nil, fmt.Errorf("unsupported script type: %s", scriptPath)
+	}
+	return append(argv, args...), nil
+}
+
 // Http helpers for script modules
 func HttpGet(url string) (string, error) {
 	resp, err := http.Get(url)
@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"iat/common/model"
+	"testing"
+)
+
+func TestCheckCommandPolicy(t *testing.T) {
+	policy := model.CommandPolicy{Allow: []string{"go", "npm run *"}, Deny: []string{"rm -rf *", "go run *"}}
+	cases := []struct {
+		argv []string
+		ok   bool
+	}{
+		{[]string{"go", "build", "./..."}, true},
+		{[]string{"/usr/local/go/bin/go", "vet"}, true},
+		{[]string{"npm", "run", "lint"}, true},
+		{[]string{"env", "CGO_ENABLED=0", "go", "build"}, true},
+		{[]string{"go", "run", "main.go"}, false},
+		{[]string{"timeout", "5", "go", "run", "x.go"}, false},
+		{[]string{"env", "rm", "-rf", "x"}, false},
+		{[]string{"curl", "https://example.com"}, false},
+		{[]string{"env", "curl", "https://example.com"}, false},
+		{[]string{"npm", "install"}, false},
+		// sudo/doas 不是透明的包装，需要策略显式允许
+		{[]string{"sudo", "go", "build"}, false},
+		{[]string{"doas", "-u", "root", "go", "build"}, false},
+		// env -S 的值按命令行拆开后再检查
+		{[]string{"env", "-S", "go build ./..."}, true},
+		{[]string{"env", "-S", "rm -rf /"}, false},
+		{[]string{"env", "-iS", "go run x.go"}, false},
+		{[]string{"env", "--split-string=curl https://example.com"}, false},
+	}
+	for _, c := range cases {
+		if err := CheckCommandPolicy(policy, c.argv); (err == nil) != c.ok {
+			t.Errorf("%v: expected ok=%v, got %v", c.argv, c.ok, err)
+		}
+	}
+
+	argv, err := ScriptArgv("tools/gen.sh", []string{"a"})
+	if err != nil || len(argv) != 3 || argv[0] != "bash" {
+		t.Fatalf("unexpected script argv %v (%v)", argv, err)
+	}
+	if err := CheckCommandPolicy(policy, argv); err == nil {
+		t.Fatalf("a script whose interpreter isn't allowed must be refused")
+	}
+}
@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// --- Project Instructions ---
+
+// ProjectInstructionFiles are looked up in the project root and in every
+// directory between the root and the paths the agent touches.
+var ProjectInstructionFiles = []string{"AGENTS.md", ".iat/instructions.md"}
+
+// MaxInstructionFileBytes caps the content taken from a single file.
+const MaxInstructionFileBytes = 32 * 1024
+
+type InstructionSource struct {
+	Path      string `json:"path"` // relative to the project root
+	Dir       string `json:"dir"`  // directory the instructions apply to, "." for the root
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type ProjectInstructions struct {
+	Root    string              `json:"root"`
+	Sources []InstructionSource `json:"sources"`
+	Text    string              `json:"text"` // rendered for the system prompt, empty without sources
+}
+
+// InstructionLoader 负责读取项目说明文件，记录已加载的目录，
+// 使对话过程中只追加新碰到的子目录说明。
+type InstructionLoader struct {
+	root   string
+	seen   map[string]bool // directories already checked, relative to root
+	loaded int
+}
+
+func NewInstructionLoader(root string) *InstructionLoader {
+	if root != "" {
+		root = filepath.Clean(root)
+	}
+	return &InstructionLoader{root: root, seen: make(map[string]bool)}
+}
+
+// Load 读取尚未检查过的目录中的说明文件：始终包含项目根目录，
+// 以及根目录到 paths 中每个路径之间的各级目录。路径可以是绝对路径或相对
+// 于项目根目录的路径，项目外的路径被忽略。
+func (l *InstructionLoader) Load(paths ...string) []InstructionSource {
+	if l.root == "" {
+		return nil
+	}
+	var dirs []string
+	add := func(rel string) {
+		if !l.seen[rel] {
+			l.seen[rel] = true
+			dirs = append(dirs, rel)
+		}
+	}
+	add(".")
+	for _, p := range paths {
+		rel, ok := l.relDir(p)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(rel, "/")
+		for i := range parts {
+			add(strings.Join(parts[:i+1], "/"))
+		}
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return instructionDepth(dirs[i]) < instructionDepth(dirs[j])
+	})
+
+	var sources []InstructionSource
+	for _, dir := range dirs {
+		for _, name := range ProjectInstructionFiles {
+			rel := filepath.ToSlash(filepath.Join(dir, name))
+			data, err := os.ReadFile(filepath.Join(l.root, filepath.FromSlash(rel)))
+			if err != nil {
+				continue
+			}
+			src := InstructionSource{Path: rel, Dir: dir}
+			if len(data) > MaxInstructionFileBytes {
+				data, src.Truncated = data[:MaxInstructionFileBytes], true
+			}
+			src.Content = strings.TrimSpace(string(data))
+			if src.Content != "" {
+				sources = append(sources, src)
+			}
+		}
+	}
+	return sources
+}
+
+// Prompt 与 Load 相同，但返回渲染后的文本；第一次有内容时带上标题
+func (l *InstructionLoader) Prompt(paths ...string) string {
+	sources := l.Load(paths...)
+	text := RenderInstructions(sources, l.loaded == 0)
+	l.loaded += len(sources)
+	return text
+}
+
+// relDir 返回路径所在目录相对于项目根目录的路径；根目录本身返回 false
+func (l *InstructionLoader) relDir(p string) (string, bool) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "", false
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(l.root, p)
+	}
+	p = filepath.Clean(p)
+	if info, err := os.Stat(p); err != nil || !info.IsDir() {
+		p = filepath.Dir(p)
+	}
+	rel, err := filepath.Rel(l.root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func instructionDepth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// LoadProjectInstructions 读取项目根目录及 paths 涉及的子目录中的说明文件
+func LoadProjectInstructions(root string, paths []string) *ProjectInstructions {
+	sources := NewInstructionLoader(root).Load(paths...)
+	if sources == nil {
+		sources = []InstructionSource{}
+	}
+	return &ProjectInstructions{Root: root, Sources: sources, Text: RenderInstructions(sources, true)}
+}
+
+// RenderInstructions 渲染说明文件供系统提示词使用；withHeader 为 false 时
+// 只渲染各文件段落，用于对话中追加新发现的子目录说明。
+func RenderInstructions(sources []InstructionSource, withHeader bool) string {
+	if len(sources) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	if withHeader {
+		b.WriteString("\n\n### Project Instructions\nFollow these instructions from the project's files. Instructions of a subdirectory apply to files under it and take precedence over the parent's.\n")
+	}
+	for _, src := range sources {
+		if src.Dir == "." {
+			fmt.Fprintf(&b, "\n#### %s\n", src.Path)
+		} else {
+			fmt.Fprintf(&b, "\n#### %s (applies to %s/)\n", src.Path, src.Dir)
+		}
+		b.WriteString(src.Content)
+		if src.Truncated {
+			b.WriteString("\n[truncated]")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ToolCallPaths 从工具参数中取出文件路径（path、paths、scriptPath、cwd 等）
+func ToolCallPaths(args map[string]any) []string {
+	var out []string
+	for _, key := range []string{"path", "paths", "file", "filePath", "scriptPath", "cwd", "dir"} {
+		switch v := args[key].(type) {
+		case string:
+			out = append(out, v)
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					out = append(out, s)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// ToolCallPathsJSON 与 ToolCallPaths 相同，参数为原始 JSON
+func ToolCallPathsJSON(rawArgs string) []string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(rawArgs), &args); err != nil {
+		return nil
+	}
+	return ToolCallPaths(args)
+}
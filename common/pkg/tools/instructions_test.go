@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstructionLoader(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"AGENTS.md":                "Run go test ./... before committing.",
+		"web/.iat/instructions.md": "Use pnpm, not npm.",
+		"web/src/app.ts":           "export const app = 1",
+		"server/api/handler.go":    "package api",
+		"server/api/AGENTS.md":     "Handlers return JSON.",
+		"../outside/AGENTS.md":     "never loaded",
+	}
+	for rel, content := range files {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := NewInstructionLoader(root)
+	text := l.Prompt()
+	if !strings.Contains(text, "### Project Instructions") || !strings.Contains(text, "go test") || strings.Contains(text, "pnpm") {
+		t.Fatalf("root instructions: %q", text)
+	}
+
+	// 子目录的说明只在触及时追加一次，不再重复标题
+	text = l.Prompt("web/src/app.ts", filepath.Join(root, "server/api/handler.go"), "../outside/x.go")
+	if strings.Contains(text, "### Project Instructions") || !strings.Contains(text, "web/.iat/instructions.md (applies to web/)") ||
+		!strings.Contains(text, "Handlers return JSON.") || strings.Contains(text, "never loaded") {
+		t.Fatalf("nested instructions: %q", text)
+	}
+	if text = l.Prompt("web/src/app.ts"); text != "" {
+		t.Fatalf("instructions repeated: %q", text)
+	}
+
+	res := LoadProjectInstructions(root, ToolCallPathsJSON(`{"paths":["server/api/handler.go"]}`))
+	if len(res.Sources) != 2 || res.Sources[0].Dir != "." || res.Sources[1].Path != "server/api/AGENTS.md" {
+		t.Fatalf("sources: %+v", res.Sources)
+	}
+}
@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- JSONPath ---
+
+// A small JSONPath subset for response extractors: $, .key, ['key'], [n]
+// (negative n counts from the end), [*] / .* and recursive descent (..key).
+// Paths with a wildcard or recursive descent return a list of matches.
+
+type jpStep struct {
+	kind  int // jpKey, jpIndex, jpWildcard
+	key   string
+	index int
+	deep  bool // recursive descent before this step
+}
+
+const (
+	jpKey = iota
+	jpIndex
+	jpWildcard
+)
+
+func compileJSONPath(expr string) ([]jpStep, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", expr)
+	}
+	var steps []jpStep
+	s := expr[1:]
+	for len(s) > 0 {
+		deep := false
+		switch {
+		case strings.HasPrefix(s, ".."):
+			deep = true
+			s = s[2:]
+		case s[0] == '.':
+			s = s[1:]
+		case s[0] == '[':
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", expr, s[0])
+		}
+
+		if len(s) > 0 && s[0] == '[' {
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: missing ]", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, jpStep{kind: jpWildcard, deep: deep})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jpStep{kind: jpKey, key: inner[1 : len(inner)-1], deep: deep})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath %q: invalid index %q", expr, inner)
+				}
+				steps = append(steps, jpStep{kind: jpIndex, index: n, deep: deep})
+			}
+			continue
+		}
+
+		end := strings.IndexAny(s, ".[")
+		if end < 0 {
+			end = len(s)
+		}
+		name := s[:end]
+		s = s[end:]
+		if name == "" {
+			return nil, fmt.Errorf("jsonpath %q: empty key", expr)
+		}
+		if name == "*" {
+			steps = append(steps, jpStep{kind: jpWildcard, deep: deep})
+		} else {
+			steps = append(steps, jpStep{kind: jpKey, key: name, deep: deep})
+		}
+	}
+	return steps, nil
+}
+
+// EvalJSONPath applies expr to a decoded JSON document.
+func EvalJSONPath(expr string, doc any) (any, error) {
+	steps, err := compileJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	multi := false
+	nodes := []any{doc}
+	for _, st := range steps {
+		if st.deep || st.kind == jpWildcard {
+			multi = true
+		}
+		var next []any
+		for _, n := range nodes {
+			if st.deep {
+				for _, d := range jpDescendants(n) {
+					next = append(next, jpApply(st, d)...)
+				}
+			} else {
+				next = append(next, jpApply(st, n)...)
+			}
+		}
+		nodes = next
+	}
+	if multi {
+		if nodes == nil {
+			nodes = []any{}
+		}
+		return nodes, nil
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("jsonpath %q matched nothing", expr)
+	}
+	return nodes[0], nil
+}
+
+func jpApply(st jpStep, n any) []any {
+	switch st.kind {
+	case jpKey:
+		if m, ok := n.(map[string]any); ok {
+			if v, ok := m[st.key]; ok {
+				return []any{v}
+			}
+		}
+	case jpIndex:
+		if a, ok := n.([]any); ok {
+			i := st.index
+			if i < 0 {
+				i += len(a)
+			}
+			if i >= 0 && i < len(a) {
+				return []any{a[i]}
+			}
+		}
+	case jpWildcard:
+		switch v := n.(type) {
+		case []any:
+			return v
+		case map[string]any:
+			out := make([]any, 0, len(v))
+			for _, k := range sortedKeys(v) {
+				out = append(out, v[k])
+			}
+			return out
+		}
+	}
+	return nil
+}
+
+// jpDescendants returns n and all values nested below it.
+func jpDescendants(n any) []any {
+	out := []any{n}
+	switch v := n.(type) {
+	case []any:
+		for _, c := range v {
+			out = append(out, jpDescendants(c)...)
+		}
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			out = append(out, jpDescendants(v[k])...)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,235 @@
+package tools
+
+import (
+	"fmt"
+	"iat/common/model"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// --- Workspace Jail ---
+
+type PathAccess int
+
+const (
+	PathRead PathAccess = iota
+	PathWrite
+)
+
+// PathRule is a PathPolicy together with where it came from, so violations
+// can tell the model which rule blocked it (e.g. "project", "mode PLAN").
+type PathRule struct {
+	Source string
+	Policy model.PathPolicy
+}
+
+// PathGuard confines tool paths to a base directory and applies every rule in
+// order. A path must satisfy all rules to be accessible. An empty Base (a
+// session without a project) confines nothing: paths resolve against the
+// working directory and only the rules apply.
+type PathGuard struct {
+	Base  string
+	Rules []PathRule
+}
+
+// CanRead reports whether the rules allow reading rel, a slash-separated
+// path relative to Base. Unlike Resolve it doesn't touch the filesystem, so
+// it suits filtering listings such as git status or the repo map.
+func (g *PathGuard) CanRead(rel string) bool {
+	if g == nil {
+		return true
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range g.Rules {
+		if checkPathRule(rule, rel, PathRead) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadRestriction returns the source of the first rule that limits reads to
+// a set of paths, or "" when every path not denied is readable.
+func (g *PathGuard) ReadRestriction() string {
+	if g == nil {
+		return ""
+	}
+	for _, rule := range g.Rules {
+		if len(rule.Policy.Readable) > 0 {
+			return rule.Source
+		}
+	}
+	return ""
+}
+
+// GitExcludes turns the denied patterns of the rules into git pathspecs that
+// exclude them, so a diff or log of a directory leaves denied files out.
+func (g *PathGuard) GitExcludes() []string {
+	if g == nil {
+		return nil
+	}
+	var specs []string
+	for _, rule := range g.Rules {
+		for _, pat := range rule.Policy.Denied {
+			pat = strings.Trim(strings.TrimSpace(filepath.ToSlash(pat)), "/")
+			if pat == "" {
+				continue
+			}
+			// 与 MatchPathGlob 一致：不含 "/" 的模式匹配任意层级
+			if !strings.Contains(pat, "/") {
+				pat = "**/" + pat
+			}
+			specs = append(specs, ":(exclude,glob)"+pat, ":(exclude,glob)"+pat+"/**")
+		}
+	}
+	return specs
+}
+
+// Resolve turns a user supplied path into an absolute path inside the base
+// directory and checks it against the rules for the requested access.
+func (g *PathGuard) Resolve(userPath string, access PathAccess) (string, error) {
+	base := ""
+	if g != nil {
+		base = g.Base
+	}
+	abs, err := ResolvePathInBase(base, userPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %q: %v", userPath, err)
+	}
+	if g == nil {
+		return abs, nil
+	}
+
+	rel := filepath.ToSlash(strings.TrimPrefix(abs, string(filepath.Separator)))
+	if strings.TrimSpace(base) != "" {
+		if err := checkSymlinkEscape(base, abs); err != nil {
+			return "", fmt.Errorf("invalid path %q: %v", userPath, err)
+		}
+		baseAbs, _ := filepath.Abs(filepath.Clean(base))
+		if r, rerr := filepath.Rel(baseAbs, abs); rerr == nil {
+			rel = filepath.ToSlash(r)
+		}
+	}
+
+	for _, rule := range g.Rules {
+		if err := checkPathRule(rule, rel, access); err != nil {
+			return "", err
+		}
+	}
+	return abs, nil
+}
+
+func checkPathRule(rule PathRule, rel string, access PathAccess) error {
+	p := rule.Policy
+	if pat, ok := matchAnyGlob(p.Denied, rel); ok {
+		return fmt.Errorf("access denied: %q matches denied pattern %q (%s policy)", rel, pat, rule.Source)
+	}
+	if access != PathWrite {
+		if len(p.Readable) > 0 {
+			if _, ok := matchAnyGlob(p.Readable, rel); !ok {
+				return fmt.Errorf("access denied: %q is outside the readable paths %v (%s policy)", rel, p.Readable, rule.Source)
+			}
+		}
+		return nil
+	}
+	if pat, ok := matchAnyGlob(p.ReadOnly, rel); ok {
+		return fmt.Errorf("access denied: %q is read-only (pattern %q, %s policy)", rel, pat, rule.Source)
+	}
+	if len(p.Writable) > 0 {
+		if _, ok := matchAnyGlob(p.Writable, rel); !ok {
+			return fmt.Errorf("access denied: %q is outside the writable paths %v (%s policy)", rel, p.Writable, rule.Source)
+		}
+	}
+	return nil
+}
+
+// checkSymlinkEscape makes sure symlinks inside the workspace don't point
+// outside of it. The target may not exist yet (e.g. write_file), so the
+// deepest existing ancestor is evaluated.
+func checkSymlinkEscape(base, abs string) error {
+	baseReal, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return nil
+	}
+	existing := abs
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(baseReal, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path escapes base directory via symlink")
+	}
+	return nil
+}
+
+func matchAnyGlob(patterns []string, rel string) (string, bool) {
+	for _, pat := range patterns {
+		if MatchPathGlob(pat, rel) {
+			return pat, true
+		}
+	}
+	return "", false
+}
+
+// MatchPathGlob matches a slash-separated relative path against a glob.
+// Patterns without "/" match any single path segment, so ".env" or "*.pem"
+// apply at every depth and a directory name covers everything below it.
+// Patterns with "/" are anchored at the root, support "**", and match
+// everything below a matching directory.
+func MatchPathGlob(pattern, rel string) bool {
+	pattern = strings.TrimSpace(filepath.ToSlash(pattern))
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if pattern == "" {
+		return false
+	}
+	segs := strings.Split(rel, "/")
+
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		pattern = strings.TrimSuffix(pattern, "/")
+		for _, s := range segs {
+			if ok, _ := path.Match(pattern, s); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	pattern = strings.Trim(strings.TrimPrefix(pattern, "./"), "/")
+	return matchSegments(strings.Split(pattern, "/"), segs)
+}
+
+// matchSegments reports whether pat matches segs or a leading prefix of segs
+// (a matched directory covers its contents).
+func matchSegments(pat, segs []string) bool {
+	if len(pat) == 0 {
+		return true
+	}
+	if pat[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pat[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pat[0], segs[0]); !ok {
+		return false
+	}
+	return matchSegments(pat[1:], segs[1:])
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"iat/common/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchPathGlob(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{".env", ".env", true},
+		{".env", "config/.env", true},
+		{"*.pem", "certs/server.pem", true},
+		{"secrets", "secrets/db/pass.txt", true},
+		{"plan/**", "plan/roadmap.md", true},
+		{"plan/**", "plan", true},
+		{"plan/**", "src/plan/x.md", false},
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"src/**/*.go", "src/pkg/main.go", true},
+		{"vendor/", "vendor/mod/a.go", true},
+	}
+	for _, c := range cases {
+		if got := MatchPathGlob(c.pattern, c.rel); got != c.want {
+			t.Errorf("MatchPathGlob(%q, %q) = %v, want %v", c.pattern, c.rel, got, c.want)
+		}
+	}
+}
+
+func TestPathGuard_Rules(t *testing.T) {
+	base := t.TempDir()
+	guard := &PathGuard{Base: base, Rules: []PathRule{
+		{Source: "project", Policy: model.PathPolicy{Denied: []string{".env"}, ReadOnly: []string{"go.sum"}}},
+		{Source: "mode PLAN", Policy: model.PathPolicy{Readable: []string{"plan/**", "go.sum"}, Writable: []string{"plan/**"}}},
+	}}
+
+	if _, err := guard.Resolve("../outside.txt", PathRead); err == nil {
+		t.Fatal("expected path outside base to be rejected")
+	}
+	if _, err := guard.Resolve(".env", PathRead); err == nil || !strings.Contains(err.Error(), "project policy") {
+		t.Fatalf("expected denied read with project source, got %v", err)
+	}
+	if _, err := guard.Resolve("go.sum", PathRead); err != nil {
+		t.Fatalf("read-only file should be readable: %v", err)
+	}
+	if _, err := guard.Resolve("src/main.go", PathRead); err == nil || !strings.Contains(err.Error(), "readable") {
+		t.Fatalf("expected read outside plan/ to fail, got %v", err)
+	}
+	if _, err := guard.Resolve("go.sum", PathWrite); err == nil {
+		t.Fatal("expected write to read-only file to fail")
+	}
+	if _, err := guard.Resolve("src/main.go", PathWrite); err == nil || !strings.Contains(err.Error(), "mode PLAN") {
+		t.Fatalf("expected write outside plan/ to fail with mode source, got %v", err)
+	}
+	abs, err := guard.Resolve("plan/notes.md", PathWrite)
+	if err != nil {
+		t.Fatalf("write inside plan/ should succeed: %v", err)
+	}
+	if abs != filepath.Join(base, "plan", "notes.md") {
+		t.Fatalf("unexpected resolved path %q", abs)
+	}
+}
+
+func TestPathGuard_SymlinkEscape(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(base, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	guard := &PathGuard{Base: base}
+	if _, err := guard.Resolve("link/new.txt", PathWrite); err == nil {
+		t.Fatal("expected symlink pointing outside base to be rejected")
+	}
+}
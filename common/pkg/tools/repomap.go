@@ -0,0 +1,418 @@
+package tools
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"hash/fnv"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// --- Repository Map ---
+
+// DefaultRepoMapTokens is the token budget used when none is configured.
+const DefaultRepoMapTokens = 1024
+
+const (
+	repoMapMaxFiles     = 5000
+	repoMapMaxFileSize  = 256 * 1024
+	repoMapMaxSymbols   = 8 // symbols listed per file
+	repoMapRecentCommit = 50
+)
+
+type RepoMapOptions struct {
+	MaxTokens int                   // 0 = DefaultRepoMapTokens
+	Allow     func(rel string) bool // nil = every file; others are left out of the map
+}
+
+type RepoMapFile struct {
+	Path    string   `json:"path"`
+	Score   float64  `json:"score"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+type RepoMap struct {
+	Root    string        `json:"root"`
+	Files   []RepoMapFile `json:"files"`   // files included in Text, by path
+	Omitted int           `json:"omitted"` // files dropped to fit the budget
+	Tokens  int           `json:"tokens"`  // estimated tokens of Text
+	Text    string        `json:"text"`
+}
+
+type repoMapCacheEntry struct {
+	fingerprint uint64
+	files       []RepoMapFile // ranked, all files
+}
+
+var repoMapCache sync.Map // root -> *repoMapCacheEntry
+
+// BuildRepoMap 生成项目的精简结构图：文件树加每个文件的关键符号。
+// 文件按被引用次数、最近 git 提交中的改动和入口文件加权排序，
+// 按预算从高到低挑选，最后按目录分组输出。
+func BuildRepoMap(root string, opts RepoMapOptions) (*RepoMap, error) {
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("project path is not a directory: %s", root)
+	}
+	budget := opts.MaxTokens
+	if budget <= 0 {
+		budget = DefaultRepoMapTokens
+	}
+
+	rels := repoMapFiles(root)
+	fp := repoMapFingerprint(root, rels)
+	var ranked []RepoMapFile
+	if v, ok := repoMapCache.Load(root); ok && v.(*repoMapCacheEntry).fingerprint == fp {
+		ranked = v.(*repoMapCacheEntry).files
+	} else {
+		ranked = rankRepoFiles(root, rels)
+		repoMapCache.Store(root, &repoMapCacheEntry{fingerprint: fp, files: ranked})
+	}
+
+	m := &RepoMap{Root: root, Files: []RepoMapFile{}}
+	// 贪心挑选：按得分依次加入，超出预算的文件跳过
+	used := 0
+	seenDir := make(map[string]bool)
+	for _, f := range ranked {
+		if opts.Allow != nil && !opts.Allow(f.Path) {
+			continue
+		}
+		cost := estimateTokens(repoMapLine(f))
+		dir := path.Dir(f.Path)
+		if !seenDir[dir] {
+			cost += estimateTokens(dir + "/\n")
+		}
+		if used+cost > budget {
+			m.Omitted++
+			continue
+		}
+		used += cost
+		seenDir[dir] = true
+		m.Files = append(m.Files, f)
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+
+	var b strings.Builder
+	lastDir := ""
+	for i, f := range m.Files {
+		dir := path.Dir(f.Path)
+		if i == 0 || dir != lastDir {
+			b.WriteString(dir + "/\n")
+			lastDir = dir
+		}
+		b.WriteString(repoMapLine(f))
+	}
+	if m.Omitted > 0 {
+		fmt.Fprintf(&b, "(%d more files omitted)\n", m.Omitted)
+	}
+	m.Text = b.String()
+	m.Tokens = estimateTokens(m.Text)
+	return m, nil
+}
+
+func repoMapLine(f RepoMapFile) string {
+	line := "  " + path.Base(f.Path)
+	if len(f.Symbols) > 0 {
+		line += ": " + strings.Join(f.Symbols, ", ")
+	}
+	return line + "\n"
+}
+
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// repoMapFiles 优先使用 git 跟踪的文件列表，非 git 目录退回遍历
+func repoMapFiles(root string) []string {
+	var rels []string
+	if out, err := runGit(root, "ls-files", "-z"); err == nil {
+		for _, rel := range strings.Split(out, "\x00") {
+			if rel != "" && !strings.HasPrefix(path.Base(rel), ".") {
+				rels = append(rels, rel)
+			}
+		}
+	} else {
+		_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			name := d.Name()
+			if d.IsDir() {
+				if p != root && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" || name == "dist" || name == "build" || name == "target") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasPrefix(name, ".") {
+				if rel, err := filepath.Rel(root, p); err == nil {
+					rels = append(rels, filepath.ToSlash(rel))
+				}
+			}
+			return nil
+		})
+	}
+	if len(rels) > repoMapMaxFiles {
+		rels = rels[:repoMapMaxFiles]
+	}
+	return rels
+}
+
+// repoMapFingerprint 由 HEAD 和文件大小/修改时间组成，任一变化都会重新排序
+func repoMapFingerprint(root string, rels []string) uint64 {
+	h := fnv.New64a()
+	if head, err := runGit(root, "rev-parse", "HEAD"); err == nil {
+		h.Write([]byte(head))
+	}
+	for _, rel := range rels {
+		if info, err := os.Stat(filepath.Join(root, rel)); err == nil {
+			fmt.Fprintf(h, "%s|%d|%d\n", rel, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return h.Sum64()
+}
+
+func rankRepoFiles(root string, rels []string) []RepoMapFile {
+	files := make([]RepoMapFile, 0, len(rels))
+	texts := make([]string, 0, len(rels))
+	for _, rel := range rels {
+		if repoMapLanguage(rel) == "" && !isRepoKeyFile(rel) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil || len(data) > repoMapMaxFileSize || isBinary(data) {
+			continue
+		}
+		files = append(files, RepoMapFile{Path: rel, Symbols: repoFileSymbols(rel, data)})
+		texts = append(texts, string(data))
+	}
+
+	// 符号被引用的次数：有多少个其他文件提到了它的名字
+	wordRe := regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	mentions := make(map[string]int)
+	fileWords := make([]map[string]bool, len(files))
+	for i, text := range texts {
+		words := make(map[string]bool)
+		for _, w := range wordRe.FindAllString(text, -1) {
+			words[w] = true
+		}
+		fileWords[i] = words
+	}
+	for i := range files {
+		for _, sym := range files[i].Symbols {
+			mentions[symbolName(sym)] = 0
+		}
+	}
+	for _, words := range fileWords {
+		for w := range words {
+			if _, ok := mentions[w]; ok {
+				mentions[w]++
+			}
+		}
+	}
+
+	recent := recentChangeCounts(root)
+	for i := range files {
+		f := &files[i]
+		score := 1.0
+		for _, sym := range f.Symbols {
+			name := symbolName(sym)
+			if len(name) < 3 {
+				continue
+			}
+			// 减去定义所在文件本身
+			if n := mentions[name] - 1; n > 0 {
+				score += math.Log1p(float64(n))
+			}
+		}
+		if n := recent[f.Path]; n > 0 {
+			score += 2 * math.Log1p(float64(n))
+		}
+		if isRepoKeyFile(f.Path) {
+			score += 3
+		}
+		if isRepoTestFile(f.Path) {
+			score *= 0.3
+		}
+		// 目录越深权重越低
+		score /= 1 + 0.1*float64(strings.Count(f.Path, "/"))
+		f.Score = math.Round(score*1000) / 1000
+		if len(f.Symbols) > repoMapMaxSymbols {
+			f.Symbols = f.Symbols[:repoMapMaxSymbols]
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Score != files[j].Score {
+			return files[i].Score > files[j].Score
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// recentChangeCounts 统计最近提交中每个文件的改动次数
+func recentChangeCounts(root string) map[string]int {
+	counts := make(map[string]int)
+	out, err := runGit(root, "log", "--name-only", "--format=", "-n", fmt.Sprint(repoMapRecentCommit))
+	if err != nil {
+		return counts
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			counts[line]++
+		}
+	}
+	return counts
+}
+
+// symbolName 取 "Type.Method" 中的方法名
+func symbolName(sym string) string {
+	if i := strings.LastIndex(sym, "."); i >= 0 {
+		return sym[i+1:]
+	}
+	return sym
+}
+
+func isBinary(data []byte) bool {
+	n := len(data)
+	if n > 8000 {
+		n = 8000
+	}
+	for _, c := range data[:n] {
+		if c == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isRepoKeyFile(rel string) bool {
+	switch strings.ToLower(path.Base(rel)) {
+	case "main.go", "go.mod", "package.json", "cargo.toml", "pyproject.toml", "readme.md",
+		"main.py", "__main__.py", "index.ts", "index.js", "main.ts", "main.rs", "lib.rs", "pom.xml", "build.gradle":
+		return true
+	}
+	return false
+}
+
+func isRepoTestFile(rel string) bool {
+	base := strings.ToLower(path.Base(rel))
+	return strings.HasSuffix(base, "_test.go") || strings.HasPrefix(base, "test_") ||
+		strings.Contains(base, ".test.") || strings.Contains(base, ".spec.") ||
+		strings.Contains("/"+rel, "/tests/") || strings.Contains("/"+rel, "/__tests__/")
+}
+
+func repoMapLanguage(rel string) string {
+	switch strings.ToLower(path.Ext(rel)) {
+	case ".go":
+		return "go"
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".vue":
+		return "js"
+	case ".py":
+		return "python"
+	case ".rs":
+		return "rust"
+	case ".java", ".kt", ".cs", ".scala":
+		return "jvm"
+	case ".rb":
+		return "ruby"
+	case ".php":
+		return "php"
+	case ".c", ".h", ".cc", ".cpp", ".hpp":
+		return "c"
+	}
+	return ""
+}
+
+var repoSymbolPatterns = map[string][]*regexp.Regexp{
+	"js": {
+		regexp.MustCompile(`(?m)^\s*export\s+(?:default\s+)?(?:async\s+)?(?:function\*?|class|interface|type|enum|const|let)\s+([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`(?m)^(?:async\s+)?(?:function\*?|class)\s+([A-Za-z_$][\w$]*)`),
+	},
+	"python": {regexp.MustCompile(`(?m)^(?:async\s+)?(?:def|class)\s+([A-Za-z_]\w*)`)},
+	"rust":   {regexp.MustCompile(`(?m)^\s*pub(?:\([^)]*\))?\s+(?:async\s+)?(?:fn|struct|enum|trait|type|mod)\s+([A-Za-z_]\w*)`)},
+	"jvm": {
+		regexp.MustCompile(`(?m)^\s*(?:public|internal|protected)?\s*(?:abstract\s+|final\s+|static\s+|sealed\s+|data\s+|open\s+)*(?:class|interface|enum|record|object)\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`(?m)^\s*public\s+(?:static\s+)?(?:final\s+)?[\w<>\[\],\s]+?\s+([a-zA-Z_]\w*)\s*\(`),
+	},
+	"ruby": {regexp.MustCompile(`(?m)^\s*(?:class|module|def)\s+(?:self\.)?([A-Za-z_]\w*[?!]?)`)},
+	"php":  {regexp.MustCompile(`(?m)^\s*(?:abstract\s+|final\s+)?(?:class|interface|trait|function)\s+([A-Za-z_]\w*)`)},
+	"c":    {regexp.MustCompile(`(?m)^(?:struct|class|typedef\s+struct)\s+([A-Za-z_]\w*)`)},
+}
+
+// repoFileSymbols 提取文件的关键符号：Go 用语法树取导出声明，其他语言用正则
+func repoFileSymbols(rel string, data []byte) []string {
+	lang := repoMapLanguage(rel)
+	if lang == "go" {
+		return goFileSymbols(rel, data)
+	}
+	var syms []string
+	seen := make(map[string]bool)
+	for _, re := range repoSymbolPatterns[lang] {
+		for _, m := range re.FindAllSubmatch(data, -1) {
+			name := string(m[1])
+			if !seen[name] {
+				seen[name] = true
+				syms = append(syms, name)
+			}
+		}
+	}
+	return syms
+}
+
+func goFileSymbols(rel string, data []byte) []string {
+	f, err := parser.ParseFile(token.NewFileSet(), rel, data, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	var syms []string
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() && d.Name.Name != "main" {
+				continue
+			}
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				recv := receiverName(d.Recv.List[0].Type)
+				if !ast.IsExported(recv) {
+					continue
+				}
+				name = recv + "." + name
+			}
+			syms = append(syms, name)
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.IsExported() {
+					syms = append(syms, ts.Name.Name)
+				}
+			}
+		}
+	}
+	return syms
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
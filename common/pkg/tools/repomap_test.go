@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"iat/common/model"
+	"strings"
+	"testing"
+)
+
+func TestBuildRepoMap(t *testing.T) {
+	root := writeGoModule(t)
+
+	m, err := BuildRepoMap(root, RepoMapOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"cart/\n", "  cart.go: Cart, New, Cart.Add", "  main.go: Add, main"} {
+		if !strings.Contains(m.Text, want) {
+			t.Fatalf("map missing %q:\n%s", want, m.Text)
+		}
+	}
+	if strings.Contains(m.Text, "count") {
+		t.Fatalf("unexported method listed:\n%s", m.Text)
+	}
+
+	// 预算很小时只保留得分最高的文件
+	small, err := BuildRepoMap(root, RepoMapOptions{MaxTokens: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if small.Omitted == 0 || len(small.Files) == 0 || small.Tokens > 12+8 {
+		t.Fatalf("budget not applied: %+v", small)
+	}
+	if !strings.Contains(small.Text, "more files omitted") {
+		t.Fatalf("expected omitted note:\n%s", small.Text)
+	}
+
+	// 不允许读取的文件不进入结构图
+	guard := &PathGuard{Base: root, Rules: []PathRule{{Source: "mode PLAN", Policy: model.PathPolicy{Readable: []string{"cart"}}}}}
+	limited, err := BuildRepoMap(root, RepoMapOptions{Allow: guard.CanRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(limited.Text, "cart.go") || strings.Contains(limited.Text, "main.go") {
+		t.Fatalf("unreadable file in map:\n%s", limited.Text)
+	}
+}
@@ -2,10 +2,11 @@ package handler
 
 import (
 	"encoding/json"
+	"iat/common/model"
+	"iat/engine/internal/service"
 	"net/http"
 	"strconv"
 	"strings"
-	"iat/engine/internal/service"
 )
 
 type AgentHandler struct {
@@ -27,25 +28,27 @@ func (h *AgentHandler) List(w http.ResponseWriter, r *http.Request) {
 
 func (h *AgentHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name           string `json:"name"`
-		Description    string `json:"description"`
-		SystemPrompt   string `json:"systemPrompt"`
-		Type           string `json:"type"`
-		ModelID        uint   `json:"modelId"`
-		ToolIDs        []uint `json:"toolIds"`
-		MCPServerIDs   []uint `json:"mcpServerIds"`
-		ModeIDs        []uint `json:"modeIds"`
-		ExternalURL    string `json:"externalUrl"`
-		ExternalType   string `json:"externalType"`
-		ExternalParams string `json:"externalParams"`
-		Status         string `json:"status"`
-		Capabilities   string `json:"capabilities"`
+		Name           string                 `json:"name"`
+		Description    string                 `json:"description"`
+		SystemPrompt   string                 `json:"systemPrompt"`
+		Type           string                 `json:"type"`
+		ModelID        uint                   `json:"modelId"`
+		ToolIDs        []uint                 `json:"toolIds"`
+		MCPServerIDs   []uint                 `json:"mcpServerIds"`
+		ModeIDs        []uint                 `json:"modeIds"`
+		ExternalURL    string                 `json:"externalUrl"`
+		ExternalType   string                 `json:"externalType"`
+		ExternalParams string                 `json:"externalParams"`
+		Status         string                 `json:"status"`
+		Capabilities   string                 `json:"capabilities"`
+		ToolPolicy     *model.AgentToolPolicy `json:"toolPolicy"` // nil keeps the current policy
+		RepoMapTokens  *int                   `json:"repoMapTokens"` // nil keeps the current budget
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := h.svc.CreateAgent(req.Name, req.Description, req.SystemPrompt, req.Type, req.ExternalURL, req.ExternalType, req.ExternalParams, req.ModelID, req.ToolIDs, req.MCPServerIDs, req.ModeIDs, req.Status, req.Capabilities); err != nil {
+	if err := h.svc.CreateAgent(req.Name, req.Description, req.SystemPrompt, req.Type, req.ExternalURL, req.ExternalType, req.ExternalParams, req.ModelID, req.ToolIDs, req.MCPServerIDs, req.ModeIDs, req.Status, req.Capabilities, req.ToolPolicy, req.RepoMapTokens); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -66,25 +69,27 @@ func (h *AgentHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name           string `json:"name"`
-		Description    string `json:"description"`
-		SystemPrompt   string `json:"systemPrompt"`
-		Type           string `json:"type"`
-		ModelID        uint   `json:"modelId"`
-		ToolIDs        []uint `json:"toolIds"`
-		MCPServerIDs   []uint `json:"mcpServerIds"`
-		ModeIDs        []uint `json:"modeIds"`
-		ExternalURL    string `json:"externalUrl"`
-		ExternalType   string `json:"externalType"`
-		ExternalParams string `json:"externalParams"`
-		Status         string `json:"status"`
-		Capabilities   string `json:"capabilities"`
+		Name           string                 `json:"name"`
+		Description    string                 `json:"description"`
+		SystemPrompt   string                 `json:"systemPrompt"`
+		Type           string                 `json:"type"`
+		ModelID        uint                   `json:"modelId"`
+		ToolIDs        []uint                 `json:"toolIds"`
+		MCPServerIDs   []uint                 `json:"mcpServerIds"`
+		ModeIDs        []uint                 `json:"modeIds"`
+		ExternalURL    string                 `json:"externalUrl"`
+		ExternalType   string                 `json:"externalType"`
+		ExternalParams string                 `json:"externalParams"`
+		Status         string                 `json:"status"`
+		Capabilities   string                 `json:"capabilities"`
+		ToolPolicy     *model.AgentToolPolicy `json:"toolPolicy"` // nil keeps the current policy
+		RepoMapTokens  *int                   `json:"repoMapTokens"` // nil keeps the current budget
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := h.svc.UpdateAgent(uint(id), req.Name, req.Description, req.SystemPrompt, req.Type, req.ExternalURL, req.ExternalType, req.ExternalParams, req.ModelID, req.ToolIDs, req.MCPServerIDs, req.ModeIDs, req.Status, req.Capabilities); err != nil {
+	if err := h.svc.UpdateAgent(uint(id), req.Name, req.Description, req.SystemPrompt, req.Type, req.ExternalURL, req.ExternalType, req.ExternalParams, req.ModelID, req.ToolIDs, req.MCPServerIDs, req.ModeIDs, req.Status, req.Capabilities, req.ToolPolicy, req.RepoMapTokens); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"iat/engine/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CheckpointHandler struct {
+	svc *service.CheckpointService
+}
+
+func NewCheckpointHandler(svc *service.CheckpointService) *CheckpointHandler {
+	return &CheckpointHandler{svc: svc}
+}
+
+func sessionIDFromPath(path string) (uint, bool) {
+	// /api/sessions/{id}/...
+	parts := strings.Split(path, "/")
+	if len(parts) < 5 {
+		return 0, false
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// List returns the files changed in a turn (?messageId=) or in the whole
+// session. /api/sessions/{id}/checkpoints/diff includes the diffs.
+func (h *CheckpointHandler) List(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := sessionIDFromPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	withDiff := strings.HasSuffix(r.URL.Path, "/diff")
+
+	var (
+		changes []service.FileChange
+		err     error
+	)
+	if raw := r.URL.Query().Get("messageId"); raw != "" {
+		messageID, perr := strconv.Atoi(raw)
+		if perr != nil {
+			http.Error(w, "Invalid messageId", http.StatusBadRequest)
+			return
+		}
+		changes, err = h.svc.ListTurn(sessionID, uint(messageID), withDiff)
+	} else {
+		changes, err = h.svc.ListSession(sessionID, withDiff)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []service.FileChange{}
+	}
+	json.NewEncoder(w).Encode(changes)
+}
+
+// Revert undoes tool edits. scope is "file" (requires path), "turn" or
+// "since" (the turn of messageId and everything after it).
+func (h *CheckpointHandler) Revert(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := sessionIDFromPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		MessageID uint   `json:"messageId"`
+		Scope     string `json:"scope"`
+		Path      string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.MessageID == 0 {
+		http.Error(w, "messageId is required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		changes []service.FileChange
+		err     error
+	)
+	switch req.Scope {
+	case "file":
+		if req.Path == "" {
+			http.Error(w, "path is required", http.StatusBadRequest)
+			return
+		}
+		changes, err = h.svc.RevertFile(sessionID, req.MessageID, req.Path)
+	case "", "turn":
+		changes, err = h.svc.RevertTurn(sessionID, req.MessageID)
+	case "since":
+		changes, err = h.svc.RevertSince(sessionID, req.MessageID)
+	default:
+		http.Error(w, "Invalid scope", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []service.FileChange{}
+	}
+	json.NewEncoder(w).Encode(changes)
+}
@@ -26,6 +26,11 @@ func (h *HookHandler) List(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(hooks)
 }
 
+// Events lists the events hooks can run on.
+func (h *HookHandler) Events(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(model.HookEvents)
+}
+
 func (h *HookHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var hook model.Hook
 	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
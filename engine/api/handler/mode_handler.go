@@ -2,8 +2,11 @@ package handler
 
 import (
 	"encoding/json"
-	"net/http"
+	"iat/common/model"
 	"iat/engine/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
 )
 
 type ModeHandler struct {
@@ -14,6 +17,49 @@ func NewModeHandler(svc *service.ModeService) *ModeHandler {
 	return &ModeHandler{svc: svc}
 }
 
+// modeRequest is the body of create/update. Policies are objects here and
+// stored as JSON text on the mode.
+type modeRequest struct {
+	Key             string                `json:"key"`
+	Name            string                `json:"name"`
+	Description     string                `json:"description"`
+	SystemPrompt    string                `json:"systemPrompt"`
+	ParentKey       string                `json:"parentKey"`
+	Instructions    string                `json:"instructions"`
+	PathPolicy      *model.PathPolicy     `json:"pathPolicy"`
+	ToolPolicy      *model.ModeToolPolicy `json:"toolPolicy"`
+	MaxTurns        int                   `json:"maxTurns"`
+	Orchestrate     *bool                 `json:"orchestrate"`
+	RepoMap         *bool                 `json:"repoMap"`
+	AllowGitRewrite *bool                 `json:"allowGitRewrite"`
+}
+
+// applyTo copies the request onto mode. A nil policy keeps the one stored
+// on mode.
+func (req *modeRequest) applyTo(mode *model.Mode) error {
+	mode.Key = strings.TrimSpace(req.Key)
+	mode.Name = req.Name
+	mode.Description = req.Description
+	mode.SystemPrompt = req.SystemPrompt
+	mode.ParentKey = strings.TrimSpace(req.ParentKey)
+	mode.Instructions = req.Instructions
+	mode.MaxTurns = req.MaxTurns
+	mode.Orchestrate = req.Orchestrate
+	mode.RepoMap = req.RepoMap
+	mode.AllowGitRewrite = req.AllowGitRewrite
+	if req.PathPolicy != nil {
+		if err := mode.SetPathPolicy(*req.PathPolicy); err != nil {
+			return err
+		}
+	}
+	if req.ToolPolicy != nil {
+		if err := mode.SetToolPolicy(*req.ToolPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *ModeHandler) List(w http.ResponseWriter, r *http.Request) {
 	modes, err := h.svc.ListModes()
 	if err != nil {
@@ -22,3 +68,89 @@ func (h *ModeHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewEncoder(w).Encode(modes)
 }
+
+func (h *ModeHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req modeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode := &model.Mode{}
+	if err := req.applyTo(mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.CreateMode(mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mode)
+}
+
+func (h *ModeHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := modeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req modeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := h.svc.GetMode(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := req.applyTo(mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.UpdateMode(mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(mode)
+}
+
+func (h *ModeHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := modeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteMode(id); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Resolve returns a mode combined with its ancestors: /api/modes/{key}/resolved
+func (h *ModeHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		http.Error(w, "Invalid mode", http.StatusBadRequest)
+		return
+	}
+	mode, err := h.svc.Resolve(parts[3])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(mode)
+}
+
+func modeIDFromPath(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
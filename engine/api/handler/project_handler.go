@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"iat/common/model"
+	"iat/engine/internal/service"
+	"iat/engine/pkg/indexdb"
 	"net/http"
 	"strconv"
 	"strings"
-	"iat/engine/internal/service"
 )
 
 type ProjectHandler struct {
@@ -28,15 +30,18 @@ func (h *ProjectHandler) List(w http.ResponseWriter, r *http.Request) {
 
 func (h *ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Path        string `json:"path"`
+		Name          string                 `json:"name"`
+		Description   string                 `json:"description"`
+		Path          string                 `json:"path"`
+		HttpAllowlist []string               `json:"httpAllowlist"`
+		PathPolicy    *model.PathPolicy      `json:"pathPolicy"`
+		Settings      *model.ProjectSettings `json:"settings"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := h.svc.CreateProject(req.Name, req.Description, req.Path); err != nil {
+	if err := h.svc.CreateProject(req.Name, req.Description, req.Path, req.HttpAllowlist, req.PathPolicy, req.Settings); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -58,16 +63,19 @@ func (h *ProjectHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Path        string `json:"path"`
+		Name          string                 `json:"name"`
+		Description   string                 `json:"description"`
+		Path          string                 `json:"path"`
+		HttpAllowlist []string               `json:"httpAllowlist"`
+		PathPolicy    *model.PathPolicy      `json:"pathPolicy"`
+		Settings      *model.ProjectSettings `json:"settings"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := h.svc.UpdateProject(uint(id), req.Name, req.Description, req.Path); err != nil {
+	if err := h.svc.UpdateProject(uint(id), req.Name, req.Description, req.Path, req.HttpAllowlist, req.PathPolicy, req.Settings); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -117,6 +125,85 @@ func (h *ProjectHandler) Index(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(res)
 }
 
+func (h *ProjectHandler) IndexStatus(w http.ResponseWriter, r *http.Request) {
+	// /api/projects/{id}/index
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	st, err := h.indexSvc.Status(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(st)
+}
+
+func (h *ProjectHandler) SearchCode(w http.ResponseWriter, r *http.Request) {
+	// /api/projects/{id}/search?q=&path=&lang=&limit=
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	if strings.TrimSpace(q.Get("q")) == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	opts := indexdb.CodeSearchOptions{
+		PathGlobs: q["path"],
+		Langs:     q["lang"],
+	}
+	if v := q.Get("limit"); v != "" {
+		opts.Limit, _ = strconv.Atoi(v)
+	}
+
+	res, err := h.indexSvc.SearchCode(uint(id), q.Get("q"), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *ProjectHandler) RepoMap(w http.ResponseWriter, r *http.Request) {
+	// /api/projects/{id}/repomap?tokens=
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	tokens := 0
+	if v := r.URL.Query().Get("tokens"); v != "" {
+		tokens, _ = strconv.Atoi(v)
+	}
+
+	m, err := h.indexSvc.RepoMap(uint(id), tokens)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
 func (h *ProjectHandler) IndexAll(w http.ResponseWriter, r *http.Request) {
 	res, err := h.indexSvc.IndexAllProjects()
 	if err != nil {
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"iat/common/model"
+	"iat/common/pkg/script/modules"
+	"iat/engine/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type ScriptHandler struct {
+	svc *service.ScriptService
+}
+
+func NewScriptHandler(svc *service.ScriptService) *ScriptHandler {
+	return &ScriptHandler{svc: svc}
+}
+
+type scriptRequest struct {
+	Name         string                    `json:"name"`
+	Description  string                    `json:"description"`
+	Content      string                    `json:"content"`
+	Language     string                    `json:"language"`
+	Capabilities *model.ScriptCapabilities `json:"capabilities"`
+}
+
+// scriptID parses the ID of /api/scripts/{id}[/...].
+func scriptID(r *http.Request) (uint, bool) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		return 0, false
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *ScriptHandler) List(w http.ResponseWriter, r *http.Request) {
+	scripts, err := h.svc.ListScripts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(scripts)
+}
+
+func (h *ScriptHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req scriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.CreateScript(req.Name, req.Description, req.Content, req.Language, req.Capabilities); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *ScriptHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := scriptID(r)
+	if !ok {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	var req scriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.UpdateScript(id, req.Name, req.Description, req.Content, req.Language, req.Capabilities); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ScriptHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := scriptID(r)
+	if !ok {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.DeleteScript(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Run runs a script with the JSON body as its args and returns the run.
+func (h *ScriptHandler) Run(w http.ResponseWriter, r *http.Request) {
+	// /api/scripts/{id}/run
+	id, ok := scriptID(r)
+	if !ok {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	var args map[string]any
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	run, err := h.svc.RunScript(r.Context(), id, args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(run)
+}
+
+func (h *ScriptHandler) Runs(w http.ResponseWriter, r *http.Request) {
+	// /api/scripts/{id}/runs?limit=
+	id, ok := scriptID(r)
+	if !ok {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, _ = strconv.Atoi(v)
+	}
+	runs, err := h.svc.ListRuns(id, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(runs)
+}
+
+// SourceRuns lists the runs of script tools and hooks as well:
+// /api/script-runs?source=tool|hook|script&id=&limit=
+func (h *ScriptHandler) SourceRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, err := strconv.Atoi(q.Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		limit, _ = strconv.Atoi(v)
+	}
+	runs, err := h.svc.ListRunsBySource(q.Get("source"), uint(id), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(runs)
+}
+
+// Types serves the .d.ts declarations of the script modules for editors.
+func (h *ScriptHandler) Types(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/typescript; charset=utf-8")
+	w.Write([]byte(modules.TypeDeclarations()))
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"iat/engine/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SearchHandler struct {
+	svc *service.SearchService
+}
+
+func NewSearchHandler(svc *service.SearchService) *SearchHandler {
+	return &SearchHandler{svc: svc}
+}
+
+// Messages handles GET /api/search/messages?q=&projectId=&agentId=&role=&from=&to=&limit=
+// role may be repeated or comma separated; from/to are RFC3339 times or
+// dates (2006-01-02, to is inclusive).
+func (h *SearchHandler) Messages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	var opts service.MessageSearchOptions
+	for _, p := range []struct {
+		name string
+		dst  *uint
+	}{{"projectId", &opts.ProjectID}, {"agentId", &opts.AgentID}} {
+		if v := q.Get(p.name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid "+p.name, http.StatusBadRequest)
+				return
+			}
+			*p.dst = uint(id)
+		}
+	}
+	for _, v := range q["role"] {
+		for _, role := range strings.Split(v, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				opts.Roles = append(opts.Roles, role)
+			}
+		}
+	}
+	var err error
+	if opts.From, err = parseSearchTime(q.Get("from"), false); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.To, err = parseSearchTime(q.Get("to"), true); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		opts.Limit, _ = strconv.Atoi(v)
+	}
+
+	res, err := h.svc.Search(query, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func parseSearchTime(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (expected RFC3339 or 2006-01-02)", v)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
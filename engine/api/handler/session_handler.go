@@ -141,6 +141,28 @@ func (h *SessionHandler) ListMessages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(msgs)
 }
 
+func (h *SessionHandler) Instructions(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	// /api/sessions/{id}/instructions
+	parts := strings.Split(path, "/")
+	if len(parts) < 5 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.chatSvc.SessionInstructions(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
 func (h *SessionHandler) Abort(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	// /api/sessions/{id}/abort
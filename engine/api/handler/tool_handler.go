@@ -71,3 +71,42 @@ func (h *ToolHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// Metrics returns per-tool call counters, including calls rejected for
+// invalid arguments.
+func (h *ToolHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(h.svc.Metrics())
+}
+
+// Approvals lists (GET) or adds (POST {"tool": "run_command"}) the tools the
+// user approved for a session: /api/sessions/{id}/approvals
+func (h *ToolHandler) Approvals(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := sessionIDFromPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPost {
+		var req struct {
+			Tool string `json:"tool"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Tool) == "" {
+			http.Error(w, "tool is required", http.StatusBadRequest)
+			return
+		}
+		if err := h.svc.ApproveTool(sessionID, strings.TrimSpace(req.Tool)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	approved, err := h.svc.ApprovedTools(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(approved)
+}
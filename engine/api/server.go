@@ -10,7 +10,9 @@ import (
 	"iat/engine/internal/runtime"
 	"iat/engine/internal/service"
 	"iat/engine/pkg/ai"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -25,7 +27,10 @@ func NewServer(addr string) *Server {
 	return &Server{addr: addr}
 }
 
-func (s *Server) Start() error {
+// Start serves until ctx is done, then shuts the server down and stops the
+// index watcher. The caller owns ctx (and any signal handling), so the engine
+// can also be embedded in another process.
+func (s *Server) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 
 	// Initialize Services
@@ -33,17 +38,44 @@ func (s *Server) Start() error {
 	indexSvc := service.NewIndexService()
 	mcpSvc := service.NewMCPService()
 	wsHub := service.NewWSHub()
-	go wsHub.Run(context.Background())
+	go wsHub.Run(ctx)
 
 	toolSvc := service.NewToolService(mcpSvc)
+	checkpointSvc := service.NewCheckpointService()
+	toolSvc.SetCheckpointService(checkpointSvc)
+	toolSvc.SetIndexService(indexSvc)
+	// IAT_INDEX_WATCH=1 时监听项目目录，文件变化后自动增量更新代码索引
+	var watcher *service.IndexWatcher
+	if watch := strings.ToLower(strings.TrimSpace(os.Getenv("IAT_INDEX_WATCH"))); watch == "1" || watch == "true" {
+		w, err := service.NewIndexWatcher(indexSvc)
+		if err != nil {
+			slog.Warn("index watcher disabled", "error", err)
+		} else {
+			watcher = w
+			indexSvc.SetWatcher(watcher)
+			go func() {
+				if err := watcher.WatchAll(); err != nil {
+					slog.Warn("index watcher: cannot watch projects", "error", err)
+				}
+			}()
+		}
+	}
 	taskSvc := service.NewTaskService(nil)                 // TODO: Handle SSE for tasks
 	subAgentTaskSvc := service.NewSubAgentTaskService(nil) // TODO: Handle SSE for sub-agent tasks
 	hookSvc := service.NewHookService()
+	scriptSvc := service.NewScriptService()
 	chatSvc := service.NewChatService(mcpSvc, toolSvc, taskSvc, subAgentTaskSvc, hookSvc, wsHub)
+	// 脚本工具通过 iat 模块调用智能体和任务列表
+	toolSvc.SetAgentRunner(chatSvc)
+	toolSvc.SetTaskService(taskSvc)
+	toolSvc.SetHookService(hookSvc)
 	sessionSvc := service.NewSessionService()
+	sessionSvc.SetHookService(hookSvc)
+	indexSvc.SetHookService(hookSvc)
 	modelSvc := service.NewAIModelService()
-	agentSvc := service.NewAgentService()
+	agentSvc := service.NewAgentService(toolSvc)
 	modeSvc := service.NewModeService()
+	searchSvc := service.NewSearchService()
 	registrySvc := service.NewRegistryService()
 	workflowRepo := repo.NewWorkflowRepo()
 
@@ -67,6 +99,7 @@ func (s *Server) Start() error {
 			Timestamp: time.Now().UnixMilli(),
 		})
 	})
+	executor.SetTaskDoneCallback(hookSvc.WorkflowTaskDone)
 	chatSvc.SetExecutor(executor)
 	chatSvc.SetPlannerFactory(func(client *ai.AIClient) service.TaskPlanner {
 		return orchestrator.NewPlanner(client)
@@ -76,16 +109,19 @@ func (s *Server) Start() error {
 	projectHandler := handler.NewProjectHandler(projectSvc, indexSvc)
 	chatHandler := handler.NewChatHandler(chatSvc)
 	sessionHandler := handler.NewSessionHandler(sessionSvc, chatSvc)
+	checkpointHandler := handler.NewCheckpointHandler(checkpointSvc)
 	modelHandler := handler.NewAIModelHandler(modelSvc)
 	agentHandler := handler.NewAgentHandler(agentSvc)
 	toolHandler := handler.NewToolHandler(toolSvc)
 	mcpHandler := handler.NewMCPHandler(mcpSvc)
 	modeHandler := handler.NewModeHandler(modeSvc)
 	hookHandler := handler.NewHookHandler(hookSvc)
+	scriptHandler := handler.NewScriptHandler(scriptSvc)
 	taskHandler := handler.NewTaskHandler(taskSvc)
 	subAgentTaskHandler := handler.NewSubAgentTaskHandler(subAgentTaskSvc)
 	runtimeTestHandler := handler.NewRuntimeTestHandler()
 	registryHandler := handler.NewRegistryHandler(registrySvc)
+	searchHandler := handler.NewSearchHandler(searchSvc)
 
 	// Start registry cleanup goroutine
 	go func() {
@@ -188,8 +224,27 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/api/projects/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 		if strings.HasSuffix(path, "/index") {
-			if r.Method == http.MethodPost {
+			switch r.Method {
+			case http.MethodPost:
 				projectHandler.Index(w, r)
+			case http.MethodGet:
+				projectHandler.IndexStatus(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		if strings.HasSuffix(path, "/search") {
+			if r.Method == http.MethodGet {
+				projectHandler.SearchCode(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		if strings.HasSuffix(path, "/repomap") {
+			if r.Method == http.MethodGet {
+				projectHandler.RepoMap(w, r)
 			} else {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
@@ -275,6 +330,15 @@ func (s *Server) Start() error {
 		}
 	})
 	mux.HandleFunc("/api/tools/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/metrics") {
+			// /api/tools/metrics
+			if r.Method == http.MethodGet {
+				toolHandler.Metrics(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
 		if r.Method == http.MethodDelete {
 			toolHandler.Delete(w, r)
 		} else {
@@ -317,9 +381,32 @@ func (s *Server) Start() error {
 
 	// Modes
 	mux.HandleFunc("/api/modes", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
 			modeHandler.List(w, r)
-		} else {
+		case http.MethodPost:
+			modeHandler.Create(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/modes/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/resolved") {
+			// /api/modes/{key}/resolved
+			if r.Method == http.MethodGet {
+				modeHandler.Resolve(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			modeHandler.Update(w, r)
+		case http.MethodDelete:
+			modeHandler.Delete(w, r)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
@@ -336,6 +423,15 @@ func (s *Server) Start() error {
 		}
 	})
 	mux.HandleFunc("/api/hooks/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/hooks/events" {
+			// /api/hooks/events: catalog of hook events
+			if r.Method == http.MethodGet {
+				hookHandler.Events(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
 		switch r.Method {
 		case http.MethodPut:
 			hookHandler.Update(w, r)
@@ -346,6 +442,63 @@ func (s *Server) Start() error {
 		}
 	})
 
+	// Scripts
+	mux.HandleFunc("/api/scripts", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			scriptHandler.List(w, r)
+		case http.MethodPost:
+			scriptHandler.Create(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/scripts/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if path == "/api/scripts/types" {
+			// /api/scripts/types: .d.ts of the script modules
+			if r.Method == http.MethodGet {
+				scriptHandler.Types(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		if strings.HasSuffix(path, "/run") {
+			// /api/scripts/{id}/run
+			if r.Method == http.MethodPost {
+				scriptHandler.Run(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		if strings.HasSuffix(path, "/runs") {
+			// /api/scripts/{id}/runs
+			if r.Method == http.MethodGet {
+				scriptHandler.Runs(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			scriptHandler.Update(w, r)
+		case http.MethodDelete:
+			scriptHandler.Delete(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/script-runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			scriptHandler.SourceRuns(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	// Sessions
 	mux.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -369,6 +522,46 @@ func (s *Server) Start() error {
 			return
 		}
 
+		if strings.HasSuffix(path, "/instructions") {
+			// /api/sessions/{id}/instructions
+			if r.Method == http.MethodGet {
+				sessionHandler.Instructions(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if strings.HasSuffix(path, "/checkpoints") || strings.HasSuffix(path, "/checkpoints/diff") {
+			// /api/sessions/{id}/checkpoints[/diff]?messageId=
+			if r.Method == http.MethodGet {
+				checkpointHandler.List(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if strings.HasSuffix(path, "/checkpoints/revert") {
+			// /api/sessions/{id}/checkpoints/revert
+			if r.Method == http.MethodPost {
+				checkpointHandler.Revert(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if strings.HasSuffix(path, "/approvals") {
+			// /api/sessions/{id}/approvals
+			if r.Method == http.MethodGet || r.Method == http.MethodPost {
+				toolHandler.Approvals(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
 		if strings.HasSuffix(path, "/abort") {
 			// /api/sessions/{id}/abort
 			if r.Method == http.MethodPost {
@@ -398,6 +591,15 @@ func (s *Server) Start() error {
 		}
 	})
 
+	// Search
+	mux.HandleFunc("/api/search/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			searchHandler.Messages(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	// Chat Stream
 	mux.HandleFunc("/api/chat/stream", chatHandler.Stream)
 
@@ -436,7 +638,30 @@ func (s *Server) Start() error {
 		}
 	})
 
-	return http.ListenAndServe(s.addr, handler)
+	srv := &http.Server{Addr: s.addr, Handler: handler}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.ListenAndServe()
+	if watcher != nil {
+		if cerr := watcher.Close(); cerr != nil {
+			slog.Warn("index watcher: close failed", "error", cerr)
+		}
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"iat/engine/api"
 	"iat/engine/pkg/seeder"
 	"iat/common/pkg/db"
@@ -16,9 +20,12 @@ func main() {
 	// Seed Data
 	seeder.Seed(db.DB)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	server := api.NewServer(":8080")
 	log.Println("Starting Engine on :8080")
-	if err := server.Start(); err != nil {
+	if err := server.Start(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
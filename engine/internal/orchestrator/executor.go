@@ -18,12 +18,18 @@ type ExecutionEngine struct {
 	reviewer     *Reviewer
 	workflowRepo *repo.WorkflowRepo
 	onStatusUp   func(taskId string, status string, output any)
+	onTaskDone   func(workflow *model.Workflow, task *model.WorkflowTask)
 }
 
 func (e *ExecutionEngine) SetStatusCallback(cb func(taskId string, status string, output any)) {
 	e.onStatusUp = cb
 }
 
+// SetTaskDoneCallback sets a function called when a task completes or fails.
+func (e *ExecutionEngine) SetTaskDoneCallback(cb func(workflow *model.Workflow, task *model.WorkflowTask)) {
+	e.onTaskDone = cb
+}
+
 func NewExecutionEngine(rt *runtime.Runtime, router *Router, reviewer *Reviewer, workflowRepo *repo.WorkflowRepo) *ExecutionEngine {
 	return &ExecutionEngine{
 		rt:           rt,
@@ -186,6 +192,9 @@ func (e *ExecutionEngine) ExecuteWorkflow(ctx context.Context, workflow *model.W
 					if e.onStatusUp != nil {
 						e.onStatusUp(id, string(status), lastResp.Payload)
 					}
+					if e.onTaskDone != nil {
+						e.onTaskDone(workflow, task)
+					}
 
 					if execErr != nil {
 						resultsMu.Unlock()
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/db"
+)
+
+type CheckpointRepo struct{}
+
+func NewCheckpointRepo() *CheckpointRepo {
+	return &CheckpointRepo{}
+}
+
+func (r *CheckpointRepo) Create(c *model.FileCheckpoint) error {
+	return db.DB.Create(c).Error
+}
+
+func (r *CheckpointRepo) GetByID(id uint) (*model.FileCheckpoint, error) {
+	var c model.FileCheckpoint
+	err := db.DB.First(&c, id).Error
+	return &c, err
+}
+
+func (r *CheckpointRepo) ListBySessionID(sessionID uint) ([]model.FileCheckpoint, error) {
+	var items []model.FileCheckpoint
+	err := db.DB.Where("session_id = ?", sessionID).Order("id asc").Find(&items).Error
+	return items, err
+}
+
+// ListByMessage returns the checkpoints taken during one turn, oldest first.
+func (r *CheckpointRepo) ListByMessage(sessionID, messageID uint) ([]model.FileCheckpoint, error) {
+	var items []model.FileCheckpoint
+	err := db.DB.Where("session_id = ? AND message_id = ?", sessionID, messageID).Order("id asc").Find(&items).Error
+	return items, err
+}
+
+// ListSinceMessage returns the checkpoints of the turn started by messageID
+// and of every later turn, oldest first.
+func (r *CheckpointRepo) ListSinceMessage(sessionID, messageID uint) ([]model.FileCheckpoint, error) {
+	var items []model.FileCheckpoint
+	err := db.DB.Where("session_id = ? AND message_id >= ?", sessionID, messageID).Order("id asc").Find(&items).Error
+	return items, err
+}
+
+// ListAfter returns the checkpoints of path taken after afterID in the
+// session, oldest first.
+func (r *CheckpointRepo) ListAfter(sessionID uint, path string, afterID uint) ([]model.FileCheckpoint, error) {
+	var items []model.FileCheckpoint
+	err := db.DB.Where("session_id = ? AND path = ? AND id > ?", sessionID, path, afterID).Order("id asc").Find(&items).Error
+	return items, err
+}
+
+func (r *CheckpointRepo) MarkReverted(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.DB.Model(&model.FileCheckpoint{}).Where("id IN ?", ids).Update("reverted", true).Error
+}
+
+func (r *CheckpointRepo) DeleteBySessionID(sessionID uint) error {
+	return db.DB.Where("session_id = ?", sessionID).Delete(&model.FileCheckpoint{}).Error
+}
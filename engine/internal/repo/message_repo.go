@@ -4,6 +4,7 @@ import (
 	"iat/common/model"
 	"iat/common/pkg/consts"
 	"iat/common/pkg/db"
+	"time"
 )
 
 type MessageRepo struct{}
@@ -22,6 +23,14 @@ func (r *MessageRepo) ListBySessionID(sessionID uint) ([]model.Message, error) {
 	return messages, err
 }
 
+// LatestUserMessageID returns the ID of the most recent user message of a
+// session, i.e. the message that started the current turn.
+func (r *MessageRepo) LatestUserMessageID(sessionID uint) (uint, error) {
+	var m model.Message
+	err := db.DB.Where("session_id = ? AND role = ?", sessionID, consts.RoleUser).Order("id desc").First(&m).Error
+	return m.ID, err
+}
+
 func (r *MessageRepo) DeleteBySessionID(sessionID uint) error {
 	return db.DB.Where("session_id = ?", sessionID).Delete(&model.Message{}).Error
 }
@@ -103,3 +112,22 @@ func (r *MessageRepo) UpsertToolResult(sessionID uint, toolCallID string, name s
 		ToolOk:        ok,
 	}).Error
 }
+
+func (r *MessageRepo) ListByIDs(ids []uint) ([]model.Message, error) {
+	var messages []model.Message
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	err := db.DB.Where("id IN ?", ids).Find(&messages).Error
+	return messages, err
+}
+
+// ListChangedSince returns messages created, updated or deleted at or after
+// since, including soft-deleted ones, in pages ordered by ID.
+func (r *MessageRepo) ListChangedSince(since time.Time, afterID uint, limit int) ([]model.Message, error) {
+	var messages []model.Message
+	err := db.DB.Unscoped().
+		Where("(updated_at >= ? OR deleted_at >= ?) AND id > ?", since, since, afterID).
+		Order("id asc").Limit(limit).Find(&messages).Error
+	return messages, err
+}
@@ -34,3 +34,15 @@ func (r *ScriptRepo) GetByID(id uint) (*model.Script, error) {
 	err := db.DB.First(&s, id).Error
 	return &s, err
 }
+
+// FindByName returns the script with the given name, or nil if there is none.
+func (r *ScriptRepo) FindByName(name string) (*model.Script, error) {
+	var scripts []model.Script
+	if err := db.DB.Where("name = ?", name).Limit(1).Find(&scripts).Error; err != nil {
+		return nil, err
+	}
+	if len(scripts) == 0 {
+		return nil, nil
+	}
+	return &scripts[0], nil
+}
@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/db"
+)
+
+type ScriptRunRepo struct{}
+
+func NewScriptRunRepo() *ScriptRunRepo {
+	return &ScriptRunRepo{}
+}
+
+func (r *ScriptRunRepo) Create(run *model.ScriptRun) error {
+	return db.DB.Create(run).Error
+}
+
+// ListBySource returns the runs of one script, tool or hook, newest first.
+func (r *ScriptRunRepo) ListBySource(source string, sourceID uint, limit int) ([]model.ScriptRun, error) {
+	var runs []model.ScriptRun
+	q := db.DB.Where("source = ? AND source_id = ?", source, sourceID).Order("id desc")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	err := q.Find(&runs).Error
+	return runs, err
+}
+
+// Prune keeps the newest keep runs of a source.
+func (r *ScriptRunRepo) Prune(source string, sourceID uint, keep int) error {
+	var ids []uint
+	err := db.DB.Model(&model.ScriptRun{}).Where("source = ? AND source_id = ?", source, sourceID).
+		Order("id desc").Offset(keep).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return db.DB.Unscoped().Where("id IN ?", ids).Delete(&model.ScriptRun{}).Error
+}
@@ -3,6 +3,7 @@ package repo
 import (
 	"iat/common/model"
 	"iat/common/pkg/db"
+	"time"
 )
 
 type SessionRepo struct{}
@@ -43,3 +44,32 @@ func (r *SessionRepo) GetByID(id uint) (*model.Session, error) {
 	err := db.DB.First(&s, id).Error
 	return &s, err
 }
+
+func (r *SessionRepo) ListByIDs(ids []uint) ([]model.Session, error) {
+	var sessions []model.Session
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+	err := db.DB.Where("id IN ?", ids).Find(&sessions).Error
+	return sessions, err
+}
+
+// ListByIDsUnscoped is ListByIDs including soft-deleted sessions.
+func (r *SessionRepo) ListByIDsUnscoped(ids []uint) ([]model.Session, error) {
+	var sessions []model.Session
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+	err := db.DB.Unscoped().Where("id IN ?", ids).Find(&sessions).Error
+	return sessions, err
+}
+
+// ListChangedSince returns sessions created, updated or deleted at or after
+// since, including soft-deleted ones, in pages ordered by ID.
+func (r *SessionRepo) ListChangedSince(since time.Time, afterID uint, limit int) ([]model.Session, error) {
+	var sessions []model.Session
+	err := db.DB.Unscoped().
+		Where("(updated_at >= ? OR deleted_at >= ?) AND id > ?", since, since, afterID).
+		Order("id asc").Limit(limit).Find(&sessions).Error
+	return sessions, err
+}
@@ -0,0 +1,26 @@
+package repo
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/db"
+)
+
+type ToolApprovalRepo struct{}
+
+func NewToolApprovalRepo() *ToolApprovalRepo {
+	return &ToolApprovalRepo{}
+}
+
+func (r *ToolApprovalRepo) Create(a *model.ToolApproval) error {
+	return db.DB.Create(a).Error
+}
+
+func (r *ToolApprovalRepo) ListBySessionID(sessionID uint) ([]model.ToolApproval, error) {
+	var items []model.ToolApproval
+	err := db.DB.Where("session_id = ?", sessionID).Order("id asc").Find(&items).Error
+	return items, err
+}
+
+func (r *ToolApprovalRepo) DeleteBySessionID(sessionID uint) error {
+	return db.DB.Where("session_id = ?", sessionID).Delete(&model.ToolApproval{}).Error
+}
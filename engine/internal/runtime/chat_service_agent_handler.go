@@ -30,6 +30,7 @@ func (h *ChatServiceAgentHandler) Handle(ctx context.Context, r *Runtime, inst *
 	}
 
 	result, err := h.chatService.RunAgentInternal(
+		ctx,
 		0,
 		inst.ModelAgent.Name,
 		content,
@@ -7,16 +7,20 @@ import (
 )
 
 type AgentService struct {
-	repo *repo.AgentRepo
+	repo        *repo.AgentRepo
+	modeRepo    *repo.ModeRepo
+	toolService *ToolService
 }
 
-func NewAgentService() *AgentService {
+func NewAgentService(toolService *ToolService) *AgentService {
 	return &AgentService{
-		repo: repo.NewAgentRepo(),
+		repo:        repo.NewAgentRepo(),
+		modeRepo:    repo.NewModeRepo(),
+		toolService: toolService,
 	}
 }
 
-func (s *AgentService) CreateAgent(name, description, systemPrompt, agentType, externalURL, externalType, externalParams string, modelID uint, toolIDs []uint, mcpServerIDs []uint, modeIDs []uint, status string, capabilities string) error {
+func (s *AgentService) CreateAgent(name, description, systemPrompt, agentType, externalURL, externalType, externalParams string, modelID uint, toolIDs []uint, mcpServerIDs []uint, modeIDs []uint, status string, capabilities string, toolPolicy *model.AgentToolPolicy, repoMapTokens *int) error {
 	var tools []model.Tool
 	for _, tid := range toolIDs {
 		tools = append(tools, model.Tool{Base: model.Base{ID: tid}})
@@ -51,10 +55,18 @@ func (s *AgentService) CreateAgent(name, description, systemPrompt, agentType, e
 		Status:         status,
 		Capabilities:   capabilities,
 	}
+	if toolPolicy != nil {
+		if err := agent.SetToolPolicy(*toolPolicy); err != nil {
+			return err
+		}
+	}
+	if repoMapTokens != nil {
+		agent.RepoMapTokens = *repoMapTokens
+	}
 	return s.repo.Create(agent)
 }
 
-func (s *AgentService) UpdateAgent(id uint, name, description, systemPrompt, agentType, externalURL, externalType, externalParams string, modelID uint, toolIDs []uint, mcpServerIDs []uint, modeIDs []uint, status string, capabilities string) error {
+func (s *AgentService) UpdateAgent(id uint, name, description, systemPrompt, agentType, externalURL, externalType, externalParams string, modelID uint, toolIDs []uint, mcpServerIDs []uint, modeIDs []uint, status string, capabilities string, toolPolicy *model.AgentToolPolicy, repoMapTokens *int) error {
 	agent, err := s.repo.GetByID(id)
 	if err != nil {
 		return err
@@ -96,6 +108,14 @@ func (s *AgentService) UpdateAgent(id uint, name, description, systemPrompt, age
 	if capabilities != "" {
 		agent.Capabilities = capabilities
 	}
+	if toolPolicy != nil {
+		if err := agent.SetToolPolicy(*toolPolicy); err != nil {
+			return err
+		}
+	}
+	if repoMapTokens != nil {
+		agent.RepoMapTokens = *repoMapTokens
+	}
 	
 	return s.repo.Update(agent)
 }
@@ -111,6 +131,19 @@ func (s *AgentService) DeleteAgent(id uint) error {
 	return s.repo.Delete(id)
 }
 
+// ListAgents returns all agents with their effective tools (for the agent's
+// default mode) filled in.
 func (s *AgentService) ListAgents() ([]model.Agent, error) {
-	return s.repo.List()
+	agents, err := s.repo.List()
+	if err != nil || s.toolService == nil {
+		return agents, err
+	}
+	for i := range agents {
+		var mode *model.Mode
+		if len(agents[i].Modes) > 0 {
+			mode, _ = resolveMode(s.modeRepo, agents[i].Modes[0].Key)
+		}
+		agents[i].EffectiveTools = s.toolService.DescribeTools(&agents[i], mode)
+	}
+	return agents, nil
 }
@@ -5,14 +5,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"iat/common/model"
 	"iat/common/pkg/chat"
 	"iat/common/pkg/consts"
+	"iat/common/pkg/tools"
 	"iat/common/protocol"
 	"iat/engine/internal/repo"
 	"iat/engine/pkg/ai"
-	"iat/engine/pkg/tools/builtin"
 	"io"
 	"log/slog"
 	"net/http"
@@ -22,7 +23,7 @@ import (
 	"time"
 
 	"github.com/cloudwego/eino/schema"
-	"github.com/eino-contrib/jsonschema"
+	"gorm.io/gorm"
 )
 
 func stripThinkContent(input string) string {
@@ -65,6 +66,8 @@ type ChatService struct {
 	modelRepo           *repo.AIModelRepo
 	messageRepo         *repo.MessageRepo
 	toolRepo            *repo.ToolInvocationRepo
+	modeRepo            *repo.ModeRepo
+	checkpointRepo      *repo.CheckpointRepo
 	mcpService          *MCPService
 	toolService         *ToolService
 	taskService         *TaskService
@@ -86,6 +89,8 @@ func NewChatService(mcpService *MCPService, toolService *ToolService, taskServic
 		modelRepo:           repo.NewAIModelRepo(),
 		messageRepo:         repo.NewMessageRepo(),
 		toolRepo:            repo.NewToolInvocationRepo(),
+		modeRepo:            repo.NewModeRepo(),
+		checkpointRepo:      repo.NewCheckpointRepo(),
 		mcpService:          mcpService,
 		toolService:         toolService,
 		taskService:         taskService,
@@ -114,6 +119,7 @@ func (s *ChatService) ClearMessages(sessionID uint) error {
 		return err
 	}
 	_ = s.toolRepo.DeleteBySessionID(sessionID)
+	_ = s.checkpointRepo.DeleteBySessionID(sessionID)
 	return nil
 }
 
@@ -134,6 +140,82 @@ func (s *ChatService) emitEvent(sessionID uint, event chat.ChatEvent, eventChan
 	}
 }
 
+// saveMessage stores a message and fires the message_saved hooks.
+func (s *ChatService) saveMessage(msg *model.Message) error {
+	if err := s.messageRepo.Create(msg); err != nil {
+		return err
+	}
+	if s.hookService != nil {
+		s.hookService.Notify(model.HookMessageSaved, "", 0, map[string]any{
+			"sessionId": msg.SessionID,
+			"messageId": msg.ID,
+			"role":      msg.Role,
+			"content":   msg.Content,
+		})
+	}
+	return nil
+}
+
+// errorText is err's message, or "" without an error.
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// notifyError fires the error hooks of a failed chat.
+func (s *ChatService) notifyError(sessionID uint, agent *model.Agent, mode string, err error) {
+	if s.hookService == nil || err == nil {
+		return
+	}
+	s.hookService.Notify(model.HookError, "agent", agent.ID, map[string]any{
+		"sessionId": sessionID,
+		"agentName": agent.Name,
+		"mode":      mode,
+		"error":     err.Error(),
+	})
+}
+
+// agentModel returns the model of an agent, or the default model if it has
+// none. When its model was deleted the default model is used too and the
+// model_fallback hooks fire; a model pinned by the project settings is never
+// replaced, and other lookup errors are returned as they are.
+func (s *ChatService) agentModel(sessionID uint, agent *model.Agent, settings model.ProjectSettings) (*model.AIModel, error) {
+	if agent.ModelID == 0 {
+		m, err := s.modelRepo.GetDefault()
+		if err != nil || m == nil {
+			return nil, fmt.Errorf("no default model found and agent has no model assigned")
+		}
+		return m, nil
+	}
+	m, err := s.modelRepo.GetByID(agent.ModelID)
+	if err == nil && m != nil {
+		return m, nil
+	}
+	if settings.ModelID != 0 {
+		return nil, fmt.Errorf("model %d pinned by the project is not available: %v", settings.ModelID, err)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("model config not found: %v", err)
+	}
+	fallback, derr := s.modelRepo.GetDefault()
+	if derr != nil || fallback == nil {
+		return nil, fmt.Errorf("model config not found: %v", err)
+	}
+	slog.Warn("智能体的模型不可用，改用默认模型", slog.String("agent", agent.Name), slog.Any("modelId", agent.ModelID), slog.Any("错误", err))
+	if s.hookService != nil {
+		s.hookService.Notify(model.HookModelFallback, "agent", agent.ID, map[string]any{
+			"sessionId":     sessionID,
+			"agentName":     agent.Name,
+			"modelId":       agent.ModelID,
+			"fallbackModel": fallback.Name,
+			"error":         fmt.Sprint(err),
+		})
+	}
+	return fallback, nil
+}
+
 // RunAgentInternal runs an agent synchronously for internal calls (like sub-agents)
 // depth: current recursion depth, starts at 0 for root calls
 func (s *ChatService) SetExecutor(executor WorkflowExecutor) {
@@ -144,12 +226,16 @@ func (s *ChatService) SetPlannerFactory(factory func(client *ai.AIClient) TaskPl
 	s.plannerFactory = factory
 }
 
-func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMessage string, projectRoot string, mode string, depth int, parentTaskID string, eventChan chan<- chat.ChatEvent) (string, error) {
+func (s *ChatService) RunAgentInternal(ctx context.Context, sessionID uint, agentName string, userMessage string, projectRoot string, mode string, depth int, parentTaskID string, eventChan chan<- chat.ChatEvent) (result string, err error) {
 	// Check recursion depth
 	if depth > SubAgentMaxDepth {
 		return "", fmt.Errorf("sub-agent recursion depth exceeded (max: %d, current: %d)", SubAgentMaxDepth, depth)
 	}
 
+	// 工具（包括脚本里的 iat.agents.run）从 ctx 得到当前的子智能体深度
+	ctx, cancel := context.WithCancel(withSubAgentDepth(ctx, depth))
+	defer cancel()
+
 	// Create SubAgentTask record
 	var subTask *model.SubAgentTask
 	if s.subAgentTaskService != nil {
@@ -158,6 +244,7 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 		if err != nil {
 			return "", fmt.Errorf("failed to create sub-agent task: %v", err)
 		}
+		s.subAgentTaskService.RegisterCancel(subTask.TaskID, cancel)
 		defer func() {
 			if subTask != nil {
 				s.subAgentTaskService.UnregisterCancel(subTask.TaskID)
@@ -193,36 +280,48 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 		effectiveMode = mode
 	}
 
-	// 2. Get Model Config
-	var modelConfig *model.AIModel
-	if targetAgent.ModelID != 0 {
-		modelConfig, err = s.modelRepo.GetByID(targetAgent.ModelID)
-	} else {
-		modelConfig, err = s.modelRepo.GetDefault()
-	}
-	if err != nil || modelConfig == nil {
-		return "", fmt.Errorf("model config not found for agent")
+	// HOOK: subagent_start / subagent_finish
+	if s.hookService != nil {
+		s.hookService.Notify(model.HookSubAgentStart, "agent", targetAgent.ID, map[string]any{
+			"sessionId": sessionID,
+			"agentName": targetAgent.Name,
+			"mode":      effectiveMode,
+			"query":     userMessage,
+			"depth":     depth,
+		})
+		started := time.Now()
+		defer func() {
+			s.hookService.Notify(model.HookSubAgentFinish, "agent", targetAgent.ID, map[string]any{
+				"sessionId":  sessionID,
+				"agentName":  targetAgent.Name,
+				"mode":       effectiveMode,
+				"query":      userMessage,
+				"depth":      depth,
+				"result":     result,
+				"error":      errorText(err),
+				"durationMs": time.Since(started).Milliseconds(),
+			})
+		}()
 	}
 
-	// 3. Prepare Tools
-	einoTools := builtin.GetEinoTools(effectiveMode)
-	mcpTools, err := s.mcpService.GetToolsForServers(targetAgent.MCPServers)
-	if err == nil {
-		einoTools = append(einoTools, mcpTools...)
+	// 子智能体同样使用项目的模型覆盖和 MCP 服务器白名单
+	toolProject := s.sessionProject(sessionID, projectRoot)
+	settings := projectSettings(toolProject)
+	applyProjectSettings(targetAgent, settings)
+
+	// 2. Get Model Config
+	modelConfig, err := s.agentModel(sessionID, targetAgent, settings)
+	if err != nil {
+		return "", err
 	}
 
-	for _, t := range targetAgent.Tools {
-		if t.Type == consts.ToolTypeCustom || t.Type == consts.ToolTypeScript {
-			var s jsonschema.Schema
-			if err := json.Unmarshal([]byte(t.Parameters), &s); err == nil {
-				einoTools = append(einoTools, &schema.ToolInfo{
-					Name:        t.Name,
-					Desc:        t.Description,
-					ParamsOneOf: schema.NewParamsOneOfByJSONSchema(&s),
-				})
-			}
-		}
+	// 3. Prepare Tools
+	modeDef := s.lookupMode(effectiveMode)
+	if modeDef != nil && modeDef.Instructions != "" {
+		targetAgent.SystemPrompt += "\n\n" + modeDef.Instructions
 	}
+	targetAgent.SystemPrompt += repoMapPrompt(targetAgent, modeDef, projectRoot, (&ToolCallContext{Project: toolProject, Mode: modeDef}).PathGuard())
+	einoTools := s.toolService.EffectiveTools(targetAgent, modeDef)
 
 	// 4. Init AI Client
 	aiClient, err := ai.NewAIClient(modelConfig, einoTools)
@@ -235,10 +334,26 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 		{Role: schema.System, Content: targetAgent.SystemPrompt},
 		{Role: schema.User, Content: userMessage},
 	}
+	// 项目说明文件：先加载根目录，工具触及子目录时再追加
+	instructions := tools.NewInstructionLoader(projectRoot)
+	messages[0].Content += instructions.Prompt()
 
 	// 6. Loop
-	ctx := context.Background()
 	maxTurns := 30
+	if modeDef != nil && modeDef.MaxTurns > 0 {
+		maxTurns = modeDef.MaxTurns
+	}
+	// Sub-agents don't store a user message; their edits belong to the
+	// caller's turn.
+	turnMessageID, _ := s.messageRepo.LatestUserMessageID(sessionID)
+	toolCtx := &ToolCallContext{
+		SessionID: sessionID,
+		MessageID: turnMessageID,
+		Agent:     targetAgent,
+		Project:   toolProject,
+		Mode:      modeDef,
+		Tools:     einoTools,
+	}
 
 	for i := 0; i < maxTurns; i++ {
 		resp, err := aiClient.Chat(ctx, messages)
@@ -276,22 +391,34 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 		for _, tc := range resp.ToolCalls {
 			fnName := tc.Function.Name
 			fnArgs := tc.Function.Arguments
+			toolStarted := time.Now()
 
-			var args map[string]interface{}
-			if err := json.Unmarshal([]byte(fnArgs), &args); err != nil {
-				output := fmt.Sprintf("Error parsing arguments: %v", err)
+			// HOOK: pre_tool，子智能体的调用同样受钩子约束
+			fnArgs, verr := s.toolService.PreToolHooks(ctx, fnName, fnArgs, toolCtx)
+			args := map[string]any(nil)
+			if verr == nil {
+				args, verr = s.toolService.ValidateCall(sessionID, fnName, fnArgs, einoTools)
+			}
+			if verr != nil {
+				output := toolArgErrorOutput(verr)
 				messages = append(messages, &schema.Message{
 					Role: schema.Tool, Content: output, ToolCallID: tc.ID,
 				})
 				continue
 			}
+			if extra := instructions.Prompt(tools.ToolCallPaths(args)...); extra != "" {
+				messages[0].Content += extra
+			}
 
 			resultStr := ""
-			var toolErr error
+			// Inline tools don't go through ToolService.Call, so the mode's
+			// approval requirement is checked here.
+			toolErr := s.toolService.CheckApproval(fnName, toolCtx)
 
 			// Specialized internal tools that need ChatService context
-			switch fnName {
-			case "call_subagent":
+			switch {
+			case toolErr != nil:
+			case fnName == "call_subagent":
 				// Recursive call with depth tracking
 				an, _ := args["agentName"].(string)
 				q, _ := args["query"].(string)
@@ -299,8 +426,8 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 				if subTask != nil {
 					taskID = subTask.TaskID
 				}
-				resultStr, toolErr = s.RunAgentInternal(sessionID, an, q, projectRoot, effectiveMode, depth+1, taskID, eventChan)
-			case "check_subagent_status":
+				resultStr, toolErr = s.RunAgentInternal(ctx, sessionID, an, q, projectRoot, effectiveMode, depth+1, taskID, eventChan)
+			case fnName == "check_subagent_status":
 				queryTaskID, _ := args["taskId"].(string)
 				if s.subAgentTaskService != nil && queryTaskID != "" {
 					task, err := s.subAgentTaskService.GetTask(queryTaskID)
@@ -321,7 +448,7 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 				} else {
 					resultStr = "Error: SubAgentTaskService not available or taskId missing"
 				}
-			case "manage_tasks":
+			case fnName == "manage_tasks":
 				action, _ := args["action"].(string)
 				content, _ := args["content"].(string)
 				idVal, _ := args["id"].(float64)
@@ -385,12 +512,15 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 				}
 			default:
 				// Delegate to ToolService
-				resultStr, toolErr = s.toolService.Call(ctx, fnName, args, targetAgent, projectRoot)
+				toolCtx.ToolCallID = tc.ID
+				resultStr, toolErr = s.toolService.Call(ctx, fnName, args, toolCtx)
 			}
 
 			if toolErr != nil {
 				resultStr = fmt.Sprintf("Error: %v", toolErr)
 			}
+			resultStr = s.toolService.PostToolHooks(ctx, fnName, fnArgs, resultStr, toolErr, toolStarted, toolCtx)
+			s.toolService.RecordResult(sessionID, fnName, toolErr == nil)
 
 			messages = append(messages, &schema.Message{
 				Role: schema.Tool, Content: resultStr, ToolCallID: tc.ID,
@@ -404,6 +534,94 @@ func (s *ChatService) RunAgentInternal(sessionID uint, agentName string, userMes
 	return "", fmt.Errorf("max turns exceeded")
 }
 
+// toolArgErrorOutput formats an argument error as a tool result. Schema
+// violations are returned as JSON so the model can repair the call.
+func toolArgErrorOutput(err error) string {
+	var verr *tools.ArgValidationError
+	if errors.As(err, &verr) {
+		return "Error: " + verr.Feedback()
+	}
+	return fmt.Sprintf("Error: %v", err)
+}
+
+// sessionProject loads the project a session belongs to. Callers that only
+// know the project root (e.g. runtime-dispatched agents) get a stand-in
+// project with just the path set.
+func (s *ChatService) sessionProject(sessionID uint, projectRoot string) *model.Project {
+	if session, err := s.sessionRepo.GetByID(sessionID); err == nil && session.ProjectID != 0 {
+		if p, perr := s.projectRepo.GetByID(session.ProjectID); perr == nil {
+			return p
+		}
+	}
+	if projectRoot == "" {
+		return nil
+	}
+	return &model.Project{Path: projectRoot}
+}
+
+// SessionInstructions 返回会话当前生效的项目说明：项目根目录以及会话中
+// 工具调用触及过的子目录里的说明文件
+func (s *ChatService) SessionInstructions(sessionID uint) (*tools.ProjectInstructions, error) {
+	if _, err := s.sessionRepo.GetByID(sessionID); err != nil {
+		return nil, err
+	}
+	project := s.sessionProject(sessionID, "")
+	if project == nil {
+		return &tools.ProjectInstructions{Sources: []tools.InstructionSource{}}, nil
+	}
+	history, err := s.messageRepo.ListBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return tools.LoadProjectInstructions(project.Path, historyToolPaths(history)), nil
+}
+
+func historyToolPaths(history []model.Message) []string {
+	var paths []string
+	for _, m := range history {
+		if m.ToolArgs != "" {
+			paths = append(paths, tools.ToolCallPathsJSON(m.ToolArgs)...)
+		}
+	}
+	return paths
+}
+
+// lookupMode loads the mode definition for a mode key, combined with the
+// modes it inherits from. Unknown keys yield nil.
+func (s *ChatService) lookupMode(key string) *model.Mode {
+	if key == "" {
+		return nil
+	}
+	m, err := resolveMode(s.modeRepo, key)
+	if err != nil {
+		slog.Warn("mode not resolved", slog.String("mode", key), slog.Any("error", err))
+		return nil
+	}
+	return m
+}
+
+// repoMapPrompt 返回要追加到系统提示词的仓库结构图。模式显式设置 repoMap 时
+// 以模式为准，否则看智能体是否配置了 repoMapTokens；预算未配置时用默认值。
+// 路径策略不允许读取的文件不出现在结构图里。
+func repoMapPrompt(agent *model.Agent, modeDef *model.Mode, projectRoot string, guard *tools.PathGuard) string {
+	enabled := agent.RepoMapTokens > 0
+	if modeDef != nil && modeDef.RepoMap != nil {
+		enabled = *modeDef.RepoMap
+	}
+	if !enabled || projectRoot == "" {
+		return ""
+	}
+	m, err := tools.BuildRepoMap(projectRoot, tools.RepoMapOptions{MaxTokens: agent.RepoMapTokens, Allow: guard.CanRead})
+	if err != nil {
+		slog.Warn("repository map not built", slog.String("root", projectRoot), slog.Any("error", err))
+		return ""
+	}
+	if len(m.Files) == 0 {
+		return ""
+	}
+	return "\n\n### Repository Map\nMost relevant files of the project and their key symbols, grouped by directory:\n" + m.Text
+}
+
 func (s *ChatService) createDynamicAgent(ctx context.Context, name string, intent string) (*model.Agent, error) {
 	// Get default model
 	modelConfig, err := s.modelRepo.GetDefault()
@@ -469,7 +687,7 @@ func (s *ChatService) chatWithExternalAgent(ctx context.Context, session *model.
 		Role:      consts.RoleUser,
 		Content:   userMessage,
 	}
-	if err := s.messageRepo.Create(userMsg); err != nil {
+	if err := s.saveMessage(userMsg); err != nil {
 		return fmt.Errorf("failed to save user message: %v", err)
 	}
 
@@ -547,7 +765,7 @@ func (s *ChatService) chatWithExternalAgent(ctx context.Context, session *model.
 				Role:      consts.RoleAssistant,
 				Content:   reply,
 			}
-			if err := s.messageRepo.Create(assistantMsg); err != nil {
+			if err := s.saveMessage(assistantMsg); err != nil {
 				return err
 			}
 		}
@@ -590,7 +808,7 @@ func (s *ChatService) chatWithExternalAgent(ctx context.Context, session *model.
 			Role:      consts.RoleAssistant,
 			Content:   out.Result,
 		}
-		if err := s.messageRepo.Create(assistantMsg); err != nil {
+		if err := s.saveMessage(assistantMsg); err != nil {
 			return err
 		}
 		if eventChan != nil {
@@ -648,6 +866,9 @@ func (s *ChatService) ListToolInvocations(sessionID uint) ([]model.ToolInvocatio
 	return s.toolRepo.ListBySessionID(sessionID)
 }
 
+// CompressSession replaces the history of a session with a summary. The
+// turns it summarizes are gone, so their file checkpoints are dropped too:
+// edits made before a compression can't be reverted.
 func (s *ChatService) CompressSession(sessionID uint) error {
 	s.AbortSession(sessionID)
 
@@ -717,13 +938,14 @@ func (s *ChatService) CompressSession(sessionID uint) error {
 		return err
 	}
 	_ = s.toolRepo.DeleteBySessionID(sessionID)
+	_ = s.checkpointRepo.DeleteBySessionID(sessionID)
 	aiMsg := &model.Message{
 		SessionID:  sessionID,
 		Role:       consts.RoleAssistant,
 		Content:    summary,
 		TokenCount: len(summary) / 4,
 	}
-	if err := s.messageRepo.Create(aiMsg); err != nil {
+	if err := s.saveMessage(aiMsg); err != nil {
 		return err
 	}
 
@@ -748,7 +970,7 @@ func (s *ChatService) AbortSession(sessionID uint) {
 }
 
 // Chat handles the main chat logic
-func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage string, agentID uint, modeKey string, eventChan chan<- chat.ChatEvent) error {
+func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage string, agentID uint, modeKey string, eventChan chan<- chat.ChatEvent) (err error) {
 	// 1. Get Session
 	session, err := s.sessionRepo.GetByID(sessionID)
 	if err != nil {
@@ -814,6 +1036,7 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 			projectRoot = p.Path
 		}
 	}
+	settings := projectSettings(project)
 
 	slog.Info("当前会话", slog.Any("session", session.ID))
 
@@ -824,6 +1047,9 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 	if agentID > 0 {
 		targetAgentID = agentID
 	}
+	if targetAgentID == 0 {
+		targetAgentID = settings.DefaultAgentID
+	}
 
 	slog.Info("会话AGENT", slog.Any("AGENT ID", targetAgentID))
 
@@ -834,16 +1060,40 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 	if err != nil {
 		return fmt.Errorf("agent not found: %v", err)
 	}
+	applyProjectSettings(agent, settings)
+
+	// Permission Check based on Agent Mode
+	// If modeKey is provided, it overrides the session's (project default)
+	// mode, which overrides the agent's default mode.
+	effectiveMode := ""
+	if len(agent.Modes) > 0 {
+		effectiveMode = agent.Modes[0].Key
+	}
+	if session.Mode != "" {
+		effectiveMode = session.Mode
+	} else if settings.DefaultMode != "" {
+		effectiveMode = settings.DefaultMode
+	}
+	if modeKey != "" {
+		effectiveMode = modeKey
+	}
+
+	slog.Info("当前模式", slog.String("模式", effectiveMode))
 
+	started := time.Now()
 	var finalResponse string
-	// HOOK: post_chat
+	// HOOK: post_chat；失败时先触发 error
 	defer func() {
 		if s.hookService != nil {
-			_ = s.hookService.ExecuteHooks(ctx, "post_chat", "agent", agent.ID, map[string]any{
+			s.notifyError(sessionID, agent, effectiveMode, err)
+			_, _ = s.hookService.ExecuteHooks(ctx, model.HookPostChat, "agent", agent.ID, map[string]any{
 				"sessionId":   sessionID,
+				"projectId":   session.ProjectID,
 				"agentName":   agent.Name,
+				"mode":        effectiveMode,
 				"userMessage": userMessage,
 				"response":    finalResponse,
+				"durationMs":  time.Since(started).Milliseconds(),
 			})
 		}
 	}()
@@ -853,95 +1103,46 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 		return s.chatWithExternalAgent(ctx, session, agent, userMessage, modeKey, project, eventChan)
 	}
 
-	// HOOK: pre_chat
+	// HOOK: pre_chat，可拒绝或改写用户消息
 	if s.hookService != nil {
-		_ = s.hookService.ExecuteHooks(ctx, "pre_chat", "agent", agent.ID, map[string]any{
+		data, err := s.hookService.ExecuteHooks(ctx, model.HookPreChat, "agent", agent.ID, map[string]any{
 			"sessionId":   sessionID,
 			"userMessage": userMessage,
 			"agentName":   agent.Name,
 			"projectId":   session.ProjectID,
+			"mode":        effectiveMode,
 		})
+		var denied *HookDeniedError
+		if errors.As(err, &denied) {
+			return denied
+		}
+		if err != nil {
+			return err
+		}
+		if msg, ok := data["userMessage"].(string); ok {
+			userMessage = msg
+		}
 	}
 
-	// Permission Check based on Agent Mode
-	// If modeKey is provided, it overrides the agent's default mode.
-	effectiveMode := ""
-	if len(agent.Modes) > 0 {
-		effectiveMode = agent.Modes[0].Key
-	}
-	if modeKey != "" {
-		effectiveMode = modeKey
-	}
-
-	slog.Info("当前模式", slog.String("模式", effectiveMode))
-
-	switch strings.ToUpper(effectiveMode) {
-	case consts.ChatMode:
-		// Chat agent should not execute tools
-		// We can clear tools if they are somehow attached
-		agent.Tools = nil
-	case consts.PlanMode:
-		// Plan agent: Ensure system prompt includes instructions to only operate in 'plan' directory
-		// And maybe we can enforce it in tool implementation (but that requires context awareness in tool)
-		// For now, let's append a strict instruction to system prompt
-		agent.SystemPrompt += consts.SystemPromptPlanRestriction
-	case consts.BuildMode:
-		// Build agent has all permissions.
+	// 模式定义（含继承）决定工具集、路径策略、审批、循环上限和是否编排
+	modeDef := s.lookupMode(effectiveMode)
+	if modeDef != nil && modeDef.Instructions != "" {
+		agent.SystemPrompt += "\n\n" + modeDef.Instructions
 	}
+	agent.SystemPrompt += repoMapPrompt(agent, modeDef, projectRoot, (&ToolCallContext{Project: project, Mode: modeDef}).PathGuard())
 
 	// 3. Get Model Config
-	var modelConfig *model.AIModel
-	if agent.ModelID != 0 {
-		modelConfig, err = s.modelRepo.GetByID(agent.ModelID)
-		if err != nil {
-			return fmt.Errorf("model config not found: %v", err)
-		}
-	} else {
-		// Use default model
-		modelConfig, err = s.modelRepo.GetDefault()
-		if err != nil {
-			return fmt.Errorf("no default model found and agent has no model assigned")
-		}
+	modelConfig, err := s.agentModel(sessionID, agent, settings)
+	if err != nil {
+		return err
 	}
 
 	// 4. Prepare Tools
-	// 获取当前模式下的工具
-	einoTools := builtin.GetEinoTools(effectiveMode)
-
-	// Get MCP Tools bound to Agent
-	mcpTools, err := s.mcpService.GetToolsForServers(agent.MCPServers)
-	if err == nil {
-		einoTools = append(einoTools, mcpTools...)
-	}
-
-	// Get Custom Tools (if any) - assuming agent.Tools is populated (need preload in GetByID)
-	// Currently GetByID preloads Tools, so we are good.
-	// We need to convert agent.Tools to schema.ToolInfo
-	// Note: Custom tool conversion logic is similar to builtin.GetEinoTools
-	// For now, let's assume we just use builtin tools filtered by agent name as requested.
-	// If we want to support custom tools attached to agent, we should iterate agent.Tools.
-
-	// Merge tools
-	// TODO: Implement custom tools conversion if needed.
-	// Since we are in "optimizing" phase and user emphasized builtin agent roles,
-	// we stick to builtin.GetEinoTools logic which handles the filtering.
-	// However, if we want to support custom tools (scripts), we should add them here.
-	// Let's iterate agent.Tools and convert them to schema.ToolInfo if they are 'custom' type.
-
-	for _, t := range agent.Tools {
-		if t.Type == consts.ToolTypeCustom {
-			var s jsonschema.Schema
-			if err := json.Unmarshal([]byte(t.Parameters), &s); err != nil {
-				fmt.Printf("Failed to parse schema for custom tool %s: %v\n", t.Name, err)
-				continue
-			}
-			einoTools = append(einoTools, &schema.ToolInfo{
-				Name:        t.Name,
-				Desc:        t.Description,
-				ParamsOneOf: schema.NewParamsOneOfByJSONSchema(&s),
-			})
-		}
-	}
+	// 当前模式的内置工具 + Agent 绑定的 MCP/自定义工具，按 Agent 的工具策略过滤
+	// Calls are validated against the effective tools even if einoTools is
+	// cleared for models that can't take tools.
+	allowedTools := s.toolService.EffectiveTools(agent, modeDef)
+	einoTools := allowedTools
 
 	// [Fix] DeepSeek R1 (reasoner) does not support Tools yet.
 	// If the model is a reasoner model, we MUST NOT send tools, otherwise API returns 400.
@@ -960,7 +1161,7 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 	}
 
 	// [New] Check if Orchestration is needed
-	if (effectiveMode == consts.PlanMode || effectiveMode == consts.BuildMode) && s.plannerFactory != nil {
+	if modeDef.OrchestrationEnabled() && s.plannerFactory != nil {
 		planner := s.plannerFactory(aiClient)
 		tree, err := planner.Plan(ctx, userMessage)
 		if err == nil && tree != nil && len(tree.Tasks) > 0 {
@@ -995,7 +1196,29 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 							DependsOn:   string(deps),
 						})
 					}
-					s.executor.ExecuteWorkflow(context.Background(), workflow, tasks)
+					if s.hookService != nil {
+						var taskData []any
+						b, _ := json.Marshal(tree.Tasks)
+						_ = json.Unmarshal(b, &taskData)
+						s.hookService.Notify(model.HookWorkflowStart, "agent", agent.ID, map[string]any{
+							"sessionId": sessionID,
+							"goal":      tree.Goal,
+							"tasks":     taskData,
+						})
+					}
+					started := time.Now()
+					werr := s.executor.ExecuteWorkflow(context.Background(), workflow, tasks)
+					if s.hookService != nil {
+						s.hookService.Notify(model.HookWorkflowFinish, "agent", agent.ID, map[string]any{
+							"sessionId":  sessionID,
+							"workflowId": workflow.ID,
+							"goal":       tree.Goal,
+							"status":     string(workflow.Status),
+							"result":     workflow.Result,
+							"error":      errorText(werr),
+							"durationMs": time.Since(started).Milliseconds(),
+						})
+					}
 				}()
 			}
 		}
@@ -1008,7 +1231,7 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 		Role:      consts.RoleUser,
 		Content:   userMessage,
 	}
-	if err := s.messageRepo.Create(userMsg); err != nil {
+	if err := s.saveMessage(userMsg); err != nil {
 		slog.Error("保存用户消息失败", slog.Any("会话ID", sessionID), slog.Any("错误", err))
 		return fmt.Errorf("failed to save user message: %v", err)
 	}
@@ -1027,6 +1250,10 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 		},
 	}
 
+	// 项目说明文件：根目录加上历史工具调用触及过的子目录，对话中继续追加
+	instructions := tools.NewInstructionLoader(projectRoot)
+	messages[0].Content += instructions.Prompt(historyToolPaths(history)...)
+
 	// [New] Inject Pending Tasks
 	if s.taskService != nil {
 		tasks, err := s.taskService.ListTasks(sessionID)
@@ -1085,6 +1312,17 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 	// Use a loop to handle potential Tool Calls
 	// Max turns to prevent infinite loops
 	maxTurns := 10
+	if modeDef != nil && modeDef.MaxTurns > 0 {
+		maxTurns = modeDef.MaxTurns
+	}
+	toolCtx := &ToolCallContext{
+		SessionID: sessionID,
+		MessageID: userMsg.ID,
+		Agent:     agent,
+		Project:   project,
+		Mode:      modeDef,
+		Tools:     einoTools,
+	}
 
 	for i := 0; i < maxTurns; i++ {
 		if ctx.Err() != nil {
@@ -1108,6 +1346,7 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 		if err != nil {
 			slog.Error("调用AI模型失败", slog.Any("失败原因", err.Error()))
 			s.emitEvent(sessionID, chat.ChatEvent{Type: chat.ChatEventError, Content: err.Error()}, eventChan)
+			s.notifyError(sessionID, agent, effectiveMode, err)
 			return nil
 		}
 
@@ -1197,7 +1436,7 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 			// Simple approximation: 1 token ~= 4 chars
 			aiMsg.TokenCount = len(fullResponse) / 4
 
-			s.messageRepo.Create(aiMsg)
+			s.saveMessage(aiMsg)
 			totalTokens += aiMsg.TokenCount
 			eventChan <- chat.ChatEvent{
 				Type:  chat.ChatEventUsage,
@@ -1235,15 +1474,8 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 			fnArgs := tc.Function.Arguments
 			fmt.Printf("[ChatService] Executing tool: %s\n", fnName) // LOG
 
-			// HOOK: pre_tool
-			if s.hookService != nil {
-				_ = s.hookService.ExecuteHooks(ctx, "pre_tool", "agent", agent.ID, map[string]any{
-					"sessionId": sessionID,
-					"toolName":  fnName,
-					"arguments": fnArgs,
-					"agentName": agent.Name,
-				})
-			}
+			// HOOK: pre_tool，可拒绝调用或改写参数
+			fnArgs, hookDenied := s.toolService.PreToolHooks(ctx, fnName, fnArgs, toolCtx)
 
 			s.sendToolEvent(sessionID, map[string]interface{}{
 				"stage":      consts.ToolStageCall,
@@ -1260,9 +1492,12 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 			}
 
 			// 2. Parse arguments
-			var args map[string]interface{}
-			if err := json.Unmarshal([]byte(fnArgs), &args); err != nil {
-				output := fmt.Sprintf("Error parsing arguments for tool %s: %v", fnName, err)
+			args, verr := map[string]any(nil), hookDenied
+			if verr == nil {
+				args, verr = s.toolService.ValidateCall(sessionID, fnName, fnArgs, allowedTools)
+			}
+			if verr != nil {
+				output := toolArgErrorOutput(verr)
 				s.sendToolEvent(sessionID, map[string]interface{}{
 					"stage":      consts.ToolStageResult,
 					"name":       fnName,
@@ -1279,13 +1514,20 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 				})
 				continue
 			}
+			if extra := instructions.Prompt(tools.ToolCallPaths(args)...); extra != "" {
+				messages[0].Content += extra
+			}
 
 			// 3. Execute
 			resultStr := ""
-			var toolErr error
-
-			switch fnName {
-			case "call_subagent":
+			toolStarted := time.Now()
+			// Inline tools don't go through ToolService.Call, so the mode's
+			// approval requirement is checked here.
+			toolErr := s.toolService.CheckApproval(fnName, toolCtx)
+
+			switch {
+			case toolErr != nil:
+			case fnName == "call_subagent":
 				// Notify Start of SubAgent
 				s.sendToolEvent(sessionID, map[string]interface{}{
 					"stage":      "subagent_start",
@@ -1295,8 +1537,8 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 				}, eventChan)
 
 				// Run Internal Agent
-				resultStr, toolErr = s.RunAgentInternal(sessionID, fmt.Sprint(args["agentName"]), fmt.Sprint(args["query"]), projectRoot, effectiveMode, 0, "", eventChan)
-			case "manage_tasks":
+				resultStr, toolErr = s.RunAgentInternal(ctx, sessionID, fmt.Sprint(args["agentName"]), fmt.Sprint(args["query"]), projectRoot, effectiveMode, 0, "", eventChan)
+			case fnName == "manage_tasks":
 				action, _ := args["action"].(string)
 				content, _ := args["content"].(string)
 				idVal, _ := args["id"].(float64)
@@ -1358,7 +1600,7 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 				default:
 					resultStr = fmt.Sprintf("Unknown action: %s", action)
 				}
-			case "review_output":
+			case fnName == "review_output":
 				passed, _ := args["passed"].(bool)
 				comment, _ := args["comment"].(string)
 				taskIdVal, _ := args["taskId"].(float64)
@@ -1379,24 +1621,16 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 				}
 			default:
 				// Delegate to ToolService
-				resultStr, toolErr = s.toolService.Call(ctx, fnName, args, agent, projectRoot)
+				toolCtx.ToolCallID = tc.ID
+				resultStr, toolErr = s.toolService.Call(ctx, fnName, args, toolCtx)
 			}
 
 			if toolErr != nil {
 				resultStr = fmt.Sprintf("Error: %v", toolErr)
 			}
 
-			// HOOK: post_tool
-			if s.hookService != nil {
-				_ = s.hookService.ExecuteHooks(ctx, "post_tool", "agent", agent.ID, map[string]any{
-					"sessionId": sessionID,
-					"toolName":  fnName,
-					"arguments": fnArgs,
-					"result":    resultStr,
-					"error":     toolErr,
-					"agentName": agent.Name,
-				})
-			}
+			// HOOK: post_tool，可在结果交给模型前脱敏或改写
+			resultStr = s.toolService.PostToolHooks(ctx, fnName, fnArgs, resultStr, toolErr, toolStarted, toolCtx)
 
 			// ... (upsert result)
 
@@ -1407,6 +1641,7 @@ func (s *ChatService) Chat(ctx context.Context, sessionID uint, userMessage stri
 			if strings.HasPrefix(resultStr, "Error:") {
 				ok = false
 			}
+			s.toolService.RecordResult(sessionID, fnName, ok)
 			_ = s.toolRepo.UpsertResult(sessionID, tc.ID, fnName, resultStr, ok)
 			_ = s.messageRepo.UpsertToolResult(sessionID, tc.ID, fnName, resultStr, ok)
 			s.sendToolEvent(sessionID, map[string]interface{}{
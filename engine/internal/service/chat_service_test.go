@@ -0,0 +1,46 @@
+package service
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/db"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestChatService_AgentModel(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.AIModel{})
+	db.DB = d
+
+	def := &model.AIModel{Name: "default", IsDefault: true}
+	own := &model.AIModel{Name: "own"}
+	d.Create(def)
+	d.Create(own)
+	svc := NewChatService(nil, nil, nil, nil, nil, nil)
+
+	if m, err := svc.agentModel(1, &model.Agent{Name: "dev", ModelID: own.ID}, model.ProjectSettings{}); err != nil || m.Name != "own" {
+		t.Fatalf("got %v, %v", m, err)
+	}
+
+	// 智能体的模型被删除时改用默认模型
+	if m, err := svc.agentModel(1, &model.Agent{Name: "dev", ModelID: 99}, model.ProjectSettings{}); err != nil || m.Name != "default" {
+		t.Fatalf("expected the default model, got %v, %v", m, err)
+	}
+
+	// 项目固定的模型不可用时报错，而不是悄悄换成默认模型
+	agent := &model.Agent{Name: "dev"}
+	settings := model.ProjectSettings{ModelID: 99}
+	applyProjectSettings(agent, settings)
+	if _, err := svc.agentModel(1, agent, settings); err == nil || !strings.Contains(err.Error(), "pinned by the project") {
+		t.Fatalf("expected the pinned model to be required, got %v", err)
+	}
+
+	// 其他查询错误不回退
+	d.Migrator().DropTable(&model.AIModel{})
+	if _, err := svc.agentModel(1, &model.Agent{Name: "dev", ModelID: own.ID}, model.ProjectSettings{}); err == nil || !strings.Contains(err.Error(), "model config not found") {
+		t.Fatalf("expected the lookup error, got %v", err)
+	}
+}
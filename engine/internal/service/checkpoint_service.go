@@ -0,0 +1,293 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"iat/common/model"
+	"iat/common/pkg/tools"
+	"iat/engine/internal/repo"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// MaxCheckpointBytes is the largest file that will be snapshotted. Tools
+// refuse to modify bigger files because the change could not be undone.
+const MaxCheckpointBytes = 10 << 20
+
+// CheckpointService snapshots files before tools modify them so a turn's
+// edits can be inspected and undone without relying on git.
+type CheckpointService struct {
+	repo *repo.CheckpointRepo
+}
+
+func NewCheckpointService() *CheckpointService {
+	return &CheckpointService{
+		repo: repo.NewCheckpointRepo(),
+	}
+}
+
+// FileChange summarizes what a turn (or range of turns) did to one file.
+type FileChange struct {
+	Path         string   `json:"path"`
+	RelPath      string   `json:"relPath"`
+	CheckpointID uint     `json:"checkpointId"` // earliest checkpoint, i.e. the state to revert to
+	Created      bool     `json:"created"`      // file did not exist before
+	Deleted      bool     `json:"deleted"`      // file no longer exists afterwards
+	ToolCallIDs  []string `json:"toolCallIds"`
+	Reverted     bool     `json:"reverted"`
+	Diff         string   `json:"diff,omitempty"`
+}
+
+// Snapshot records the current content of absPath for the tool call in tc.
+// It must be called before the file is modified.
+func (s *CheckpointService) Snapshot(tc *ToolCallContext, toolName, absPath string) error {
+	if s == nil || tc == nil || tc.SessionID == 0 {
+		return nil
+	}
+	cp := &model.FileCheckpoint{
+		SessionID:  tc.SessionID,
+		MessageID:  tc.MessageID,
+		ToolCallID: tc.ToolCallID,
+		ToolName:   toolName,
+		Path:       absPath,
+		RelPath:    absPath,
+	}
+	if root := tc.ProjectRoot(); root != "" {
+		if rel, err := filepath.Rel(root, absPath); err == nil {
+			cp.RelPath = filepath.ToSlash(rel)
+		}
+	}
+
+	info, err := os.Stat(absPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		cp.Existed = false
+	case err != nil:
+		return fmt.Errorf("checkpoint %s: %v", cp.RelPath, err)
+	case info.IsDir():
+		return fmt.Errorf("checkpoint %s: is a directory", cp.RelPath)
+	case info.Size() > MaxCheckpointBytes:
+		return fmt.Errorf("checkpoint %s: file is larger than %d bytes", cp.RelPath, MaxCheckpointBytes)
+	default:
+		data, err := os.ReadFile(absPath)
+		if err != nil {
+			return fmt.Errorf("checkpoint %s: %v", cp.RelPath, err)
+		}
+		cp.Existed = true
+		cp.Content = string(data)
+	}
+	return s.repo.Create(cp)
+}
+
+// ListTurn lists the files changed in the turn started by messageID.
+func (s *CheckpointService) ListTurn(sessionID, messageID uint, withDiff bool) ([]FileChange, error) {
+	cps, err := s.repo.ListByMessage(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return s.summarize(cps, withDiff)
+}
+
+// ListSession lists every file changed in a session.
+func (s *CheckpointService) ListSession(sessionID uint, withDiff bool) ([]FileChange, error) {
+	cps, err := s.repo.ListBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.summarize(cps, withDiff)
+}
+
+// RevertFile restores one file to its state before the turn started by
+// messageID.
+func (s *CheckpointService) RevertFile(sessionID, messageID uint, path string) ([]FileChange, error) {
+	cps, err := s.repo.ListByMessage(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	var matched []model.FileCheckpoint
+	for _, cp := range cps {
+		if cp.Path == path || cp.RelPath == path {
+			matched = append(matched, cp)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no checkpoint for %q in message %d", path, messageID)
+	}
+	if err := s.checkNoLaterEdits(matched); err != nil {
+		return nil, err
+	}
+	return s.revert(matched)
+}
+
+// RevertTurn restores every file the turn started by messageID modified. It
+// refuses when a later turn changed one of those files again, since
+// restoring would silently discard that turn's edits; use RevertSince.
+func (s *CheckpointService) RevertTurn(sessionID, messageID uint) ([]FileChange, error) {
+	cps, err := s.repo.ListByMessage(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkNoLaterEdits(cps); err != nil {
+		return nil, err
+	}
+	return s.revert(cps)
+}
+
+// RevertSince restores every file modified in the turn started by messageID
+// or in any later turn.
+func (s *CheckpointService) RevertSince(sessionID, messageID uint) ([]FileChange, error) {
+	cps, err := s.repo.ListSinceMessage(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return s.revert(cps)
+}
+
+// checkNoLaterEdits fails if a file in cps has a checkpoint that was taken
+// after cps and has not been reverted yet.
+func (s *CheckpointService) checkNoLaterEdits(cps []model.FileCheckpoint) error {
+	for _, cp := range lastCheckpoints(cps) {
+		later, err := s.repo.ListAfter(cp.SessionID, cp.Path, cp.ID)
+		if err != nil {
+			return err
+		}
+		for _, l := range later {
+			if !l.Reverted {
+				return fmt.Errorf("cannot revert %s: it was modified again in a later turn (message %d); revert since this turn instead", cp.RelPath, l.MessageID)
+			}
+		}
+	}
+	return nil
+}
+
+// lastCheckpoints returns the newest checkpoint of each file in cps (oldest
+// first), in the order the files first appear.
+func lastCheckpoints(cps []model.FileCheckpoint) []model.FileCheckpoint {
+	var last []model.FileCheckpoint
+	index := make(map[string]int)
+	for _, cp := range cps {
+		if i, ok := index[cp.Path]; ok {
+			last[i] = cp
+			continue
+		}
+		index[cp.Path] = len(last)
+		last = append(last, cp)
+	}
+	return last
+}
+
+func (s *CheckpointService) DeleteBySessionID(sessionID uint) error {
+	return s.repo.DeleteBySessionID(sessionID)
+}
+
+// revert restores each file to the content of its earliest checkpoint among
+// cps (cps must be ordered oldest first) and marks all of them reverted.
+func (s *CheckpointService) revert(cps []model.FileCheckpoint) ([]FileChange, error) {
+	var pending []model.FileCheckpoint
+	for _, cp := range cps {
+		if !cp.Reverted {
+			pending = append(pending, cp)
+		}
+	}
+	changes := groupCheckpoints(pending)
+	earliest := make(map[string]model.FileCheckpoint)
+	for _, cp := range pending {
+		if _, ok := earliest[cp.Path]; !ok {
+			earliest[cp.Path] = cp
+		}
+	}
+
+	var reverted []uint
+	for i, ch := range changes {
+		cp := earliest[ch.Path]
+		if err := restoreCheckpoint(cp); err != nil {
+			_ = s.repo.MarkReverted(reverted)
+			return nil, fmt.Errorf("revert %s: %v", cp.RelPath, err)
+		}
+		for _, other := range pending {
+			if other.Path == cp.Path {
+				reverted = append(reverted, other.ID)
+			}
+		}
+		changes[i].Reverted = true
+	}
+	if err := s.repo.MarkReverted(reverted); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func restoreCheckpoint(cp model.FileCheckpoint) error {
+	if !cp.Existed {
+		if err := os.Remove(cp.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.Path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(cp.Path, []byte(cp.Content), 0644)
+}
+
+// summarize groups checkpoints (oldest first) by file. A file's state after
+// the checkpoints is taken from the next later checkpoint of the same file,
+// or from disk when there is none, so a turn's diff doesn't include edits
+// made by later turns.
+func (s *CheckpointService) summarize(cps []model.FileCheckpoint, withDiff bool) ([]FileChange, error) {
+	changes := groupCheckpoints(cps)
+	for i, last := range lastCheckpoints(cps) {
+		later, err := s.repo.ListAfter(last.SessionID, last.Path, last.ID)
+		if err != nil {
+			return nil, err
+		}
+		var after string
+		if len(later) > 0 {
+			changes[i].Deleted = !later[0].Existed
+			after = later[0].Content
+		} else {
+			current, err := os.ReadFile(last.Path)
+			changes[i].Deleted = errors.Is(err, fs.ErrNotExist)
+			after = string(current)
+		}
+		if withDiff {
+			changes[i].Diff = tools.DiffText(firstContent(cps, last.Path), after)
+		}
+	}
+	return changes, nil
+}
+
+func firstContent(cps []model.FileCheckpoint, path string) string {
+	for _, cp := range cps {
+		if cp.Path == path {
+			return cp.Content
+		}
+	}
+	return ""
+}
+
+// groupCheckpoints groups checkpoints (oldest first) by file.
+func groupCheckpoints(cps []model.FileCheckpoint) []FileChange {
+	var changes []FileChange
+	index := make(map[string]int)
+	for _, cp := range cps {
+		i, ok := index[cp.Path]
+		if !ok {
+			i = len(changes)
+			index[cp.Path] = i
+			changes = append(changes, FileChange{
+				Path:         cp.Path,
+				RelPath:      cp.RelPath,
+				CheckpointID: cp.ID,
+				Created:      !cp.Existed,
+				Reverted:     true,
+			})
+		}
+		if cp.ToolCallID != "" {
+			changes[i].ToolCallIDs = append(changes[i].ToolCallIDs, cp.ToolCallID)
+		}
+		changes[i].Reverted = changes[i].Reverted && cp.Reverted
+	}
+	return changes
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/db"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCheckpointService_RevertTurnAndSince(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.FileCheckpoint{})
+	db.DB = d
+
+	root := t.TempDir()
+	svc := NewCheckpointService()
+	existing := filepath.Join(root, "a.txt")
+	created := filepath.Join(root, "new", "b.txt")
+	os.WriteFile(existing, []byte("v1\n"), 0644)
+
+	write := func(messageID uint, path, content string) {
+		tc := &ToolCallContext{SessionID: 1, MessageID: messageID, ToolCallID: "call", Project: &model.Project{Path: root}}
+		if err := svc.Snapshot(tc, "write_file", path); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	write(10, existing, "v2\n")
+	write(10, existing, "v3\n")
+	write(10, created, "hello\n")
+	write(20, existing, "v4\n")
+
+	changes, err := svc.ListTurn(1, 10, true)
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("expected 2 changed files in turn, got %v (%v)", changes, err)
+	}
+	if changes[0].RelPath != "a.txt" || changes[0].Diff != "-v1\n+v3\n" || !changes[1].Created {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+
+	if _, err := svc.RevertTurn(1, 10); err == nil || !strings.Contains(err.Error(), "later turn") {
+		t.Fatalf("expected revert of turn 10 to be refused while turn 20 edits a.txt, got %v", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "v4\n" {
+		t.Fatalf("refused revert must not touch files, got %q", data)
+	}
+
+	if _, err := svc.RevertTurn(1, 20); err != nil {
+		t.Fatalf("revert turn: %v", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "v3\n" {
+		t.Fatalf("expected v3 after reverting turn 20, got %q", data)
+	}
+
+	if _, err := svc.RevertSince(1, 10); err != nil {
+		t.Fatalf("revert since: %v", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "v1\n" {
+		t.Fatalf("expected v1 after reverting since turn 10, got %q", data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Fatalf("expected created file to be removed, got %v", err)
+	}
+}
+
+func TestSessionService_DeleteRemovesCheckpoints(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Session{}, &model.FileCheckpoint{})
+	db.DB = d
+
+	sessions := NewSessionService()
+	sess, err := sessions.CreateSession("s", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	tc := &ToolCallContext{SessionID: sess.ID, MessageID: 1, Project: &model.Project{Path: root}}
+	if err := NewCheckpointService().Snapshot(tc, "write_file", filepath.Join(root, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sessions.DeleteSession(sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	d.Model(&model.FileCheckpoint{}).Where("session_id = ?", sess.ID).Count(&n)
+	if n != 0 {
+		t.Fatalf("expected the session's checkpoints to be deleted, %d left", n)
+	}
+}
@@ -1,31 +1,60 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"iat/common/model"
 	"iat/common/pkg/script"
 	"iat/engine/internal/repo"
+	"io"
+	"log/slog"
+	"maps"
 	"net/http"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
 type HookService struct {
-	repo *repo.HookRepo
+	repo        *repo.HookRepo
+	projectRepo *repo.ProjectRepo
+	sessionRepo *repo.SessionRepo
 }
 
 func NewHookService() *HookService {
 	return &HookService{
-		repo: repo.NewHookRepo(),
+		repo:        repo.NewHookRepo(),
+		projectRepo: repo.NewProjectRepo(),
+		sessionRepo: repo.NewSessionRepo(),
 	}
 }
 
 func (s *HookService) CreateHook(hook *model.Hook) error {
+	if err := validateHook(hook); err != nil {
+		return err
+	}
 	return s.repo.Create(hook)
 }
 
+func validateHook(hook *model.Hook) error {
+	if !model.IsHookEvent(hook.Type) {
+		return fmt.Errorf("unknown hook event %q", hook.Type)
+	}
+	if hook.ToolPattern != "" {
+		if _, err := toolPatternRegexp(hook.ToolPattern); err != nil {
+			return fmt.Errorf("invalid tool pattern: %w", err)
+		}
+	}
+	if _, err := scriptEngineFor(hook.Capabilities, ""); err != nil {
+		return fmt.Errorf("invalid capabilities: %w", err)
+	}
+	return nil
+}
+
 func (s *HookService) ListHooks() ([]model.Hook, error) {
 	return s.repo.List()
 }
@@ -35,6 +64,9 @@ func (s *HookService) GetHook(id uint) (*model.Hook, error) {
 }
 
 func (s *HookService) UpdateHook(hook *model.Hook) error {
+	if err := validateHook(hook); err != nil {
+		return err
+	}
 	return s.repo.Update(hook)
 }
 
@@ -46,11 +78,149 @@ func (s *HookService) GetHooksByType(hookType string) ([]model.Hook, error) {
 	return s.repo.ListByType(hookType)
 }
 
-func (s *HookService) ExecuteHooks(ctx context.Context, hookType string, targetType string, targetID uint, contextData map[string]any) error {
+// hookPayloadFields are the event fields hooks of each type may rewrite.
+var hookPayloadFields = map[string][]string{
+	model.HookPreChat:  {"userMessage"},
+	model.HookPreTool:  {"arguments"},
+	model.HookPostTool: {"result"},
+}
+
+// HookDeniedError is returned by ExecuteHooks when a pre hook denies the
+// event.
+type HookDeniedError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *HookDeniedError) Error() string {
+	return fmt.Sprintf("blocked by hook %s: %s", e.Hook, e.Reason)
+}
+
+// Notify runs the hooks of an event that can't be denied or rewritten in
+// the background; see ExecuteHooks.
+func (s *HookService) Notify(hookType string, targetType string, targetID uint, contextData map[string]any) {
+	go func() {
+		if _, err := s.ExecuteHooks(context.Background(), hookType, targetType, targetID, contextData); err != nil {
+			slog.Warn("hooks failed", slog.String("type", hookType), slog.Any("error", err))
+		}
+	}()
+}
+
+// WorkflowTaskDone fires the workflow_task_complete hooks of a finished
+// workflow task.
+func (s *HookService) WorkflowTaskDone(workflow *model.Workflow, task *model.WorkflowTask) {
+	data := map[string]any{
+		"sessionId":  workflow.SessionID,
+		"workflowId": workflow.ID,
+		"taskId":     task.TaskID,
+		"title":      task.Title,
+		"status":     string(task.Status),
+		"output":     task.Output,
+		"error":      task.Error,
+	}
+	if task.StartedAt != nil && task.CompletedAt != nil {
+		data["durationMs"] = task.CompletedAt.Sub(*task.StartedAt).Milliseconds()
+	}
+	s.Notify(model.HookWorkflowTaskComplete, "", 0, data)
+}
+
+// maxToolPatterns bounds the compiled tool patterns kept in memory.
+const maxToolPatterns = 256
+
+var toolPatterns = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+// toolPatternRegexp compiles a hook's tool pattern once; hooks are read from
+// the database on every event.
+func toolPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	toolPatterns.Lock()
+	defer toolPatterns.Unlock()
+	if re, ok := toolPatterns.m[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(toolPatterns.m) >= maxToolPatterns {
+		clear(toolPatterns.m)
+	}
+	toolPatterns.m[pattern] = re
+	return re, nil
+}
+
+// hookMatches reports whether the event data passes the hook's filters.
+func hookMatches(hook *model.Hook, data map[string]any) bool {
+	if hook.ToolPattern != "" {
+		re, err := toolPatternRegexp(hook.ToolPattern)
+		if err != nil {
+			// 校验之前保存的钩子可能有无效的模式
+			slog.Warn("hook has an invalid tool pattern", slog.String("hook", hook.Name), slog.Any("error", err))
+			return false
+		}
+		if name, _ := data["toolName"].(string); name == "" || !re.MatchString(name) {
+			return false
+		}
+	}
+	if hook.ProjectID != 0 {
+		if id, ok := hookNumber(data["projectId"]); !ok || id != int64(hook.ProjectID) {
+			return false
+		}
+	}
+	if hook.Mode != "" {
+		if mode, _ := data["mode"].(string); mode != hook.Mode {
+			return false
+		}
+	}
+	if hook.MinDurationMs > 0 {
+		if d, ok := hookNumber(data["durationMs"]); !ok || d < hook.MinDurationMs {
+			return false
+		}
+	}
+	return true
+}
+
+func hookNumber(v any) (int64, bool) {
+	switch n := v.(type) {
+	case uint:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// ExecuteHooks runs the enabled global and target hooks of hookType whose
+// filters match, in order, and returns the event data with their
+// modifications applied; each hook sees the changes of the ones before it.
+// A pre hook that denies the event stops the chain with a *HookDeniedError.
+// Hooks that fail are logged and skipped, unless a pre hook is FailClosed:
+// then its error or timeout denies the event, so a broken policy hook can't
+// be bypassed. Events of a session get its projectId when they don't carry
+// one.
+func (s *HookService) ExecuteHooks(ctx context.Context, hookType string, targetType string, targetID uint, contextData map[string]any) (map[string]any, error) {
+	data := maps.Clone(contextData)
+	if data == nil {
+		data = map[string]any{}
+	}
+	if _, ok := data["projectId"]; !ok {
+		if sid, _ := data["sessionId"].(uint); sid != 0 {
+			if session, err := s.sessionRepo.GetByID(sid); err == nil {
+				data["projectId"] = session.ProjectID
+			}
+		}
+	}
+
 	// 1. Get Global Hooks for this type
 	globalHooks, err := s.repo.ListByTarget("global", 0)
 	if err != nil {
-		return err
+		return data, err
 	}
 
 	// 2. Get Target Hooks for this type
@@ -58,7 +228,7 @@ func (s *HookService) ExecuteHooks(ctx context.Context, hookType string, targetT
 	if targetType != "" && targetID != 0 {
 		targetHooks, err = s.repo.ListByTarget(targetType, targetID)
 		if err != nil {
-			return err
+			return data, err
 		}
 	}
 
@@ -68,48 +238,124 @@ func (s *HookService) ExecuteHooks(ctx context.Context, hookType string, targetT
 		if !hook.Enabled {
 			continue
 		}
-		if hook.Type != hookType {
+		if hook.Type != hookType || !hookMatches(&hook, data) {
 			continue
 		}
 
-		// Execute asynchronously to avoid blocking main flow?
-		// For pre-hooks, we might want to block (validation).
-		// For post-hooks, maybe async.
-		// For now, let's run synchronously but safely.
-		if err := s.runSingleHook(ctx, &hook, contextData); err != nil {
-			fmt.Printf("[HookService] Hook %s (ID: %d) failed: %v\n", hook.Name, hook.ID, err)
-			// Continue executing other hooks even if one fails
+		// 同步执行：pre 钩子的决定要在继续之前生效
+		decision, err := s.runSingleHook(ctx, &hook, maps.Clone(data))
+		if err != nil {
+			slog.Warn("hook failed", slog.String("hook", hook.Name), slog.Any("id", hook.ID), slog.Any("error", err))
+			if hook.FailClosed && model.IsBlockingHookEvent(hookType) {
+				return data, &HookDeniedError{Hook: hook.Name, Reason: fmt.Sprintf("hook failed: %v", err)}
+			}
+			continue
+		}
+		if decision == nil {
+			continue
+		}
+		switch decision.Action {
+		case "", model.HookAllow, model.HookModify:
+		case model.HookDeny:
+			if !strings.HasPrefix(hookType, "pre_") {
+				slog.Warn("only pre hooks can deny", slog.String("hook", hook.Name), slog.String("type", hookType))
+				continue
+			}
+			reason := decision.Reason
+			if reason == "" {
+				reason = "denied"
+			}
+			return data, &HookDeniedError{Hook: hook.Name, Reason: reason}
+		default:
+			slog.Warn("unknown hook decision", slog.String("hook", hook.Name), slog.String("action", decision.Action))
+			continue
+		}
+		for field, v := range decision.Payload {
+			if !slices.Contains(hookPayloadFields[hookType], field) {
+				slog.Warn("hook cannot rewrite field", slog.String("hook", hook.Name), slog.String("type", hookType), slog.String("field", field))
+				continue
+			}
+			data[field] = v
 		}
 	}
-	return nil
+	return data, nil
 }
 
-func (s *HookService) runSingleHook(ctx context.Context, hook *model.Hook, data map[string]any) error {
+// hookProjectRoot returns the root of the project the event belongs to, the
+// base directory of a hook script's fs grant.
+func (s *HookService) hookProjectRoot(data map[string]any) string {
+	id, _ := data["projectId"].(uint)
+	if id == 0 {
+		return ""
+	}
+	p, err := s.projectRepo.GetByID(id)
+	if err != nil {
+		return ""
+	}
+	return p.Path
+}
+
+// runSingleHook runs a hook and returns its decision: the object a script
+// returns or the JSON object an http hook responds with. Anything else is
+// no decision.
+func (s *HookService) runSingleHook(ctx context.Context, hook *model.Hook, data map[string]any) (*model.HookDecision, error) {
 	switch hook.Action {
 	case "script":
-		engine := script.NewScriptEngine()
+		engine, err := scriptEngineFor(hook.Capabilities, s.hookProjectRoot(data))
+		if err != nil {
+			return nil, err
+		}
 		engine.RegisterGlobal("context", data)
-		_, err := engine.RunWithTimeout(hook.Content, 10*time.Second)
-		return err
+		run := &model.ScriptRun{Source: model.ScriptRunHook, SourceID: hook.ID, Name: hook.Name}
+		run.SessionID, _ = data["sessionId"].(uint)
+		res, err := executeScript(ctx, engine, "", hook.Content, script.Limits{Timeout: 10 * time.Second}, run, data)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := res.(map[string]any); !ok {
+			return nil, nil
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+		return parseHookDecision(b)
 	case "http":
 		client := &http.Client{Timeout: 10 * time.Second}
 		body, _ := json.Marshal(data)
 		req, err := http.NewRequestWithContext(ctx, "POST", hook.Content, strings.NewReader(string(body)))
 		if err != nil {
-			return err
+			return nil, err
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("X-Hook-Event", hook.Type)
 		resp, err := client.Do(req)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode >= 400 {
-			return fmt.Errorf("http hook returned status %d", resp.StatusCode)
+			return nil, fmt.Errorf("http hook returned status %d", resp.StatusCode)
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, err
 		}
-		return nil
+		return parseHookDecision(respBody)
 	default:
-		return fmt.Errorf("unknown hook action: %s", hook.Action)
+		return nil, fmt.Errorf("unknown hook action: %s", hook.Action)
+	}
+}
+
+// parseHookDecision decodes a decision; empty or non-object input is none.
+func parseHookDecision(b []byte) (*model.HookDecision, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		return nil, nil
+	}
+	var d model.HookDecision
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("invalid hook decision: %w", err)
 	}
+	return &d, nil
 }
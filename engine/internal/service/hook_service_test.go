@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"iat/common/model"
+	"iat/common/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestHookService_Decisions(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Hook{}, &model.ScriptRun{}, &model.Project{})
+	db.DB = d
+
+	policy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"action": "deny", "reason": "no shell access"}`))
+	}))
+	defer policy.Close()
+
+	svc := NewHookService()
+	hooks := []model.Hook{
+		{Name: "rewrite", Type: model.HookPreTool, TargetType: "global", Action: "script", Enabled: true,
+			Content: `context.toolName === "read_file" ? ({action: "modify", payload: {arguments: {path: "safe.txt"}, sessionId: 99}}) : null`},
+		{Name: "policy", Type: model.HookPreTool, TargetType: "agent", TargetID: 7, Action: "http", Enabled: true, Content: policy.URL},
+		{Name: "redact", Type: model.HookPostTool, TargetType: "global", Action: "script", Enabled: true,
+			Content: `({action: "modify", payload: {result: context.result.replace(/secret/g, "***")}})`},
+	}
+	for i := range hooks {
+		if err := svc.CreateHook(&hooks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	data, err := svc.ExecuteHooks(ctx, model.HookPreTool, "", 0, map[string]any{"sessionId": uint(1), "toolName": "read_file", "arguments": `{"path":"a.txt"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hookArguments(data["arguments"], ""); got != `{"path":"safe.txt"}` || data["sessionId"] != uint(1) {
+		t.Fatalf("unexpected rewrite: %v", data)
+	}
+
+	_, err = svc.ExecuteHooks(ctx, model.HookPreTool, "agent", 7, map[string]any{"toolName": "run_command", "arguments": `{}`})
+	var denied *HookDeniedError
+	if !errors.As(err, &denied) || denied.Hook != "policy" || denied.Reason != "no shell access" {
+		t.Fatalf("expected denial, got %v", err)
+	}
+
+	// post 钩子可以在结果交给模型前脱敏
+	data, err = svc.ExecuteHooks(ctx, model.HookPostTool, "", 0, map[string]any{"result": "token=secret"})
+	if err != nil || data["result"] != "token=***" {
+		t.Fatalf("unexpected post_tool outcome: %v, %v", data, err)
+	}
+
+	// 出错的钩子默认跳过；FailClosed 的钩子在可拒绝的事件上拒绝
+	broken := model.Hook{Name: "broken", TargetType: "agent", TargetID: 8, Action: "script", Enabled: true, Content: `throw new Error("boom")`}
+	for _, typ := range []string{model.HookPreChat, model.HookPostTool} {
+		h := broken
+		h.Type = typ
+		if err := svc.CreateHook(&h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = svc.ExecuteHooks(ctx, model.HookPreChat, "agent", 8, map[string]any{"userMessage": "hi"}); err != nil {
+		t.Fatalf("a failing hook must be skipped by default, got %v", err)
+	}
+	strict := broken
+	strict.Type, strict.FailClosed = model.HookPreTool, true
+	if err := svc.CreateHook(&strict); err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.ExecuteHooks(ctx, model.HookPreTool, "agent", 8, map[string]any{"toolName": "read_file", "arguments": `{}`})
+	if !errors.As(err, &denied) || denied.Hook != "broken" {
+		t.Fatalf("expected a failing FailClosed pre hook to deny, got %v", err)
+	}
+	strict.ID, strict.Type = 0, model.HookPostTool
+	if err := svc.CreateHook(&strict); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = svc.ExecuteHooks(ctx, model.HookPostTool, "agent", 8, map[string]any{"result": "ok"}); err != nil {
+		t.Fatalf("a failing post hook must not fail the event, got %v", err)
+	}
+}
+
+func TestHookService_Filters(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Hook{}, &model.ScriptRun{}, &model.Project{}, &model.Session{})
+	db.DB = d
+
+	svc := NewHookService()
+	mark := func(name string) string {
+		return `({payload: {result: context.result + "` + name + `"}})`
+	}
+	hooks := []model.Hook{
+		{Name: "shell", ToolPattern: "^run_command$", Content: mark("S")},
+		{Name: "project", ProjectID: 3, Content: mark("P")},
+		{Name: "mode", Mode: "code", Content: mark("M")},
+		{Name: "slow", MinDurationMs: 1000, Content: mark("D")},
+	}
+	for i := range hooks {
+		hooks[i].Type, hooks[i].TargetType, hooks[i].Action, hooks[i].Enabled = model.HookPostTool, "global", "script", true
+		if err := svc.CreateHook(&hooks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.CreateHook(&model.Hook{Name: "bad", Type: model.HookPostTool, ToolPattern: "("}); err == nil {
+		t.Fatal("expected invalid tool pattern to be rejected")
+	}
+	if err := svc.CreateHook(&model.Hook{Name: "bad", Type: "pre_run"}); err == nil {
+		t.Fatal("expected unknown event to be rejected")
+	}
+	// 会话事件的 projectId 从会话补齐
+	d.Create(&model.Session{Base: model.Base{ID: 5}, ProjectID: 3})
+
+	cases := []struct {
+		data map[string]any
+		want string
+	}{
+		{map[string]any{"toolName": "read_file", "mode": "chat", "durationMs": int64(10)}, ""},
+		{map[string]any{"toolName": "run_command", "mode": "code", "durationMs": int64(10)}, "SM"},
+		{map[string]any{"toolName": "run_command_x", "projectId": uint(3), "durationMs": int64(1500)}, "PD"},
+		{map[string]any{"toolName": "read_file", "sessionId": uint(5)}, "P"},
+	}
+	for _, c := range cases {
+		c.data["result"] = ""
+		data, err := svc.ExecuteHooks(context.Background(), model.HookPostTool, "", 0, c.data)
+		if err != nil || data["result"] != c.want {
+			t.Errorf("%v: got %v, %v; want %q", c.data, data["result"], err, c.want)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package service
 import (
 	"fmt"
 	"iat/common/model"
+	"iat/common/pkg/tools"
 	"iat/engine/pkg/indexdb"
 	"iat/engine/internal/repo"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -22,19 +24,154 @@ type IndexService struct {
 	sessionRepo   *repo.SessionRepo
 	autoIndexOnce sync.Once
 	autoIndexErr  error
+
+	statusMu sync.Mutex
+	status   map[uint]*IndexStatus
+	watcher  *IndexWatcher
+	hooks    *HookService
 }
 
 func NewIndexService() *IndexService {
 	return &IndexService{
 		projectRepo: repo.NewProjectRepo(),
 		sessionRepo: repo.NewSessionRepo(),
+		status:      make(map[uint]*IndexStatus),
 	}
 }
 
 type IndexResult struct {
-	Indexed int    `json:"indexed"`
-	Files   int    `json:"files"`
-	DBPath  string `json:"dbPath"`
+	Indexed int                      `json:"indexed"`
+	Files   int                      `json:"files"`
+	DBPath  string                   `json:"dbPath"`
+	Update  *indexdb.CodeIndexUpdate `json:"update,omitempty"`
+}
+
+// IndexStatus 是项目代码索引的状态
+type IndexStatus struct {
+	ProjectID  uint                     `json:"projectId"`
+	State      string                   `json:"state"` // none, indexing, ready, error
+	Watching   bool                     `json:"watching"`
+	Files      int                      `json:"files"`
+	IndexedAt  string                   `json:"indexedAt,omitempty"`
+	Version    int                      `json:"version,omitempty"`
+	LastUpdate *indexdb.CodeIndexUpdate `json:"lastUpdate,omitempty"`
+	LastError  string                   `json:"lastError,omitempty"`
+}
+
+func (s *IndexService) setStatus(projectID uint, fn func(st *IndexStatus)) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	st, ok := s.status[projectID]
+	if !ok {
+		st = &IndexStatus{ProjectID: projectID}
+		s.status[projectID] = st
+	}
+	fn(st)
+}
+
+// Status 返回项目的索引状态；进程内没有记录时从索引库读取
+func (s *IndexService) Status(projectID uint) (*IndexStatus, error) {
+	if _, err := s.projectRepo.GetByID(projectID); err != nil {
+		return nil, err
+	}
+	s.statusMu.Lock()
+	st := IndexStatus{ProjectID: projectID, State: "none"}
+	if cur, ok := s.status[projectID]; ok {
+		st = *cur
+	}
+	s.statusMu.Unlock()
+
+	st.Watching = s.watcher != nil && s.watcher.Watching(projectID)
+	if st.State != "indexing" {
+		info, err := indexdb.GetProjectCodeIndexInfo(projectID)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			if st.State == "none" {
+				st.State = "ready"
+			}
+			st.Files, st.IndexedAt, st.Version = info.Files, info.IndexedAt, info.Version
+		}
+	}
+	return &st, nil
+}
+
+// SetWatcher 关联文件监听器，用于在状态中报告是否在监听
+func (s *IndexService) SetWatcher(w *IndexWatcher) {
+	s.watcher = w
+}
+
+// SetHookService 设置索引完成时触发 index_complete 钩子的服务
+func (s *IndexService) SetHookService(h *HookService) {
+	s.hooks = h
+}
+
+// syncProject 增量更新项目的代码索引并记录状态
+func (s *IndexService) syncProject(p *model.Project, files []string) (*indexdb.ProjectCodeIndexInfo, *indexdb.CodeIndexUpdate, error) {
+	files = filterIndexFiles(files, projectSettings(p))
+	s.setStatus(p.ID, func(st *IndexStatus) { st.State = "indexing" })
+	info, upd, err := indexdb.SyncProjectCodeFiles(p.ID, p.Path, files)
+	s.setStatus(p.ID, func(st *IndexStatus) {
+		if err != nil {
+			st.State, st.LastError = "error", err.Error()
+			return
+		}
+		st.State, st.LastError, st.LastUpdate = "ready", "", upd
+		st.Files, st.IndexedAt, st.Version = info.Files, info.IndexedAt, info.Version
+	})
+	if err == nil && upd != nil && s.hooks != nil {
+		s.hooks.Notify(model.HookIndexComplete, "", 0, map[string]any{
+			"projectId":  p.ID,
+			"files":      info.Files,
+			"full":       upd.Full,
+			"added":      upd.Added,
+			"updated":    upd.Updated,
+			"removed":    upd.Removed,
+			"durationMs": upd.Duration,
+		})
+	}
+	return info, upd, err
+}
+
+// filterIndexFiles 按项目设置的 indexInclude / indexExclude 过滤文件
+func filterIndexFiles(files []string, settings model.ProjectSettings) []string {
+	if len(settings.IndexInclude) == 0 && len(settings.IndexExclude) == 0 {
+		return files
+	}
+	matchAny := func(globs []string, rel string) bool {
+		for _, g := range globs {
+			if tools.MatchPathGlob(g, rel) {
+				return true
+			}
+		}
+		return false
+	}
+	var out []string
+	for _, rel := range files {
+		rel = filepath.ToSlash(rel)
+		if len(settings.IndexInclude) > 0 && !matchAny(settings.IndexInclude, rel) {
+			continue
+		}
+		if matchAny(settings.IndexExclude, rel) {
+			continue
+		}
+		out = append(out, rel)
+	}
+	return out
+}
+
+// projectFiles 列出项目中需要索引的文件：优先使用 git 跟踪的文件，否则遍历目录
+func projectFiles(projectPath string) ([]string, error) {
+	files, ferr := listCommittableFiles(projectPath)
+	if ferr != nil {
+		var werr error
+		files, werr = walkProjectFiles(projectPath)
+		if werr != nil {
+			return nil, fmt.Errorf("无法获取项目文件列表: %v (git) / %v (walk)", ferr, werr)
+		}
+	}
+	return files, nil
 }
 
 func (s *IndexService) IndexProject(projectID uint) (*IndexResult, error) {
@@ -49,25 +186,27 @@ func (s *IndexService) IndexProject(projectID uint) (*IndexResult, error) {
 	if !containsUint(ids, p.ID) {
 		return nil, fmt.Errorf("索引校验失败：无法通过项目名检索到 projectId=%d", p.ID)
 	}
-	files, ferr := listCommittableFiles(p.Path)
-	if ferr != nil {
-		var werr error
-		files, werr = walkProjectFiles(p.Path)
-		if werr != nil {
-			return nil, fmt.Errorf("无法获取项目文件列表: %v (git) / %v (walk)", ferr, werr)
-		}
+	files, err := projectFiles(p.Path)
+	if err != nil {
+		return nil, err
 	}
 	if len(files) == 0 {
 		return nil, fmt.Errorf("项目目录下没有找到可索引的文件")
 	}
-	codeInfo, cerr := indexdb.IndexProjectCodeFiles(p.ID, p.Path, files)
-	if cerr != nil {
-		return nil, cerr
+	codeInfo, upd, err := s.syncProject(p, files)
+	if err != nil {
+		return nil, err
+	}
+	if s.watcher != nil && !s.watcher.Watching(p.ID) {
+		if werr := s.watcher.Watch(p); werr != nil {
+			slog.Warn("index watcher: cannot watch project", "project", p.ID, "error", werr)
+		}
 	}
 	return &IndexResult{
 		Indexed: 1,
 		Files:   codeInfo.Files,
 		DBPath:  indexdb.OpenedPath(),
+		Update:  upd,
 	}, nil
 }
 
@@ -77,22 +216,16 @@ func (s *IndexService) IndexAllProjects() (*IndexResult, error) {
 		return nil, err
 	}
 	totalFiles := 0
-	for _, p := range projects {
+	for i := range projects {
+		p := &projects[i]
 		if err := indexdb.IndexProject(p.ID, p.Name, p.Path); err != nil {
 			return nil, err
 		}
-		files, ferr := listCommittableFiles(p.Path)
-		if ferr != nil {
-			var werr error
-			files, werr = walkProjectFiles(p.Path)
-			if werr != nil {
-				continue
-			}
-		}
-		if len(files) == 0 {
+		files, ferr := projectFiles(p.Path)
+		if ferr != nil || len(files) == 0 {
 			continue
 		}
-		codeInfo, cerr := indexdb.IndexProjectCodeFiles(p.ID, p.Path, files)
+		codeInfo, _, cerr := s.syncProject(p, files)
 		if cerr != nil {
 			return nil, cerr
 		}
@@ -105,6 +238,33 @@ func (s *IndexService) IndexAllProjects() (*IndexResult, error) {
 	}, nil
 }
 
+// SearchCode 在项目代码索引中检索；索引不存在或版本过旧时先重建索引。
+func (s *IndexService) SearchCode(projectID uint, query string, opts indexdb.CodeSearchOptions) (*indexdb.CodeSearchResult, error) {
+	p, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := indexdb.GetProjectCodeIndexInfo(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil || info.Version < indexdb.CodeIndexVersion {
+		if _, err := s.IndexProject(p.ID); err != nil {
+			return nil, err
+		}
+	}
+	return indexdb.SearchCode(p.ID, p.Path, query, opts)
+}
+
+// RepoMap 生成项目的仓库结构图，与注入系统提示词的内容一致
+func (s *IndexService) RepoMap(projectID uint, maxTokens int) (*tools.RepoMap, error) {
+	p, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return tools.BuildRepoMap(p.Path, tools.RepoMapOptions{MaxTokens: maxTokens})
+}
+
 func (s *IndexService) SearchSessionsByProjectName(query string) ([]SessionWithProject, error) {
 	q := strings.TrimSpace(query)
 	if q == "" {
@@ -217,12 +377,8 @@ func walkProjectFiles(projectPath string) ([]string, error) {
 		if err != nil {
 			return nil
 		}
-		name := d.Name()
 		if d.IsDir() {
-			if name == ".git" || name == "node_modules" || name == "dist" || name == "vendor" {
-				return filepath.SkipDir
-			}
-			if strings.HasPrefix(name, ".") && name != "." {
+			if path != root && skipIndexDir(d.Name()) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -236,3 +392,12 @@ func walkProjectFiles(projectPath string) ([]string, error) {
 	})
 	return files, err
 }
+
+// skipIndexDir 判断遍历项目时是否跳过该目录（依赖、构建产物和隐藏目录）
+func skipIndexDir(name string) bool {
+	switch name {
+	case ".git", "node_modules", "dist", "vendor":
+		return true
+	}
+	return strings.HasPrefix(name, ".") && name != "."
+}
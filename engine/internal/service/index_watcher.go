@@ -0,0 +1,258 @@
+package service
+
+import (
+	"fmt"
+	"iat/common/model"
+	"iat/engine/internal/repo"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// IndexWatcher 监听项目目录的文件变化，防抖后增量更新代码索引。
+// fsnotify 不支持递归监听，所以每个目录单独注册；.git 目录只监听顶层，
+// 用来感知 git add / checkout 等改变跟踪文件列表的操作。
+type IndexWatcher struct {
+	svc         *IndexService
+	projectRepo *repo.ProjectRepo
+	fsw         *fsnotify.Watcher
+	debounce    time.Duration
+
+	mu     sync.Mutex
+	roots  map[uint]string      // projectID -> project root
+	dirs   map[string]uint      // watched directory -> projectID
+	timers map[uint]*time.Timer // pending index runs
+	done   chan struct{}
+}
+
+func NewIndexWatcher(svc *IndexService) (*IndexWatcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &IndexWatcher{
+		svc:         svc,
+		projectRepo: repo.NewProjectRepo(),
+		fsw:         fsw,
+		debounce:    time.Second,
+		roots:       make(map[uint]string),
+		dirs:        make(map[string]uint),
+		timers:      make(map[uint]*time.Timer),
+		done:        make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// WatchAll 监听所有项目
+func (w *IndexWatcher) WatchAll() error {
+	projects, err := w.projectRepo.List()
+	if err != nil {
+		return err
+	}
+	for i := range projects {
+		if err := w.Watch(&projects[i]); err != nil {
+			slog.Warn("index watcher: cannot watch project", "project", projects[i].ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// Watch 开始监听项目目录，并立即做一次增量索引
+func (w *IndexWatcher) Watch(p *model.Project) error {
+	root := filepath.Clean(p.Path)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("项目路径不存在或不是目录: %s", p.Path)
+	}
+	w.mu.Lock()
+	if cur, ok := w.roots[p.ID]; ok && cur == root {
+		w.mu.Unlock()
+		return nil
+	}
+	w.mu.Unlock()
+	w.Unwatch(p.ID)
+
+	w.mu.Lock()
+	w.roots[p.ID] = root
+	w.mu.Unlock()
+	if err := w.addTree(p.ID, root); err != nil {
+		w.Unwatch(p.ID)
+		return err
+	}
+	if info, err := os.Stat(filepath.Join(root, ".git")); err == nil && info.IsDir() {
+		w.addDir(p.ID, filepath.Join(root, ".git"))
+	}
+	w.schedule(p.ID)
+	return nil
+}
+
+// Unwatch 停止监听项目
+func (w *IndexWatcher) Unwatch(projectID uint) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.roots[projectID]; !ok {
+		return
+	}
+	delete(w.roots, projectID)
+	for dir, id := range w.dirs {
+		if id == projectID {
+			_ = w.fsw.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+	if t, ok := w.timers[projectID]; ok {
+		t.Stop()
+		delete(w.timers, projectID)
+	}
+}
+
+func (w *IndexWatcher) Watching(projectID uint) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.roots[projectID]
+	return ok
+}
+
+func (w *IndexWatcher) Close() error {
+	w.mu.Lock()
+	for id, t := range w.timers {
+		t.Stop()
+		delete(w.timers, id)
+	}
+	w.mu.Unlock()
+	close(w.done)
+	return w.fsw.Close()
+}
+
+func (w *IndexWatcher) addTree(projectID uint, root string) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != root && skipIndexDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		w.addDir(projectID, path)
+		return nil
+	})
+}
+
+func (w *IndexWatcher) addDir(projectID uint, dir string) {
+	if err := w.fsw.Add(dir); err != nil {
+		slog.Warn("index watcher: cannot watch directory", "dir", dir, "error", err)
+		return
+	}
+	w.mu.Lock()
+	w.dirs[dir] = projectID
+	w.mu.Unlock()
+}
+
+func (w *IndexWatcher) loop() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(ev)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("index watcher error", "error", err)
+		}
+	}
+}
+
+func (w *IndexWatcher) handle(ev fsnotify.Event) {
+	dir := filepath.Dir(ev.Name)
+	w.mu.Lock()
+	projectID, ok := w.dirs[dir]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// .git 目录里只关心暂存区和 HEAD 的变化
+	if filepath.Base(dir) == ".git" {
+		if name := filepath.Base(ev.Name); name != "index" && name != "HEAD" {
+			return
+		}
+		w.schedule(projectID)
+		return
+	}
+
+	if ev.Has(fsnotify.Create) {
+		if info, err := os.Stat(ev.Name); err == nil && info.IsDir() && !skipIndexDir(info.Name()) {
+			if err := w.addTree(projectID, ev.Name); err != nil {
+				slog.Warn("index watcher: cannot watch directory", "dir", ev.Name, "error", err)
+			}
+		}
+	}
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		w.mu.Lock()
+		prefix := ev.Name + string(filepath.Separator)
+		for d := range w.dirs {
+			if d == ev.Name || strings.HasPrefix(d, prefix) {
+				delete(w.dirs, d)
+			}
+		}
+		w.mu.Unlock()
+	}
+	if ev.Has(fsnotify.Chmod) && !ev.Has(fsnotify.Write) {
+		return
+	}
+	w.schedule(projectID)
+}
+
+// schedule 在防抖时间后增量更新项目索引，期间的新事件会推迟执行
+func (w *IndexWatcher) schedule(projectID uint) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t, ok := w.timers[projectID]; ok {
+		t.Reset(w.debounce)
+		return
+	}
+	w.timers[projectID] = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		delete(w.timers, projectID)
+		root, watching := w.roots[projectID]
+		w.mu.Unlock()
+		if watching {
+			w.sync(projectID, root)
+		}
+	})
+}
+
+func (w *IndexWatcher) sync(projectID uint, root string) {
+	p, err := w.projectRepo.GetByID(projectID)
+	if err != nil {
+		// 项目已删除
+		w.Unwatch(projectID)
+		return
+	}
+	if filepath.Clean(p.Path) != root {
+		// 项目路径变了，重新监听
+		if err := w.Watch(p); err != nil {
+			w.Unwatch(projectID)
+		}
+		return
+	}
+	files, err := projectFiles(p.Path)
+	if err != nil {
+		w.svc.setStatus(p.ID, func(st *IndexStatus) { st.State, st.LastError = "error", err.Error() })
+		return
+	}
+	if _, upd, err := w.svc.syncProject(p, files); err != nil {
+		slog.Warn("index watcher: index update failed", "project", p.ID, "error", err)
+	} else if upd.Added+upd.Updated+upd.Removed > 0 {
+		slog.Info("index watcher: index updated", "project", p.ID, "added", upd.Added, "updated", upd.Updated, "removed", upd.Removed)
+	}
+}
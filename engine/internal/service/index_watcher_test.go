@@ -0,0 +1,75 @@
+package service
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/db"
+	"iat/engine/pkg/indexdb"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIndexWatcher_UpdatesIndex(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Project{})
+	db.DB = d
+	_ = os.Setenv("IAT_INDEXDB_DIR", filepath.Join(t.TempDir(), "indexdb"))
+	defer func() { _ = indexdb.CloseDefault() }()
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.go"), []byte("package a\n\nfunc Alpha() {}\n"), 0644)
+	p := &model.Project{Name: "watched", Path: root}
+	d.Create(p)
+
+	w, err := NewIndexWatcher(NewIndexService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.debounce = 20 * time.Millisecond
+	if err := w.Watch(p); err != nil {
+		t.Fatal(err)
+	}
+
+	hits := func(query string) int {
+		res, err := indexdb.SearchCode(p.ID, root, query, indexdb.CodeSearchOptions{})
+		if err != nil {
+			return -1
+		}
+		return len(res.Hits)
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	// Watch 立即做一次索引
+	waitFor("initial index", func() bool { return hits("alpha") == 1 })
+
+	// 新建目录里的文件也会被监听到
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	time.Sleep(50 * time.Millisecond)
+	os.WriteFile(filepath.Join(root, "sub", "b.go"), []byte("package sub\n\nfunc Bravo() {}\n"), 0644)
+	waitFor("new file in new directory", func() bool { return hits("bravo") == 1 })
+
+	os.Remove(filepath.Join(root, "a.go"))
+	waitFor("removed file", func() bool { return hits("alpha") == 0 })
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	os.WriteFile(filepath.Join(root, "c.go"), []byte("package a\n\nfunc Charlie() {}\n"), 0644)
+	time.Sleep(100 * time.Millisecond)
+	if n := hits("charlie"); n != 0 {
+		t.Fatalf("closed watcher must not update the index, got %d hits", n)
+	}
+}
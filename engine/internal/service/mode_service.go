@@ -1,10 +1,16 @@
 package service
 
 import (
+	"fmt"
 	"iat/common/model"
 	"iat/engine/internal/repo"
+	"iat/engine/pkg/tools/builtin"
+	"strings"
 )
 
+// maxModeDepth bounds inheritance chains.
+const maxModeDepth = 8
+
 type ModeService struct {
 	repo *repo.ModeRepo
 }
@@ -15,32 +21,122 @@ func NewModeService() *ModeService {
 	}
 }
 
-func (s *ModeService) CreateMode(key, name, description, systemPrompt string) error {
-	mode := &model.Mode{
-		Key:          key,
-		Name:         name,
-		Description:  description,
-		SystemPrompt: systemPrompt,
+func (s *ModeService) CreateMode(mode *model.Mode) error {
+	if err := s.validate(mode); err != nil {
+		return err
 	}
 	return s.repo.Create(mode)
 }
 
-func (s *ModeService) UpdateMode(id uint, key, name, description, systemPrompt string) error {
-	mode, err := s.repo.GetByID(id)
-	if err != nil {
+func (s *ModeService) UpdateMode(mode *model.Mode) error {
+	if _, err := s.repo.GetByID(mode.ID); err != nil {
+		return err
+	}
+	if err := s.validate(mode); err != nil {
 		return err
 	}
-	mode.Key = key
-	mode.Name = name
-	mode.Description = description
-	mode.SystemPrompt = systemPrompt
 	return s.repo.Update(mode)
 }
 
 func (s *ModeService) DeleteMode(id uint) error {
+	mode, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	modes, err := s.repo.List()
+	if err != nil {
+		return err
+	}
+	for _, m := range modes {
+		if m.ParentKey == mode.Key {
+			return fmt.Errorf("mode %s is the parent of %s", mode.Key, m.Key)
+		}
+	}
 	return s.repo.Delete(id)
 }
 
+func (s *ModeService) GetMode(id uint) (*model.Mode, error) {
+	return s.repo.GetByID(id)
+}
+
 func (s *ModeService) ListModes() ([]model.Mode, error) {
 	return s.repo.List()
 }
+
+// Resolve returns the mode with key combined with its ancestors.
+func (s *ModeService) Resolve(key string) (*model.Mode, error) {
+	return resolveMode(s.repo, key)
+}
+
+func (s *ModeService) validate(mode *model.Mode) error {
+	if strings.TrimSpace(mode.Key) == "" {
+		return fmt.Errorf("mode key is required")
+	}
+	if _, err := mode.GetPathPolicy(); err != nil {
+		return fmt.Errorf("invalid path policy: %v", err)
+	}
+	if _, err := mode.GetToolPolicy(); err != nil {
+		return fmt.Errorf("invalid tool policy: %v", err)
+	}
+	if mode.MaxTurns < 0 {
+		return fmt.Errorf("maxTurns must not be negative")
+	}
+	// Walk up from the parent; reaching the mode itself means a cycle.
+	seen := map[string]bool{mode.Key: true}
+	for parent, depth := mode.ParentKey, 0; parent != ""; depth++ {
+		if seen[parent] {
+			return fmt.Errorf("mode %s cannot inherit from itself", mode.Key)
+		}
+		if depth >= maxModeDepth {
+			return fmt.Errorf("mode inheritance is deeper than %d levels", maxModeDepth)
+		}
+		seen[parent] = true
+		p, err := s.repo.GetByKey(parent)
+		if err != nil {
+			return fmt.Errorf("parent mode %s not found", parent)
+		}
+		parent = p.ParentKey
+	}
+	return nil
+}
+
+// resolveMode loads a mode by key (as given, then upper-cased since the
+// built-in modes are stored as CHAT/PLAN/BUILD) together with its ancestors
+// and combines them with model.ResolveMode. When no mode in the chain lists
+// builtin tools, the root ancestor's built-in defaults are used.
+func resolveMode(r *repo.ModeRepo, key string) (*model.Mode, error) {
+	if key == "" {
+		return nil, fmt.Errorf("mode key is empty")
+	}
+	m, err := r.GetByKey(key)
+	if err != nil {
+		if m, err = r.GetByKey(strings.ToUpper(key)); err != nil {
+			return nil, fmt.Errorf("mode %s not found", key)
+		}
+	}
+
+	chain := []model.Mode{*m}
+	seen := map[string]bool{m.Key: true}
+	for parent := m.ParentKey; parent != "" && len(chain) < maxModeDepth && !seen[parent]; {
+		p, err := r.GetByKey(parent)
+		if err != nil {
+			return nil, fmt.Errorf("mode %s: parent mode %s not found", m.Key, parent)
+		}
+		seen[parent] = true
+		chain = append([]model.Mode{*p}, chain...)
+		parent = p.ParentKey
+	}
+
+	resolved := model.ResolveMode(chain)
+	policy, err := resolved.GetToolPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("mode %s: invalid tool policy: %v", m.Key, err)
+	}
+	if len(policy.Builtins) == 0 {
+		for _, info := range builtin.GetEinoTools(chain[0].Key) {
+			policy.Builtins = append(policy.Builtins, info.Name)
+		}
+		_ = resolved.SetToolPolicy(policy)
+	}
+	return resolved, nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"encoding/json"
 	"iat/common/model"
 	"iat/engine/internal/repo"
 )
@@ -15,16 +16,33 @@ func NewProjectService() *ProjectService {
 	}
 }
 
-func (s *ProjectService) CreateProject(name, description, path string) error {
+func (s *ProjectService) CreateProject(name, description, path string, httpAllowlist []string, pathPolicy *model.PathPolicy, settings *model.ProjectSettings) error {
 	project := &model.Project{
 		Name:        name,
 		Description: description,
 		Path:        path,
 	}
+	if httpAllowlist != nil {
+		raw, _ := json.Marshal(httpAllowlist)
+		project.HttpAllowlist = string(raw)
+	}
+	if pathPolicy != nil {
+		if err := project.SetPathPolicy(*pathPolicy); err != nil {
+			return err
+		}
+	}
+	if settings != nil {
+		if err := project.SetSettings(*settings); err != nil {
+			return err
+		}
+	}
 	return s.repo.Create(project)
 }
 
-func (s *ProjectService) UpdateProject(id uint, name, description, path string) error {
+// UpdateProject updates the basic project fields. A nil httpAllowlist,
+// pathPolicy or settings leaves the stored value unchanged so older clients
+// don't wipe it.
+func (s *ProjectService) UpdateProject(id uint, name, description, path string, httpAllowlist []string, pathPolicy *model.PathPolicy, settings *model.ProjectSettings) error {
 	project, err := s.repo.GetByID(id)
 	if err != nil {
 		return err
@@ -32,6 +50,20 @@ func (s *ProjectService) UpdateProject(id uint, name, description, path string)
 	project.Name = name
 	project.Description = description
 	project.Path = path
+	if httpAllowlist != nil {
+		raw, _ := json.Marshal(httpAllowlist)
+		project.HttpAllowlist = string(raw)
+	}
+	if pathPolicy != nil {
+		if err := project.SetPathPolicy(*pathPolicy); err != nil {
+			return err
+		}
+	}
+	if settings != nil {
+		if err := project.SetSettings(*settings); err != nil {
+			return err
+		}
+	}
 	return s.repo.Update(project)
 }
 
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iat/common/model"
+	"iat/common/pkg/chat"
+	"iat/common/pkg/script"
+	"iat/common/pkg/tools"
+	"iat/engine/internal/repo"
+	"iat/engine/pkg/ai"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// MaxScriptToolDepth limits script tools calling script tools through
+// iat.tools.call.
+const MaxScriptToolDepth = 4
+
+// AgentRunner runs an agent as a sub-agent; implemented by ChatService.
+type AgentRunner interface {
+	RunAgentInternal(ctx context.Context, sessionID uint, agentName string, userMessage string, projectRoot string, mode string, depth int, parentTaskID string, eventChan chan<- chat.ChatEvent) (string, error)
+}
+
+type scriptDepthKey struct{}
+
+type subAgentDepthKey struct{}
+
+func withSubAgentDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, subAgentDepthKey{}, depth)
+}
+
+// nextSubAgentDepth is the depth of a sub-agent started from ctx: 0 from a
+// top level chat, one more than the running sub-agent's otherwise.
+func nextSubAgentDepth(ctx context.Context) int {
+	if d, ok := ctx.Value(subAgentDepthKey{}).(int); ok {
+		return d + 1
+	}
+	return 0
+}
+
+func scriptDepth(ctx context.Context) int {
+	d, _ := ctx.Value(scriptDepthKey{}).(int)
+	return d
+}
+
+// scriptHost implements the iat script module for a script tool. Everything
+// goes through the same checks as a tool call of the agent that called the
+// script tool.
+type scriptHost struct {
+	tools *ToolService
+	tc    *ToolCallContext
+	depth int // script tool nesting of the tool running this script
+}
+
+func (h *scriptHost) CallTool(ctx context.Context, name string, args map[string]any) (string, error) {
+	infos := h.tc.Tools
+	if infos == nil {
+		infos = h.tools.EffectiveTools(h.tc.Agent, h.tc.Mode)
+	}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	// 脚本发起的调用与模型发起的一样经过 pre_tool/post_tool 钩子
+	rawArgs, err := h.tools.PreToolHooks(ctx, name, string(raw), h.tc)
+	if err != nil {
+		return "", err
+	}
+	if args, err = tools.ParseToolArgs(name, rawArgs); err != nil {
+		return "", err
+	}
+	if err := validateAgainstInfos(name, args, infos); err != nil {
+		return "", err
+	}
+	started := time.Now()
+	res, err := h.tools.Call(context.WithValue(ctx, scriptDepthKey{}, h.depth), name, args, h.tc)
+	h.tools.RecordResult(h.tc.SessionID, name, err == nil)
+	if err != nil {
+		h.tools.PostToolHooks(ctx, name, rawArgs, fmt.Sprintf("Error: %v", err), err, started, h.tc)
+		return res, err
+	}
+	return h.tools.PostToolHooks(ctx, name, rawArgs, res, nil, started, h.tc), nil
+}
+
+// require checks that the calling agent may use the builtin tool backing an
+// iat function.
+func (h *scriptHost) require(tool string) error {
+	if !h.tools.toolAllowed(tool, h.tc) {
+		return fmt.Errorf("%s is not available to agent %s", tool, h.tc.Agent.Name)
+	}
+	return h.tools.checkApproval(tool, h.tc)
+}
+
+func (h *scriptHost) RunAgent(ctx context.Context, name, query string) (string, error) {
+	if h.tools.agents == nil {
+		return "", fmt.Errorf("agents are not available to scripts")
+	}
+	if err := h.require("call_subagent"); err != nil {
+		return "", err
+	}
+	// 脚本工具运行自己的智能体会无限递归
+	if h.tc.Agent != nil && h.tc.Agent.Name == name {
+		return "", fmt.Errorf("agent %s cannot run itself from its own script tool", name)
+	}
+	mode := ""
+	if h.tc.Mode != nil {
+		mode = h.tc.Mode.Key
+	}
+	return h.tools.agents.RunAgentInternal(ctx, h.tc.SessionID, name, query, h.tc.ProjectRoot(), mode, nextSubAgentDepth(ctx), "", nil)
+}
+
+// Chat asks the agent's model, or a configured model by name unless the
+// project pins the model.
+func (h *scriptHost) Chat(ctx context.Context, messages []script.ChatMessage, modelName string) (string, error) {
+	if len(messages) == 0 {
+		return "", fmt.Errorf("messages are required")
+	}
+	modelRepo := repo.NewAIModelRepo()
+	var (
+		cfg *model.AIModel
+		err error
+	)
+	switch {
+	case modelName != "":
+		models, lerr := modelRepo.List()
+		if lerr != nil {
+			return "", lerr
+		}
+		for i := range models {
+			if models[i].Name == modelName {
+				cfg = &models[i]
+				break
+			}
+		}
+		if cfg == nil {
+			return "", fmt.Errorf("model %q not found", modelName)
+		}
+		if pinned := h.tc.Settings().ModelID; pinned != 0 && cfg.ID != pinned {
+			return "", fmt.Errorf("model %q is not allowed in this project", modelName)
+		}
+	case h.tc.Agent != nil && h.tc.Agent.ModelID != 0:
+		cfg, err = modelRepo.GetByID(h.tc.Agent.ModelID)
+	default:
+		cfg, err = modelRepo.GetDefault()
+	}
+	if err != nil || cfg == nil {
+		return "", fmt.Errorf("model config not found")
+	}
+
+	client, err := ai.NewAIClient(cfg, nil)
+	if err != nil {
+		return "", err
+	}
+	msgs := make([]*schema.Message, 0, len(messages))
+	for _, m := range messages {
+		role := schema.RoleType(m.Role)
+		switch role {
+		case schema.System, schema.User, schema.Assistant:
+		case "":
+			role = schema.User
+		default:
+			return "", fmt.Errorf("unsupported message role %q", m.Role)
+		}
+		msgs = append(msgs, &schema.Message{Role: role, Content: m.Content})
+	}
+	resp, err := client.Chat(ctx, msgs)
+	if err != nil {
+		return "", err
+	}
+	return stripThinkContent(resp.Content), nil
+}
+
+func (h *scriptHost) taskService() (*TaskService, error) {
+	if h.tools.tasks == nil || h.tc.SessionID == 0 {
+		return nil, fmt.Errorf("tasks are only available in a session")
+	}
+	if err := h.require("manage_tasks"); err != nil {
+		return nil, err
+	}
+	return h.tools.tasks, nil
+}
+
+func (h *scriptHost) ListTasks(ctx context.Context) ([]model.Task, error) {
+	ts, err := h.taskService()
+	if err != nil {
+		return nil, err
+	}
+	return ts.ListTasks(h.tc.SessionID)
+}
+
+func (h *scriptHost) AddTask(ctx context.Context, content, priority string, parentID *uint) (*model.Task, error) {
+	ts, err := h.taskService()
+	if err != nil {
+		return nil, err
+	}
+	if priority == "" {
+		priority = "medium"
+	}
+	return ts.CreateTask(h.tc.SessionID, content, priority, parentID)
+}
+
+func (h *scriptHost) UpdateTask(ctx context.Context, id uint, status string) error {
+	ts, err := h.sessionTask(id)
+	if err != nil {
+		return err
+	}
+	return ts.UpdateTask(id, status)
+}
+
+func (h *scriptHost) DeleteTask(ctx context.Context, id uint) error {
+	ts, err := h.sessionTask(id)
+	if err != nil {
+		return err
+	}
+	return ts.DeleteTask(id)
+}
+
+// sessionTask makes sure task id belongs to the caller's session.
+func (h *scriptHost) sessionTask(id uint) (*TaskService, error) {
+	ts, err := h.taskService()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := ts.ListTasks(h.tc.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		if t.ID == id {
+			return ts, nil
+		}
+	}
+	return nil, fmt.Errorf("task %d not found in this session", id)
+}
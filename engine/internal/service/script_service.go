@@ -1,33 +1,50 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"iat/common/model"
 	"iat/common/pkg/script"
 	"iat/engine/internal/repo"
+	"log/slog"
+	"time"
 )
 
+// ScriptRunHistory is how many runs are kept per script, script tool and
+// hook.
+const ScriptRunHistory = 100
+
 type ScriptService struct {
-	repo   *repo.ScriptRepo
-	engine *script.ScriptEngine
+	repo    *repo.ScriptRepo
+	runRepo *repo.ScriptRunRepo
 }
 
 func NewScriptService() *ScriptService {
 	return &ScriptService{
-		repo:   repo.NewScriptRepo(),
-		engine: script.NewScriptEngine(),
+		repo:    repo.NewScriptRepo(),
+		runRepo: repo.NewScriptRunRepo(),
 	}
 }
 
-func (s *ScriptService) CreateScript(name, description, content string) error {
+func (s *ScriptService) CreateScript(name, description, content, language string, caps *model.ScriptCapabilities) error {
 	script := &model.Script{
 		Name:        name,
 		Description: description,
 		Content:     content,
+		Language:    language,
+	}
+	if err := checkScriptSource(language, content, name); err != nil {
+		return err
+	}
+	if err := setScriptCapabilities(script, caps); err != nil {
+		return err
 	}
 	return s.repo.Create(script)
 }
 
-func (s *ScriptService) UpdateScript(id uint, name, description, content string) error {
+// UpdateScript updates a script; nil caps keeps the current capabilities.
+func (s *ScriptService) UpdateScript(id uint, name, description, content, language string, caps *model.ScriptCapabilities) error {
 	script, err := s.repo.GetByID(id)
 	if err != nil {
 		return err
@@ -35,9 +52,38 @@ func (s *ScriptService) UpdateScript(id uint, name, description, content string)
 	script.Name = name
 	script.Description = description
 	script.Content = content
+	script.Language = language
+	if err := checkScriptSource(language, content, name); err != nil {
+		return err
+	}
+	if err := setScriptCapabilities(script, caps); err != nil {
+		return err
+	}
 	return s.repo.Update(script)
 }
 
+// checkScriptSource rejects unknown languages and TypeScript that doesn't
+// transpile, reporting the TS diagnostics when saving.
+func checkScriptSource(language, content, name string) error {
+	switch language {
+	case "", model.ScriptLangJavaScript, model.ScriptLangTypeScript:
+	default:
+		return fmt.Errorf("unknown script language %q (expected %q or %q)", language, model.ScriptLangJavaScript, model.ScriptLangTypeScript)
+	}
+	_, err := script.Compile(language, content, name+".ts")
+	return err
+}
+
+func setScriptCapabilities(sc *model.Script, caps *model.ScriptCapabilities) error {
+	if caps == nil {
+		return nil
+	}
+	if _, err := script.GrantsFor(*caps, ""); err != nil {
+		return err
+	}
+	return sc.SetCapabilities(*caps)
+}
+
 func (s *ScriptService) DeleteScript(id uint) error {
 	return s.repo.Delete(id)
 }
@@ -46,14 +92,97 @@ func (s *ScriptService) ListScripts() ([]model.Script, error) {
 	return s.repo.List()
 }
 
-func (s *ScriptService) RunScript(id uint) (interface{}, error) {
+func (s *ScriptService) GetScript(id uint) (*model.Script, error) {
+	return s.repo.GetByID(id)
+}
+
+// RunScript runs a stored script with args as the args global and returns
+// the recorded run; a failing script is a run with an error, not an error.
+// The run is cancelled with ctx.
+func (s *ScriptService) RunScript(ctx context.Context, id uint, args map[string]any) (*model.ScriptRun, error) {
 	sc, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
-	val, err := s.engine.Run(sc.Content)
+	engine, err := scriptEngineFor(sc.Capabilities, "")
 	if err != nil {
 		return nil, err
 	}
-	return val, nil
+	if args == nil {
+		args = map[string]any{}
+	}
+	engine.RegisterGlobal("args", args)
+	run := &model.ScriptRun{Source: model.ScriptRunManual, SourceID: sc.ID, Name: sc.Name}
+	executeScript(ctx, engine, sc.Language, sc.Content, script.DefaultLimits, run, args)
+	return run, nil
+}
+
+// ListRuns returns the newest runs of a stored script.
+func (s *ScriptService) ListRuns(id uint, limit int) ([]model.ScriptRun, error) {
+	return s.ListRunsBySource(model.ScriptRunManual, id, limit)
+}
+
+// ListRunsBySource returns the newest runs of a script, script tool or hook
+// (source is one of the model.ScriptRun* sources).
+func (s *ScriptService) ListRunsBySource(source string, id uint, limit int) ([]model.ScriptRun, error) {
+	switch source {
+	case model.ScriptRunManual, model.ScriptRunTool, model.ScriptRunHook:
+	default:
+		return nil, fmt.Errorf("unknown script run source %q", source)
+	}
+	return s.runRepo.ListBySource(source, id, limit)
+}
+
+// executeScript runs content written in language within limits and records
+// the run in the history; run says what was run and is filled with the
+// outcome. input is stored as the run's arguments. Cancelling ctx stops the
+// script.
+func executeScript(ctx context.Context, engine *script.ScriptEngine, language, content string, limits script.Limits, run *model.ScriptRun, input any) (any, error) {
+	var res *script.RunResult
+	if code, err := script.Compile(language, content, run.Name+".ts"); err != nil {
+		now := time.Now()
+		res = &script.RunResult{Err: err, StartedAt: now, EndedAt: now}
+	} else {
+		res = engine.RunContext(ctx, code, limits)
+	}
+
+	run.StartedAt = res.StartedAt
+	run.EndedAt = res.EndedAt
+	run.DurationMs = res.EndedAt.Sub(res.StartedAt).Milliseconds()
+	run.Args = jsonText(input)
+	switch {
+	case res.TimedOut:
+		run.Status = model.ScriptRunTimeout
+	case res.Cancelled:
+		run.Status = model.ScriptRunCancelled
+	case res.Err != nil:
+		run.Status = model.ScriptRunError
+	default:
+		run.Status = model.ScriptRunOK
+		run.Result = jsonText(res.Value)
+	}
+	if res.Err != nil {
+		run.Error = res.Err.Error()
+		run.Stack = res.Stack
+	}
+	_ = run.SetConsole(res.Console)
+
+	runRepo := repo.NewScriptRunRepo()
+	if err := runRepo.Create(run); err != nil {
+		slog.Warn("failed to record script run", slog.String("source", run.Source), slog.String("name", run.Name), slog.Any("error", err))
+	} else if err := runRepo.Prune(run.Source, run.SourceID, ScriptRunHistory); err != nil {
+		slog.Warn("failed to prune script runs", slog.String("source", run.Source), slog.Any("error", err))
+	}
+	return res.Value, res.Err
+}
+
+func jsonText(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
 }
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"iat/common/model"
+	"iat/common/pkg/db"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestScriptService_RunHistory(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Script{}, &model.ScriptRun{})
+	db.DB = d
+
+	svc := NewScriptService()
+	if err := svc.CreateScript("greet", "", `console.log("hi", args.name); ({greeting: "hello " + args.name})`, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateScript("broken", "", "null.x", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := svc.RunScript(context.Background(), 1, map[string]any{"name": "ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	console, _ := run.GetConsole()
+	if run.Status != model.ScriptRunOK || run.Result != `{"greeting":"hello ada"}` || run.Args != `{"name":"ada"}` || len(console) != 1 || console[0].Text != "hi ada" {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+
+	run, err = svc.RunScript(context.Background(), 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != model.ScriptRunError || !strings.Contains(run.Error, "TypeError") || run.Stack == "" {
+		t.Fatalf("unexpected failed run: %+v", run)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	run, err = svc.RunScript(ctx, 1, map[string]any{"name": "bob"})
+	if err != nil || run.Status != model.ScriptRunCancelled {
+		t.Fatalf("expected cancelled run, got %+v, %v", run, err)
+	}
+
+	runs, err := svc.ListRuns(1, 0)
+	if err != nil || len(runs) != 2 || runs[0].ID == 0 {
+		t.Fatalf("history: %+v, %v", runs, err)
+	}
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"iat/common/model"
+	"iat/engine/internal/repo"
+	"iat/engine/pkg/indexdb"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SearchService 提供会话消息的全文检索。消息、工具参数/输出和会话摘要写入
+// indexdb 的消息索引；每次检索前按更新时间把变更（含软删除）同步进索引。
+type SearchService struct {
+	messageRepo *repo.MessageRepo
+	sessionRepo *repo.SessionRepo
+	projectRepo *repo.ProjectRepo
+	syncMu      sync.Mutex
+}
+
+func NewSearchService() *SearchService {
+	return &SearchService{
+		messageRepo: repo.NewMessageRepo(),
+		sessionRepo: repo.NewSessionRepo(),
+		projectRepo: repo.NewProjectRepo(),
+	}
+}
+
+type MessageSearchOptions struct {
+	ProjectID uint
+	AgentID   uint
+	Roles     []string // system, user, assistant, tool, summary
+	From, To  time.Time
+	Limit     int // sessions, default 20
+}
+
+type MessageSearchHit struct {
+	MessageID  uint                `json:"messageId,omitempty"` // 0 for the session summary
+	Role       string              `json:"role"`
+	ToolName   string              `json:"toolName,omitempty"`
+	Field      string              `json:"field"` // content, toolArguments, toolOutput, summary
+	CreatedAt  time.Time           `json:"createdAt"`
+	Score      float64             `json:"score"`
+	Snippet    string              `json:"snippet"`
+	Highlights []indexdb.Highlight `json:"highlights"`
+}
+
+type SessionSearchHit struct {
+	Session     model.Session      `json:"session"`
+	ProjectName string             `json:"projectName"`
+	Score       float64            `json:"score"`
+	Matches     int                `json:"matches"`
+	Messages    []MessageSearchHit `json:"messages"`
+}
+
+type MessageSearchResult struct {
+	Query    string             `json:"query"`
+	Total    int                `json:"total"` // matching sessions before the limit
+	Sessions []SessionSearchHit `json:"sessions"`
+}
+
+const (
+	summaryRole     = "summary"
+	hitsPerSession  = 3
+	snippetWidth    = 200
+	messageSyncPage = 500
+)
+
+// Search 检索消息并按会话分组返回，会话得分为其最相关的几条消息得分之和
+func (s *SearchService) Search(query string, opts MessageSearchOptions) (*MessageSearchResult, error) {
+	if err := s.SyncIndex(); err != nil {
+		return nil, err
+	}
+	hits, terms, err := indexdb.SearchMessages(query, indexdb.MessageSearchOptions{
+		ProjectID: opts.ProjectID,
+		AgentID:   opts.AgentID,
+		Roles:     opts.Roles,
+		From:      opts.From,
+		To:        opts.To,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &MessageSearchResult{Query: query, Sessions: []SessionSearchHit{}}
+	if len(hits) == 0 {
+		return res, nil
+	}
+
+	// 按会话分组（hits 已按得分排序）
+	bySession := make(map[uint][]indexdb.MessageDocHit)
+	var order []uint
+	for _, h := range hits {
+		if _, ok := bySession[h.Doc.SessionID]; !ok {
+			order = append(order, h.Doc.SessionID)
+		}
+		bySession[h.Doc.SessionID] = append(bySession[h.Doc.SessionID], h)
+	}
+	// 已删除的会话不返回
+	sessions, err := s.sessionRepo.ListByIDs(order)
+	if err != nil {
+		return nil, err
+	}
+	sessionByID := make(map[uint]model.Session, len(sessions))
+	for _, sess := range sessions {
+		sessionByID[sess.ID] = sess
+	}
+
+	var groups []SessionSearchHit
+	for _, id := range order {
+		sess, ok := sessionByID[id]
+		if !ok {
+			continue
+		}
+		g := SessionSearchHit{Session: sess, Matches: len(bySession[id])}
+		for i, h := range bySession[id] {
+			if i < hitsPerSession {
+				g.Score += h.Score
+			}
+		}
+		g.Score = float64(int(g.Score*1000+0.5)) / 1000
+		groups = append(groups, g)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Score > groups[j].Score })
+
+	res.Total = len(groups)
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if len(groups) > limit {
+		groups = groups[:limit]
+	}
+
+	// 只为返回的会话加载消息正文生成摘要
+	var messageIDs, projectIDs []uint
+	for _, g := range groups {
+		projectIDs = append(projectIDs, g.Session.ProjectID)
+		for i, h := range bySession[g.Session.ID] {
+			if i >= hitsPerSession {
+				break
+			}
+			if h.Doc.MessageID != 0 {
+				messageIDs = append(messageIDs, h.Doc.MessageID)
+			}
+		}
+	}
+	messages, err := s.messageRepo.ListByIDs(messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	messageByID := make(map[uint]model.Message, len(messages))
+	for _, m := range messages {
+		messageByID[m.ID] = m
+	}
+	projects, err := s.projectRepo.ListByIDs(projectIDs)
+	if err != nil {
+		return nil, err
+	}
+	projectName := make(map[uint]string, len(projects))
+	for _, p := range projects {
+		projectName[p.ID] = p.Name
+	}
+
+	for gi := range groups {
+		g := &groups[gi]
+		g.ProjectName = projectName[g.Session.ProjectID]
+		for i, h := range bySession[g.Session.ID] {
+			if i >= hitsPerSession {
+				break
+			}
+			hit := MessageSearchHit{
+				MessageID: h.Doc.MessageID,
+				Role:      h.Doc.Role,
+				ToolName:  h.Doc.ToolName,
+				CreatedAt: time.Unix(h.Doc.CreatedAt, 0),
+				Score:     h.Score,
+			}
+			var fields [][2]string
+			if h.Doc.MessageID == 0 {
+				fields = [][2]string{{"summary", g.Session.Summary}, {"name", g.Session.Name}}
+			} else if m, ok := messageByID[h.Doc.MessageID]; ok {
+				fields = [][2]string{{"content", m.Content}, {"toolOutput", m.ToolOutput}, {"toolArguments", m.ToolArgs}}
+			}
+			for _, f := range fields {
+				if snippet, hl, ok := indexdb.Snippet(f[1], terms, snippetWidth); ok {
+					hit.Field, hit.Snippet, hit.Highlights = f[0], snippet, hl
+					break
+				}
+			}
+			if hit.Field == "" {
+				// 只命中了工具名等未展示的字段，取第一段非空内容
+				for _, f := range fields {
+					if strings.TrimSpace(f[1]) != "" {
+						text := []rune(strings.TrimSpace(f[1]))
+						if len(text) > snippetWidth {
+							text = append(text[:snippetWidth], '…')
+						}
+						hit.Field, hit.Snippet = f[0], string(text)
+						break
+					}
+				}
+			}
+			g.Messages = append(g.Messages, hit)
+		}
+	}
+	res.Sessions = groups
+	return res, nil
+}
+
+// SyncIndex 把上次同步之后新增、修改和删除的消息与会话摘要写入索引
+func (s *SearchService) SyncIndex() error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	st, err := indexdb.GetMessageIndexState()
+	if err != nil {
+		return err
+	}
+	since := st.Watermark
+	now := time.Now()
+	sessionCache := make(map[uint]*model.Session)
+
+	for afterID := uint(0); ; {
+		messages, err := s.messageRepo.ListChangedSince(since, afterID, messageSyncPage)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		if err := s.loadSessions(messages, sessionCache); err != nil {
+			return err
+		}
+		var docs []indexdb.MessageDoc
+		var texts, remove []string
+		for _, m := range messages {
+			afterID = m.ID
+			key := indexdb.MessageDocKey(m.ID)
+			sess := sessionCache[m.SessionID]
+			if m.DeletedAt.Valid || sess == nil {
+				remove = append(remove, key)
+				continue
+			}
+			docs = append(docs, indexdb.MessageDoc{
+				Key:       key,
+				MessageID: m.ID,
+				SessionID: m.SessionID,
+				ProjectID: sess.ProjectID,
+				AgentID:   sess.AgentID,
+				Role:      m.Role,
+				ToolName:  m.ToolName,
+				CreatedAt: m.CreatedAt.Unix(),
+			})
+			texts = append(texts, strings.Join([]string{m.Content, m.ToolName, m.ToolArgs, m.ToolOutput}, "\n"))
+		}
+		if err := indexdb.UpdateMessageIndex(docs, texts, remove, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	for afterID := uint(0); ; {
+		sessions, err := s.sessionRepo.ListChangedSince(since, afterID, messageSyncPage)
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			break
+		}
+		var docs []indexdb.MessageDoc
+		var texts, remove []string
+		for _, sess := range sessions {
+			afterID = sess.ID
+			key := indexdb.SummaryDocKey(sess.ID)
+			if sess.DeletedAt.Valid {
+				remove = append(remove, key)
+				continue
+			}
+			docs = append(docs, indexdb.MessageDoc{
+				Key:       key,
+				SessionID: sess.ID,
+				ProjectID: sess.ProjectID,
+				AgentID:   sess.AgentID,
+				Role:      summaryRole,
+				CreatedAt: sess.UpdatedAt.Unix(),
+			})
+			texts = append(texts, sess.Name+"\n"+sess.Summary)
+		}
+		if err := indexdb.UpdateMessageIndex(docs, texts, remove, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	// 所有变更写入后再推进水位，中途失败时下次会重新同步
+	return indexdb.UpdateMessageIndex(nil, nil, nil, now)
+}
+
+func (s *SearchService) loadSessions(messages []model.Message, cache map[uint]*model.Session) error {
+	var missing []uint
+	for _, m := range messages {
+		if _, ok := cache[m.SessionID]; !ok {
+			cache[m.SessionID] = nil
+			missing = append(missing, m.SessionID)
+		}
+	}
+	sessions, err := s.sessionRepo.ListByIDsUnscoped(missing)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		cache[sessions[i].ID] = &sessions[i]
+	}
+	return nil
+}
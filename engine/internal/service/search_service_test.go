@@ -0,0 +1,67 @@
+package service
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/consts"
+	"iat/common/pkg/db"
+	"iat/engine/pkg/indexdb"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSearchService_Messages(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Project{}, &model.Session{}, &model.Message{})
+	db.DB = d
+	_ = os.Setenv("IAT_INDEXDB_DIR", filepath.Join(t.TempDir(), "indexdb"))
+	defer func() { _ = indexdb.CloseDefault() }()
+
+	d.Create(&model.Project{Name: "engine"})
+	s1 := &model.Session{ProjectID: 1, AgentID: 1, Name: "Fix migration bug"}
+	s2 := &model.Session{ProjectID: 1, AgentID: 2, Name: "UI work"}
+	d.Create(s1)
+	d.Create(s2)
+	d.Create(&model.Message{SessionID: s1.ID, Role: consts.RoleUser, Content: "The migration fails on startup"})
+	d.Create(&model.Message{SessionID: s1.ID, Role: consts.RoleTool, ToolName: "run_command", ToolArgs: `{"command":"go test"}`, ToolOutput: "FAIL: migration of messages table"})
+	m3 := &model.Message{SessionID: s2.ID, Role: consts.RoleAssistant, Content: "Unrelated: the button migration to the new theme is done"}
+	d.Create(m3)
+
+	svc := NewSearchService()
+	res, err := svc.Search("migration", MessageSearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 || res.Sessions[0].Session.ID != s1.ID || res.Sessions[0].ProjectName != "engine" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	first := res.Sessions[0].Messages[0]
+	if len(first.Highlights) == 0 || first.Snippet[first.Highlights[0].Start:first.Highlights[0].End] != "migration" {
+		t.Fatalf("expected a highlighted snippet, got %+v", first)
+	}
+
+	// 过滤
+	res, _ = svc.Search("migration", MessageSearchOptions{Roles: []string{"tool"}})
+	if res.Total != 1 || res.Sessions[0].Messages[0].Field != "toolOutput" {
+		t.Fatalf("role filter: %+v", res)
+	}
+	res, _ = svc.Search("migration", MessageSearchOptions{AgentID: 2})
+	if res.Total != 1 || res.Sessions[0].Session.ID != s2.ID {
+		t.Fatalf("agent filter: %+v", res)
+	}
+
+	// 删除与修改在下次检索时同步
+	d.Delete(m3)
+	d.Model(s1).Update("summary", "Fixed the messages table migration")
+	res, _ = svc.Search(`"table migration"`, MessageSearchOptions{})
+	if res.Total != 1 || res.Sessions[0].Messages[0].Field != "summary" {
+		t.Fatalf("phrase after update: %+v", res)
+	}
+	res, _ = svc.Search("button", MessageSearchOptions{})
+	if res.Total != 0 {
+		t.Fatalf("deleted message still found: %+v", res)
+	}
+}
@@ -1,33 +1,69 @@
 package service
 
 import (
+	"fmt"
 	"iat/common/model"
 	"iat/engine/internal/repo"
 )
 
 type SessionService struct {
-	repo *repo.SessionRepo
+	repo           *repo.SessionRepo
+	projectRepo    *repo.ProjectRepo
+	checkpointRepo *repo.CheckpointRepo
+	hooks          *HookService
 }
 
 func NewSessionService() *SessionService {
 	return &SessionService{
-		repo: repo.NewSessionRepo(),
+		repo:           repo.NewSessionRepo(),
+		projectRepo:    repo.NewProjectRepo(),
+		checkpointRepo: repo.NewCheckpointRepo(),
 	}
 }
 
+// SetHookService makes session creation and deletion fire hooks.
+func (s *SessionService) SetHookService(h *HookService) {
+	s.hooks = h
+}
+
 func (s *SessionService) ListSessions(projectID uint) ([]model.Session, error) {
 	return s.repo.ListByProjectID(projectID)
 }
 
+// CreateSession creates a session; without an agent it gets the project's
+// default agent, and it always starts in the project's default mode.
 func (s *SessionService) CreateSession(name string, projectID uint, agentID uint) (*model.Session, error) {
 	session := &model.Session{
 		Name:      name,
 		ProjectID: projectID,
 		AgentID:   agentID,
 	}
+	if projectID != 0 {
+		project, err := s.projectRepo.GetByID(projectID)
+		if err != nil {
+			return nil, err
+		}
+		settings, err := project.GetSettings()
+		if err != nil {
+			return nil, fmt.Errorf("invalid project settings: %v", err)
+		}
+		if session.AgentID == 0 {
+			session.AgentID = settings.DefaultAgentID
+		}
+		session.Mode = settings.DefaultMode
+	}
 	if err := s.repo.Create(session); err != nil {
 		return nil, err
 	}
+	if s.hooks != nil {
+		s.hooks.Notify(model.HookSessionCreated, "agent", session.AgentID, map[string]any{
+			"sessionId": session.ID,
+			"projectId": session.ProjectID,
+			"agentId":   session.AgentID,
+			"mode":      session.Mode,
+			"name":      session.Name,
+		})
+	}
 	return session, nil
 }
 
@@ -40,8 +76,23 @@ func (s *SessionService) UpdateSession(id uint, name string) error {
 	return s.repo.Update(session)
 }
 
+// DeleteSession deletes a session together with its file checkpoints.
 func (s *SessionService) DeleteSession(id uint) error {
-	return s.repo.Delete(id)
+	session, _ := s.repo.GetByID(id)
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	if err := s.checkpointRepo.DeleteBySessionID(id); err != nil {
+		return err
+	}
+	if s.hooks != nil && session != nil {
+		s.hooks.Notify(model.HookSessionDeleted, "agent", session.AgentID, map[string]any{
+			"sessionId": session.ID,
+			"projectId": session.ProjectID,
+			"name":      session.Name,
+		})
+	}
+	return nil
 }
 
 func (s *SessionService) GetSession(id uint) (*model.Session, error) {
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// UnknownToolStats is the tool name counters are kept under for calls to
+// tools that don't exist, and for any tool once MaxToolStats is reached, so
+// names made up by a model can't grow the counters without bound.
+const UnknownToolStats = "<unknown>"
+
+// MaxToolStats is the number of tools counters are kept for.
+const MaxToolStats = 512
+
+// ToolMetrics keeps in-memory counters of tool calls since engine start.
+type ToolMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*ToolStats
+	// consecutive invalid calls per session and tool; reset by a valid call
+	invalidStreak map[toolStreakKey]int
+}
+
+type toolStreakKey struct {
+	sessionID uint
+	tool      string
+}
+
+type ToolStats struct {
+	Tool            string    `json:"tool"`
+	Calls           int64     `json:"calls"`
+	Failures        int64     `json:"failures"`
+	InvalidArgs     int64     `json:"invalidArgs"`     // calls rejected by schema validation
+	RepeatedInvalid int64     `json:"repeatedInvalid"` // invalid calls right after another invalid call of the same tool in the same session
+	LastInvalidAt   time.Time `json:"lastInvalidAt,omitempty"`
+}
+
+func NewToolMetrics() *ToolMetrics {
+	return &ToolMetrics{
+		stats:         make(map[string]*ToolStats),
+		invalidStreak: make(map[toolStreakKey]int),
+	}
+}
+
+func (m *ToolMetrics) get(tool string) *ToolStats {
+	st, ok := m.stats[tool]
+	if !ok && len(m.stats) >= MaxToolStats {
+		tool = UnknownToolStats
+		st, ok = m.stats[tool]
+	}
+	if !ok {
+		st = &ToolStats{Tool: tool}
+		m.stats[tool] = st
+	}
+	return st
+}
+
+// RecordInvalid counts a call rejected because of invalid arguments and
+// returns how many invalid calls in a row the session made to this tool.
+func (m *ToolMetrics) RecordInvalid(sessionID uint, tool string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.get(tool)
+	st.Calls++
+	st.InvalidArgs++
+	st.LastInvalidAt = time.Now()
+	key := toolStreakKey{sessionID, st.Tool}
+	if _, ok := m.invalidStreak[key]; !ok && len(m.invalidStreak) >= MaxToolStats {
+		// 只影响重复无效调用的计数，清空即可
+		clear(m.invalidStreak)
+	}
+	m.invalidStreak[key]++
+	if m.invalidStreak[key] > 1 {
+		st.RepeatedInvalid++
+	}
+	return m.invalidStreak[key]
+}
+
+// RecordResult counts an executed call.
+func (m *ToolMetrics) RecordResult(sessionID uint, tool string, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.get(tool)
+	st.Calls++
+	if !ok {
+		st.Failures++
+	}
+	delete(m.invalidStreak, toolStreakKey{sessionID, st.Tool})
+}
+
+// Snapshot returns a copy of the counters sorted by tool name.
+func (m *ToolMetrics) Snapshot() []ToolStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]ToolStats, 0, len(m.stats))
+	for _, st := range m.stats {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tool < out[j].Tool })
+	return out
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestToolMetrics_Bounded(t *testing.T) {
+	svc := NewToolService(nil)
+	infos := []*schema.ToolInfo{{Name: "read_file"}}
+
+	// 模型编造的工具名都记在同一个桶里
+	for i := 0; i < 3; i++ {
+		if _, err := svc.ValidateCall(1, fmt.Sprintf("made_up_%d", i), `{}`, infos); err == nil {
+			t.Fatal("expected a call to an unknown tool to be rejected")
+		}
+	}
+	stats := svc.Metrics()
+	if len(stats) != 1 || stats[0].Tool != UnknownToolStats || stats[0].InvalidArgs != 3 || stats[0].RepeatedInvalid != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	m := NewToolMetrics()
+	for i := 0; i < MaxToolStats+10; i++ {
+		m.RecordResult(1, fmt.Sprintf("tool_%d", i), true)
+	}
+	if n := len(m.Snapshot()); n != MaxToolStats+1 {
+		t.Fatalf("expected %d counters, got %d", MaxToolStats+1, n)
+	}
+}
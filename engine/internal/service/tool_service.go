@@ -7,25 +7,190 @@ import (
 	"iat/common/model"
 	"iat/common/pkg/consts"
 	"iat/common/pkg/script"
+	"iat/common/pkg/tools"
 	"iat/engine/internal/repo"
+	"iat/engine/pkg/indexdb"
 	"iat/engine/pkg/tools/builtin"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/eino/schema"
 	"github.com/eino-contrib/jsonschema"
 )
 
 type ToolService struct {
-	repo       *repo.ToolRepo
-	mcpService *MCPService
+	repo        *repo.ToolRepo
+	mcpService  *MCPService
+	checkpoints *CheckpointService
+	index       *IndexService
+	agents      AgentRunner
+	tasks       *TaskService
+	metrics     *ToolMetrics
+	approvals   *repo.ToolApprovalRepo
+	hooks       *HookService
 }
 
 func NewToolService(mcpService *MCPService) *ToolService {
 	return &ToolService{
 		repo:       repo.NewToolRepo(),
 		mcpService: mcpService,
+		metrics:    NewToolMetrics(),
+		approvals:  repo.NewToolApprovalRepo(),
 	}
 }
 
+// SetCheckpointService enables snapshots of files before tools modify them.
+func (s *ToolService) SetCheckpointService(cs *CheckpointService) {
+	s.checkpoints = cs
+}
+
+// SetIndexService enables search_code over the project code index.
+func (s *ToolService) SetIndexService(is *IndexService) {
+	s.index = is
+}
+
+// SetAgentRunner lets script tools run agents through iat.agents.
+func (s *ToolService) SetAgentRunner(r AgentRunner) {
+	s.agents = r
+}
+
+// SetHookService runs the pre_tool and post_tool hooks around tool calls
+// made by the chat loop, sub-agents and scripts.
+func (s *ToolService) SetHookService(h *HookService) {
+	s.hooks = h
+}
+
+// SetTaskService lets script tools manage the session tasks through iat.tasks.
+func (s *ToolService) SetTaskService(ts *TaskService) {
+	s.tasks = ts
+}
+
+func (s *ToolService) Metrics() []ToolStats {
+	return s.metrics.Snapshot()
+}
+
+// ValidateCall parses and validates the raw arguments of a tool call against
+// the schema the tool was declared with (infos are the agent's effective
+// tools, even when the model itself was given none). Calls to tools that are
+// not in infos are rejected. Invalid calls are counted in the metrics, those
+// to unknown tools under UnknownToolStats, and returned as
+// *tools.ArgValidationError; tools without a known schema are not checked.
+func (s *ToolService) ValidateCall(sessionID uint, name, rawArgs string, infos []*schema.ToolInfo) (map[string]any, error) {
+	args, err := tools.ParseToolArgs(name, rawArgs)
+	if err == nil {
+		err = validateAgainstInfos(name, args, infos)
+	}
+	if err != nil {
+		metric := UnknownToolStats
+		for _, info := range infos {
+			if info != nil && info.Name == name {
+				metric = name
+				break
+			}
+		}
+		if n := s.metrics.RecordInvalid(sessionID, metric); n > 1 {
+			slog.Warn("repeated invalid tool call", slog.String("tool", name), slog.Any("sessionId", sessionID), slog.Int("streak", n))
+		}
+		return nil, err
+	}
+	return args, nil
+}
+
+// RecordResult counts an executed tool call in the metrics.
+func (s *ToolService) RecordResult(sessionID uint, name string, ok bool) {
+	s.metrics.RecordResult(sessionID, name, ok)
+}
+
+// toolHookData is the event data of the pre_tool and post_tool hooks.
+func toolHookData(name, rawArgs string, tc *ToolCallContext) (uint, map[string]any) {
+	data := map[string]any{"toolName": name, "arguments": rawArgs}
+	var agentID uint
+	if tc == nil {
+		return 0, data
+	}
+	data["sessionId"] = tc.SessionID
+	if tc.Project != nil && tc.Project.ID != 0 {
+		data["projectId"] = tc.Project.ID
+	}
+	if tc.Agent != nil {
+		agentID = tc.Agent.ID
+		data["agentName"] = tc.Agent.Name
+	}
+	if tc.Mode != nil {
+		data["mode"] = tc.Mode.Key
+	}
+	return agentID, data
+}
+
+// PreToolHooks runs the pre_tool hooks of a call and returns the arguments
+// they leave. The error, a *HookDeniedError when a hook denied or failed,
+// means the call must not run.
+func (s *ToolService) PreToolHooks(ctx context.Context, name, rawArgs string, tc *ToolCallContext) (string, error) {
+	if s.hooks == nil {
+		return rawArgs, nil
+	}
+	agentID, data := toolHookData(name, rawArgs, tc)
+	data, err := s.hooks.ExecuteHooks(ctx, model.HookPreTool, "agent", agentID, data)
+	if err != nil {
+		return rawArgs, err
+	}
+	return hookArguments(data["arguments"], rawArgs), nil
+}
+
+// PostToolHooks runs the post_tool hooks of a call and returns the result
+// they leave.
+func (s *ToolService) PostToolHooks(ctx context.Context, name, rawArgs, result string, toolErr error, started time.Time, tc *ToolCallContext) string {
+	if s.hooks == nil {
+		return result
+	}
+	agentID, data := toolHookData(name, rawArgs, tc)
+	data["result"] = result
+	data["error"] = errorText(toolErr)
+	data["durationMs"] = time.Since(started).Milliseconds()
+	data, _ = s.hooks.ExecuteHooks(ctx, model.HookPostTool, "agent", agentID, data)
+	if r, ok := data["result"].(string); ok {
+		return r
+	}
+	return result
+}
+
+// hookArguments returns the tool arguments a pre_tool hook left: the JSON
+// string, or an object it replaced them with. Anything else keeps orig.
+func hookArguments(v any, orig string) string {
+	switch a := v.(type) {
+	case string:
+		return a
+	case map[string]any:
+		if b, err := json.Marshal(a); err == nil {
+			return string(b)
+		}
+	}
+	return orig
+}
+
+func validateAgainstInfos(name string, args map[string]any, infos []*schema.ToolInfo) error {
+	for _, info := range infos {
+		if info == nil || info.Name != name {
+			continue
+		}
+		if info.ParamsOneOf == nil {
+			return nil
+		}
+		js, err := info.ParamsOneOf.ToJSONSchema()
+		if err != nil || js == nil {
+			return nil
+		}
+		m, err := tools.SchemaToMap(js)
+		if err != nil {
+			return nil
+		}
+		return tools.ValidateToolArgs(name, m, args)
+	}
+	return fmt.Errorf("tool %s is not available to this agent; use one of the tools you were given", name)
+}
+
 // ... existing CRUD methods ...
 
 func (s *ToolService) ListTools() ([]model.Tool, error) {
@@ -33,13 +198,66 @@ func (s *ToolService) ListTools() ([]model.Tool, error) {
 }
 
 func (s *ToolService) CreateTool(tool *model.Tool) error {
+	if err := validateToolDefinition(tool); err != nil {
+		return err
+	}
 	return s.repo.Create(tool)
 }
 
 func (s *ToolService) UpdateTool(tool *model.Tool) error {
+	if err := validateToolDefinition(tool); err != nil {
+		return err
+	}
 	return s.repo.Update(tool)
 }
 
+// validateToolDefinition rejects api tools whose request template can't be
+// used and script tools that don't transpile, so the mistake shows up when
+// saving rather than on the first call.
+func validateToolDefinition(tool *model.Tool) error {
+	if tool.Type == consts.ToolTypeAPI {
+		_, err := tools.ParseAPIToolSpec(tool.Content)
+		return err
+	}
+	if _, err := scriptEngineFor(tool.Capabilities, ""); err != nil {
+		return fmt.Errorf("invalid capabilities: %w", err)
+	}
+	if tool.Type == consts.ToolTypeCustom || tool.Type == consts.ToolTypeScript {
+		return checkScriptSource(tool.Language, tool.Content, tool.Name)
+	}
+	return nil
+}
+
+// scriptEngineFor builds a sandboxed engine with the declared capabilities
+// (a JSON ScriptCapabilities) granted; fs is confined to root unless the
+// capabilities name another base directory. require() resolves stored
+// scripts by name and .js/.ts files under root/.iat/scripts.
+func scriptEngineFor(rawCaps, root string) (*script.ScriptEngine, error) {
+	var caps model.ScriptCapabilities
+	if strings.TrimSpace(rawCaps) != "" {
+		if err := json.Unmarshal([]byte(rawCaps), &caps); err != nil {
+			return nil, err
+		}
+	}
+	grants, err := script.GrantsFor(caps, root)
+	if err != nil {
+		return nil, err
+	}
+	engine := script.NewSandboxedEngine(grants)
+	engine.SetModuleSource(script.ModuleSource{ProjectRoot: root, Stored: storedScript})
+	return engine, nil
+}
+
+// storedScript looks up a stored script for require().
+func storedScript(name string) (string, bool, error) {
+	sc, err := repo.NewScriptRepo().FindByName(name)
+	if err != nil || sc == nil {
+		return "", false, err
+	}
+	code, err := script.Compile(sc.Language, sc.Content, sc.Name+".ts")
+	return code, err == nil, err
+}
+
 func (s *ToolService) DeleteTool(id uint) error {
 	tool, err := s.repo.Get(id)
 	if err != nil {
@@ -51,26 +269,243 @@ func (s *ToolService) DeleteTool(id uint) error {
 	return s.repo.Delete(id)
 }
 
+// ToolCallContext describes the environment of a single tool call: the
+// session it belongs to, the calling agent and the project it operates on.
+type ToolCallContext struct {
+	SessionID  uint
+	MessageID  uint   // user message that started the current turn
+	ToolCallID string // set per call by the chat loop
+	Agent      *model.Agent
+	Project    *model.Project
+	Mode       *model.Mode
+	Tools      []*schema.ToolInfo // tools offered to the model; nil = the agent's effective tools
+}
+
+func (c *ToolCallContext) ProjectRoot() string {
+	if c == nil || c.Project == nil {
+		return ""
+	}
+	return c.Project.Path
+}
+
+// HttpPolicy returns the egress policy for http_request/fetch_url. Without a
+// project (or with an empty allowlist) no host is reachable.
+func (c *ToolCallContext) HttpPolicy() tools.HttpPolicy {
+	var policy tools.HttpPolicy
+	if c != nil && c.Project != nil {
+		policy.AllowedHosts = tools.ParseHostList(c.Project.HttpAllowlist)
+	}
+	return policy
+}
+
+// Settings returns the project settings, zero without a project.
+func (c *ToolCallContext) Settings() model.ProjectSettings {
+	if c == nil {
+		return model.ProjectSettings{}
+	}
+	return projectSettings(c.Project)
+}
+
+// projectSettings reads the settings of p; invalid settings are ignored.
+func projectSettings(p *model.Project) model.ProjectSettings {
+	if p == nil {
+		return model.ProjectSettings{}
+	}
+	settings, err := p.GetSettings()
+	if err != nil {
+		slog.Warn("invalid project settings, ignoring them", slog.Uint64("project", uint64(p.ID)), slog.Any("error", err))
+		return model.ProjectSettings{}
+	}
+	return settings
+}
+
+// applyProjectSettings overrides the agent's model and drops the MCP servers
+// the project doesn't allow. agent must be a copy owned by the caller.
+func applyProjectSettings(agent *model.Agent, settings model.ProjectSettings) {
+	if settings.ModelID != 0 {
+		agent.ModelID = settings.ModelID
+	}
+	if settings.MCPServerIDs != nil {
+		allowed := make(map[uint]bool, len(settings.MCPServerIDs))
+		for _, id := range settings.MCPServerIDs {
+			allowed[id] = true
+		}
+		var servers []model.MCPServer
+		for _, srv := range agent.MCPServers {
+			if allowed[srv.ID] {
+				servers = append(servers, srv)
+			}
+		}
+		agent.MCPServers = servers
+	}
+}
+
+// CommandEnv returns the project's extra run_command environment as
+// "KEY=value" entries.
+func (c *ToolCallContext) CommandEnv() []string {
+	env := c.Settings().Env
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k+"="+env[k])
+	}
+	return out
+}
+
+// GitPolicy returns what the git tools may do in the current mode.
+func (c *ToolCallContext) GitPolicy() tools.GitPolicy {
+	var policy tools.GitPolicy
+	if c != nil && c.Mode != nil && c.Mode.AllowGitRewrite != nil {
+		policy.AllowHistoryRewrite = *c.Mode.AllowGitRewrite
+	}
+	return policy
+}
+
+// PathGuard jails file tools to the project root and applies the project's
+// and the mode's path policies. Without a project nothing is jailed and only
+// the mode's policy applies.
+func (c *ToolCallContext) PathGuard() *tools.PathGuard {
+	guard := &tools.PathGuard{Base: c.ProjectRoot()}
+	if c == nil {
+		return guard
+	}
+	if c.Project != nil {
+		if policy, err := c.Project.GetPathPolicy(); err == nil && !policy.IsEmpty() {
+			guard.Rules = append(guard.Rules, tools.PathRule{Source: "project", Policy: policy})
+		}
+	}
+	if c.Mode != nil {
+		if policy, err := c.Mode.GetPathPolicy(); err == nil && !policy.IsEmpty() {
+			guard.Rules = append(guard.Rules, tools.PathRule{Source: "mode " + c.Mode.Key, Policy: policy})
+		}
+	}
+	return guard
+}
+
+// ToolApprovalError is returned when the mode requires the user to approve a
+// tool before it runs in a session.
+type ToolApprovalError struct {
+	Tool string
+	Mode string
+}
+
+func (e *ToolApprovalError) Error() string {
+	return fmt.Sprintf("tool %s requires user approval in %s mode; the call was not executed. Ask the user to approve it for this session", e.Tool, e.Mode)
+}
+
+// ApproveTool lets tool (a name or glob) run in a session even if the mode
+// requires approval for it. Approvals are stored with the session.
+func (s *ToolService) ApproveTool(sessionID uint, tool string) error {
+	approved, err := s.ApprovedTools(sessionID)
+	if err != nil {
+		return err
+	}
+	for _, t := range approved {
+		if t == tool {
+			return nil
+		}
+	}
+	return s.approvals.Create(&model.ToolApproval{SessionID: sessionID, Tool: tool})
+}
+
+func (s *ToolService) ApprovedTools(sessionID uint) ([]string, error) {
+	items, err := s.approvals.ListBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	approved := []string{}
+	for _, a := range items {
+		approved = append(approved, a.Tool)
+	}
+	return approved, nil
+}
+
+// CheckApproval fails with *ToolApprovalError when the mode requires approval
+// for name and the user hasn't given it in this session.
+func (s *ToolService) CheckApproval(name string, tc *ToolCallContext) error {
+	return s.checkApproval(name, tc)
+}
+
+func (s *ToolService) checkApproval(name string, tc *ToolCallContext) error {
+	if tc.Mode == nil {
+		return nil
+	}
+	policy, _ := tc.Mode.GetToolPolicy()
+	if !model.MatchToolName(policy.Approve, name) {
+		return nil
+	}
+	approved, err := s.ApprovedTools(tc.SessionID)
+	if err != nil {
+		return fmt.Errorf("tool %s: cannot load approvals: %v", name, err)
+	}
+	if model.MatchToolName(approved, name) {
+		return nil
+	}
+	return &ToolApprovalError{Tool: name, Mode: tc.Mode.Key}
+}
+
+// toolAllowed checks name against the tools offered in this call context,
+// computing the agent's effective tools when the caller didn't set them.
+func (s *ToolService) toolAllowed(name string, tc *ToolCallContext) bool {
+	infos := tc.Tools
+	if infos == nil {
+		infos = s.EffectiveTools(tc.Agent, tc.Mode)
+	}
+	for _, info := range infos {
+		if info.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // New Execution Logic
-func (s *ToolService) Call(ctx context.Context, name string, args map[string]any, agent *model.Agent, projectRoot string) (string, error) {
+func (s *ToolService) Call(ctx context.Context, name string, args map[string]any, tc *ToolCallContext) (string, error) {
+	agent := tc.Agent
+	if !s.toolAllowed(name, tc) {
+		return "", fmt.Errorf("tool %s is not available to agent %s", name, agent.Name)
+	}
+	if err := s.checkApproval(name, tc); err != nil {
+		return "", err
+	}
+
 	// 1. Try Builtin
 	switch name {
-	case "read_file", "write_file", "list_files", "run_command", "run_script", "read_file_range", "diff_file", "manage_tasks":
+	case "read_file", "write_file", "list_files", "run_command", "run_script", "read_file_range", "diff_file", "manage_tasks",
+		"http_request", "fetch_url",
+		"git_status", "git_diff", "git_log", "git_commit", "git_branch", "git_worktree",
+		"find_definition", "find_references", "list_symbols", "package_outline", "search_code":
 		// Handle via existing builtin logic (needs slight refactor to be more modular)
-		return s.executeBuiltin(name, args, projectRoot)
+		return s.executeBuiltin(ctx, name, args, tc)
 	}
 
-	// 2. Try Agent-attached Script Tools
+	// 2. Try Agent-attached Script and API Tools
 	for _, t := range agent.Tools {
 		if t.Name == name && (t.Type == consts.ToolTypeCustom || t.Type == consts.ToolTypeScript) {
-			engine := script.NewScriptEngine()
+			depth := scriptDepth(ctx) + 1
+			if depth > MaxScriptToolDepth {
+				return "", fmt.Errorf("tool %s: script tools nested too deeply (max %d)", t.Name, MaxScriptToolDepth)
+			}
+			engine, err := scriptEngineFor(t.Capabilities, tc.ProjectRoot())
+			if err != nil {
+				return "", fmt.Errorf("tool %s: %w", t.Name, err)
+			}
+			engine.SetHost(&scriptHost{tools: s, tc: tc, depth: depth})
 			engine.RegisterGlobal("args", args)
-			res, err := engine.Run(t.Content)
+			run := &model.ScriptRun{Source: model.ScriptRunTool, SourceID: t.ID, Name: t.Name, SessionID: tc.SessionID}
+			res, err := executeScript(ctx, engine, t.Language, t.Content, script.DefaultLimits, run, args)
 			if err != nil {
 				return "", fmt.Errorf("script error: %w", err)
 			}
 			return fmt.Sprintf("%v", res), nil
 		}
+		if t.Name == name && t.Type == consts.ToolTypeAPI {
+			return tools.CallAPITool(ctx, tc.HttpPolicy(), t.Content, args)
+		}
 	}
 
 	// 3. Try MCP
@@ -84,21 +519,36 @@ func (s *ToolService) Call(ctx context.Context, name string, args map[string]any
 	return "", fmt.Errorf("tool %s not found", name)
 }
 
-func (s *ToolService) executeBuiltin(name string, args map[string]any, projectRoot string) (string, error) {
+func (s *ToolService) executeBuiltin(ctx context.Context, name string, args map[string]any, tc *ToolCallContext) (string, error) {
+	projectRoot := tc.ProjectRoot()
+	guard := tc.PathGuard()
+
 	// Implementation similar to chat_service.go's switch but using tools pkg directly
 	switch name {
 	case "read_file":
 		path, _ := args["path"].(string)
-		p, _ := builtin.ResolvePathInBase(projectRoot, path)
+		p, err := guard.Resolve(path, tools.PathRead)
+		if err != nil {
+			return "", err
+		}
 		return builtin.ReadFile(p)
 	case "write_file":
 		path, _ := args["path"].(string)
 		content, _ := args["content"].(string)
-		p, _ := builtin.ResolvePathInBase(projectRoot, path)
+		p, err := guard.Resolve(path, tools.PathWrite)
+		if err != nil {
+			return "", err
+		}
+		if err := s.checkpoints.Snapshot(tc, name, p); err != nil {
+			return "", err
+		}
 		return builtin.WriteFile(p, content)
 	case "list_files":
 		path, _ := args["path"].(string)
-		p, _ := builtin.ResolvePathInBase(projectRoot, path)
+		p, err := guard.Resolve(path, tools.PathRead)
+		if err != nil {
+			return "", err
+		}
 		return builtin.ListFiles(p)
 	case "run_command":
 		cmd, _ := args["command"].(string)
@@ -107,63 +557,390 @@ func (s *ToolService) executeBuiltin(name string, args map[string]any, projectRo
 		for _, a := range cmdArgsRaw {
 			cmdArgs = append(cmdArgs, fmt.Sprintf("%v", a))
 		}
-		return builtin.RunCommand(cmd, cmdArgs)
+		// 命令交给 shell 执行；策略和 git 检查作用于解析出的每个简单命令，只能尽力而为
+		line := strings.Join(append([]string{cmd}, cmdArgs...), " ")
+		for _, argv := range tools.ShellCommands(line) {
+			if err := tools.CheckCommandPolicy(tc.Settings().CommandPolicy, argv); err != nil {
+				return "", err
+			}
+			if err := tools.CheckGitArgv(tc.GitPolicy(), argv); err != nil {
+				return "", err
+			}
+		}
+		dir := projectRoot
+		if d, _ := args["dir"].(string); d != "" {
+			var err error
+			if dir, err = guard.Resolve(d, tools.PathRead); err != nil {
+				return "", err
+			}
+		}
+		return builtin.RunCommandWithEnv(ctx, dir, cmd, cmdArgs, tc.CommandEnv())
 	case "run_script":
 		path, _ := args["scriptPath"].(string)
-		p, _ := builtin.ResolvePathInBase(projectRoot, path)
+		p, err := guard.Resolve(path, tools.PathRead)
+		if err != nil {
+			return "", err
+		}
 		scriptArgsRaw, _ := args["args"].([]any)
 		var scriptArgs []string
 		for _, a := range scriptArgsRaw {
 			scriptArgs = append(scriptArgs, fmt.Sprintf("%v", a))
 		}
-		return builtin.RunScript(p, scriptArgs)
+		argv, err := builtin.ScriptArgv(p, scriptArgs)
+		if err != nil {
+			return "", err
+		}
+		if err := tools.CheckCommandPolicy(tc.Settings().CommandPolicy, argv); err != nil {
+			return "", err
+		}
+		return builtin.RunScriptInDir(projectRoot, p, scriptArgs)
 	case "read_file_range":
 		path, _ := args["path"].(string)
-		p, _ := builtin.ResolvePathInBase(projectRoot, path)
+		p, err := guard.Resolve(path, tools.PathRead)
+		if err != nil {
+			return "", err
+		}
 		start, _ := args["startLine"].(float64) // JSON numbers are float64
 		limit, _ := args["limit"].(float64)
 		return builtin.ReadFileRange(p, int(start), int(limit))
 	case "diff_file":
 		path1, _ := args["path1"].(string)
 		path2, _ := args["path2"].(string)
-		p1, _ := builtin.ResolvePathInBase(projectRoot, path1)
-		p2, _ := builtin.ResolvePathInBase(projectRoot, path2)
+		p1, err := guard.Resolve(path1, tools.PathRead)
+		if err != nil {
+			return "", err
+		}
+		p2, err := guard.Resolve(path2, tools.PathRead)
+		if err != nil {
+			return "", err
+		}
 		return builtin.DiffFile(p1, p2)
+	case "http_request":
+		url, _ := args["url"].(string)
+		method, _ := args["method"].(string)
+		body, _ := args["body"].(string)
+		timeout, _ := args["timeout"].(float64)
+		headers := make(map[string]string)
+		if raw, ok := args["headers"].(map[string]any); ok {
+			for k, v := range raw {
+				headers[k] = fmt.Sprint(v)
+			}
+		}
+		return builtin.HttpRequest(ctx, tc.HttpPolicy(), tools.HttpRequestOptions{
+			Method:  method,
+			URL:     url,
+			Headers: headers,
+			Body:    body,
+			Timeout: time.Duration(timeout) * time.Second,
+		})
+	case "fetch_url":
+		url, _ := args["url"].(string)
+		timeout, _ := args["timeout"].(float64)
+		return builtin.FetchURL(ctx, tc.HttpPolicy(), url, time.Duration(timeout)*time.Second)
+	case "find_definition", "find_references":
+		q, err := goQueryArgs(guard, args)
+		if err != nil {
+			return "", err
+		}
+		if name == "find_definition" {
+			return builtin.GoFindDefinition(guard.Base, q)
+		}
+		return builtin.GoFindReferences(guard.Base, q)
+	case "list_symbols", "package_outline":
+		pathStr, _ := args["path"].(string)
+		target, err := guard.Resolve(pathStr, tools.PathRead)
+		if err != nil {
+			return "", err
+		}
+		if name == "list_symbols" {
+			return builtin.GoListSymbols(guard.Base, target)
+		}
+		return builtin.GoPackageOutline(guard.Base, target)
+	case "search_code":
+		if s.index == nil || tc == nil || tc.Project == nil || tc.Project.ID == 0 {
+			return "", fmt.Errorf("search_code requires a project with a code index")
+		}
+		query, _ := args["query"].(string)
+		pathGlob, _ := args["path"].(string)
+		lang, _ := args["lang"].(string)
+		limit, _ := args["limit"].(float64)
+		opts := indexdb.CodeSearchOptions{Limit: int(limit)}
+		if pathGlob != "" {
+			opts.PathGlobs = []string{pathGlob}
+		}
+		if lang != "" {
+			opts.Langs = []string{lang}
+		}
+		// 不返回路径策略禁止读取的文件（在排序和 limit 之前过滤）
+		opts.Allow = func(rel string) bool {
+			_, err := guard.Resolve(rel, tools.PathRead)
+			return err == nil
+		}
+		res, err := s.index.SearchCode(tc.Project.ID, query, opts)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case "git_status":
+		res, err := tools.GitStatus(projectRoot)
+		if err != nil {
+			return "", err
+		}
+		// 只列出路径策略允许读取的文件
+		files := res.Files[:0]
+		for _, f := range res.Files {
+			if guard.CanRead(f.Path) && (f.OrigPath == "" || guard.CanRead(f.OrigPath)) {
+				files = append(files, f)
+			}
+		}
+		res.Files = files
+		b, err := json.Marshal(res)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case "git_diff":
+		from, _ := args["from"].(string)
+		to, _ := args["to"].(string)
+		staged, _ := args["staged"].(bool)
+		paths, err := gitReadPaths(guard, name, args["paths"])
+		if err != nil {
+			return "", err
+		}
+		return builtin.GitDiff(projectRoot, tools.GitDiffOptions{Staged: staged, From: from, To: to, Paths: paths})
+	case "git_log":
+		limit, _ := args["limit"].(float64)
+		ref, _ := args["ref"].(string)
+		paths, err := gitReadPaths(guard, name, args["paths"])
+		if err != nil {
+			return "", err
+		}
+		return builtin.GitLog(projectRoot, int(limit), ref, paths)
+	case "git_commit":
+		message, _ := args["message"].(string)
+		all, _ := args["all"].(bool)
+		amend, _ := args["amend"].(bool)
+		paths, err := resolvePathArgs(guard, args["paths"], tools.PathWrite)
+		if err != nil {
+			return "", err
+		}
+		opts := tools.GitCommitOptions{Message: message, Paths: paths, All: all, Amend: amend}
+		committed, err := tools.GitCommitPaths(projectRoot, opts)
+		if err != nil {
+			return "", err
+		}
+		// Committing records the files in history and commit hooks may
+		// rewrite them, so they have to be writable.
+		if err := s.checkGitWrites(tc, guard, name, committed); err != nil {
+			return "", err
+		}
+		return builtin.GitCommit(projectRoot, tc.GitPolicy(), opts)
+	case "git_branch":
+		opts := tools.GitBranchOptions{}
+		opts.Action, _ = args["action"].(string)
+		opts.Name, _ = args["name"].(string)
+		opts.StartPoint, _ = args["startPoint"].(string)
+		opts.Create, _ = args["create"].(bool)
+		opts.Force, _ = args["force"].(bool)
+		if strings.EqualFold(strings.TrimSpace(opts.Action), "switch") {
+			changed, err := tools.GitSwitchPaths(projectRoot, opts)
+			if err != nil {
+				return "", err
+			}
+			if err := s.checkGitWrites(tc, guard, name, changed); err != nil {
+				return "", err
+			}
+		}
+		return builtin.GitBranch(projectRoot, tc.GitPolicy(), opts)
+	case "git_worktree":
+		opts := tools.GitWorktreeOptions{}
+		opts.Action, _ = args["action"].(string)
+		opts.Branch, _ = args["branch"].(string)
+		opts.NewBranch, _ = args["newBranch"].(bool)
+		opts.Force, _ = args["force"].(bool)
+		if path, _ := args["path"].(string); path != "" {
+			p, err := guard.Resolve(path, tools.PathWrite)
+			if err != nil {
+				return "", err
+			}
+			opts.Path = p
+		}
+		return builtin.GitWorktree(projectRoot, tc.GitPolicy(), opts)
 	}
 	return "", fmt.Errorf("builtin %s not implemented in ToolService or handled by Orchestrator", name)
 }
 
-func (s *ToolService) GetEinoTools(agent *model.Agent) ([]*schema.ToolInfo, error) {
-	var infos []*schema.ToolInfo
+// checkGitWrites applies the write path policy to the files a git tool is
+// about to change and snapshots them, since git writes them directly.
+func (s *ToolService) checkGitWrites(tc *ToolCallContext, guard *tools.PathGuard, toolName string, paths []string) error {
+	for _, p := range paths {
+		if _, err := guard.Resolve(p, tools.PathWrite); err != nil {
+			return err
+		}
+	}
+	for _, p := range paths {
+		if err := s.checkpoints.Snapshot(tc, toolName, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolvePathArgs resolves a JSON array of paths through the guard.
+func resolvePathArgs(guard *tools.PathGuard, raw any, access tools.PathAccess) ([]string, error) {
+	items, _ := raw.([]any)
+	var paths []string
+	for _, item := range items {
+		p, err := guard.Resolve(fmt.Sprint(item), access)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// gitReadPaths resolves the pathspecs of a read-only git tool and excludes
+// the denied paths. Without pathspecs git shows the whole repository, which
+// a policy that limits the readable paths doesn't allow.
+func gitReadPaths(guard *tools.PathGuard, tool string, raw any) ([]string, error) {
+	paths, err := resolvePathArgs(guard, raw, tools.PathRead)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		if source := guard.ReadRestriction(); source != "" {
+			return nil, fmt.Errorf("%s needs paths: the %s policy limits the readable paths", tool, source)
+		}
+	}
+	return append(paths, guard.GitExcludes()...), nil
+}
+
+// goQueryArgs reads the arguments of find_definition/find_references. The
+// path defaults to the project root.
+func goQueryArgs(guard *tools.PathGuard, args map[string]any) (tools.GoQuery, error) {
+	var q tools.GoQuery
+	pathStr, _ := args["path"].(string)
+	if pathStr == "" {
+		pathStr = "."
+	}
+	target, err := guard.Resolve(pathStr, tools.PathRead)
+	if err != nil {
+		return q, err
+	}
+	line, _ := args["line"].(float64)
+	column, _ := args["column"].(float64)
+	q.Path = target
+	q.Symbol, _ = args["symbol"].(string)
+	q.Line, q.Column = int(line), int(column)
+	return q, nil
+}
 
-	// Add Builtins based on mode
-	m := ""
+func (s *ToolService) GetEinoTools(agent *model.Agent) ([]*schema.ToolInfo, error) {
+	var mode *model.Mode
 	if len(agent.Modes) > 0 {
-		m = agent.Modes[0].Key
+		mode, _ = resolveMode(repo.NewModeRepo(), agent.Modes[0].Key)
 	}
-	infos = append(infos, builtin.GetEinoTools(m)...)
+	return s.EffectiveTools(agent, mode), nil
+}
 
-	// Add MCP Tools
-	if s.mcpService != nil {
+// EffectiveTools is the single place that decides which tools an agent may
+// use in a (resolved) mode: the builtins the mode offers, the tools of the
+// agent's MCP servers and its custom/script/api tools, filtered by the mode's
+// deny list and the agent's tool policy. The chat loops offer exactly this
+// set to the model and Call refuses anything else. A nil mode gets the
+// default read-only builtins.
+func (s *ToolService) EffectiveTools(agent *model.Agent, mode *model.Mode) []*schema.ToolInfo {
+	policy, err := agent.GetToolPolicy()
+	if err != nil {
+		slog.Warn("invalid agent tool policy, ignoring it", slog.String("agent", agent.Name), slog.Any("error", err))
+	}
+	var modePolicy model.ModeToolPolicy
+	modeKey := ""
+	if mode != nil {
+		modeKey = mode.Key
+		if modePolicy, err = mode.GetToolPolicy(); err != nil {
+			slog.Warn("invalid mode tool policy, ignoring it", slog.String("mode", mode.Key), slog.Any("error", err))
+		}
+	}
+
+	var infos []*schema.ToolInfo
+	seen := make(map[string]bool)
+	add := func(info *schema.ToolInfo, byDefault bool) {
+		if info == nil || seen[info.Name] || model.MatchToolName(modePolicy.Deny, info.Name) || !policy.Allows(info.Name, byDefault) {
+			return
+		}
+		seen[info.Name] = true
+		infos = append(infos, info)
+	}
+
+	// Builtins: what the mode offers, plus any other builtin the agent
+	// policy enables explicitly.
+	all := builtin.GetEinoTools(consts.BuildMode)
+	if len(modePolicy.Builtins) > 0 {
+		for _, info := range all {
+			add(info, model.MatchToolName(modePolicy.Builtins, info.Name))
+		}
+	} else {
+		defaults := make(map[string]bool)
+		for _, info := range builtin.GetEinoTools(modeKey) {
+			defaults[info.Name] = true
+			add(info, true)
+		}
+		for _, info := range all {
+			add(info, defaults[info.Name])
+		}
+	}
+	if modePolicy.AllowsMCPTools() && s.mcpService != nil && len(agent.MCPServers) > 0 {
 		mcpTools, err := s.mcpService.GetToolsForServers(agent.MCPServers)
 		if err == nil {
-			infos = append(infos, mcpTools...)
+			for _, info := range mcpTools {
+				add(info, true)
+			}
 		}
 	}
 
-	// Add Custom Tools
+	if !modePolicy.AllowsAgentTools() {
+		return infos
+	}
 	for _, t := range agent.Tools {
-		if t.Type == consts.ToolTypeCustom || t.Type == consts.ToolTypeScript {
-			var js jsonschema.Schema
-			if err := json.Unmarshal([]byte(t.Parameters), &js); err == nil {
-				infos = append(infos, &schema.ToolInfo{
-					Name:        t.Name,
-					Desc:        t.Description,
-					ParamsOneOf: schema.NewParamsOneOfByJSONSchema(&js),
-				})
-			}
+		if t.Type != consts.ToolTypeCustom && t.Type != consts.ToolTypeScript && t.Type != consts.ToolTypeAPI {
+			continue
+		}
+		var js jsonschema.Schema
+		if err := json.Unmarshal([]byte(t.Parameters), &js); err != nil {
+			slog.Warn("invalid tool parameters schema", slog.String("tool", t.Name), slog.Any("error", err))
+			continue
 		}
+		add(&schema.ToolInfo{
+			Name:        t.Name,
+			Desc:        t.Description,
+			ParamsOneOf: schema.NewParamsOneOfByJSONSchema(&js),
+		}, true)
 	}
+	return infos
+}
 
-	return infos, nil
+// DescribeTools lists the effective tools of an agent for the API.
+func (s *ToolService) DescribeTools(agent *model.Agent, mode *model.Mode) []model.EffectiveTool {
+	sources := make(map[string]string, len(agent.Tools))
+	for _, t := range agent.Tools {
+		sources[t.Name] = t.Type
+	}
+	infos := s.EffectiveTools(agent, mode)
+	out := make([]model.EffectiveTool, 0, len(infos))
+	for _, info := range infos {
+		source := "builtin"
+		if src, ok := sources[info.Name]; ok {
+			source = src
+		} else if strings.HasPrefix(info.Name, "mcp__") {
+			source = "mcp"
+		}
+		out = append(out, model.EffectiveTool{Name: info.Name, Description: info.Desc, Source: source})
+	}
+	return out
 }
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"iat/common/model"
+	"iat/common/pkg/chat"
+	"iat/common/pkg/consts"
+	"iat/common/pkg/db"
+	"iat/engine/internal/repo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func toolNames(t *testing.T, svc *ToolService, agent *model.Agent, mode *model.Mode) map[string]bool {
+	t.Helper()
+	names := make(map[string]bool)
+	for _, info := range svc.EffectiveTools(agent, mode) {
+		names[info.Name] = true
+	}
+	return names
+}
+
+func TestToolService_EffectiveToolsPolicy(t *testing.T) {
+	svc := NewToolService(nil)
+	agent := &model.Agent{
+		Name:  "reviewer",
+		Tools: []model.Tool{{Name: "lookup", Type: consts.ToolTypeCustom, Parameters: `{"type":"object"}`}},
+	}
+	if err := agent.SetToolPolicy(model.AgentToolPolicy{
+		Enabled:  []string{"git_commit"},
+		Disabled: []string{"http_*", "fetch_url", "lookup"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := &model.Mode{Key: consts.PlanMode}
+	names := toolNames(t, svc, agent, plan)
+	if !names["read_file"] || !names["git_commit"] {
+		t.Fatalf("expected mode default and enabled builtin, got %v", names)
+	}
+	if names["write_file"] || names["http_request"] || names["fetch_url"] || names["lookup"] {
+		t.Fatalf("unexpected tools offered: %v", names)
+	}
+
+	tc := &ToolCallContext{Agent: agent, Mode: plan}
+	if _, err := svc.Call(context.Background(), "write_file", map[string]any{"path": "x", "content": ""}, tc); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Fatalf("expected write_file to be refused, got %v", err)
+	}
+	if _, err := svc.ValidateCall(0, "lookup", `{}`, svc.EffectiveTools(agent, plan)); err == nil {
+		t.Fatal("expected disabled custom tool to fail validation")
+	}
+	if _, err := svc.ValidateCall(0, "read_file", `{"path":"a"}`, nil); err == nil {
+		t.Fatal("expected validation to fail when no tools were offered")
+	}
+}
+
+func TestResolveMode_Inheritance(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Mode{}, &model.ToolApproval{})
+	db.DB = d
+
+	yes, no := true, false
+	modes := NewModeService()
+	plan := &model.Mode{Key: consts.PlanMode, Instructions: "Only write under plan/.", PathPolicy: `{"writable":["plan/**"]}`, Orchestrate: &yes, MaxTurns: 5, AllowGitRewrite: &yes}
+	if err := modes.CreateMode(plan); err != nil {
+		t.Fatal(err)
+	}
+	review := &model.Mode{Key: "REVIEW", ParentKey: consts.PlanMode, Instructions: "Review, don't fix.", Orchestrate: &no, AllowGitRewrite: &no}
+	review.SetToolPolicy(model.ModeToolPolicy{Deny: []string{"http_*", "fetch_url"}, Approve: []string{"git_diff"}, AgentTools: &no})
+	if err := modes.CreateMode(review); err != nil {
+		t.Fatal(err)
+	}
+	plan.ParentKey = "REVIEW"
+	if err := modes.UpdateMode(plan); err == nil {
+		t.Fatal("expected inheritance cycle to be rejected")
+	}
+
+	m, err := resolveMode(repo.NewModeRepo(), "review")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Key != "REVIEW" || m.MaxTurns != 5 || m.OrchestrationEnabled() || m.PathPolicy != plan.PathPolicy || (&ToolCallContext{Mode: m}).GitPolicy().AllowHistoryRewrite {
+		t.Fatalf("unexpected resolved mode: %+v", m)
+	}
+	if m.Instructions != "Only write under plan/.\n\nReview, don't fix." {
+		t.Fatalf("unexpected instructions %q", m.Instructions)
+	}
+
+	svc := NewToolService(nil)
+	agent := &model.Agent{Name: "reviewer", Tools: []model.Tool{{Name: "lookup", Type: consts.ToolTypeCustom, Parameters: `{"type":"object"}`}}}
+	names := toolNames(t, svc, agent, m)
+	if !names["read_file"] || !names["git_diff"] || names["write_file"] || names["http_request"] || names["lookup"] {
+		t.Fatalf("unexpected tools for inherited mode: %v", names)
+	}
+
+	tc := &ToolCallContext{SessionID: 7, Agent: agent, Mode: m}
+	var approvalErr *ToolApprovalError
+	if _, err := svc.Call(context.Background(), "git_diff", map[string]any{}, tc); !errors.As(err, &approvalErr) {
+		t.Fatalf("expected approval error, got %v", err)
+	}
+	if err := svc.ApproveTool(7, "git_*"); err != nil {
+		t.Fatal(err)
+	}
+	// Approvals are stored, so a new service (e.g. after a restart) keeps them.
+	if _, err := NewToolService(nil).Call(context.Background(), "git_diff", map[string]any{}, tc); errors.As(err, &approvalErr) {
+		t.Fatalf("approved tool still refused: %v", err)
+	}
+}
+
+func TestProjectSettings(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Project{}, &model.Session{})
+	db.DB = d
+
+	root := t.TempDir()
+	project := &model.Project{Name: "shop", Path: root}
+	if err := project.SetSettings(model.ProjectSettings{
+		DefaultAgentID: 7,
+		DefaultMode:    consts.PlanMode,
+		CommandPolicy:  model.CommandPolicy{Allow: []string{"echo", "printenv", "go test *"}, Deny: []string{"echo *secret*"}},
+		Env:            map[string]string{"SHOP_ENV": "test"},
+		IndexExclude:   []string{"vendor"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d.Create(project)
+
+	sess, err := NewSessionService().CreateSession("s", project.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.AgentID != 7 || sess.Mode != consts.PlanMode {
+		t.Fatalf("project defaults not applied: %+v", sess)
+	}
+
+	svc := NewToolService(nil)
+	tc := &ToolCallContext{Agent: &model.Agent{Name: "dev"}, Project: project, Mode: &model.Mode{Key: consts.BuildMode}}
+	out, err := svc.Call(context.Background(), "run_command", map[string]any{"command": "echo", "args": []any{"$SHOP_ENV"}}, tc)
+	if err != nil || strings.TrimSpace(out) != "test" {
+		t.Fatalf("expected project env in run_command, got %q, %v", out, err)
+	}
+	out, err = svc.Call(context.Background(), "run_command", map[string]any{"command": "printenv SHOP_ENV | echo piped"}, tc)
+	if err != nil || strings.TrimSpace(out) != "piped" {
+		t.Fatalf("expected run_command to run in a shell, got %q, %v", out, err)
+	}
+	for _, cmd := range []string{"echo the secret", "rm -rf /", "env rm -rf /", "echo ok && rm -rf /", "echo $(rm -rf /)"} {
+		if _, err := svc.Call(context.Background(), "run_command", map[string]any{"command": cmd}, tc); err == nil || !strings.Contains(err.Error(), "command policy") && !strings.Contains(err.Error(), "allowed commands") {
+			t.Fatalf("expected %q to be refused, got %v", cmd, err)
+		}
+	}
+	os.WriteFile(filepath.Join(root, "gen.sh"), []byte("echo generated\n"), 0755)
+	if _, err := svc.Call(context.Background(), "run_script", map[string]any{"scriptPath": "gen.sh"}, tc); err == nil || !strings.Contains(err.Error(), "allowed commands") {
+		t.Fatalf("expected run_script to follow the command policy, got %v", err)
+	}
+
+	files := filterIndexFiles([]string{"main.go", "vendor/lib/a.go"}, projectSettings(project))
+	if len(files) != 1 || files[0] != "main.go" {
+		t.Fatalf("index filter: %v", files)
+	}
+}
+
+func TestGitTools_PathPolicy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.ToolApproval{})
+	db.DB = d
+
+	root := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"config", "user.name", "Test"}, {"config", "user.email", "test@example.com"}} {
+		if out, err := exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	os.MkdirAll(filepath.Join(root, "plans"), 0755)
+	os.WriteFile(filepath.Join(root, "plans", "plan.md"), []byte("plan\n"), 0644)
+	os.WriteFile(filepath.Join(root, "plans", ".env"), []byte("TOKEN=1\n"), 0644)
+	os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644)
+
+	project := &model.Project{Path: root}
+	project.SetPathPolicy(model.PathPolicy{Denied: []string{".env"}})
+	mode := &model.Mode{Key: consts.BuildMode}
+	mode.SetPathPolicy(model.PathPolicy{Readable: []string{"plans"}})
+	tc := &ToolCallContext{SessionID: 1, Agent: &model.Agent{Name: "dev"}, Project: project, Mode: mode}
+	svc := NewToolService(nil)
+	ctx := context.Background()
+
+	out, err := svc.Call(ctx, "git_status", map[string]any{}, tc)
+	if err != nil || !strings.Contains(out, "plans/plan.md") || strings.Contains(out, "main.go") || strings.Contains(out, ".env") {
+		t.Fatalf("git_status must only list readable files, got %s (%v)", out, err)
+	}
+
+	// 模式限制了可读路径时，不带路径的 diff 会暴露整个仓库
+	if _, err := svc.Call(ctx, "git_diff", map[string]any{}, tc); err == nil || !strings.Contains(err.Error(), "needs paths") {
+		t.Fatalf("expected git_diff without paths to be refused, got %v", err)
+	}
+	if _, err := svc.Call(ctx, "git_log", map[string]any{"paths": []any{"main.go"}}, tc); err == nil {
+		t.Fatal("expected git_log of an unreadable path to be refused")
+	}
+
+	exec.Command("git", "-C", root, "add", "-A").Run()
+	out, err = svc.Call(ctx, "git_diff", map[string]any{"staged": true, "paths": []any{"plans"}}, tc)
+	if err != nil || !strings.Contains(out, "plans/plan.md") || strings.Contains(out, "TOKEN") {
+		t.Fatalf("git_diff must leave denied files out, got %s (%v)", out, err)
+	}
+}
+
+func TestScriptTool_HostAPI(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Task{}, &model.Script{}, &model.ScriptRun{})
+	db.DB = d
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewToolService(nil)
+	svc.SetTaskService(NewTaskService(nil))
+	combo := model.Tool{Name: "combo", Type: consts.ToolTypeScript, Parameters: `{"type":"object"}`, Content: `
+		const text = await iat.tools.call("read_file", {path: "notes.txt"});
+		const task = await iat.tasks.add("review " + text, {priority: "high"});
+		const tasks = await iat.tasks.list();
+		return text + ":" + tasks.length + ":" + tasks[0].priority + ":" + (task.id > 0);
+	`}
+	agent := &model.Agent{Name: "dev", Tools: []model.Tool{combo}}
+	tc := &ToolCallContext{SessionID: 3, Agent: agent, Project: &model.Project{Path: root}, Mode: &model.Mode{Key: consts.BuildMode}}
+
+	out, err := svc.Call(context.Background(), "combo", map[string]any{}, tc)
+	if err != nil || out != "hello:1:high:true" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+
+	// 脚本只能调用智能体自己可用的工具
+	agent.Tools[0].Content = `await iat.tools.call("write_file", {path: "x.txt", content: "x"})`
+	tc.Mode = &model.Mode{Key: consts.PlanMode}
+	if _, err := svc.Call(context.Background(), "combo", map[string]any{}, tc); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Fatalf("expected write_file to be refused in plan mode, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "x.txt")); err == nil {
+		t.Fatal("refused call still wrote the file")
+	}
+}
+
+func TestScriptTool_Hooks(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Hook{}, &model.Script{}, &model.ScriptRun{}, &model.Session{})
+	db.DB = d
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello secret"), 0644)
+	hooks := NewHookService()
+	for _, h := range []model.Hook{
+		{Name: "rewrite", Type: model.HookPreTool, TargetType: "global", Action: "script", Enabled: true,
+			Content: `context.toolName === "read_file" ? ({action: "modify", payload: {arguments: {path: "notes.txt"}}}) : null`},
+		{Name: "broken", Type: model.HookPreTool, TargetType: "global", Action: "script", Enabled: true, FailClosed: true,
+			Content: `if (context.toolName === "write_file") { throw new Error("boom") }`},
+		{Name: "redact", Type: model.HookPostTool, TargetType: "global", Action: "script", Enabled: true,
+			Content: `context.toolName === "read_file" ? ({action: "modify", payload: {result: context.result.replace(/secret/g, "***")}}) : null`},
+	} {
+		if err := hooks.CreateHook(&h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := NewToolService(nil)
+	svc.SetHookService(hooks)
+	combo := model.Tool{Name: "combo", Type: consts.ToolTypeScript, Parameters: `{"type":"object"}`,
+		Content: `return await iat.tools.call("read_file", {path: "other.txt"})`}
+	agent := &model.Agent{Name: "dev", Tools: []model.Tool{combo}}
+	tc := &ToolCallContext{SessionID: 3, Agent: agent, Project: &model.Project{Path: root}, Mode: &model.Mode{Key: consts.BuildMode}}
+
+	// iat.tools.call 与模型发起的调用一样经过 pre_tool/post_tool 钩子
+	out, err := svc.Call(context.Background(), "combo", map[string]any{}, tc)
+	if err != nil || out != "hello ***" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+
+	// 出错的 FailClosed pre 钩子拒绝调用，而不是放行
+	agent.Tools[0].Content = `await iat.tools.call("write_file", {path: "x.txt", content: "x"})`
+	if _, err := svc.Call(context.Background(), "combo", map[string]any{}, tc); err == nil || !strings.Contains(err.Error(), "blocked by hook broken") {
+		t.Fatalf("expected the failing hook to deny write_file, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "x.txt")); err == nil {
+		t.Fatal("denied call still wrote the file")
+	}
+}
+
+type recordingRunner struct {
+	depths []int
+	ctxErr error
+}
+
+func (r *recordingRunner) RunAgentInternal(ctx context.Context, sessionID uint, agentName, userMessage, projectRoot, mode string, depth int, parentTaskID string, eventChan chan<- chat.ChatEvent) (string, error) {
+	r.depths = append(r.depths, depth)
+	r.ctxErr = ctx.Err()
+	return "ran " + agentName, nil
+}
+
+func TestScriptTool_RunAgentDepth(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Script{}, &model.ScriptRun{})
+	db.DB = d
+
+	svc := NewToolService(nil)
+	runner := &recordingRunner{}
+	svc.SetAgentRunner(runner)
+	delegate := model.Tool{Name: "delegate", Type: consts.ToolTypeScript, Parameters: `{"type":"object"}`, Content: `return await iat.agents.run("reviewer", "check it")`}
+	agent := &model.Agent{Name: "dev", Tools: []model.Tool{delegate}}
+	tc := &ToolCallContext{SessionID: 3, Agent: agent, Project: &model.Project{Path: t.TempDir()}, Mode: &model.Mode{Key: consts.BuildMode}}
+
+	// 顶层对话里启动的子智能体深度为 0，子智能体里再启动的深度递增
+	if out, err := svc.Call(context.Background(), "delegate", map[string]any{}, tc); err != nil || out != "ran reviewer" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+	if _, err := svc.Call(withSubAgentDepth(context.Background(), 2), "delegate", map[string]any{}, tc); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.depths) != 2 || runner.depths[0] != 0 || runner.depths[1] != 3 || runner.ctxErr != nil {
+		t.Fatalf("unexpected depths %v (ctx err %v)", runner.depths, runner.ctxErr)
+	}
+
+	agent.Tools[0].Content = `return await iat.agents.run("dev", "again")`
+	if _, err := svc.Call(context.Background(), "delegate", map[string]any{}, tc); err == nil || !strings.Contains(err.Error(), "cannot run itself") {
+		t.Fatalf("expected an agent's script tool not to run the agent itself, got %v", err)
+	}
+}
@@ -15,11 +15,17 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// CodeIndexVersion is bumped when the layout of the code index changes;
+// indexes with an older version must be rebuilt before they can be searched.
+const CodeIndexVersion = 4
+
 type ProjectCodeIndexInfo struct {
 	ProjectID   uint   `json:"projectId"`
 	IndexedAt   string `json:"indexedAt"`
 	Files       int    `json:"files"`
 	TotalTokens int    `json:"totalTokens"`
+	TotalLength int    `json:"totalLength"` // token occurrences over all files, for BM25
+	Version     int    `json:"version"`
 }
 
 func ClearProjectCodeIndex(projectID uint) error {
@@ -29,6 +35,8 @@ func ClearProjectCodeIndex(projectID uint) error {
 	}
 	prefixes := []string{
 		fmt.Sprintf("tokf:%d:", projectID),
+		fmt.Sprintf("tokp:%d:", projectID),
+		fmt.Sprintf("ftok:%d:", projectID),
 		fmt.Sprintf("doc:%d:", projectID),
 		fmt.Sprintf("pcode:%d", projectID),
 	}
@@ -70,12 +78,23 @@ type CodeFileMeta struct {
 	Size     int64  `json:"size"`
 	ModTime  string `json:"modTime"`
 	TokenCnt int    `json:"tokenCnt"`
+	Length   int    `json:"length"` // token occurrences
+	Lang     string `json:"lang,omitempty"`
+	Hash     string `json:"hash,omitempty"` // sha1 of the content
 }
 
+// IndexProjectCodeFiles rebuilds the code index of a project from scratch.
+// Use SyncProjectCodeFiles to only update files that changed.
 func IndexProjectCodeFiles(projectID uint, projectPath string, relFiles []string) (*ProjectCodeIndexInfo, error) {
 	if strings.TrimSpace(projectPath) == "" {
 		return nil, fmt.Errorf("project path is empty")
 	}
+	unlock := lockProjectIndex(projectID)
+	defer unlock()
+	return rebuildProjectCodeIndex(projectID, projectPath, relFiles)
+}
+
+func rebuildProjectCodeIndex(projectID uint, projectPath string, relFiles []string) (*ProjectCodeIndexInfo, error) {
 	db, err := OpenDefault()
 	if err != nil {
 		return nil, err
@@ -84,110 +103,62 @@ func IndexProjectCodeFiles(projectID uint, projectPath string, relFiles []string
 		return nil, err
 	}
 
-	tokenToFiles := make(map[string]map[string]struct{}, 4096)
-	docBatch := new(leveldb.Batch)
-	filesIndexed := 0
-	totalTokens := 0
-
+	w := newCodeIndexWriter(db, projectID, true)
 	for _, rel := range relFiles {
 		rel = filepath.ToSlash(strings.TrimSpace(rel))
 		if rel == "" {
 			continue
 		}
-		abs := filepath.Join(projectPath, filepath.FromSlash(rel))
-		info, statErr := os.Stat(abs)
-		if statErr != nil {
-			continue
-		}
-		if info.IsDir() {
-			continue
-		}
-		if info.Size() > 2*1024*1024 {
-			continue
-		}
-		if !looksLikeTextFile(abs, info.Size()) {
-			continue
-		}
-		content, rerr := os.ReadFile(abs)
-		if rerr != nil {
+		f, ok := readIndexableFile(filepath.Join(projectPath, filepath.FromSlash(rel)))
+		if !ok {
 			continue
 		}
-		text := string(content)
-		tokens := tokenizeCodeText(text)
-		if len(tokens) == 0 {
-			continue
-		}
-		filesIndexed++
-		totalTokens += len(tokens)
-
-		for _, tok := range tokens {
-			m, ok := tokenToFiles[tok]
-			if !ok {
-				m = make(map[string]struct{}, 8)
-				tokenToFiles[tok] = m
-			}
-			m[rel] = struct{}{}
-		}
-
-		meta, _ := json.Marshal(CodeFileMeta{
-			Path:     rel,
-			Size:     info.Size(),
-			ModTime:  info.ModTime().UTC().Format(time.RFC3339),
-			TokenCnt: len(tokens),
-		})
-		docBatch.Put([]byte(fmt.Sprintf("doc:%d:%s", projectID, rel)), meta)
-		if docBatch.Len() >= 2000 {
-			if err := db.Write(docBatch, nil); err != nil {
-				return nil, err
-			}
-			docBatch = new(leveldb.Batch)
-		}
-	}
-
-	if docBatch.Len() > 0 {
-		if err := db.Write(docBatch, nil); err != nil {
+		if err := w.add(rel, f); err != nil {
 			return nil, err
 		}
 	}
-
-	postBatch := new(leveldb.Batch)
-	for tok, filesSet := range tokenToFiles {
-		files := make([]string, 0, len(filesSet))
-		for f := range filesSet {
-			files = append(files, f)
-		}
-		sort.Strings(files)
-		raw, _ := json.Marshal(files)
-		postBatch.Put([]byte(fmt.Sprintf("tokf:%d:%s", projectID, tok)), raw)
-		if postBatch.Len() >= 2000 {
-			if err := db.Write(postBatch, nil); err != nil {
-				return nil, err
-			}
-			postBatch = new(leveldb.Batch)
-		}
-	}
-	if postBatch.Len() > 0 {
-		if err := db.Write(postBatch, nil); err != nil {
-			return nil, err
-		}
+	if err := w.flush(); err != nil {
+		return nil, err
 	}
 
-	info, _ := json.Marshal(ProjectCodeIndexInfo{
+	res := &ProjectCodeIndexInfo{
 		ProjectID:   projectID,
 		IndexedAt:   time.Now().UTC().Format(time.RFC3339),
-		Files:       filesIndexed,
-		TotalTokens: totalTokens,
-	})
-	if err := db.Put([]byte(fmt.Sprintf("pcode:%d", projectID)), info, nil); err != nil {
+		Files:       w.files,
+		TotalTokens: w.tokens,
+		TotalLength: w.length,
+		Version:     CodeIndexVersion,
+	}
+	if err := putProjectCodeIndexInfo(db, res); err != nil {
 		return nil, err
 	}
+	return res, nil
+}
 
-	return &ProjectCodeIndexInfo{
-		ProjectID:   projectID,
-		IndexedAt:   time.Now().UTC().Format(time.RFC3339),
-		Files:       filesIndexed,
-		TotalTokens: totalTokens,
-	}, nil
+func putProjectCodeIndexInfo(db *leveldb.DB, info *ProjectCodeIndexInfo) error {
+	raw, _ := json.Marshal(info)
+	return db.Put([]byte(fmt.Sprintf("pcode:%d", info.ProjectID)), raw, nil)
+}
+
+// GetProjectCodeIndexInfo returns the code index summary of a project, or
+// nil if the project has no code index.
+func GetProjectCodeIndexInfo(projectID uint) (*ProjectCodeIndexInfo, error) {
+	db, err := OpenDefault()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := db.Get([]byte(fmt.Sprintf("pcode:%d", projectID)), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info ProjectCodeIndexInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
 }
 
 func looksLikeTextFile(path string, size int64) bool {
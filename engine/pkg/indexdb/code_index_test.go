@@ -50,3 +50,63 @@ func TestIndexProjectCodeFiles_WritesPostings(t *testing.T) {
 		t.Fatalf("expected tokf:1:* keys to be written")
 	}
 }
+
+func TestSyncProjectCodeFiles_Incremental(t *testing.T) {
+	projectDir := t.TempDir()
+	dbDir := filepath.Join(t.TempDir(), "indexdb")
+	_ = os.Setenv("IAT_INDEXDB_DIR", dbDir)
+	defer func() { _ = CloseDefault() }()
+
+	write := func(rel, content string) {
+		if err := os.WriteFile(filepath.Join(projectDir, rel), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", "package a\n\nfunc Alpha() {}\n")
+	write("b.go", "package a\n\nfunc Beta() {}\n")
+	write("c.go", "package a\n\nfunc Gamma() {}\n")
+
+	_, upd, err := SyncProjectCodeFiles(1, projectDir, []string{"a.go", "b.go", "c.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upd.Full || upd.Added != 3 {
+		t.Fatalf("first sync should rebuild the index: %+v", upd)
+	}
+
+	write("b.go", "package a\n\nfunc Delta() {}\n")
+	if err := os.Remove(filepath.Join(projectDir, "c.go")); err != nil {
+		t.Fatal(err)
+	}
+	write("d.go", "package a\n\nfunc Epsilon() {}\n")
+	info, upd, err := SyncProjectCodeFiles(1, projectDir, []string{"a.go", "b.go", "d.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upd.Full || upd.Added != 1 || upd.Updated != 1 || upd.Removed != 1 || upd.Unchanged != 1 {
+		t.Fatalf("unexpected update: %+v", upd)
+	}
+	if info.Files != 3 {
+		t.Fatalf("expected 3 files, got %d", info.Files)
+	}
+
+	for query, want := range map[string]int{"alpha": 1, "beta": 0, "delta": 1, "gamma": 0, "epsilon": 1, "package": 3} {
+		res, err := SearchCode(1, projectDir, query, CodeSearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Hits) != want {
+			t.Fatalf("%s: expected %d hits, got %d", query, want, len(res.Hits))
+		}
+	}
+	db, _ := OpenDefault()
+	if _, err := db.Get([]byte("tokf:1:gamma"), nil); err == nil {
+		t.Fatalf("postings of removed file should be deleted")
+	}
+	if _, err := db.Get([]byte("tokp:1:gamma:c.go"), nil); err == nil {
+		t.Fatalf("positions of removed file should be deleted")
+	}
+	if _, err := db.Get([]byte("tokp:1:delta:b.go"), nil); err != nil {
+		t.Fatalf("expected positions of b.go under their own key: %v", err)
+	}
+}
@@ -0,0 +1,481 @@
+package indexdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"iat/common/pkg/tools"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	// maxPositionsPerFile caps the occurrences of one token stored per file.
+	maxPositionsPerFile = 1000
+	// maxPrefixExpansions caps the number of tokens a prefix query expands to.
+	maxPrefixExpansions = 200
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type CodeSearchOptions struct {
+	PathGlobs    []string // only files matching one of these globs
+	Langs        []string // only files in one of these languages
+	Limit        int      // maximum number of files (default 20, max 100)
+	LinesPerFile int      // maximum matching lines per file (default 5)
+	// Allow, if set, is asked about every matching file before ranking and
+	// the limit, e.g. to hide files the caller's path policy can't read.
+	Allow func(rel string) bool
+}
+
+type CodeSearchLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+type CodeSearchHit struct {
+	Path  string           `json:"path"`
+	Lang  string           `json:"lang,omitempty"`
+	Score float64          `json:"score"`
+	Lines []CodeSearchLine `json:"lines"`
+}
+
+type CodeSearchResult struct {
+	Query string          `json:"query"`
+	Total int             `json:"total"` // matching files before the limit
+	Hits  []CodeSearchHit `json:"hits"`
+}
+
+// codeToken is one token occurrence: its ordinal position in the text, its
+// 1-based line and its byte range in the original text.
+type codeToken struct {
+	Text       string
+	Pos        int
+	Line       int
+	Start, End int
+}
+
+// tokenizeCodePositions splits text like tokenizeCodeText but keeps every
+// occurrence with its position, for phrase queries, snippets and highlights.
+func tokenizeCodePositions(input string) []codeToken {
+	var out []codeToken
+	var buf []rune
+	line := 1
+	bufLine, bufStart := 1, 0
+
+	flush := func(end int) {
+		if len(buf) == 0 {
+			return
+		}
+		out = append(out, codeToken{Text: string(buf), Pos: len(out), Line: bufLine, Start: bufStart, End: end})
+		buf = buf[:0]
+	}
+
+	for i, orig := range input {
+		r := unicode.ToLower(orig)
+		if r <= unicode.MaxASCII && ((r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_') {
+			if len(buf) == 0 {
+				bufLine, bufStart = line, i
+			}
+			buf = append(buf, r)
+			if len(buf) >= 64 {
+				flush(i + utf8.RuneLen(orig))
+			}
+			continue
+		}
+		flush(i)
+		if r > unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			out = append(out, codeToken{Text: string(r), Pos: len(out), Line: line, Start: i, End: i + utf8.RuneLen(orig)})
+		}
+		if r == '\n' {
+			line++
+		}
+	}
+	flush(len(input))
+	return out
+}
+
+// LanguageForPath guesses the language of a file from its name.
+func LanguageForPath(path string) string {
+	switch strings.ToLower(filepath.Base(path)) {
+	case "dockerfile":
+		return "dockerfile"
+	case "makefile":
+		return "makefile"
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return "go"
+	case ".js", ".mjs", ".cjs", ".jsx":
+		return "javascript"
+	case ".ts", ".tsx", ".mts", ".cts":
+		return "typescript"
+	case ".vue":
+		return "vue"
+	case ".py":
+		return "python"
+	case ".java":
+		return "java"
+	case ".kt", ".kts":
+		return "kotlin"
+	case ".rs":
+		return "rust"
+	case ".c", ".h":
+		return "c"
+	case ".cc", ".cpp", ".cxx", ".hpp", ".hh":
+		return "cpp"
+	case ".cs":
+		return "csharp"
+	case ".rb":
+		return "ruby"
+	case ".php":
+		return "php"
+	case ".swift":
+		return "swift"
+	case ".html", ".htm":
+		return "html"
+	case ".css", ".scss", ".less":
+		return "css"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".json":
+		return "json"
+	case ".yml", ".yaml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".xml":
+		return "xml"
+	case ".sql":
+		return "sql"
+	case ".sh", ".bash", ".zsh":
+		return "shell"
+	case ".bat", ".cmd", ".ps1":
+		return "batch"
+	case ".proto":
+		return "protobuf"
+	}
+	return ""
+}
+
+// codeClause is one required part of a query: a term, or a phrase of
+// consecutive terms. With prefix, the last term matches any token starting
+// with it.
+type codeClause struct {
+	terms  []string
+	prefix bool
+}
+
+// parseCodeQuery parses a search query. Words are ANDed; "quoted text" is a
+// phrase; word* is a prefix query; path:GLOB and lang:NAME filter files.
+// A word that splits into several tokens (e.g. pkg.Func) is a phrase.
+func parseCodeQuery(query string) ([]codeClause, []string, []string) {
+	var clauses []codeClause
+	var paths, langs []string
+	add := func(text string, prefix bool) {
+		var terms []string
+		for _, tok := range tokenizeCodePositions(text) {
+			terms = append(terms, tok.Text)
+		}
+		if len(terms) > 0 {
+			clauses = append(clauses, codeClause{terms: terms, prefix: prefix})
+		}
+	}
+
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			phrase := rest[1 : end+1]
+			add(strings.TrimSuffix(phrase, "*"), strings.HasSuffix(phrase, "*"))
+			rest = strings.TrimSpace(rest[min(end+2, len(rest)):])
+			continue
+		}
+		word := rest
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			word = rest[:i]
+		}
+		rest = strings.TrimSpace(rest[len(word):])
+		switch {
+		case strings.HasPrefix(word, "path:") && len(word) > len("path:"):
+			paths = append(paths, strings.TrimPrefix(word, "path:"))
+		case strings.HasPrefix(word, "lang:") && len(word) > len("lang:"):
+			langs = append(langs, strings.ToLower(strings.TrimPrefix(word, "lang:")))
+		default:
+			add(strings.TrimSuffix(word, "*"), strings.HasSuffix(word, "*"))
+		}
+	}
+	return clauses, paths, langs
+}
+
+// positionPostings maps a file to the flattened (position, line) pairs of a
+// token in it. They are stored per token and file under
+// tokp:{project}:{token}:{file}, so changing a file only rewrites its own keys.
+type positionPostings map[string][]int
+
+func positionsKey(projectID uint, tok, file string) []byte {
+	return []byte(fmt.Sprintf("tokp:%d:%s:%s", projectID, tok, file))
+}
+
+// loadPositions reads the postings of term, or with prefix those of every
+// token starting with term (at most maxPrefixExpansions tokens). Tokens never
+// contain ':', so the token ends at the first ':' after the key prefix.
+func loadPositions(db *leveldb.DB, projectID uint, term string, prefix bool) (positionPostings, error) {
+	base := fmt.Sprintf("tokp:%d:", projectID)
+	start := base + term
+	if !prefix {
+		start += ":"
+	}
+	out := positionPostings{}
+	iter := db.NewIterator(util.BytesPrefix([]byte(start)), nil)
+	defer iter.Release()
+	tokens, last := 0, ""
+	for iter.Next() {
+		tok, file, ok := strings.Cut(strings.TrimPrefix(string(iter.Key()), base), ":")
+		if !ok {
+			continue
+		}
+		if tok != last {
+			if tokens++; tokens > maxPrefixExpansions {
+				break
+			}
+			last = tok
+		}
+		var pairs []int
+		if err := json.Unmarshal(iter.Value(), &pairs); err != nil {
+			continue
+		}
+		out[file] = append(out[file], pairs...)
+	}
+	return out, iter.Error()
+}
+
+// clauseMatch is how often a clause matched in a file and on which lines.
+type clauseMatch struct {
+	tf    int
+	lines []int
+}
+
+func evalClause(db *leveldb.DB, projectID uint, c codeClause) (map[string]clauseMatch, error) {
+	first, err := loadPositions(db, projectID, c.terms[0], c.prefix && len(c.terms) == 1)
+	if err != nil {
+		return nil, err
+	}
+	// For phrases keep the start positions whose following tokens are the
+	// rest of the phrase.
+	starts := make(map[string]map[int]int, len(first)) // file -> start position -> line
+	for file, pairs := range first {
+		m := make(map[int]int, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			m[pairs[i]] = pairs[i+1]
+		}
+		starts[file] = m
+	}
+	for i := 1; i < len(c.terms) && len(starts) > 0; i++ {
+		next, err := loadPositions(db, projectID, c.terms[i], c.prefix && i == len(c.terms)-1)
+		if err != nil {
+			return nil, err
+		}
+		for file, m := range starts {
+			present := make(map[int]bool, len(next[file])/2)
+			for j := 0; j+1 < len(next[file]); j += 2 {
+				present[next[file][j]] = true
+			}
+			for pos := range m {
+				if !present[pos+i] {
+					delete(m, pos)
+				}
+			}
+			if len(m) == 0 {
+				delete(starts, file)
+			}
+		}
+	}
+
+	out := make(map[string]clauseMatch, len(starts))
+	for file, m := range starts {
+		if len(m) == 0 {
+			continue
+		}
+		match := clauseMatch{tf: len(m)}
+		for _, line := range m {
+			match.lines = append(match.lines, line)
+		}
+		out[file] = match
+	}
+	return out, nil
+}
+
+func matchesCodeFilters(rel string, paths, langs []string) bool {
+	if len(paths) > 0 {
+		ok := false
+		for _, g := range paths {
+			if tools.MatchPathGlob(g, rel) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(langs) > 0 {
+		lang := LanguageForPath(rel)
+		for _, l := range langs {
+			if l == lang {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// SearchCode searches the code index of a project. All words, phrases and
+// prefixes in the query must match; files are ranked with BM25 and come with
+// the matching lines read from projectPath.
+func SearchCode(projectID uint, projectPath, query string, opts CodeSearchOptions) (*CodeSearchResult, error) {
+	info, err := GetProjectCodeIndexInfo(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil || info.Version < CodeIndexVersion {
+		return nil, fmt.Errorf("project %d has no up-to-date code index", projectID)
+	}
+	db, err := OpenDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	clauses, paths, langs := parseCodeQuery(query)
+	paths = append(paths, opts.PathGlobs...)
+	for _, l := range opts.Langs {
+		langs = append(langs, strings.ToLower(l))
+	}
+	res := &CodeSearchResult{Query: query, Hits: []CodeSearchHit{}}
+	if len(clauses) == 0 {
+		return res, nil
+	}
+
+	// Evaluate all clauses, keeping only files that match every one.
+	var matches []map[string]clauseMatch
+	var candidates map[string]bool
+	for _, c := range clauses {
+		m, err := evalClause(db, projectID, c)
+		if err != nil {
+			return nil, err
+		}
+		next := make(map[string]bool, len(m))
+		for file := range m {
+			if (candidates == nil || candidates[file]) && matchesCodeFilters(file, paths, langs) && (opts.Allow == nil || opts.Allow(file)) {
+				next[file] = true
+			}
+		}
+		candidates = next
+		matches = append(matches, m)
+		if len(candidates) == 0 {
+			return res, nil
+		}
+	}
+
+	n := float64(max(info.Files, 1))
+	avgdl := float64(info.TotalLength) / n
+	if avgdl <= 0 {
+		avgdl = 1
+	}
+	for file := range candidates {
+		dl := avgdl
+		if raw, err := db.Get([]byte(fmt.Sprintf("doc:%d:%s", projectID, file)), nil); err == nil {
+			var meta CodeFileMeta
+			if json.Unmarshal(raw, &meta) == nil && meta.Length > 0 {
+				dl = float64(meta.Length)
+			}
+		}
+		hit := CodeSearchHit{Path: file, Lang: LanguageForPath(file)}
+		var lines []int
+		for _, m := range matches {
+			df := float64(len(m))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			tf := float64(m[file].tf)
+			hit.Score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*dl/avgdl))
+			lines = append(lines, m[file].lines...)
+		}
+		hit.Score = math.Round(hit.Score*1000) / 1000
+		hit.Lines = uniqueLines(lines)
+		res.Hits = append(res.Hits, hit)
+	}
+	sort.Slice(res.Hits, func(i, j int) bool {
+		if res.Hits[i].Score != res.Hits[j].Score {
+			return res.Hits[i].Score > res.Hits[j].Score
+		}
+		return res.Hits[i].Path < res.Hits[j].Path
+	})
+
+	res.Total = len(res.Hits)
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if len(res.Hits) > limit {
+		res.Hits = res.Hits[:limit]
+	}
+	perFile := opts.LinesPerFile
+	if perFile <= 0 {
+		perFile = 5
+	}
+	for i := range res.Hits {
+		res.Hits[i].Lines = snippetLines(filepath.Join(projectPath, filepath.FromSlash(res.Hits[i].Path)), res.Hits[i].Lines, perFile)
+	}
+	return res, nil
+}
+
+func uniqueLines(lines []int) []CodeSearchLine {
+	sort.Ints(lines)
+	var out []CodeSearchLine
+	for i, l := range lines {
+		if i == 0 || l != lines[i-1] {
+			out = append(out, CodeSearchLine{Line: l})
+		}
+	}
+	return out
+}
+
+// snippetLines fills in the text of the first limit lines from the file on
+// disk. Lines that no longer exist (the file changed since indexing) are
+// dropped.
+func snippetLines(path string, lines []CodeSearchLine, limit int) []CodeSearchLine {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []CodeSearchLine{}
+	}
+	text := strings.Split(string(data), "\n")
+	out := make([]CodeSearchLine, 0, min(limit, len(lines)))
+	for _, l := range lines {
+		if len(out) >= limit {
+			break
+		}
+		if l.Line < 1 || l.Line > len(text) {
+			continue
+		}
+		line := strings.TrimSpace(strings.TrimRight(text[l.Line-1], "\r"))
+		if r := []rune(line); len(r) > 240 {
+			line = string(r[:240]) + "..."
+		}
+		out = append(out, CodeSearchLine{Line: l.Line, Text: line})
+	}
+	return out
+}
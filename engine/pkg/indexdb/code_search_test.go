@@ -0,0 +1,92 @@
+package indexdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchCode(t *testing.T) {
+	projectDir := t.TempDir()
+	dbDir := filepath.Join(t.TempDir(), "indexdb")
+	_ = os.Setenv("IAT_INDEXDB_DIR", dbDir)
+	defer func() { _ = CloseDefault() }()
+
+	files := map[string]string{
+		"server/handler.go": "package server\n\n// HandleRequest serves the request.\nfunc HandleRequest() {\n\thandleRequest()\n\thandleRequest()\n}\n",
+		"server/util.go":    "package server\n\nfunc request() {}\n\nfunc handle() {}\n",
+		"web/app.ts":        "export function handleRequest() {\n  return fetchData()\n}\n",
+		"README.md":         "# Demo\n\nhandle the request here\n",
+	}
+	var rels []string
+	for rel, content := range files {
+		p := filepath.Join(projectDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rels = append(rels, rel)
+	}
+	if _, err := IndexProjectCodeFiles(1, projectDir, rels); err != nil {
+		t.Fatalf("index failed: %v", err)
+	}
+
+	paths := func(res *CodeSearchResult) []string {
+		var out []string
+		for _, h := range res.Hits {
+			out = append(out, h.Path)
+		}
+		return out
+	}
+
+	// 多次出现的文件排在前面，且带有匹配行
+	res, err := SearchCode(1, projectDir, "handlerequest", CodeSearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 2 || res.Hits[0].Path != "server/handler.go" {
+		t.Fatalf("unexpected hits: %v", paths(res))
+	}
+	if got := res.Hits[0].Lines; len(got) != 4 || got[0].Line != 3 || got[1].Text != "func HandleRequest() {" {
+		t.Fatalf("unexpected lines: %+v", got)
+	}
+
+	// 短语要求词相邻
+	res, err = SearchCode(1, projectDir, `"handle the request"`, CodeSearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(res); len(got) != 1 || got[0] != "README.md" {
+		t.Fatalf("phrase: unexpected hits: %v", got)
+	}
+
+	// 前缀与过滤
+	res, err = SearchCode(1, projectDir, "fetch* lang:typescript", CodeSearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(res); len(got) != 1 || got[0] != "web/app.ts" {
+		t.Fatalf("prefix: unexpected hits: %v", got)
+	}
+	res, err = SearchCode(1, projectDir, "handle request", CodeSearchOptions{PathGlobs: []string{"server/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(res); len(got) != 1 || got[0] != "server/util.go" {
+		t.Fatalf("path filter: unexpected hits: %v", got)
+	}
+
+	// Allow 在 limit 之前过滤，被拒绝的文件不占用名额
+	res, err = SearchCode(1, projectDir, "handlerequest", CodeSearchOptions{
+		Limit: 1,
+		Allow: func(rel string) bool { return rel != "server/handler.go" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(res); len(got) != 1 || got[0] != "web/app.ts" || res.Total != 1 {
+		t.Fatalf("allow: unexpected hits: %v (total %d)", got, res.Total)
+	}
+}
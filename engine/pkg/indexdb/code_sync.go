@@ -0,0 +1,394 @@
+package indexdb
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// --- Incremental Code Indexing ---
+
+// CodeIndexUpdate summarizes what an index run changed.
+type CodeIndexUpdate struct {
+	Full      bool  `json:"full"` // the index was rebuilt from scratch
+	Added     int   `json:"added"`
+	Updated   int   `json:"updated"`
+	Removed   int   `json:"removed"`
+	Unchanged int   `json:"unchanged"`
+	Duration  int64 `json:"durationMs"`
+}
+
+var projectIndexLocks sync.Map // projectID -> *sync.Mutex
+
+// lockProjectIndex serializes writes to the code index of one project, so a
+// manual index run and the watcher don't interleave.
+func lockProjectIndex(projectID uint) func() {
+	v, _ := projectIndexLocks.LoadOrStore(projectID, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+type indexableFile struct {
+	Text    string
+	Size    int64
+	ModTime string
+	Hash    string
+}
+
+func fileModTime(info os.FileInfo) string {
+	return info.ModTime().UTC().Format(time.RFC3339Nano)
+}
+
+// readIndexableFile reads a file if it should be in the code index: a
+// regular text file of at most 2MB.
+func readIndexableFile(abs string) (indexableFile, bool) {
+	info, err := os.Stat(abs)
+	if err != nil || info.IsDir() || info.Size() > 2*1024*1024 {
+		return indexableFile{}, false
+	}
+	if !looksLikeTextFile(abs, info.Size()) {
+		return indexableFile{}, false
+	}
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return indexableFile{}, false
+	}
+	sum := sha1.Sum(content)
+	return indexableFile{
+		Text:    string(content),
+		Size:    info.Size(),
+		ModTime: fileModTime(info),
+		Hash:    hex.EncodeToString(sum[:]),
+	}, true
+}
+
+// SyncProjectCodeFiles brings the code index of a project in line with
+// relFiles (the complete list of project files). Files whose size and
+// modification time are unchanged are skipped, files whose content hash is
+// unchanged only get their metadata refreshed, and files no longer listed
+// are removed. Without an up-to-date index it falls back to a full rebuild.
+func SyncProjectCodeFiles(projectID uint, projectPath string, relFiles []string) (*ProjectCodeIndexInfo, *CodeIndexUpdate, error) {
+	if strings.TrimSpace(projectPath) == "" {
+		return nil, nil, fmt.Errorf("project path is empty")
+	}
+	start := time.Now()
+	unlock := lockProjectIndex(projectID)
+	defer unlock()
+
+	info, err := GetProjectCodeIndexInfo(projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info == nil || info.Version < CodeIndexVersion {
+		info, err := rebuildProjectCodeIndex(projectID, projectPath, relFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+		return info, &CodeIndexUpdate{Full: true, Added: info.Files, Duration: time.Since(start).Milliseconds()}, nil
+	}
+
+	db, err := OpenDefault()
+	if err != nil {
+		return nil, nil, err
+	}
+	existing, err := loadCodeFileMetas(db, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := newCodeIndexWriter(db, projectID, false)
+	upd := &CodeIndexUpdate{}
+	wanted := make(map[string]bool, len(relFiles))
+	for _, rel := range relFiles {
+		rel = filepath.ToSlash(strings.TrimSpace(rel))
+		if rel == "" || wanted[rel] {
+			continue
+		}
+		wanted[rel] = true
+		abs := filepath.Join(projectPath, filepath.FromSlash(rel))
+		old, indexed := existing[rel]
+
+		if indexed {
+			if st, err := os.Stat(abs); err == nil && st.Size() == old.Size && fileModTime(st) == old.ModTime {
+				upd.Unchanged++
+				continue
+			}
+		}
+		f, ok := readIndexableFile(abs)
+		switch {
+		case !ok && indexed:
+			if err := w.remove(rel, old); err != nil {
+				return nil, nil, err
+			}
+			upd.Removed++
+		case !ok:
+		case indexed && f.Hash == old.Hash:
+			// 内容未变（例如只是 touch），只刷新元数据
+			old.Size, old.ModTime = f.Size, f.ModTime
+			w.putMeta(old)
+			upd.Unchanged++
+		default:
+			if indexed {
+				if err := w.remove(rel, old); err != nil {
+					return nil, nil, err
+				}
+			}
+			if err := w.add(rel, f); err != nil {
+				return nil, nil, err
+			}
+			if indexed {
+				upd.Updated++
+			} else {
+				upd.Added++
+			}
+		}
+	}
+	for rel, old := range existing {
+		if !wanted[rel] {
+			if err := w.remove(rel, old); err != nil {
+				return nil, nil, err
+			}
+			upd.Removed++
+		}
+	}
+	if err := w.flush(); err != nil {
+		return nil, nil, err
+	}
+
+	info.Files += w.files
+	info.TotalTokens += w.tokens
+	info.TotalLength += w.length
+	if upd.Added+upd.Updated+upd.Removed > 0 {
+		info.IndexedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if err := putProjectCodeIndexInfo(db, info); err != nil {
+		return nil, nil, err
+	}
+	upd.Duration = time.Since(start).Milliseconds()
+	return info, upd, nil
+}
+
+func loadCodeFileMetas(db *leveldb.DB, projectID uint) (map[string]CodeFileMeta, error) {
+	iter := db.NewIterator(util.BytesPrefix([]byte(fmt.Sprintf("doc:%d:", projectID))), nil)
+	defer iter.Release()
+	out := make(map[string]CodeFileMeta)
+	for iter.Next() {
+		var meta CodeFileMeta
+		if err := json.Unmarshal(iter.Value(), &meta); err == nil && meta.Path != "" {
+			out[meta.Path] = meta
+		}
+	}
+	return out, iter.Error()
+}
+
+// codeIndexWriter applies file additions and removals to the postings of a
+// project. File lists are loaded on first use, changed in memory and written
+// by flush; positions only record the files that changed. files/tokens/length track the change of the index totals.
+type codeIndexWriter struct {
+	db        *leveldb.DB
+	projectID uint
+	fresh     bool // the index is empty, nothing to load
+	batch     *leveldb.Batch
+
+	tokFiles  map[string]map[string]struct{} // tokf: token -> files
+	positions map[string]positionPostings    // tokp: token -> changed file -> (pos, line) pairs, nil to delete
+
+	files, tokens, length int
+}
+
+func newCodeIndexWriter(db *leveldb.DB, projectID uint, fresh bool) *codeIndexWriter {
+	return &codeIndexWriter{
+		db:        db,
+		projectID: projectID,
+		fresh:     fresh,
+		batch:     new(leveldb.Batch),
+		tokFiles:  make(map[string]map[string]struct{}, 4096),
+		positions: make(map[string]positionPostings, 4096),
+	}
+}
+
+func (w *codeIndexWriter) key(prefix, s string) []byte {
+	return []byte(fmt.Sprintf("%s:%d:%s", prefix, w.projectID, s))
+}
+
+func (w *codeIndexWriter) write() error {
+	if w.batch.Len() < 2000 {
+		return nil
+	}
+	if err := w.db.Write(w.batch, nil); err != nil {
+		return err
+	}
+	w.batch = new(leveldb.Batch)
+	return nil
+}
+
+func (w *codeIndexWriter) filesOf(tok string) (map[string]struct{}, error) {
+	if m, ok := w.tokFiles[tok]; ok {
+		return m, nil
+	}
+	m := make(map[string]struct{}, 8)
+	if !w.fresh {
+		raw, err := w.db.Get(w.key("tokf", tok), nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			return nil, err
+		}
+		var files []string
+		if len(raw) > 0 {
+			_ = json.Unmarshal(raw, &files)
+		}
+		for _, f := range files {
+			m[f] = struct{}{}
+		}
+	}
+	w.tokFiles[tok] = m
+	return m, nil
+}
+
+// positionsOf returns the pending position changes of tok. Positions are
+// keyed per file, so unlike filesOf nothing has to be loaded.
+func (w *codeIndexWriter) positionsOf(tok string) positionPostings {
+	p, ok := w.positions[tok]
+	if !ok {
+		p = positionPostings{}
+		w.positions[tok] = p
+	}
+	return p
+}
+
+func (w *codeIndexWriter) putMeta(meta CodeFileMeta) {
+	raw, _ := json.Marshal(meta)
+	w.batch.Put(w.key("doc", meta.Path), raw)
+}
+
+// add indexes a file. Files without tokens are not indexed.
+func (w *codeIndexWriter) add(rel string, f indexableFile) error {
+	tokens := tokenizeCodeText(f.Text)
+	if len(tokens) == 0 {
+		return nil
+	}
+	occurrences := tokenizeCodePositions(f.Text)
+	for _, tok := range tokens {
+		m, err := w.filesOf(tok)
+		if err != nil {
+			return err
+		}
+		m[rel] = struct{}{}
+	}
+	for _, occ := range occurrences {
+		p := w.positionsOf(occ.Text)
+		if len(p[rel]) < 2*maxPositionsPerFile {
+			p[rel] = append(p[rel], occ.Pos, occ.Line)
+		}
+	}
+
+	// 记录文件贡献的词，增量更新时据此从倒排表中删除
+	seen := make(map[string]struct{}, len(tokens))
+	fileTokens := make([]string, 0, len(tokens))
+	for _, occ := range occurrences {
+		if _, ok := seen[occ.Text]; !ok {
+			seen[occ.Text] = struct{}{}
+			fileTokens = append(fileTokens, occ.Text)
+		}
+	}
+	for _, tok := range tokens {
+		if _, ok := seen[tok]; !ok {
+			seen[tok] = struct{}{}
+			fileTokens = append(fileTokens, tok)
+		}
+	}
+	raw, _ := json.Marshal(fileTokens)
+	w.batch.Put(w.key("ftok", rel), raw)
+	w.putMeta(CodeFileMeta{
+		Path:     rel,
+		Size:     f.Size,
+		ModTime:  f.ModTime,
+		TokenCnt: len(tokens),
+		Length:   len(occurrences),
+		Lang:     LanguageForPath(rel),
+		Hash:     f.Hash,
+	})
+
+	w.files++
+	w.tokens += len(tokens)
+	w.length += len(occurrences)
+	return w.write()
+}
+
+// remove drops a file and its postings from the index.
+func (w *codeIndexWriter) remove(rel string, meta CodeFileMeta) error {
+	raw, err := w.db.Get(w.key("ftok", rel), nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return err
+	}
+	var fileTokens []string
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &fileTokens)
+	}
+	for _, tok := range fileTokens {
+		m, err := w.filesOf(tok)
+		if err != nil {
+			return err
+		}
+		delete(m, rel)
+		w.positionsOf(tok)[rel] = nil
+	}
+	w.batch.Delete(w.key("ftok", rel))
+	w.batch.Delete(w.key("doc", rel))
+
+	w.files--
+	w.tokens -= meta.TokenCnt
+	w.length -= meta.Length
+	return w.write()
+}
+
+// flush writes the changed postings; empty postings are deleted.
+func (w *codeIndexWriter) flush() error {
+	for tok, m := range w.tokFiles {
+		if len(m) == 0 {
+			w.batch.Delete(w.key("tokf", tok))
+		} else {
+			files := make([]string, 0, len(m))
+			for f := range m {
+				files = append(files, f)
+			}
+			sort.Strings(files)
+			raw, _ := json.Marshal(files)
+			w.batch.Put(w.key("tokf", tok), raw)
+		}
+		if err := w.write(); err != nil {
+			return err
+		}
+	}
+	for tok, p := range w.positions {
+		for file, pairs := range p {
+			key := positionsKey(w.projectID, tok, file)
+			if pairs == nil {
+				w.batch.Delete(key)
+			} else {
+				raw, _ := json.Marshal(pairs)
+				w.batch.Put(key, raw)
+			}
+		}
+		if err := w.write(); err != nil {
+			return err
+		}
+	}
+	if w.batch.Len() > 0 {
+		if err := w.db.Write(w.batch, nil); err != nil {
+			return err
+		}
+		w.batch = new(leveldb.Batch)
+	}
+	return nil
+}
@@ -73,6 +73,8 @@ func CloseDefault() error {
 	}
 	err := openDB.Close()
 	openDB = nil
+	// 允许关闭后重新打开（例如测试中切换 IAT_INDEXDB_DIR）
+	openOnce = sync.Once{}
 	return err
 }
 
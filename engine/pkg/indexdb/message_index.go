@@ -0,0 +1,417 @@
+package indexdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// --- Message Index ---
+//
+// Session messages (content, tool arguments and outputs) and session
+// summaries are indexed as documents. Keys:
+//
+//	mpost:{token}:{docKey} -> positions of the token in the document
+//	mdoc:{docKey}          -> MessageDoc
+//	mstat                  -> MessageIndexState
+//
+// docKey is "m{messageID}" for messages and "s{sessionID}" for summaries.
+
+// MessageIndexVersion is bumped when the layout of the message index
+// changes; an index with another version is dropped and rebuilt.
+const MessageIndexVersion = 1
+
+// maxPositionsPerDoc caps the occurrences of one token stored per document.
+const maxPositionsPerDoc = 200
+
+// MessageDoc describes an indexed message or session summary.
+type MessageDoc struct {
+	Key       string   `json:"key"`
+	MessageID uint     `json:"messageId,omitempty"`
+	SessionID uint     `json:"sessionId"`
+	ProjectID uint     `json:"projectId"`
+	AgentID   uint     `json:"agentId"`
+	Role      string   `json:"role"`
+	ToolName  string   `json:"toolName,omitempty"`
+	CreatedAt int64    `json:"createdAt"` // unix seconds
+	Length    int      `json:"length"`
+	Tokens    []string `json:"tokens,omitempty"`
+}
+
+func MessageDocKey(messageID uint) string { return fmt.Sprintf("m%d", messageID) }
+func SummaryDocKey(sessionID uint) string { return fmt.Sprintf("s%d", sessionID) }
+
+// MessageIndexState is the summary of the message index. Watermark is the
+// time up to which changes have been indexed.
+type MessageIndexState struct {
+	Version     int       `json:"version"`
+	Docs        int       `json:"docs"`
+	TotalLength int       `json:"totalLength"`
+	Watermark   time.Time `json:"watermark"`
+}
+
+// GetMessageIndexState returns the state of the message index. An index of
+// another version is cleared first, so callers start from a zero watermark.
+func GetMessageIndexState() (*MessageIndexState, error) {
+	db, err := OpenDefault()
+	if err != nil {
+		return nil, err
+	}
+	st := &MessageIndexState{}
+	raw, err := db.Get([]byte("mstat"), nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, st)
+	}
+	if st.Version != MessageIndexVersion {
+		for _, p := range []string{"mpost:", "mdoc:"} {
+			if err := clearPrefix(db, []byte(p)); err != nil {
+				return nil, err
+			}
+		}
+		st = &MessageIndexState{Version: MessageIndexVersion}
+		if err := putMessageIndexState(db, st); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+func putMessageIndexState(db *leveldb.DB, st *MessageIndexState) error {
+	raw, _ := json.Marshal(st)
+	return db.Put([]byte("mstat"), raw, nil)
+}
+
+// UpdateMessageIndex removes the documents in remove, (re)indexes docs with
+// the given texts and advances the watermark. texts[i] belongs to docs[i];
+// documents without tokens are only removed.
+func UpdateMessageIndex(docs []MessageDoc, texts []string, remove []string, watermark time.Time) error {
+	st, err := GetMessageIndexState()
+	if err != nil {
+		return err
+	}
+	db, err := OpenDefault()
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	flush := func(force bool) error {
+		if batch.Len() == 0 || (!force && batch.Len() < 2000) {
+			return nil
+		}
+		if err := db.Write(batch, nil); err != nil {
+			return err
+		}
+		batch = new(leveldb.Batch)
+		return nil
+	}
+	drop := func(key string) error {
+		raw, err := db.Get([]byte("mdoc:"+key), nil)
+		if err == leveldb.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var old MessageDoc
+		if err := json.Unmarshal(raw, &old); err != nil {
+			return err
+		}
+		for _, tok := range old.Tokens {
+			batch.Delete([]byte("mpost:" + tok + ":" + key))
+		}
+		batch.Delete([]byte("mdoc:" + key))
+		st.Docs--
+		st.TotalLength -= old.Length
+		return flush(false)
+	}
+
+	for _, key := range remove {
+		if err := drop(key); err != nil {
+			return err
+		}
+	}
+	for i, doc := range docs {
+		if err := drop(doc.Key); err != nil {
+			return err
+		}
+		occurrences := tokenizeCodePositions(texts[i])
+		if len(occurrences) == 0 {
+			continue
+		}
+		positions := make(map[string][]int)
+		doc.Tokens = nil
+		for _, occ := range occurrences {
+			if _, ok := positions[occ.Text]; !ok {
+				doc.Tokens = append(doc.Tokens, occ.Text)
+			}
+			if len(positions[occ.Text]) < maxPositionsPerDoc {
+				positions[occ.Text] = append(positions[occ.Text], occ.Pos)
+			}
+		}
+		for tok, pos := range positions {
+			raw, _ := json.Marshal(pos)
+			batch.Put([]byte("mpost:"+tok+":"+doc.Key), raw)
+		}
+		doc.Length = len(occurrences)
+		raw, _ := json.Marshal(doc)
+		batch.Put([]byte("mdoc:"+doc.Key), raw)
+		st.Docs++
+		st.TotalLength += doc.Length
+		if err := flush(false); err != nil {
+			return err
+		}
+	}
+	if err := flush(true); err != nil {
+		return err
+	}
+	if watermark.After(st.Watermark) {
+		st.Watermark = watermark
+	}
+	return putMessageIndexState(db, st)
+}
+
+type MessageSearchOptions struct {
+	ProjectID uint
+	AgentID   uint
+	SessionID uint
+	Roles     []string
+	From, To  time.Time // zero = unbounded
+}
+
+// MessageDocHit is a matching document with its BM25 score.
+type MessageDocHit struct {
+	Doc   MessageDoc
+	Score float64
+}
+
+// SearchMessages searches the message index. The query syntax is the one of
+// SearchCode (words ANDed, "phrases", prefix*). It returns all matching
+// documents ordered by score and the index tokens the query matched, for
+// highlighting.
+func SearchMessages(query string, opts MessageSearchOptions) ([]MessageDocHit, []string, error) {
+	st, err := GetMessageIndexState()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := OpenDefault()
+	if err != nil {
+		return nil, nil, err
+	}
+	clauses, _, _ := parseCodeQuery(query)
+	if len(clauses) == 0 {
+		return nil, nil, nil
+	}
+
+	matched := make(map[string]struct{})
+	var tfs []map[string]int // per clause: docKey -> term frequency
+	var candidates map[string]bool
+	for _, c := range clauses {
+		tf, err := evalMessageClause(db, c, matched)
+		if err != nil {
+			return nil, nil, err
+		}
+		next := make(map[string]bool, len(tf))
+		for key := range tf {
+			if candidates == nil || candidates[key] {
+				next[key] = true
+			}
+		}
+		candidates = next
+		tfs = append(tfs, tf)
+		if len(candidates) == 0 {
+			return nil, nil, nil
+		}
+	}
+
+	n := float64(max(st.Docs, 1))
+	avgdl := float64(st.TotalLength) / n
+	if avgdl <= 0 {
+		avgdl = 1
+	}
+	roles := make(map[string]bool, len(opts.Roles))
+	for _, r := range opts.Roles {
+		roles[strings.ToLower(r)] = true
+	}
+
+	var hits []MessageDocHit
+	for key := range candidates {
+		raw, err := db.Get([]byte("mdoc:"+key), nil)
+		if err != nil {
+			continue
+		}
+		var doc MessageDoc
+		if json.Unmarshal(raw, &doc) != nil {
+			continue
+		}
+		switch {
+		case opts.ProjectID != 0 && doc.ProjectID != opts.ProjectID,
+			opts.AgentID != 0 && doc.AgentID != opts.AgentID,
+			opts.SessionID != 0 && doc.SessionID != opts.SessionID,
+			len(roles) > 0 && !roles[doc.Role],
+			!opts.From.IsZero() && doc.CreatedAt < opts.From.Unix(),
+			!opts.To.IsZero() && doc.CreatedAt > opts.To.Unix():
+			continue
+		}
+		doc.Tokens = nil
+		hit := MessageDocHit{Doc: doc}
+		dl := float64(max(doc.Length, 1))
+		for _, tf := range tfs {
+			df := float64(len(tf))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			f := float64(tf[key])
+			hit.Score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*dl/avgdl))
+		}
+		hit.Score = math.Round(hit.Score*1000) / 1000
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Doc.CreatedAt > hits[j].Doc.CreatedAt
+	})
+
+	terms := make([]string, 0, len(matched))
+	for t := range matched {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+	return hits, terms, nil
+}
+
+// loadMessagePostings returns docKey -> positions for a term, or for all
+// tokens starting with it. Matching tokens are added to matched.
+func loadMessagePostings(db *leveldb.DB, term string, prefix bool, matched map[string]struct{}) (map[string][]int, error) {
+	key := "mpost:" + term
+	if !prefix {
+		key += ":"
+	}
+	out := make(map[string][]int)
+	iter := db.NewIterator(util.BytesPrefix([]byte(key)), nil)
+	defer iter.Release()
+	expansions := 0
+	lastTok := ""
+	for iter.Next() {
+		k := strings.TrimPrefix(string(iter.Key()), "mpost:")
+		i := strings.LastIndexByte(k, ':')
+		if i < 0 {
+			continue
+		}
+		tok, doc := k[:i], k[i+1:]
+		if tok != lastTok {
+			if expansions++; expansions > maxPrefixExpansions {
+				break
+			}
+			lastTok = tok
+			matched[tok] = struct{}{}
+		}
+		var pos []int
+		if err := json.Unmarshal(iter.Value(), &pos); err != nil {
+			continue
+		}
+		out[doc] = append(out[doc], pos...)
+	}
+	return out, iter.Error()
+}
+
+func evalMessageClause(db *leveldb.DB, c codeClause, matched map[string]struct{}) (map[string]int, error) {
+	first, err := loadMessagePostings(db, c.terms[0], c.prefix && len(c.terms) == 1, matched)
+	if err != nil {
+		return nil, err
+	}
+	starts := make(map[string]map[int]bool, len(first))
+	for doc, pos := range first {
+		m := make(map[int]bool, len(pos))
+		for _, p := range pos {
+			m[p] = true
+		}
+		starts[doc] = m
+	}
+	for i := 1; i < len(c.terms) && len(starts) > 0; i++ {
+		next, err := loadMessagePostings(db, c.terms[i], c.prefix && i == len(c.terms)-1, matched)
+		if err != nil {
+			return nil, err
+		}
+		for doc, m := range starts {
+			present := make(map[int]bool, len(next[doc]))
+			for _, p := range next[doc] {
+				present[p] = true
+			}
+			for p := range m {
+				if !present[p+i] {
+					delete(m, p)
+				}
+			}
+			if len(m) == 0 {
+				delete(starts, doc)
+			}
+		}
+	}
+	out := make(map[string]int, len(starts))
+	for doc, m := range starts {
+		out[doc] = len(m)
+	}
+	return out, nil
+}
+
+// Highlight is a byte range [Start, End) in a snippet.
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Snippet cuts a window of about width bytes around the first occurrence of
+// one of terms in text and returns it with the ranges of all occurrences in
+// it. ok is false if text contains none of the terms.
+func Snippet(text string, terms []string, width int) (string, []Highlight, bool) {
+	want := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		want[t] = true
+	}
+	var spans []codeToken
+	for _, tok := range tokenizeCodePositions(text) {
+		if want[tok.Text] {
+			spans = append(spans, tok)
+		}
+	}
+	if len(spans) == 0 {
+		return "", nil, false
+	}
+
+	start := max(spans[0].Start-width/3, 0)
+	end := min(start+width, len(text))
+	start = max(min(start, end-width), 0)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(text) {
+		suffix = "…"
+	}
+	snippet := prefix + text[start:end] + suffix
+	var hl []Highlight
+	for _, sp := range spans {
+		if sp.Start >= start && sp.End <= end {
+			hl = append(hl, Highlight{Start: sp.Start - start + len(prefix), End: sp.End - start + len(prefix)})
+		}
+	}
+	return snippet, hl, true
+}
@@ -5,6 +5,7 @@ import (
 	"iat/common/pkg/consts"
 	"iat/engine/pkg/tools/builtin"
 	"log"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -15,25 +16,35 @@ func Seed(db *gorm.DB) {
 	seedBuiltinAgents(db)
 }
 
+// modeSeedVersion is bumped when the built-in modes get settings existing
+// rows should receive.
+const modeSeedVersion = 1
+
 func seedModes(db *gorm.DB) {
+	orchestrate := true
 	modes := []model.Mode{
 		{
 			Key:          consts.ChatMode,
 			Name:         "Chat",
 			Description:  "General conversational mode",
 			SystemPrompt: consts.SystemPromptChat,
+			ToolPolicy:   `{"agentTools":false}`, // chat doesn't run the agent's custom tools
 		},
 		{
 			Key:          consts.PlanMode,
 			Name:         "Plan",
 			Description:  "Planning mode with restricted file access",
 			SystemPrompt: consts.SystemPromptPlan,
+			Instructions: strings.TrimSpace(consts.SystemPromptPlanRestriction),
+			PathPolicy:   `{"readable":["plan/**"],"writable":["plan/**"]}`,
+			Orchestrate:  &orchestrate,
 		},
 		{
 			Key:          consts.BuildMode,
 			Name:         "Build",
 			Description:  "Build mode with full project access",
 			SystemPrompt: consts.SystemPromptBuild,
+			Orchestrate:  &orchestrate,
 		},
 	}
 
@@ -41,9 +52,35 @@ func seedModes(db *gorm.DB) {
 		var count int64
 		db.Model(&model.Mode{}).Where("key = ?", mode.Key).Count(&count)
 		if count == 0 {
+			mode.SeedVersion = modeSeedVersion
 			db.Create(&mode)
 			log.Printf("Seeded mode: %s", mode.Name)
+			continue
+		}
+		// Modes seeded before these settings existed get the defaults once;
+		// after that the row is the user's, including settings they cleared.
+		var seeded int64
+		db.Model(&model.Mode{}).Where("key = ? AND seed_version >= ?", mode.Key, modeSeedVersion).Count(&seeded)
+		if seeded > 0 {
+			continue
+		}
+		for column, value := range map[string]string{
+			"path_policy":  mode.PathPolicy,
+			"tool_policy":  mode.ToolPolicy,
+			"instructions": mode.Instructions,
+		} {
+			if value != "" {
+				db.Model(&model.Mode{}).
+					Where("key = ? AND ("+column+" IS NULL OR "+column+" = '')", mode.Key).
+					Update(column, value)
+			}
+		}
+		if mode.Orchestrate != nil {
+			db.Model(&model.Mode{}).
+				Where("key = ? AND orchestrate IS NULL", mode.Key).
+				Update("orchestrate", *mode.Orchestrate)
 		}
+		db.Model(&model.Mode{}).Where("key = ?", mode.Key).Update("seed_version", modeSeedVersion)
 	}
 }
 
@@ -0,0 +1,38 @@
+package seeder
+
+import (
+	"iat/common/model"
+	"iat/common/pkg/consts"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSeedModes_KeepsUserChanges(t *testing.T) {
+	d, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	d.AutoMigrate(&model.Mode{})
+
+	// 旧版本播种的模式还没有这些设置，补一次
+	d.Create(&model.Mode{Key: consts.PlanMode, Name: "Plan"})
+	seedModes(d)
+	var plan model.Mode
+	d.Where("key = ?", consts.PlanMode).First(&plan)
+	if plan.PathPolicy == "" || plan.SeedVersion != modeSeedVersion {
+		t.Fatalf("expected the built-in settings to be seeded, got %+v", plan)
+	}
+
+	// 用户清空的设置在重启后不会被恢复
+	d.Model(&model.Mode{}).Where("key = ?", consts.PlanMode).Updates(map[string]any{"path_policy": "", "instructions": ""})
+	seedModes(d)
+	d.Where("key = ?", consts.PlanMode).First(&plan)
+	if plan.PathPolicy != "" || plan.Instructions != "" {
+		t.Fatalf("cleared settings were restored: %+v", plan)
+	}
+
+	var build model.Mode
+	d.Where("key = ?", consts.BuildMode).First(&build)
+	if build.SeedVersion != modeSeedVersion || !build.OrchestrationEnabled() {
+		t.Fatalf("unexpected new mode %+v", build)
+	}
+}
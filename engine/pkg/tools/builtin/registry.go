@@ -1,11 +1,13 @@
 package builtin
 
 import (
+	"context"
 	"encoding/json"
 	"iat/common/model"
 	"iat/common/pkg/consts"
 	"iat/common/pkg/tools"
 	"strings"
+	"time"
 
 	"github.com/cloudwego/eino/schema"
 	"github.com/eino-contrib/jsonschema"
@@ -71,7 +73,8 @@ var BuiltinTools = []model.Tool{
 					"type": "array",
 					"items": {"type": "string"},
 					"description": "Command arguments"
-				}
+				},
+				"dir": {"type": "string", "description": "Working directory relative to the project root"}
 			},
 			"required": ["command"]
 		}`,
@@ -120,6 +123,183 @@ var BuiltinTools = []model.Tool{
 			"required": ["path1", "path2"]
 		}`,
 	},
+	{
+		Name:        "http_request",
+		Description: "Send an HTTP request to an allowlisted host and return status, headers and body",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"url":     {"type": "string", "description": "Absolute http(s) URL; the host must be in the project's HTTP allowlist"},
+				"method":  {"type": "string", "enum": ["GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"], "description": "HTTP method (default: GET)"},
+				"headers": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Request headers"},
+				"body":    {"type": "string", "description": "Request body"},
+				"timeout": {"type": "integer", "description": "Timeout in seconds (default: 30, max: 120)"}
+			},
+			"required": ["url"]
+		}`,
+	},
+	{
+		Name:        "fetch_url",
+		Description: "Fetch a web page from an allowlisted host and return it as readable markdown",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"url":     {"type": "string", "description": "Absolute http(s) URL; the host must be in the project's HTTP allowlist"},
+				"timeout": {"type": "integer", "description": "Timeout in seconds (default: 30, max: 120)"}
+			},
+			"required": ["url"]
+		}`,
+	},
+	{
+		Name:        "git_status",
+		Description: "Show the git working tree status of the project as JSON (branch, upstream, ahead/behind, changed files)",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {}
+		}`,
+	},
+	{
+		Name:        "git_diff",
+		Description: "Show git changes as JSON (per-file stats plus patch). Unstaged by default; set staged for the index or from/to for a revision range",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"staged": {"type": "boolean", "description": "Diff staged changes against HEAD"},
+				"from":   {"type": "string", "description": "Start revision (e.g. main, HEAD~3)"},
+				"to":     {"type": "string", "description": "End revision; omit to compare against the working tree"},
+				"paths":  {"type": "array", "items": {"type": "string"}, "description": "Limit the diff to these paths"}
+			}
+		}`,
+	},
+	{
+		Name:        "git_log",
+		Description: "Show commit history as JSON",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"limit": {"type": "integer", "description": "Maximum number of commits (default: 20, max: 200)"},
+				"ref":   {"type": "string", "description": "Revision or range to list (default: HEAD)"},
+				"paths": {"type": "array", "items": {"type": "string"}, "description": "Only commits touching these paths"}
+			}
+		}`,
+	},
+	{
+		Name:        "find_definition",
+		Description: "Find where a Go identifier is declared, using the type checker. Give either a symbol name or a file position. Returns file:line locations with signature and doc comment",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"symbol": {"type": "string", "description": "Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method"},
+				"path":   {"type": "string", "description": "Go file (required with line) or package directory to search in"},
+				"line":   {"type": "integer", "description": "Line of the identifier in path"},
+				"column": {"type": "integer", "description": "Column of the identifier (default: first identifier on the line)"}
+			}
+		}`,
+	},
+	{
+		Name:        "find_references",
+		Description: "Find every use of a Go identifier in its module, using the type checker (no false hits from same-named identifiers). Give either a symbol name or a file position. Returns file:line locations",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"symbol": {"type": "string", "description": "Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method"},
+				"path":   {"type": "string", "description": "Go file (required with line) or package directory the symbol is declared in"},
+				"line":   {"type": "integer", "description": "Line of the identifier in path"},
+				"column": {"type": "integer", "description": "Column of the identifier (default: first identifier on the line)"}
+			}
+		}`,
+	},
+	{
+		Name:        "list_symbols",
+		Description: "List the top-level declarations (funcs, methods, types, vars, consts) of a Go file or package directory with signatures and file:line locations",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "Go file or package directory"}
+			},
+			"required": ["path"]
+		}`,
+	},
+	{
+		Name:        "package_outline",
+		Description: "Show the exported API of a Go package (types with constructors and methods, funcs, consts, vars) with doc comments and file:line locations",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "Package directory"}
+			},
+			"required": ["path"]
+		}`,
+	},
+	{
+		Name:        "search_code",
+		Description: "Search the project's code index. All words must match; \"quoted text\" matches a phrase and word* a prefix. Returns files ranked by relevance (BM25) with the matching lines",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "Words, \"phrases\" and prefix* terms; may also contain path:GLOB and lang:NAME filters"},
+				"path":  {"type": "string", "description": "Only search files matching this glob, e.g. engine/**/*.go"},
+				"lang":  {"type": "string", "description": "Only search files in this language, e.g. go, typescript, python"},
+				"limit": {"type": "integer", "description": "Maximum number of files (default 20)"}
+			},
+			"required": ["query"]
+		}`,
+	},
+	{
+		Name:        "git_commit",
+		Description: "Create a git commit. Commits the staged changes, or only the given paths (which are staged first)",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"message": {"type": "string", "description": "Commit message"},
+				"paths":   {"type": "array", "items": {"type": "string"}, "description": "Stage and commit only these paths"},
+				"all":     {"type": "boolean", "description": "Stage all modified tracked files (git commit -a)"},
+				"amend":   {"type": "boolean", "description": "Amend the last commit (only if the mode allows history rewrites)"}
+			},
+			"required": ["message"]
+		}`,
+	},
+	{
+		Name:        "git_branch",
+		Description: "List, create, switch or delete git branches. Returns the branch list as JSON",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"action":     {"type": "string", "enum": ["list", "create", "switch", "delete"], "description": "Action to perform (default: list)"},
+				"name":       {"type": "string", "description": "Branch name (required except for list)"},
+				"startPoint": {"type": "string", "description": "Revision the new branch starts from"},
+				"create":     {"type": "boolean", "description": "For switch: create the branch first"},
+				"force":      {"type": "boolean", "description": "For delete: delete even if unmerged (only if the mode allows history rewrites)"}
+			}
+		}`,
+	},
+	{
+		Name:        "git_worktree",
+		Description: "List, add or remove git worktrees. Returns the worktree list as JSON",
+		Type:        consts.ToolTypeBuiltin,
+		Parameters: `{
+			"type": "object",
+			"properties": {
+				"action":    {"type": "string", "enum": ["list", "add", "remove"], "description": "Action to perform (default: list)"},
+				"path":      {"type": "string", "description": "Worktree path inside the project (required for add/remove)"},
+				"branch":    {"type": "string", "description": "For add: branch to check out"},
+				"newBranch": {"type": "boolean", "description": "For add: create the branch"},
+				"force":     {"type": "boolean", "description": "For remove: discard local changes (only if the mode allows history rewrites)"}
+			}
+		}`,
+	},
 	{
 		Name:        "manage_tasks",
 		Description: "Create, update, delete or list tasks in the current session",
@@ -224,6 +404,142 @@ func GetEinoTools(mode string) []*schema.ToolInfo {
 		}`),
 	})
 
+	// HTTP Request
+	infos = append(infos, &schema.ToolInfo{
+		Name: "http_request",
+		Desc: "Send an HTTP request to an allowlisted host and return status, headers and body",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"url":     {"type": "string", "description": "Absolute http(s) URL; the host must be in the project's HTTP allowlist"},
+				"method":  {"type": "string", "enum": ["GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"], "description": "HTTP method (default: GET)"},
+				"headers": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Request headers"},
+				"body":    {"type": "string", "description": "Request body"},
+				"timeout": {"type": "integer", "description": "Timeout in seconds (default: 30, max: 120)"}
+			},
+			"required": ["url"]
+		}`),
+	})
+
+	// Fetch URL
+	infos = append(infos, &schema.ToolInfo{
+		Name: "fetch_url",
+		Desc: "Fetch a web page from an allowlisted host and return it as readable markdown",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"url":     {"type": "string", "description": "Absolute http(s) URL; the host must be in the project's HTTP allowlist"},
+				"timeout": {"type": "integer", "description": "Timeout in seconds (default: 30, max: 120)"}
+			},
+			"required": ["url"]
+		}`),
+	})
+
+	// Git (read-only)
+	infos = append(infos, &schema.ToolInfo{
+		Name: "git_status",
+		Desc: "Show the git working tree status of the project as JSON (branch, upstream, ahead/behind, changed files)",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {}
+		}`),
+	})
+
+	infos = append(infos, &schema.ToolInfo{
+		Name: "git_diff",
+		Desc: "Show git changes as JSON (per-file stats plus patch). Unstaged by default; set staged for the index or from/to for a revision range",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"staged": {"type": "boolean", "description": "Diff staged changes against HEAD"},
+				"from":   {"type": "string", "description": "Start revision (e.g. main, HEAD~3)"},
+				"to":     {"type": "string", "description": "End revision; omit to compare against the working tree"},
+				"paths":  {"type": "array", "items": {"type": "string"}, "description": "Limit the diff to these paths"}
+			}
+		}`),
+	})
+
+	infos = append(infos, &schema.ToolInfo{
+		Name: "git_log",
+		Desc: "Show commit history as JSON",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"limit": {"type": "integer", "description": "Maximum number of commits (default: 20, max: 200)"},
+				"ref":   {"type": "string", "description": "Revision or range to list (default: HEAD)"},
+				"paths": {"type": "array", "items": {"type": "string"}, "description": "Only commits touching these paths"}
+			}
+		}`),
+	})
+
+	// Go code intelligence (read-only)
+	infos = append(infos, &schema.ToolInfo{
+		Name: "find_definition",
+		Desc: "Find where a Go identifier is declared, using the type checker. Give either a symbol name or a file position. Returns file:line locations with signature and doc comment",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"symbol": {"type": "string", "description": "Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method"},
+				"path":   {"type": "string", "description": "Go file (required with line) or package directory to search in"},
+				"line":   {"type": "integer", "description": "Line of the identifier in path"},
+				"column": {"type": "integer", "description": "Column of the identifier (default: first identifier on the line)"}
+			}
+		}`),
+	})
+
+	infos = append(infos, &schema.ToolInfo{
+		Name: "find_references",
+		Desc: "Find every use of a Go identifier in its module, using the type checker (no false hits from same-named identifiers). Give either a symbol name or a file position. Returns file:line locations",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"symbol": {"type": "string", "description": "Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method"},
+				"path":   {"type": "string", "description": "Go file (required with line) or package directory the symbol is declared in"},
+				"line":   {"type": "integer", "description": "Line of the identifier in path"},
+				"column": {"type": "integer", "description": "Column of the identifier (default: first identifier on the line)"}
+			}
+		}`),
+	})
+
+	infos = append(infos, &schema.ToolInfo{
+		Name: "list_symbols",
+		Desc: "List the top-level declarations (funcs, methods, types, vars, consts) of a Go file or package directory with signatures and file:line locations",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "Go file or package directory"}
+			},
+			"required": ["path"]
+		}`),
+	})
+
+	infos = append(infos, &schema.ToolInfo{
+		Name: "package_outline",
+		Desc: "Show the exported API of a Go package (types with constructors and methods, funcs, consts, vars) with doc comments and file:line locations",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "Package directory"}
+			},
+			"required": ["path"]
+		}`),
+	})
+
+	infos = append(infos, &schema.ToolInfo{
+		Name: "search_code",
+		Desc: "Search the project's code index. All words must match; \"quoted text\" matches a phrase and word* a prefix. Returns files ranked by relevance (BM25) with the matching lines",
+		ParamsOneOf: mustParseSchema(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "Words, \"phrases\" and prefix* terms; may also contain path:GLOB and lang:NAME filters"},
+				"path":  {"type": "string", "description": "Only search files matching this glob, e.g. engine/**/*.go"},
+				"lang":  {"type": "string", "description": "Only search files in this language, e.g. go, typescript, python"},
+				"limit": {"type": "integer", "description": "Maximum number of files (default 20)"}
+			},
+			"required": ["query"]
+		}`),
+	})
+
 	// 仅在构建模式下添加写文件工具
 	if strings.ToUpper(mode) == consts.BuildMode {
 		// Write File
@@ -252,7 +568,8 @@ func GetEinoTools(mode string) []*schema.ToolInfo {
 						"type": "array",
 						"items": {"type": "string"},
 						"description": "Command arguments"
-					}
+					},
+					"dir": {"type": "string", "description": "Working directory relative to the project root"}
 				},
 				"required": ["command"]
 			}`),
@@ -275,6 +592,52 @@ func GetEinoTools(mode string) []*schema.ToolInfo {
 				"required": ["scriptPath"]
 			}`),
 		})
+
+		// Git (mutating)
+		infos = append(infos, &schema.ToolInfo{
+			Name: "git_commit",
+			Desc: "Create a git commit. Commits the staged changes, or only the given paths (which are staged first)",
+			ParamsOneOf: mustParseSchema(`{
+				"type": "object",
+				"properties": {
+					"message": {"type": "string", "description": "Commit message"},
+					"paths":   {"type": "array", "items": {"type": "string"}, "description": "Stage and commit only these paths"},
+					"all":     {"type": "boolean", "description": "Stage all modified tracked files (git commit -a)"},
+					"amend":   {"type": "boolean", "description": "Amend the last commit (only if the mode allows history rewrites)"}
+				},
+				"required": ["message"]
+			}`),
+		})
+
+		infos = append(infos, &schema.ToolInfo{
+			Name: "git_branch",
+			Desc: "List, create, switch or delete git branches. Returns the branch list as JSON",
+			ParamsOneOf: mustParseSchema(`{
+				"type": "object",
+				"properties": {
+					"action":     {"type": "string", "enum": ["list", "create", "switch", "delete"], "description": "Action to perform (default: list)"},
+					"name":       {"type": "string", "description": "Branch name (required except for list)"},
+					"startPoint": {"type": "string", "description": "Revision the new branch starts from"},
+					"create":     {"type": "boolean", "description": "For switch: create the branch first"},
+					"force":      {"type": "boolean", "description": "For delete: delete even if unmerged (only if the mode allows history rewrites)"}
+				}
+			}`),
+		})
+
+		infos = append(infos, &schema.ToolInfo{
+			Name: "git_worktree",
+			Desc: "List, add or remove git worktrees. Returns the worktree list as JSON",
+			ParamsOneOf: mustParseSchema(`{
+				"type": "object",
+				"properties": {
+					"action":    {"type": "string", "enum": ["list", "add", "remove"], "description": "Action to perform (default: list)"},
+					"path":      {"type": "string", "description": "Worktree path inside the project (required for add/remove)"},
+					"branch":    {"type": "string", "description": "For add: branch to check out"},
+					"newBranch": {"type": "boolean", "description": "For add: create the branch"},
+					"force":     {"type": "boolean", "description": "For remove: discard local changes (only if the mode allows history rewrites)"}
+				}
+			}`),
+		})
 	}
 
 	// Call Sub-agent
@@ -326,9 +689,68 @@ func RunCommand(command string, args []string) (string, error) {
 	return tools.RunCommand(command, args)
 }
 func RunScript(path string, args []string) (string, error) { return tools.RunScript(path, args) }
+func RunCommandInDir(dir, command string, args []string) (string, error) {
+	return tools.RunCommandInDir(dir, command, args)
+}
+func RunCommandWithEnv(ctx context.Context, dir, command string, args, env []string) (string, error) {
+	return tools.RunCommandWithEnv(ctx, dir, command, args, env)
+}
+func RunScriptInDir(dir, path string, args []string) (string, error) {
+	return tools.RunScriptInDir(dir, path, args)
+}
+func ScriptArgv(path string, args []string) ([]string, error) { return tools.ScriptArgv(path, args) }
+
+// Git helpers; they return JSON so agents get structured results
+func GitStatus(dir string) (string, error) { return toJSON(tools.GitStatus(dir)) }
+func GitDiff(dir string, opts tools.GitDiffOptions) (string, error) {
+	return toJSON(tools.GitDiff(dir, opts))
+}
+func GitLog(dir string, limit int, ref string, paths []string) (string, error) {
+	return toJSON(tools.GitLog(dir, limit, ref, paths))
+}
+func GitCommit(dir string, policy tools.GitPolicy, opts tools.GitCommitOptions) (string, error) {
+	return toJSON(tools.GitCommit(dir, policy, opts))
+}
+func GitBranch(dir string, policy tools.GitPolicy, opts tools.GitBranchOptions) (string, error) {
+	return toJSON(tools.GitBranch(dir, policy, opts))
+}
+func GitWorktree(dir string, policy tools.GitPolicy, opts tools.GitWorktreeOptions) (string, error) {
+	return toJSON(tools.GitWorktree(dir, policy, opts))
+}
+
+// Go code intelligence
+func GoFindDefinition(base string, q tools.GoQuery) (string, error) {
+	return toJSON(tools.GoFindDefinition(base, q))
+}
+func GoFindReferences(base string, q tools.GoQuery) (string, error) {
+	return toJSON(tools.GoFindReferences(base, q))
+}
+func GoListSymbols(base, path string) (string, error) { return toJSON(tools.GoListSymbols(base, path)) }
+func GoPackageOutline(base, dir string) (string, error) {
+	return toJSON(tools.GoPackageOutline(base, dir))
+}
+
+func toJSON[T any](v T, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
 
 // Http helpers for script modules
 func HttpGet(url string) (string, error) { return tools.HttpGet(url) }
 func HttpPost(url, contentType, body string) (string, error) {
 	return tools.HttpPost(url, contentType, body)
 }
+
+// Policy-checked HTTP for agent tools
+func HttpRequest(ctx context.Context, policy tools.HttpPolicy, opts tools.HttpRequestOptions) (string, error) {
+	return tools.HttpRequestJSON(ctx, policy, opts)
+}
+func FetchURL(ctx context.Context, policy tools.HttpPolicy, url string, timeout time.Duration) (string, error) {
+	return tools.FetchURL(ctx, policy, url, timeout)
+}
@@ -47,6 +47,12 @@ func (a *App) GetScriptAPIDocs() *result.Result {
 	return result.Success(modules.GetModuleDocs())
 }
 
+// GetScriptTypeDeclarations returns the .d.ts declarations of the script
+// engine modules, for type-checking TypeScript scripts in the editor
+func (a *App) GetScriptTypeDeclarations() *result.Result {
+	return result.Success(modules.TypeDeclarations())
+}
+
 // --- Proxy Methods to Engine ---
 
 const EngineURL = "http://localhost:8080/api"
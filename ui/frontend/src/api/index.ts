@@ -123,6 +123,10 @@ export const api = {
     const resp = await client.delete(`/hooks/${id}`);
     return resp.data;
   },
+  listHookEvents: async () => {
+    const resp = await client.get("/hooks/events");
+    return resp.data;
+  },
 
   // Task Methods (Simple Tasks)
   listTasks: async (sessionId: number) => {
@@ -29,6 +29,8 @@ export function DeleteTool(arg1:number):Promise<result.Result>;
 
 export function GetScriptAPIDocs():Promise<result.Result>;
 
+export function GetScriptTypeDeclarations():Promise<result.Result>;
+
 export function GetSessionMessages(arg1:number):Promise<result.Result>;
 
 export function IndexAllProjects():Promise<result.Result>;
@@ -54,6 +54,10 @@ export function GetScriptAPIDocs() {
   return window['go']['main']['App']['GetScriptAPIDocs']();
 }
 
+export function GetScriptTypeDeclarations() {
+  return window['go']['main']['App']['GetScriptTypeDeclarations']();
+}
+
 export function GetSessionMessages(arg1) {
   return window['go']['main']['App']['GetSessionMessages'](arg1);
 }